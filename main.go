@@ -164,7 +164,7 @@ func main() {
 		Nodeid     nodeid.NodeID          `cmd:""`
 		Node       node.Node              `cmd:""`
 		Satellite  satellite.Satellite    `cmd:""`
-		Downloadng downloadng.DownloadCmd `cmd:""`
+		Downloadng downloadng.Downloadng  `cmd:""`
 		Telemetry  stbb.TelemetryReceiver `cmd:""`
 		Version    Version                `cmd:""`
 		Access     access.AccessCmd       `cmd:""`
@@ -1,10 +1,11 @@
 package badger
 
 import (
+	"fmt"
 	badger "github.com/dgraph-io/badger/v4"
 	"github.com/pkg/errors"
-	"github.com/zeebo/errs"
 	"io"
+	"os"
 	"storj.io/storj/storagenode/blobstore"
 	"storj.io/storj/storagenode/blobstore/filestore"
 )
@@ -47,7 +48,7 @@ func NewReader(db *badger.DB, ref blobstore.BlobRef) (blobstore.BlobReader, erro
 		return nil, err
 	}
 	if !found {
-		return nil, errs.New("missing blob")
+		return nil, fmt.Errorf("missing blob: %w", os.ErrNotExist)
 	}
 	return &r, nil
 }
@@ -80,17 +80,30 @@ func suspiciousPattern(pattern string) int {
 }
 
 func OpenFilter(filter string, proto bool) (*bloomfilter.Filter, error) {
-	rawFilter, err := os.ReadFile(filter)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
 	if strings.HasSuffix(filter, ".pb") || proto {
-		retainInfo := &internalpb.RetainInfo{}
-		err = pb.Unmarshal(rawFilter, retainInfo)
+		retainInfo, err := OpenRetainInfo(filter)
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, err
 		}
-		rawFilter = retainInfo.Filter
+		return bloomfilter.NewFromBytes(retainInfo.Filter)
+	}
+	rawFilter, err := os.ReadFile(filter)
+	if err != nil {
+		return nil, errors.WithStack(err)
 	}
 	return bloomfilter.NewFromBytes(rawFilter)
 }
+
+// OpenRetainInfo reads a RetainInfo protobuf file (filter with the storage node ID and the creation date), as it's generated by the satellite.
+func OpenRetainInfo(file string) (*internalpb.RetainInfo, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	retainInfo := &internalpb.RetainInfo{}
+	err = pb.Unmarshal(raw, retainInfo)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return retainInfo, nil
+}
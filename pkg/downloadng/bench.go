@@ -0,0 +1,258 @@
+package downloadng
+
+import (
+	"context"
+	"fmt"
+	"github.com/zeebo/errs"
+	"io"
+	"net"
+	"os"
+	"storj.io/common/grant"
+	"storj.io/common/memory"
+	"storj.io/common/rpc"
+	"storj.io/storj/cmd/uplink/ulloc"
+	"storj.io/uplink"
+	"sync/atomic"
+	"time"
+)
+
+// Bench downloads the same objects with storj.io/uplink and with the downloadng pipeline, and compares the results.
+type Bench struct {
+	LongTail
+	PoolConfig
+	Reuse bool     `help:"reuse the piecestore connections of downloadng across the downloads"`
+	Runs  int      `default:"3" help:"number of downloads per object and downloader"`
+	Paths []string `arg:"" help:"objects to download (sj://bucket/key)"`
+}
+
+type benchObject struct {
+	bucket string
+	key    string
+}
+
+// benchStats are the measurements of one downloader.
+type benchStats struct {
+	name      string
+	durations []time.Duration
+	ttfb      []time.Duration
+	errors    int
+	// lastError is the error of the last failed download.
+	lastError error
+
+	// downloaded is the plain data, received is all the bytes read from the network connections.
+	downloaded int64
+	received   int64
+
+	// cancelled is the size of the cancelled / failed piece downloads (only available for downloadng).
+	cancelled int64
+
+	// connections are the piecestore connection counters (only available for downloadng).
+	connections PoolStats
+}
+
+func (b Bench) Run() error {
+	var objects []benchObject
+	for _, path := range b.Paths {
+		p, err := ulloc.Parse(path)
+		if err != nil {
+			return err
+		}
+		bucket, key, ok := p.RemoteParts()
+		if !ok {
+			return errs.New("Path is not remote %s", path)
+		}
+		objects = append(objects, benchObject{bucket: bucket, key: key})
+	}
+
+	dialer := net.Dialer{}
+	stats, err := b.bench(context.Background(), os.Getenv("UPLINK_ACCESS"), dialer.DialContext, objects)
+	if err != nil {
+		return err
+	}
+	printBench(os.Stdout, stats)
+	return nil
+}
+
+// bench executes the downloads. Uplink and downloadng are alternating, and the order is changed in each run.
+func (b Bench) bench(ctx context.Context, serializedAccess string, dial rpc.DialFunc, objects []benchObject) ([]*benchStats, error) {
+	uplinkAccess, err := uplink.ParseAccess(serializedAccess)
+	if err != nil {
+		return nil, err
+	}
+	access, err := grant.ParseAccess(serializedAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	uplinkStats := &benchStats{name: "uplink"}
+	ngStats := &benchStats{name: "downloadng"}
+
+	// connections are counted by the same dialer, per download we use the difference
+	ngConn := &countingDialer{dial: dial}
+	dialer, err := getDialer(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	dialer.Connector = rpc.NewDefaultTCPConnector(ngConn.DialContext)
+
+	var pool *Pool
+	if b.Reuse {
+		pool = NewPool(dialer, b.PoolConfig)
+		defer pool.Close()
+	}
+
+	for i := 0; i < b.Runs; i++ {
+		for _, o := range objects {
+			downloadUplink := func() {
+				conn := &countingDialer{dial: dial}
+				out := &measuringWriter{start: time.Now()}
+				err := uplinkDownload(ctx, uplink.Config{
+					UserAgent:   "stbb",
+					DialContext: conn.DialContext,
+				}, uplinkAccess, o, out)
+				uplinkStats.add(out, conn.received.Load(), err)
+			}
+			downloadNG := func() {
+				received := ngConn.received.Load()
+				p := pool
+				if p == nil {
+					p = NewPool(dialer, b.PoolConfig)
+					defer p.Close()
+				}
+				out := &measuringWriter{start: time.Now()}
+				result, err := run(ctx, Environment{
+					Access: access,
+					Dialer: dialer,
+					Output: out,
+					Pool:   p,
+				}, &DownloadObject{bucket: o.bucket, key: o.key}, b.LongTail)
+				ngStats.add(out, ngConn.received.Load()-received, err)
+				if result != nil {
+					for _, n := range result.Nodes {
+						if n.Status != "finished" {
+							ngStats.cancelled += n.Size
+						}
+					}
+					ngStats.connections = ngStats.connections.Add(result.Connections)
+				}
+			}
+
+			if i%2 == 0 {
+				downloadUplink()
+				downloadNG()
+			} else {
+				downloadNG()
+				downloadUplink()
+			}
+		}
+	}
+	return []*benchStats{uplinkStats, ngStats}, nil
+}
+
+func uplinkDownload(ctx context.Context, cfg uplink.Config, access *uplink.Access, o benchObject, out io.Writer) error {
+	project, err := cfg.OpenProject(ctx, access)
+	if err != nil {
+		return err
+	}
+	defer project.Close()
+
+	source, err := project.DownloadObject(ctx, o.bucket, o.key, nil)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	_, err = io.Copy(out, source)
+	return err
+}
+
+func (s *benchStats) add(out *measuringWriter, received int64, err error) {
+	s.received += received
+	if err != nil {
+		s.errors++
+		s.lastError = err
+		return
+	}
+	s.durations = append(s.durations, time.Since(out.start))
+	s.ttfb = append(s.ttfb, out.firstByte)
+	s.downloaded += out.size
+}
+
+func printBench(w io.Writer, stats []*benchStats) {
+	_, _ = fmt.Fprintf(w, "%-12s %6s %6s %12s %10s %10s %10s %12s %12s %12s\n", "downloader", "ok", "errors", "throughput", "ttfb-p50", "p50", "p99", "received", "wasted", "cancelled")
+	for _, s := range stats {
+		var total time.Duration
+		for _, d := range s.durations {
+			total += d
+		}
+		throughput := "-"
+		if total > 0 {
+			throughput = fmt.Sprintf("%s/s", memory.Size(float64(s.downloaded)/total.Seconds()))
+		}
+		cancelled := "-"
+		if s.name == "downloadng" {
+			cancelled = memory.Size(s.cancelled).String()
+		}
+		_, _ = fmt.Fprintf(w, "%-12s %6d %6d %12s %10s %10s %10s %12s %12s %12s\n",
+			s.name,
+			len(s.durations),
+			s.errors,
+			throughput,
+			percentile(s.ttfb, 50).Round(time.Millisecond),
+			percentile(s.durations, 50).Round(time.Millisecond),
+			percentile(s.durations, 99).Round(time.Millisecond),
+			memory.Size(s.received),
+			memory.Size(s.received-s.downloaded),
+			cancelled)
+	}
+	for _, s := range stats {
+		if s.lastError != nil {
+			_, _ = fmt.Fprintf(w, "%s last error (of %d): %v\n", s.name, s.errors, s.lastError)
+		}
+	}
+	for _, s := range stats {
+		if s.connections != (PoolStats{}) {
+			_, _ = fmt.Fprintf(w, "%s piecestore connections: dialed: %d, reused: %d, waited for free slot: %d\n", s.name, s.connections.Dials, s.connections.Reuses, s.connections.Waits)
+		}
+	}
+}
+
+// measuringWriter discards the data, but records the size and the time of the first byte.
+type measuringWriter struct {
+	start     time.Time
+	firstByte time.Duration
+	size      int64
+}
+
+func (m *measuringWriter) Write(p []byte) (int, error) {
+	if m.size == 0 && len(p) > 0 {
+		m.firstByte = time.Since(m.start)
+	}
+	m.size += int64(len(p))
+	return len(p), nil
+}
+
+// countingDialer counts all the bytes received on the opened connections.
+type countingDialer struct {
+	dial     rpc.DialFunc
+	received atomic.Int64
+}
+
+func (c *countingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := c.dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, received: &c.received}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	received *atomic.Int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.received.Add(int64(n))
+	return n, err
+}
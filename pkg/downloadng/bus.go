@@ -0,0 +1,106 @@
+package downloadng
+
+import (
+	"context"
+	"github.com/spacemonkeygo/monkit/v3"
+	"time"
+)
+
+var mon = monkit.Package()
+
+// Each actor accepts only the messages which implement its message interface.
+type (
+	// DownloaderMessage is accepted by the ObjectDownloader.
+	DownloaderMessage interface{ downloaderMessage() }
+
+	// RouterMessage is accepted by the DownloadRouter.
+	RouterMessage interface{ routerMessage() }
+
+	// PieceMessage is accepted by the PieceStoreClient.
+	PieceMessage interface{ pieceMessage() }
+
+	// ParallelMessage is accepted by Parallel.
+	ParallelMessage interface{ parallelMessage() }
+
+	// DecoderMessage is accepted by the ECDecoder.
+	DecoderMessage interface{ decoderMessage() }
+
+	// DecryptMessage is accepted by Decrypt.
+	DecryptMessage interface{ decryptMessage() }
+
+	// OutputMessage is the output of the pipeline.
+	OutputMessage interface{ outputMessage() }
+)
+
+func (*DownloadObject) downloaderMessage() {}
+
+func (*DownloadPiece) routerMessage() {}
+func (*SegmentPlan) routerMessage()   {}
+
+func (*DownloadPiece) pieceMessage() {}
+
+func (*SegmentPlan) parallelMessage()     {}
+func (*DownloadSegment) parallelMessage() {}
+
+func (*DecodeShares) decoderMessage()   {}
+func (*InitDecryption) decoderMessage() {}
+
+func (*DecryptBuffer) decryptMessage()  {}
+func (*InitDecryption) decryptMessage() {}
+
+func (Decrypted) outputMessage() {}
+
+// Done and FatalFailure are propagated through all the actors.
+
+func (Done) downloaderMessage() {}
+func (Done) routerMessage()     {}
+func (Done) pieceMessage()      {}
+func (Done) parallelMessage()   {}
+func (Done) decoderMessage()    {}
+func (Done) decryptMessage()    {}
+func (Done) outputMessage()     {}
+
+func (FatalFailure) downloaderMessage() {}
+func (FatalFailure) routerMessage()     {}
+func (FatalFailure) pieceMessage()      {}
+func (FatalFailure) parallelMessage()   {}
+func (FatalFailure) decoderMessage()    {}
+func (FatalFailure) decryptMessage()    {}
+func (FatalFailure) outputMessage()     {}
+
+// Mailbox is the (unbuffered) inbox of an actor. Time spent by the senders waiting for the receiver is recorded as backpressure.
+type Mailbox[T any] struct {
+	name    string
+	c       chan T
+	tracer  *Tracer
+	blocked *monkit.DurationVal
+}
+
+// NewMailbox creates a new mailbox. Name is used for tracing and metrics, usually the name of the receiving actor.
+func NewMailbox[T any](name string, tracer *Tracer) *Mailbox[T] {
+	return &Mailbox[T]{
+		name:    name,
+		c:       make(chan T),
+		tracer:  tracer,
+		blocked: mon.DurationVal("mailbox_blocked", monkit.NewSeriesTag("mailbox", name)),
+	}
+}
+
+// Send delivers the message to the receiver. Returns false if the context is cancelled before the message is received.
+func (m *Mailbox[T]) Send(ctx context.Context, msg T) bool {
+	start := time.Now()
+	select {
+	case m.c <- msg:
+	case <-ctx.Done():
+		return false
+	}
+	blocked := time.Since(start)
+	m.blocked.Observe(blocked)
+	m.tracer.sent(m.name, msg, blocked)
+	return true
+}
+
+// Receive returns the channel of the incoming messages.
+func (m *Mailbox[T]) Receive() <-chan T {
+	return m.c
+}
@@ -1,13 +1,26 @@
 package downloadng
 
 import (
+	"fmt"
 	"github.com/zeebo/errs"
+	"os"
 	"runtime"
 	"storj.io/storj/cmd/uplink/ulloc"
 )
 
+type Downloadng struct {
+	Download DownloadCmd `cmd:"" default:"withargs" help:"download an object with the actor based pipeline"`
+	Bench    Bench       `cmd:"" help:"compare the download performance with storj.io/uplink"`
+}
+
 type DownloadCmd struct {
-	Path string `arg:""`
+	LongTail
+	PoolConfig
+	Verbose bool   `short:"v" help:"print timing information of each piece download"`
+	Trace   string `default:"silent" enum:"silent,summary,verbose" help:"trace the messages between the actors: silent, summary (backpressure per actor) or verbose (every message)"`
+	Offset  int64  `help:"offset of the plain byte range to download"`
+	Length  int64  `help:"length of the plain byte range to download (0: till the end of the object)"`
+	Path    string `arg:""`
 }
 
 func (d DownloadCmd) Run() error {
@@ -21,8 +34,32 @@ func (d DownloadCmd) Run() error {
 		return errs.New("Path is not remote %s", d.Path)
 	}
 
-	return download(bucket, key)
+	tracer := NewTracer(TraceLevel(d.Trace))
+	result, err := download(&DownloadObject{
+		bucket: bucket,
+		key:    key,
+		offset: d.Offset,
+		length: d.Length,
+	}, d.LongTail, d.PoolConfig, tracer)
+	if err != nil {
+		return err
+	}
+	tracer.Print(os.Stdout)
 
+	counts := map[string]int{}
+	hedged := 0
+	for _, n := range result.Nodes {
+		counts[n.Status]++
+		if n.Hedged {
+			hedged++
+		}
+		if d.Verbose {
+			fmt.Printf("%s %d %-9s hedged=%v size=%d ttfb=%s duration=%s\n", n.Node, n.ECShare, n.Status, n.Hedged, n.Size, n.FirstByte, n.Duration)
+		}
+	}
+	fmt.Printf("downloaded in %s, pieces finished: %d, cancelled: %d, failed: %d, hedged: %d\n", result.Duration, counts["finished"], counts["cancelled"], counts["failed"], hedged)
+	fmt.Printf("connections: dialed: %d, reused: %d, waited for free slot: %d\n", result.Connections.Dials, result.Connections.Reuses, result.Connections.Waits)
+	return nil
 }
 func readStack() []byte {
 	buf := make([]byte, 1024)
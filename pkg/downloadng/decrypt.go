@@ -10,10 +10,16 @@ import (
 )
 
 type Decrypt struct {
-	inbox   chan any
-	outbox  chan any
+	inbox   *Mailbox[DecryptMessage]
+	outbox  *Mailbox[OutputMessage]
 	store   *encryption.Store
 	counter int64
+
+	// pending is the encrypted data which is not yet enough for a full block.
+	pending   []byte
+	skip      int64
+	plainSkip int64
+	remaining int64
 }
 
 type DecryptBuffer struct {
@@ -27,13 +33,19 @@ type InitDecryption struct {
 	unencryptedKey       string
 	encryptedKey         []byte
 	position             *metaclient.SegmentPosition
+	rng                  stripeRange
+}
+
+// Decrypted is the decrypted plain data.
+type Decrypted struct {
+	data []byte
 }
 
-func NewDecrypt(inbox chan any, store *encryption.Store) (*Decrypt, error) {
+func NewDecrypt(inbox *Mailbox[DecryptMessage], store *encryption.Store, tracer *Tracer) (*Decrypt, error) {
 	return &Decrypt{
 		store:  store,
 		inbox:  inbox,
-		outbox: logReceived("final", make(chan any)),
+		outbox: NewMailbox[OutputMessage]("Output", tracer),
 	}, nil
 }
 
@@ -41,7 +53,7 @@ func (d *Decrypt) Run(ctx context.Context) error {
 	var decrypter encryption.Transformer
 	for {
 		select {
-		case req := <-d.inbox:
+		case req := <-d.inbox.Receive():
 			switch r := req.(type) {
 			case *InitDecryption:
 				derivedKey, err := encryption.DeriveContentKey(string(r.bucket), paths.NewUnencrypted(r.unencryptedKey), d.store)
@@ -65,17 +77,45 @@ func (d *Decrypt) Run(ctx context.Context) error {
 					return err
 				}
 
-				d.counter = 0
+				d.counter = r.rng.firstBlock
+				d.skip = r.rng.encryptedSkip
+				d.plainSkip = r.rng.plainSkip
+				d.remaining = r.rng.plainLength
+				d.pending = nil
 			case *DecryptBuffer:
-				var out []byte
-				transformed, err := decrypter.Transform(out, r.encrypted, d.counter)
-				if err != nil {
-					return err
+				data := r.encrypted
+				if d.skip > 0 {
+					skipped := min(d.skip, int64(len(data)))
+					data = data[skipped:]
+					d.skip -= skipped
+				}
+				d.pending = append(d.pending, data...)
+
+				blockSize := decrypter.InBlockSize()
+				for len(d.pending) >= blockSize && d.remaining > 0 {
+					var out []byte
+					transformed, err := decrypter.Transform(out, d.pending[:blockSize], d.counter)
+					if err != nil {
+						return err
+					}
+					d.pending = d.pending[blockSize:]
+					d.counter++
+
+					transformed = transformed[d.plainSkip:]
+					d.plainSkip = 0
+					if int64(len(transformed)) > d.remaining {
+						transformed = transformed[:d.remaining]
+					}
+					d.remaining -= int64(len(transformed))
+					if !d.outbox.Send(ctx, Decrypted{data: transformed}) {
+						return nil
+					}
 				}
-				d.counter++
-				d.outbox <- transformed
+			case FatalFailure:
+				d.outbox.Send(ctx, r)
+				return nil
 			case Done:
-				d.outbox <- req
+				d.outbox.Send(ctx, r)
 				return nil
 			}
 		case <-ctx.Done():
@@ -2,11 +2,14 @@ package downloadng
 
 import (
 	"context"
-	"fmt"
+	"github.com/zeebo/errs"
+	"io"
 	"os"
 	"storj.io/common/grant"
+	"storj.io/common/rpc"
 	"storj.io/common/storj"
 	"sync"
+	"time"
 )
 
 type FatalFailure struct {
@@ -16,136 +19,193 @@ type FatalFailure struct {
 type Done struct {
 }
 
-func download(bucket string, key string) error {
+// Environment contains the external dependencies of a download. Tests can use it to download from an in-process network.
+type Environment struct {
+	Access *grant.Access
+	Dialer rpc.Dialer
+	Output io.Writer
+
+	// Tracer records the messages between the actors (optional).
+	Tracer *Tracer
+
+	// Pool is used for the piecestore connections. If nil, a new pool is created for the download.
+	Pool *Pool
+}
+
+func download(req *DownloadObject, policy LongTail, poolConfig PoolConfig, tracer *Tracer) (*Result, error) {
 	access, err := grant.ParseAccess(os.Getenv("UPLINK_ACCESS"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ctx := context.Background()
 
-	first := make(chan any)
+	dialer, err := getDialer(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := os.Create("/tmp/out")
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	pool := NewPool(dialer, poolConfig)
+	defer pool.Close()
+
+	return run(ctx, Environment{
+		Access: access,
+		Dialer: dialer,
+		Output: out,
+		Tracer: tracer,
+		Pool:   pool,
+	}, req, policy)
+}
+
+// run executes the download pipeline. It returns with the first error of any actor.
+func run(ctx context.Context, env Environment, req *DownloadObject, policy LongTail) (_ *Result, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var failure error
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failure == nil {
+			failure = err
+		}
+		cancel()
+	}
+	failed := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if failure == nil {
+			return ctx.Err()
+		}
+		return failure
+	}
+
+	tracer := env.Tracer
+
+	pool := env.Pool
+	if pool == nil {
+		pool = NewPool(env.Dialer, PoolConfig{
+			IdleTimeout: 2 * time.Minute,
+			MaxStreams:  4,
+		})
+		defer pool.Close()
+	}
+	poolStats := pool.Stats()
 	downloader := ObjectDownloader{
-		inbox:            first,
-		outbox:           make(chan any),
-		satelliteAddress: access.SatelliteAddress,
-		APIKey:           access.APIKey,
-		store:            access.EncAccess.Store,
+		inbox:            NewMailbox[DownloaderMessage]("ObjectDownloader", tracer),
+		outbox:           NewMailbox[RouterMessage]("DownloadRouter", tracer),
+		satelliteAddress: env.Access.SatelliteAddress,
+		APIKey:           env.Access.APIKey,
+		store:            env.Access.EncAccess.Store,
+		policy:           policy,
+		dialer:           env.Dialer,
 	}
 
 	sd := &DownloadRouter{
-		inbox:       logReceived("DownloadRouter", downloader.outbox),
-		outbox:      make(chan any),
-		connections: make(map[storj.NodeID]chan any),
-		factory: func(url storj.NodeURL, outbox chan any) (chan any, error) {
-			client, err := NewPieceStoreClient(url, outbox)
+		inbox:       downloader.outbox,
+		outbox:      NewMailbox[ParallelMessage]("Parallel", tracer),
+		connections: make(map[storj.NodeID]*Mailbox[PieceMessage]),
+		factory: func(url storj.NodeURL, outbox *Mailbox[ParallelMessage]) (*Mailbox[PieceMessage], error) {
+			client, err := NewPieceStoreClient(url, pool, outbox, tracer)
 			if err != nil {
 				return nil, err
 			}
-			go client.Run(context.Background())
+			go client.Run(ctx)
 			return client.inbox, nil
 		},
 	}
 
+	result := &Result{}
 	p := Parallel{
-		global:   first,
-		inbox:    logReceived("Parallel", sd.outbox),
-		outbox:   make(chan any),
+		global:   downloader.inbox,
+		inbox:    sd.outbox,
+		outbox:   NewMailbox[DecoderMessage]("ECDecoder", tracer),
 		segments: map[string]*segmentBuffer{},
+		requests: downloader.outbox,
+		policy:   policy,
+		result:   result,
 	}
 
-	ec, err := NewECDecoder(p.outbox)
+	ec, err := NewECDecoder(p.outbox, tracer)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	dc, err := NewDecrypt(ec.outbox, access.EncAccess.Store)
+	dc, err := NewDecrypt(ec.outbox, env.Access.EncAccess.Store, tracer)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	wg := sync.WaitGroup{}
-	wg.Add(6)
+	wg.Add(5)
 	go func() {
 		defer wg.Done()
 		err := downloader.Run(ctx)
 		if err != nil {
-			fmt.Println(err)
+			fail(err)
 		}
 	}()
 	go func() {
 		defer wg.Done()
 		err := dc.Run(ctx)
 		if err != nil {
-			fmt.Println("decryption is failed", err)
+			fail(errs.New("decryption is failed: %v", err))
 		}
 	}()
 	go func() {
 		defer wg.Done()
 		err := sd.Run(ctx)
 		if err != nil {
-			fmt.Println(err)
+			fail(err)
 		}
 	}()
 	go func() {
 		defer wg.Done()
 		err := p.Run(ctx)
 		if err != nil {
-			fmt.Println(err)
+			fail(err)
 		}
 	}()
 	go func() {
 		defer wg.Done()
 		err := ec.Run(ctx)
 		if err != nil {
-			fmt.Println(err)
+			fail(err)
 		}
 	}()
-	go func() {
-		defer wg.Done()
-		out, err := os.Create("/tmp/out")
-		if err != nil {
-			panic(err)
-		}
-		defer out.Close()
-
-		for {
-			select {
-			case msg := <-dc.outbox:
-				switch r := msg.(type) {
-				case []byte:
-					out.Write(r)
-				case Done:
-					return
-				}
 
-			}
-		}
-	}()
-
-	downloader.inbox <- &DownloadObject{
-		bucket: bucket,
-		key:    key,
+	if !downloader.inbox.Send(ctx, req) {
+		return nil, failed()
 	}
 
-	wg.Wait()
-	return nil
-}
-
-func logReceived[T any](name string, outbox chan T) chan T {
-	c := make(chan T)
-	go func() {
-		for {
-			select {
-			case t, ok := <-outbox:
-				if !ok {
-					//close(c)
-					return
+	for {
+		select {
+		case msg := <-dc.outbox.Receive():
+			switch r := msg.(type) {
+			case Decrypted:
+				_, err := env.Output.Write(r.data)
+				if err != nil {
+					return nil, err
 				}
-				fmt.Printf("%s: %T\n", name, t)
-				c <- t
+			case FatalFailure:
+				return nil, r.Error
+			case Done:
+				wg.Wait()
+				result.Connections = pool.Stats().Sub(poolStats)
+				return result, nil
 			}
+		case <-ctx.Done():
+			// actors may be blocked on sending messages, we don't wait for them.
+			return nil, failed()
 		}
-	}()
-	return c
+	}
 }
@@ -6,41 +6,36 @@ import (
 )
 
 type DownloadRouter struct {
-	inbox       chan any
-	outbox      chan any
-	connections map[storj.NodeID]chan any
-	factory     func(url storj.NodeURL, outbox chan any) (chan any, error)
+	inbox       *Mailbox[RouterMessage]
+	outbox      *Mailbox[ParallelMessage]
+	connections map[storj.NodeID]*Mailbox[PieceMessage]
+	factory     func(url storj.NodeURL, outbox *Mailbox[ParallelMessage]) (*Mailbox[PieceMessage], error)
 }
 
 func (d *DownloadRouter) Run(ctx context.Context) (err error) {
-	defer close(d.outbox)
-
 	for {
 		select {
-		case req := <-d.inbox:
-			if req == nil {
-				return
-			}
+		case req := <-d.inbox.Receive():
 			switch r := req.(type) {
 			case *DownloadPiece:
-				err := d.pieceDownloader(r)
+				err := d.pieceDownloader(ctx, r)
 				if err != nil {
 					// not a problem if we have enough connections. Probably count it.
 				}
+			case *SegmentPlan:
+				d.outbox.Send(ctx, r)
 			case FatalFailure:
 				for _, c := range d.connections {
-					c <- r
+					c.Send(ctx, r)
 				}
-				d.outbox <- r
+				d.outbox.Send(ctx, r)
 				return nil
 			case Done:
 				for _, c := range d.connections {
-					c <- r
+					c.Send(ctx, r)
 				}
-				d.outbox <- r
+				d.outbox.Send(ctx, r)
 				return nil
-			default:
-				d.outbox <- r
 			}
 
 		case <-ctx.Done():
@@ -50,7 +45,7 @@ func (d *DownloadRouter) Run(ctx context.Context) (err error) {
 	}
 }
 
-func (d *DownloadRouter) pieceDownloader(req *DownloadPiece) error {
+func (d *DownloadRouter) pieceDownloader(ctx context.Context, req *DownloadPiece) error {
 	worker, found := d.connections[req.orderLimit.StorageNodeId]
 	if !found {
 		ch, err := d.factory(storj.NodeURL{
@@ -63,6 +58,6 @@ func (d *DownloadRouter) pieceDownloader(req *DownloadPiece) error {
 		d.connections[req.orderLimit.StorageNodeId] = ch
 		worker = d.connections[req.orderLimit.StorageNodeId]
 	}
-	worker <- req
+	worker.Send(ctx, req)
 	return nil
 }
@@ -0,0 +1,196 @@
+package downloadng
+
+import (
+	"bytes"
+	"context"
+	"github.com/elek/stbb/pkg/downloadng/stub"
+	"github.com/stretchr/testify/require"
+	"storj.io/common/grant"
+	"storj.io/common/testcontext"
+	"storj.io/common/testrand"
+	"storj.io/uplink"
+	"testing"
+	"time"
+)
+
+func TestDownload(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	network, err := stub.NewNetwork(120)
+	require.NoError(t, err)
+
+	access, err := network.Access()
+	require.NoError(t, err)
+
+	data := testrand.BytesInt(1024*1024 + 1234)
+	upload(t, ctx, network, access, "bucket1", "key1", data)
+
+	policy := LongTail{
+		Extra:           10,
+		HedgePercentile: 50,
+		HedgeMinDelay:   10 * time.Millisecond,
+		HedgeMax:        40,
+	}
+
+	downloadAll := func(req *DownloadObject) ([]byte, *Result, error) {
+		dialer, err := network.Dialer(ctx)
+		require.NoError(t, err)
+		out := bytes.NewBuffer(nil)
+		result, err := run(ctx, Environment{
+			Access: access,
+			Dialer: dialer,
+			Output: out,
+		}, req, policy)
+		return out.Bytes(), result, err
+	}
+
+	setFaults := func(count int, faults stub.Faults) {
+		for i, node := range network.Nodes {
+			f := stub.Faults{}
+			if i < count {
+				f = faults
+			}
+			require.NoError(t, network.SetFaults(node.Identity.ID, f))
+		}
+	}
+
+	t.Run("full object", func(t *testing.T) {
+		downloaded, _, err := downloadAll(&DownloadObject{bucket: "bucket1", key: "key1"})
+		require.NoError(t, err)
+		require.Equal(t, data, downloaded)
+	})
+
+	t.Run("trace", func(t *testing.T) {
+		dialer, err := network.Dialer(ctx)
+		require.NoError(t, err)
+		tracer := NewTracer(TraceSummary)
+		out := bytes.NewBuffer(nil)
+		_, err = run(ctx, Environment{
+			Access: access,
+			Dialer: dialer,
+			Output: out,
+			Tracer: tracer,
+		}, &DownloadObject{bucket: "bucket1", key: "key1"}, policy)
+		require.NoError(t, err)
+		require.Equal(t, data, out.Bytes())
+
+		mailboxes := map[string]MailboxStats{}
+		for _, s := range tracer.Stats() {
+			mailboxes[s.Name] = s
+		}
+		require.Equal(t, 1, mailboxes["ObjectDownloader"].Messages["*downloadng.DownloadObject"])
+		require.Equal(t, 1, mailboxes["Parallel"].Messages["*downloadng.SegmentPlan"])
+		require.Greater(t, mailboxes["ECDecoder"].Messages["*downloadng.DecodeShares"], 0)
+		require.Equal(t, 1, mailboxes["Output"].Messages["downloadng.Done"])
+	})
+
+	t.Run("bench", func(t *testing.T) {
+		serialized, err := access.Serialize()
+		require.NoError(t, err)
+
+		stats, err := Bench{LongTail: policy, Runs: 2, Reuse: true, PoolConfig: PoolConfig{IdleTimeout: time.Minute, MaxStreams: 2}}.bench(ctx, serialized, network.DialContext, []benchObject{{bucket: "bucket1", key: "key1"}})
+		require.NoError(t, err)
+		require.Len(t, stats, 2)
+		for _, s := range stats {
+			require.Equal(t, 0, s.errors, s.name)
+			require.Len(t, s.durations, 2, s.name)
+			require.Equal(t, int64(2*len(data)), s.downloaded, s.name)
+			require.Greater(t, s.received, s.downloaded, s.name)
+		}
+	})
+
+	t.Run("connection reuse", func(t *testing.T) {
+		dialer, err := network.Dialer(ctx)
+		require.NoError(t, err)
+		pool := NewPool(dialer, PoolConfig{IdleTimeout: time.Minute, MaxStreams: 2})
+		defer func() { require.NoError(t, pool.Close()) }()
+
+		var results []*Result
+		for i := 0; i < 2; i++ {
+			out := bytes.NewBuffer(nil)
+			result, err := run(ctx, Environment{
+				Access: access,
+				Dialer: dialer,
+				Output: out,
+				Pool:   pool,
+			}, &DownloadObject{bucket: "bucket1", key: "key1"}, policy)
+			require.NoError(t, err)
+			require.Equal(t, data, out.Bytes())
+			results = append(results, result)
+		}
+		require.Greater(t, results[0].Connections.Dials, int64(0))
+		require.Equal(t, int64(0), results[0].Connections.Reuses)
+		require.Greater(t, results[1].Connections.Reuses, int64(0))
+		require.Equal(t, results[0].Connections.Dials+results[1].Connections.Dials, pool.Stats().Dials)
+	})
+
+	t.Run("range", func(t *testing.T) {
+		downloaded, _, err := downloadAll(&DownloadObject{bucket: "bucket1", key: "key1", offset: 12345, length: 100000})
+		require.NoError(t, err)
+		require.Equal(t, data[12345:12345+100000], downloaded)
+	})
+
+	t.Run("slow nodes", func(t *testing.T) {
+		defer setFaults(0, stub.Faults{})
+		setFaults(60, stub.Faults{Latency: time.Second})
+
+		downloaded, result, err := downloadAll(&DownloadObject{bucket: "bucket1", key: "key1"})
+		require.NoError(t, err)
+		require.Equal(t, data, downloaded)
+
+		hedged := 0
+		for _, n := range result.Nodes {
+			if n.Hedged {
+				hedged++
+			}
+		}
+		require.Greater(t, hedged, 0)
+	})
+
+	t.Run("missing pieces", func(t *testing.T) {
+		defer setFaults(0, stub.Faults{})
+		setFaults(60, stub.Faults{Missing: true})
+
+		downloaded, result, err := downloadAll(&DownloadObject{bucket: "bucket1", key: "key1"})
+		require.NoError(t, err)
+		require.Equal(t, data, downloaded)
+
+		failed := 0
+		for _, n := range result.Nodes {
+			if n.Status == "failed" {
+				failed++
+			}
+		}
+		require.Greater(t, failed, 0)
+	})
+
+	t.Run("corrupted pieces", func(t *testing.T) {
+		defer setFaults(0, stub.Faults{})
+		setFaults(len(network.Nodes), stub.Faults{Corrupt: true})
+
+		_, _, err := downloadAll(&DownloadObject{bucket: "bucket1", key: "key1"})
+		require.Error(t, err)
+	})
+}
+
+func upload(t *testing.T, ctx context.Context, network *stub.Network, access *grant.Access, bucket string, key string, data []byte) {
+	serialized, err := access.Serialize()
+	require.NoError(t, err)
+
+	parsed, err := uplink.ParseAccess(serialized)
+	require.NoError(t, err)
+
+	project, err := network.UplinkConfig().OpenProject(ctx, parsed)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, project.Close()) }()
+
+	_, err = project.EnsureBucket(ctx, bucket)
+	require.NoError(t, err)
+
+	upload, err := project.UploadObject(ctx, bucket, key, nil)
+	require.NoError(t, err)
+
+	_, err = upload.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, upload.Commit())
+}
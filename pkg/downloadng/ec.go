@@ -7,8 +7,8 @@ import (
 
 type ECDecoder struct {
 	fc     *infectious.FEC
-	inbox  chan any
-	outbox chan any
+	inbox  *Mailbox[DecoderMessage]
+	outbox *Mailbox[DecryptMessage]
 }
 
 type DecodeShares struct {
@@ -19,15 +19,15 @@ type DecodedShare struct {
 	encrypted []byte
 }
 
-func NewECDecoder(inbox chan any) (*ECDecoder, error) {
+func NewECDecoder(inbox *Mailbox[DecoderMessage], tracer *Tracer) (*ECDecoder, error) {
 	fc, err := infectious.NewFEC(29, 119)
 	if err != nil {
 		return nil, err
 	}
 	return &ECDecoder{
 		fc:     fc,
-		inbox:  logReceived("ECDecoder", inbox),
-		outbox: make(chan any),
+		inbox:  inbox,
+		outbox: NewMailbox[DecryptMessage]("Decrypt", tracer),
 	}, nil
 }
 
@@ -35,10 +35,7 @@ func (e *ECDecoder) Run(ctx context.Context) error {
 	var dest []byte
 	for {
 		select {
-		case req := <-e.inbox:
-			if req == nil {
-				return nil
-			}
+		case req := <-e.inbox.Receive():
 			switch r := req.(type) {
 			case *DecodeShares:
 				decoded, err := e.fc.Decode(dest, r.shares)
@@ -47,14 +44,17 @@ func (e *ECDecoder) Run(ctx context.Context) error {
 					return err
 
 				}
-				e.outbox <- &DecryptBuffer{
+				e.outbox.Send(ctx, &DecryptBuffer{
 					encrypted: decoded,
-				}
+				})
+			case *InitDecryption:
+				e.outbox.Send(ctx, r)
+			case FatalFailure:
+				e.outbox.Send(ctx, r)
+				return nil
 			case Done:
-				e.outbox <- r
+				e.outbox.Send(ctx, r)
 				return nil
-			default:
-				e.outbox <- r
 			}
 
 		case <-ctx.Done():
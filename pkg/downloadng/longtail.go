@@ -0,0 +1,74 @@
+package downloadng
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"storj.io/common/storj"
+)
+
+// LongTail defines how many piece downloads are started and how the slow ones are handled.
+type LongTail struct {
+	Extra           int           `default:"10" help:"number of piece downloads started in addition to the required shares"`
+	HedgePercentile float64       `default:"0" help:"start a hedged request to an extra node when a piece is slower than this percentile of the finished pieces (0 disables hedging)"`
+	HedgeMinDelay   time.Duration `default:"100ms" help:"minimum time to wait before a hedged request is started"`
+	HedgeMax        int           `default:"5" help:"maximum number of hedged requests per segment"`
+}
+
+// SegmentPlan is sent before the piece downloads of a segment. It contains all the information to decide when the segment is decodable,
+// and the remaining order limits which can be used for hedged requests.
+type SegmentPlan struct {
+	segmentID   storj.SegmentID
+	required    int
+	shareSize   int
+	pieceLength int64
+	last        bool
+	spares      []*DownloadPiece
+
+	// init is forwarded to the decryption when the first stripe of the segment is ready.
+	init *InitDecryption
+
+	// finish ends the monkit span of the segment download.
+	finish func(*error)
+}
+
+// NodeTiming is the timing information of one piece download.
+type NodeTiming struct {
+	Node      storj.NodeID
+	Segment   storj.SegmentID
+	ECShare   int
+	Hedged    bool
+	Status    string
+	Size      int64
+	FirstByte time.Duration
+	Duration  time.Duration
+}
+
+// Result is the outcome of one object download.
+type Result struct {
+	Duration time.Duration
+	Nodes    []NodeTiming
+
+	// Connections are the piecestore connection pool counters of this download.
+	Connections PoolStats
+}
+
+// percentile returns the p-th percentile of the durations (nearest rank method).
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
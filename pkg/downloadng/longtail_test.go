@@ -0,0 +1,30 @@
+package downloadng
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	require.Equal(t, time.Duration(0), percentile(nil, 50))
+
+	one := []time.Duration{7}
+	require.Equal(t, time.Duration(7), percentile(one, 0))
+	require.Equal(t, time.Duration(7), percentile(one, 50))
+	require.Equal(t, time.Duration(7), percentile(one, 100))
+
+	durations := []time.Duration{5, 1, 4, 2, 3, 10, 9, 8, 7, 6}
+	// nearest rank: ceil(p/100*n)-th smallest value
+	require.Equal(t, time.Duration(1), percentile(durations, 0))
+	require.Equal(t, time.Duration(1), percentile(durations, 1))
+	require.Equal(t, time.Duration(1), percentile(durations, 10))
+	require.Equal(t, time.Duration(2), percentile(durations, 11))
+	require.Equal(t, time.Duration(5), percentile(durations, 50))
+	require.Equal(t, time.Duration(10), percentile(durations, 91))
+	require.Equal(t, time.Duration(10), percentile(durations, 100))
+	require.Equal(t, time.Duration(10), percentile(durations, 150))
+
+	// the input is not modified
+	require.Equal(t, []time.Duration{5, 1, 4, 2, 3, 10, 9, 8, 7, 6}, durations)
+}
@@ -2,42 +2,50 @@ package downloadng
 
 import (
 	"context"
+	"github.com/zeebo/errs"
+	"math/rand"
+	"sort"
 	"storj.io/common/encryption"
 	"storj.io/common/macaroon"
 	"storj.io/common/paths"
+	"storj.io/common/rpc"
+	"storj.io/common/storj"
 	"storj.io/uplink/private/metaclient"
 )
 
 type ObjectDownloader struct {
-	inbox            chan any
-	outbox           chan any
+	inbox            *Mailbox[DownloaderMessage]
+	outbox           *Mailbox[RouterMessage]
 	satelliteAddress string
 	APIKey           *macaroon.APIKey
 	store            *encryption.Store
+	policy           LongTail
+	dialer           rpc.Dialer
 }
 
 type DownloadObject struct {
 	bucket string
 	key    string
+
+	// offset and length define the plain byte range to download. Zero length means: till the end of the object.
+	offset int64
+	length int64
 }
 
 func (s *ObjectDownloader) Run(ctx context.Context) error {
 	//defer close(s.outbox)
-	dialer, err := getDialer(ctx, false)
-	if err != nil {
-		return err
-	}
 	metainfoClient, err := metaclient.DialNodeURL(ctx,
-		dialer,
+		s.dialer,
 		s.satelliteAddress,
 		s.APIKey,
 		"stbb")
+	if err != nil {
+		return err
+	}
+	defer metainfoClient.Close()
 	for {
 		select {
-		case req := <-s.inbox:
-			if req == nil {
-				return nil
-			}
+		case req := <-s.inbox.Receive():
 			switch r := req.(type) {
 			case *DownloadObject:
 				err = s.Download(ctx, metainfoClient, r)
@@ -45,10 +53,10 @@ func (s *ObjectDownloader) Run(ctx context.Context) error {
 					return err
 				}
 			case Done:
-				s.outbox <- req
+				s.outbox.Send(ctx, r)
 				return nil
 			case FatalFailure:
-				s.outbox <- req
+				s.outbox.Send(ctx, r)
 				return nil
 			}
 		case <-ctx.Done():
@@ -58,42 +66,171 @@ func (s *ObjectDownloader) Run(ctx context.Context) error {
 	}
 }
 
-func (s *ObjectDownloader) Download(ctx context.Context, metainfoClient *metaclient.Client, req *DownloadObject) error {
+func (s *ObjectDownloader) Download(ctx context.Context, metainfoClient *metaclient.Client, req *DownloadObject) (err error) {
+	defer mon.Task()(&ctx)(&err)
 
 	encPath, err := encryption.EncryptPathWithStoreCipher(req.bucket, paths.NewUnencrypted(req.key), s.store)
 	if err != nil {
 		return err
 	}
-	resp, err := metainfoClient.DownloadObject(ctx, metaclient.DownloadObjectParams{
+	params := metaclient.DownloadObjectParams{
 		Bucket:             []byte(req.bucket),
 		EncryptedObjectKey: []byte(encPath.Raw()),
-	})
+	}
+	if req.length > 0 {
+		params.Range = metaclient.StreamRange{
+			Mode:  metaclient.StreamRangeStartLimit,
+			Start: req.offset,
+			Limit: req.offset + req.length,
+		}
+	} else if req.offset > 0 {
+		params.Range = metaclient.StreamRange{
+			Mode:  metaclient.StreamRangeStart,
+			Start: req.offset,
+		}
+	}
+	resp, err := metainfoClient.DownloadObject(ctx, params)
 	if err != nil {
 		return err
 	}
 
-	for _, k := range resp.DownloadedSegments {
-		s.outbox <- &InitDecryption{
-			bucket:               req.bucket,
-			segmentEncryption:    k.Info.SegmentEncryption,
-			encryptionParameters: resp.Object.EncryptionParameters,
-			position:             k.Info.Position,
-			unencryptedKey:       req.key,
+	end := resp.Object.PlainSize
+	if req.length > 0 && req.offset+req.length < end {
+		end = req.offset + req.length
+	}
+	if req.offset >= end {
+		return errs.New("offset %d is outside of the object (size: %d)", req.offset, resp.Object.PlainSize)
+	}
+
+	segments, err := s.rangeSegments(ctx, metainfoClient, resp, req.offset, end)
+	if err != nil {
+		return err
+	}
+
+	ep := resp.Object.EncryptionParameters
+	// only used to get the plain block size of the cipher suite
+	blockDecrypter, err := encryption.NewDecrypter(ep.CipherSuite, new(storj.Key), new(storj.Nonce), int(ep.BlockSize))
+	if err != nil {
+		return err
+	}
+
+	for i, k := range segments {
+		rs := k.Info.RedundancyScheme
+		if rs.RequiredShares == 0 {
+			rs = resp.Object.RedundancyScheme
 		}
+
+		start := max(req.offset, k.Info.PlainOffset) - k.Info.PlainOffset
+		length := min(end, k.Info.PlainOffset+k.Info.PlainSize) - k.Info.PlainOffset - start
+		rng := calculateRange(start, length, k.Info.EncryptedSize, int64(blockDecrypter.OutBlockSize()), int64(ep.BlockSize), int(rs.ShareSize), int(rs.RequiredShares))
+
+		var pieces []*DownloadPiece
 		for ix, l := range k.Limits {
 			if l != nil && l.StorageNodeAddress != nil {
-				d := DownloadPiece{
+				pieces = append(pieces, &DownloadPiece{
 					orderLimit: l.Limit,
 					pk:         k.Info.PiecePrivateKey,
 					sn:         l.StorageNodeAddress,
 					size:       k.Info.EncryptedSize,
+					offset:     rng.pieceOffset,
+					length:     rng.pieceLength,
 					ecShare:    ix,
 					segmentID:  k.Info.SegmentID,
-				}
-				s.outbox <- &d
+				})
+			}
+		}
+		rand.Shuffle(len(pieces), func(i, j int) {
+			pieces[i], pieces[j] = pieces[j], pieces[i]
+		})
+
+		started := int(rs.RequiredShares) + s.policy.Extra
+		if started > len(pieces) {
+			started = len(pieces)
+		}
+
+		// the span of the segment is finished by Parallel, when enough pieces are downloaded
+		segmentCtx := ctx
+		finish := mon.TaskNamed("segment")(&segmentCtx)
+		for _, piece := range pieces {
+			piece.ctx = segmentCtx
+		}
 
+		plan := &SegmentPlan{
+			segmentID:   k.Info.SegmentID,
+			required:    int(rs.RequiredShares),
+			shareSize:   int(rs.ShareSize),
+			pieceLength: rng.pieceLength,
+			last:        i == len(segments)-1,
+			spares:      pieces[started:],
+			init: &InitDecryption{
+				bucket:               req.bucket,
+				segmentEncryption:    k.Info.SegmentEncryption,
+				encryptionParameters: ep,
+				position:             k.Info.Position,
+				unencryptedKey:       req.key,
+				rng:                  rng,
+			},
+			finish: finish,
+		}
+		if !s.outbox.Send(ctx, plan) {
+			return ctx.Err()
+		}
+		for _, d := range pieces[:started] {
+			if !s.outbox.Send(ctx, d) {
+				return ctx.Err()
 			}
 		}
 	}
 	return nil
 }
+
+// rangeSegments returns the download information of all the segments which are (partially) included in the [start, end) plain range.
+func (s *ObjectDownloader) rangeSegments(ctx context.Context, metainfoClient *metaclient.Client, resp metaclient.DownloadObjectResponse, start int64, end int64) (segments []metaclient.DownloadSegmentWithRSResponse, err error) {
+	inRange := func(offset int64, size int64) bool {
+		return offset < end && offset+size > start
+	}
+
+	downloaded := map[metaclient.SegmentPosition]bool{}
+	for _, segment := range resp.DownloadedSegments {
+		if segment.Info.Position != nil {
+			downloaded[*segment.Info.Position] = true
+		}
+		if inRange(segment.Info.PlainOffset, segment.Info.PlainSize) {
+			segments = append(segments, segment)
+		}
+	}
+
+	listed := resp.ListSegments
+	for {
+		var cursor metaclient.SegmentPosition
+		for _, item := range listed.Items {
+			cursor = item.Position
+			if downloaded[item.Position] || !inRange(item.PlainOffset, item.PlainSize) {
+				continue
+			}
+			segment, err := metainfoClient.DownloadSegmentWithRS(ctx, metaclient.DownloadSegmentParams{
+				StreamID: resp.Object.StreamID,
+				Position: item.Position,
+			})
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, segment)
+		}
+		if !listed.More {
+			break
+		}
+		listed, err = metainfoClient.ListSegments(ctx, metaclient.ListSegmentsParams{
+			StreamID: resp.Object.StreamID,
+			Cursor:   cursor,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Info.PlainOffset < segments[j].Info.PlainOffset
+	})
+	return segments, nil
+}
@@ -3,41 +3,72 @@ package downloadng
 import (
 	"context"
 	"github.com/vivint/infectious"
-	"storj.io/common/pb"
 	"storj.io/common/storj"
 	"time"
 )
 
 type Parallel struct {
-	global   chan any
-	inbox    chan any
-	outbox   chan any
+	global   *Mailbox[DownloaderMessage]
+	inbox    *Mailbox[ParallelMessage]
+	outbox   *Mailbox[DecoderMessage]
 	segments map[string]*segmentBuffer
+
+	// downloaded contains the IDs of the finished segments (removed from segments), to ignore the late messages of the cancelled pieces.
+	downloaded map[string]bool
+	// lastDownloaded is true if the last segment of the object is finished.
+	lastDownloaded bool
+
+	// requests is used to start hedged piece downloads.
+	requests *Mailbox[RouterMessage]
+	policy   LongTail
+
+	// queue contains the planned segments in order, the first one is forwarded to the decoder.
+	queue []*segmentBuffer
+
+	// durations of all the finished pieces, used to calculate the hedge threshold.
+	history []time.Duration
+	result  *Result
+	start   time.Time
 }
 
-func (p *Parallel) Add(req *DownloadSegment) *segmentBuffer {
-	if _, found := p.segments[req.segmentID.String()]; !found {
-		p.segments[req.segmentID.String()] = &segmentBuffer{
+func (p *Parallel) Add(segmentID storj.SegmentID) *segmentBuffer {
+	if _, found := p.segments[segmentID.String()]; !found {
+		p.segments[segmentID.String()] = &segmentBuffer{
 			results: map[storj.NodeID]*pieceBuffer{},
 		}
 	}
-	return p.segments[req.segmentID.String()]
+	return p.segments[segmentID.String()]
 }
 
 type pieceBuffer struct {
-	start    time.Time
-	duration time.Duration
-	ecShare  int
+	node      storj.NodeID
+	start     time.Time
+	firstByte time.Duration
+	duration  time.Duration
+	ecShare   int
+	hedged    bool
+
+	// hedgeStarted is true if a hedged request is already started because this piece was too slow.
+	hedgeStarted bool
+	failed       bool
 
 	cancel       func()
 	expectedSize int64
 	size         int64
-	chunks       []*pb.PieceDownloadResponse
+	data         []byte
 }
 
 func (b *pieceBuffer) Add(req *DownloadSegment) {
-	if req.response != nil {
-		b.chunks = append(b.chunks, req.response)
+	if req.err != nil {
+		b.failed = true
+		if !b.start.IsZero() {
+			b.duration = time.Since(b.start)
+		}
+	} else if req.response != nil {
+		if b.size == 0 {
+			b.firstByte = time.Since(b.start)
+		}
+		b.data = append(b.data, req.response.Chunk.Data...)
 		b.size += int64(len(req.response.Chunk.Data))
 		if b.size == b.expectedSize {
 			b.duration = time.Since(b.start)
@@ -47,6 +78,7 @@ func (b *pieceBuffer) Add(req *DownloadSegment) {
 		b.start = req.startTime
 		b.cancel = req.cancel
 		b.ecShare = req.ecShare
+		b.hedged = req.hedged
 	}
 }
 
@@ -54,58 +86,170 @@ func (b *pieceBuffer) HasStripe(offset int64, i int) bool {
 	return b.size >= offset+int64(i)
 }
 
+func (b *pieceBuffer) Finished() bool {
+	return !b.failed && b.expectedSize > 0 && b.size == b.expectedSize
+}
+
+func (b *pieceBuffer) InFlight() bool {
+	return !b.failed && !b.Finished()
+}
+
+func (b *pieceBuffer) Timing(segmentID storj.SegmentID, status string) NodeTiming {
+	duration := b.duration
+	if duration == 0 && !b.start.IsZero() {
+		duration = time.Since(b.start)
+	}
+	return NodeTiming{
+		Node:      b.node,
+		Segment:   segmentID,
+		ECShare:   b.ecShare,
+		Hedged:    b.hedged,
+		Status:    status,
+		Size:      b.size,
+		FirstByte: b.firstByte,
+		Duration:  duration,
+	}
+}
+
 type segmentBuffer struct {
+	segmentID       storj.SegmentID
 	results         map[storj.NodeID]*pieceBuffer
 	finished        bool
 	duration        int64
 	size            int64
 	processedOffset int64
+
+	planned     bool
+	last        bool
+	required    int
+	shareSize   int
+	pieceLength int64
+	spares      []*DownloadPiece
+	hedged      int
+	init        *InitDecryption
+	initSent    bool
+	finish      func(*error)
+}
+
+func (b *segmentBuffer) Plan(plan *SegmentPlan) {
+	b.planned = true
+	b.segmentID = plan.segmentID
+	b.last = plan.last
+	b.required = plan.required
+	b.shareSize = plan.shareSize
+	b.pieceLength = plan.pieceLength
+	b.spares = plan.spares
+	b.init = plan.init
+	b.finish = plan.finish
 }
 
-func (b *segmentBuffer) Add(req *DownloadSegment) {
+// Add registers a piece download event and returns the piece buffer if the piece is just finished.
+func (b *segmentBuffer) Add(req *DownloadSegment) *pieceBuffer {
 	if _, found := b.results[req.sn]; !found {
 		b.results[req.sn] = &pieceBuffer{
-			chunks: []*pb.PieceDownloadResponse{},
+			node: req.sn,
 		}
 	}
-	b.results[req.sn].Add(req)
+	piece := b.results[req.sn]
+	wasFinished := piece.Finished()
+	piece.Add(req)
 
 	finished := 0
-
-	// check if we have 29
 	for _, piece := range b.results {
-		if piece.expectedSize == piece.size {
+		if piece.Finished() {
 			finished++
 		}
 	}
 
-	if finished == 29 && !b.finished {
+	if b.planned && finished >= b.required && !b.finished {
 		b.finished = true
 
 		for _, piece := range b.results {
-			if b.duration == 0 || piece.duration.Milliseconds() > b.duration {
+			if piece.Finished() && (b.duration == 0 || piece.duration.Milliseconds() > b.duration) {
 				b.duration = piece.duration.Milliseconds()
 			}
 		}
 	}
 
+	if !wasFinished && piece.Finished() {
+		return piece
+	}
+	return nil
 }
 
+// Cancel stops all the piece downloads which are still in progress.
 func (b *segmentBuffer) Cancel() {
 	for _, piece := range b.results {
-		piece.cancel()
+		if piece.cancel != nil {
+			piece.cancel()
+		}
 	}
 }
 
-func (b *segmentBuffer) ForwardDownloaded(outbox chan any) {
-	// check if we can have at least 29 pieces from the next stripe
-	for {
+// Timings returns the timing information of all the started piece downloads.
+func (b *segmentBuffer) Timings() (timings []NodeTiming) {
+	for _, piece := range b.results {
+		status := "cancelled"
+		if piece.Finished() {
+			status = "finished"
+		} else if piece.failed {
+			status = "failed"
+		}
+		timings = append(timings, piece.Timing(b.segmentID, status))
+	}
+	return timings
+}
+
+// Hedge returns the new piece downloads which should be started to replace the failed and slow pieces.
+func (b *segmentBuffer) Hedge(policy LongTail, threshold time.Duration) (requests []*DownloadPiece) {
+	if b.finished {
+		return nil
+	}
+	for _, piece := range b.results {
+		if len(b.spares) == 0 {
+			return requests
+		}
+		if piece.hedgeStarted {
+			continue
+		}
+
+		replace := piece.failed
+		if !replace && piece.InFlight() && policy.HedgePercentile > 0 && b.hedged < policy.HedgeMax && threshold > 0 {
+			replace = time.Since(piece.start) > threshold
+			if replace {
+				b.hedged++
+			}
+		}
+		if !replace {
+			continue
+		}
+
+		piece.hedgeStarted = true
+		next := b.spares[0]
+		b.spares = b.spares[1:]
+		next.hedged = true
+		requests = append(requests, next)
+	}
+	return requests
+}
+
+// Forwarded returns true if all the stripes of the segment are sent to the decoder.
+func (b *segmentBuffer) Forwarded() bool {
+	return b.planned && b.processedOffset >= b.pieceLength
+}
+
+func (b *segmentBuffer) ForwardDownloaded(ctx context.Context, outbox *Mailbox[DecoderMessage]) {
+	if !b.planned {
+		return
+	}
+	// check if we can have at least the required pieces from the next stripe
+	for !b.Forwarded() {
 		pieces := make([]*pieceBuffer, 0)
 		for _, piece := range b.results {
-			if piece.HasStripe(b.processedOffset, 256) {
+			if piece.HasStripe(b.processedOffset, b.shareSize) {
 				pieces = append(pieces, piece)
 			}
-			if len(pieces) == 29 {
+			if len(pieces) == b.required {
 				// ready to decode next stripe
 
 				c := &DecodeShares{
@@ -115,55 +259,146 @@ func (b *segmentBuffer) ForwardDownloaded(outbox chan any) {
 				for _, p := range pieces {
 					c.shares = append(c.shares, infectious.Share{
 						Number: p.ecShare,
-						// BIG TODO
-						Data: p.chunks[0].Chunk.Data[b.processedOffset : b.processedOffset+256],
+						Data:   p.data[b.processedOffset : b.processedOffset+int64(b.shareSize)],
 					})
 				}
-				outbox <- c
-				b.processedOffset += int64(256)
+				if !outbox.Send(ctx, c) {
+					return
+				}
+				b.processedOffset += int64(b.shareSize)
 				break
 			}
 		}
-		if len(pieces) < 29 {
+		if len(pieces) < b.required {
 			break
 		}
 	}
 }
 
 func (p *Parallel) Run(ctx context.Context) error {
+	p.start = time.Now()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
 	done := false
 	for {
 		select {
-		case req := <-p.inbox:
-			if req == nil {
-				return nil
-			}
-
+		case req := <-p.inbox.Receive():
 			switch r := req.(type) {
+			case *SegmentPlan:
+				segment := p.Add(r.segmentID)
+				segment.Plan(r)
+				p.queue = append(p.queue, segment)
+				p.forward(ctx)
 			case *DownloadSegment:
-				segment := p.Add(r)
-				segment.Add(r)
+				if p.downloaded[r.segmentID.String()] {
+					// late message from a cancelled piece
+					continue
+				}
+				segment := p.Add(r.segmentID)
+				if piece := segment.Add(r); piece != nil {
+					p.history = append(p.history, piece.duration)
+				}
 
-				segment.ForwardDownloaded(p.outbox)
+				p.forward(ctx)
+
+				if r.err != nil {
+					p.hedge(ctx, segment, p.hedgeThreshold())
+				}
 
-				if segment.finished && !done {
+				if segment.finished {
 					segment.Cancel()
-					// todo: finish only if this is the last segment
-					p.global <- Done{}
+					if segment.finish != nil {
+						segment.finish(nil)
+						segment.finish = nil
+					}
+					if p.result != nil {
+						p.result.Nodes = append(p.result.Nodes, segment.Timings()...)
+					}
+					p.remove(segment)
+				}
+				if !done && p.allFinished() {
+					if p.result != nil {
+						p.result.Duration = time.Since(p.start)
+					}
+					// asynchronous, as the downloader may be blocked on sending the remaining requests.
+					go p.global.Send(ctx, Done{})
 					done = true
 				}
 			case FatalFailure:
-				p.outbox <- r
+				p.outbox.Send(ctx, r)
 				return nil
 			case Done:
-				p.outbox <- r
+				p.outbox.Send(ctx, r)
 				return nil
-			default:
-				p.outbox <- r
 			}
-
+		case <-ticker.C:
+			// failed pieces are replaced when the error is received, only the slow pieces are checked here
+			if p.policy.HedgePercentile == 0 {
+				continue
+			}
+			threshold := p.hedgeThreshold()
+			for _, segment := range p.segments {
+				p.hedge(ctx, segment, threshold)
+			}
 		case <-ctx.Done():
 			return nil
 		}
 	}
 }
+
+// forward sends the downloaded stripes to the decoder, segment by segment.
+func (p *Parallel) forward(ctx context.Context) {
+	for len(p.queue) > 0 {
+		segment := p.queue[0]
+		if !segment.initSent {
+			segment.initSent = true
+			if segment.init != nil {
+				p.outbox.Send(ctx, segment.init)
+			}
+		}
+		segment.ForwardDownloaded(ctx, p.outbox)
+		if !segment.Forwarded() {
+			return
+		}
+		p.queue = p.queue[1:]
+	}
+}
+
+// remove forgets the finished segment, only its ID is kept.
+func (p *Parallel) remove(segment *segmentBuffer) {
+	if p.downloaded == nil {
+		p.downloaded = map[string]bool{}
+	}
+	p.downloaded[segment.segmentID.String()] = true
+	p.lastDownloaded = p.lastDownloaded || segment.last
+	delete(p.segments, segment.segmentID.String())
+}
+
+// hedgeThreshold returns the duration after which a piece is too slow (0: slow pieces are not hedged).
+func (p *Parallel) hedgeThreshold() time.Duration {
+	if p.policy.HedgePercentile == 0 || len(p.history) == 0 {
+		return 0
+	}
+	return max(percentile(p.history, p.policy.HedgePercentile), p.policy.HedgeMinDelay)
+}
+
+// hedge starts new piece downloads for the failed and the too slow pieces of the segment.
+func (p *Parallel) hedge(ctx context.Context, segment *segmentBuffer, threshold time.Duration) {
+	requests := segment.Hedge(p.policy, threshold)
+	if len(requests) == 0 {
+		return
+	}
+	// sending is asynchronous, as the router may be blocked on sending messages to us.
+	go func() {
+		for _, r := range requests {
+			p.requests.Send(ctx, r)
+		}
+	}()
+}
+
+// allFinished returns true if the last segment is planned and all the segments are downloaded.
+func (p *Parallel) allFinished() bool {
+	// finished segments are removed from p.segments
+	return len(p.queue) == 0 && len(p.segments) == 0 && p.lastDownloaded
+}
@@ -0,0 +1,75 @@
+package downloadng
+
+import (
+	"github.com/stretchr/testify/require"
+	"storj.io/common/storj"
+	"storj.io/common/testrand"
+	"testing"
+	"time"
+)
+
+func TestSegmentBufferHedge(t *testing.T) {
+	// newSegment creates a segment with running piece downloads (started a second ago), and the given number of spare limits
+	newSegment := func(running int, failed int, spares int) *segmentBuffer {
+		b := &segmentBuffer{
+			results:  map[storj.NodeID]*pieceBuffer{},
+			planned:  true,
+			required: 10,
+		}
+		for i := 0; i < running+failed; i++ {
+			b.results[testrand.NodeID()] = &pieceBuffer{
+				start:        time.Now().Add(-time.Second),
+				expectedSize: 100,
+				failed:       i >= running,
+			}
+		}
+		for i := 0; i < spares; i++ {
+			b.spares = append(b.spares, &DownloadPiece{ecShare: i})
+		}
+		return b
+	}
+	hedging := LongTail{HedgePercentile: 90, HedgeMax: 2}
+
+	t.Run("slow pieces are hedged up to HedgeMax", func(t *testing.T) {
+		b := newSegment(4, 0, 5)
+		requests := b.Hedge(hedging, 100*time.Millisecond)
+		require.Len(t, requests, 2)
+		for _, r := range requests {
+			require.True(t, r.hedged)
+		}
+		require.Len(t, b.spares, 3)
+		require.Empty(t, b.Hedge(hedging, 100*time.Millisecond))
+	})
+
+	t.Run("pieces faster than the threshold are not hedged", func(t *testing.T) {
+		b := newSegment(4, 0, 5)
+		require.Empty(t, b.Hedge(hedging, time.Minute))
+		// no threshold yet (no finished pieces)
+		require.Empty(t, b.Hedge(hedging, 0))
+		// hedging is disabled
+		require.Empty(t, b.Hedge(LongTail{HedgeMax: 2}, 100*time.Millisecond))
+	})
+
+	t.Run("failed pieces are replaced without hedging and HedgeMax", func(t *testing.T) {
+		b := newSegment(2, 3, 5)
+		requests := b.Hedge(LongTail{}, 0)
+		require.Len(t, requests, 3)
+		require.Equal(t, 0, b.hedged)
+		// only once
+		require.Empty(t, b.Hedge(LongTail{}, 0))
+	})
+
+	t.Run("spares run out", func(t *testing.T) {
+		b := newSegment(4, 3, 1)
+		require.Len(t, b.Hedge(hedging, 100*time.Millisecond), 1)
+		require.Empty(t, b.spares)
+		require.Empty(t, b.Hedge(hedging, 100*time.Millisecond))
+	})
+
+	t.Run("finished segment", func(t *testing.T) {
+		b := newSegment(0, 3, 5)
+		b.finished = true
+		require.Empty(t, b.Hedge(hedging, 100*time.Millisecond))
+		require.Len(t, b.spares, 5)
+	})
+}
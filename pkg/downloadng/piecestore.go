@@ -2,8 +2,8 @@ package downloadng
 
 import (
 	"context"
+	"storj.io/common/errs2"
 	"storj.io/common/pb"
-	"storj.io/common/rpc"
 	"storj.io/common/signing"
 	"storj.io/common/storj"
 	"time"
@@ -17,6 +17,14 @@ type DownloadPiece struct {
 	buffer     []byte
 	ecShare    int
 	segmentID  storj.SegmentID
+	hedged     bool
+
+	// offset and length define the requested range of the piece. Zero length means the full piece.
+	offset int64
+	length int64
+
+	// ctx contains the monkit span of the segment download.
+	ctx context.Context
 }
 
 type DownloadSegment struct {
@@ -31,53 +39,42 @@ type DownloadSegment struct {
 	// after download, we send one with the response.
 	response *pb.PieceDownloadResponse
 	sn       pb.NodeID
+
+	// hedged is true for the requests started to replace a slow piece.
+	hedged bool
+
+	// err is sent when the piece download is failed.
+	err error
 }
 
 type PieceStoreClient struct {
-	inbox  chan any
-	outbox chan any
-	dialer rpc.Dialer
+	inbox  *Mailbox[PieceMessage]
+	outbox *Mailbox[ParallelMessage]
+	pool   *Pool
 	sn     storj.NodeURL
 }
 
-func NewPieceStoreClient(node storj.NodeURL, outbox chan any) (*PieceStoreClient, error) {
-	dialer, err := getDialer(context.Background(), false)
-	if err != nil {
-		return nil, err
-	}
+func NewPieceStoreClient(node storj.NodeURL, pool *Pool, outbox *Mailbox[ParallelMessage], tracer *Tracer) (*PieceStoreClient, error) {
 	return &PieceStoreClient{
-		inbox:  make(chan any),
-		dialer: dialer,
+		inbox:  NewMailbox[PieceMessage]("PieceStoreClient", tracer),
+		pool:   pool,
 		sn:     node,
 		outbox: outbox,
 	}, nil
 }
 
 func (d *PieceStoreClient) Run(ctx context.Context) {
-	conn, err := d.dialer.DialNodeURL(ctx, d.sn)
-	if err != nil {
-		return
-	}
-	defer conn.Close()
-	client := pb.NewDRPCPiecestoreClient(conn)
-
 	for {
 		select {
-		case req := <-d.inbox:
-			if req == nil {
-				return
-			}
+		case req := <-d.inbox.Receive():
 			switch r := req.(type) {
 			case *DownloadPiece:
-				_, err = d.Download(ctx, client, r)
-				// we need to send out errors and count them
-				//fmt.Println(err)
+				// pieces of different segments can be downloaded in parallel (the pool limits the streams per node)
+				go d.downloadPiece(ctx, r)
 			case FatalFailure:
 				return
 			case Done:
 				return
-			default:
-				d.outbox <- d
 			}
 
 		case <-ctx.Done():
@@ -87,19 +84,50 @@ func (d *PieceStoreClient) Run(ctx context.Context) {
 	}
 }
 
+// downloadPiece downloads the piece with a pooled connection, and reports the failure if the download is not cancelled.
+func (d *PieceStoreClient) downloadPiece(ctx context.Context, r *DownloadPiece) {
+	conn, err := d.pool.Get(ctx, d.sn)
+	if err == nil {
+		_, err = d.Download(ctx, pb.NewDRPCPiecestoreClient(conn), r)
+		// cancelled streams may close the connection, only the successful ones are reused.
+		d.pool.Put(d.sn.ID, conn, err == nil)
+	}
+	if err != nil && !errs2.IsCanceled(err) {
+		d.outbox.Send(ctx, &DownloadSegment{
+			ecShare:   r.ecShare,
+			segmentID: r.segmentID,
+			sn:        r.orderLimit.StorageNodeId,
+			hedged:    r.hedged,
+			err:       err,
+		})
+	}
+}
+
 func (d *PieceStoreClient) Download(ctx context.Context, client pb.DRPCPiecestoreClient, req *DownloadPiece) (downloaded int64, err error) {
 	size := req.orderLimit.Limit
+	if req.length > 0 {
+		size = req.length
+	}
+
+	if req.ctx != nil {
+		// piece download span is the child of the segment span
+		ctx = req.ctx
+	}
+	defer mon.Task()(&ctx)(&err)
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	d.outbox <- &DownloadSegment{
+	if !d.outbox.Send(ctx, &DownloadSegment{
 		startTime: time.Now(),
 		size:      size,
 		ecShare:   req.ecShare,
 		segmentID: req.segmentID,
 		sn:        req.orderLimit.StorageNodeId,
+		hedged:    req.hedged,
 		cancel:    cancel,
+	}) {
+		return 0, ctx.Err()
 	}
 
 	stream, err := client.Download(ctx)
@@ -111,7 +139,7 @@ func (d *PieceStoreClient) Download(ctx context.Context, client pb.DRPCPiecestor
 	err = stream.Send(&pb.PieceDownloadRequest{
 		Limit: req.orderLimit,
 		Chunk: &pb.PieceDownloadRequest_Chunk{
-			Offset:    0,
+			Offset:    req.offset,
 			ChunkSize: size,
 		},
 	})
@@ -148,11 +176,13 @@ func (d *PieceStoreClient) Download(ctx context.Context, client pb.DRPCPiecestor
 			return
 		}
 
-		d.outbox <- &DownloadSegment{
+		if !d.outbox.Send(ctx, &DownloadSegment{
 			response:  resp,
 			ecShare:   req.ecShare,
 			segmentID: req.segmentID,
 			sn:        req.orderLimit.StorageNodeId,
+		}) {
+			return downloaded, ctx.Err()
 		}
 		downloaded += int64(len(resp.Chunk.Data))
 	}
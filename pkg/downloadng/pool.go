@@ -0,0 +1,241 @@
+package downloadng
+
+import (
+	"context"
+	"storj.io/common/rpc"
+	"storj.io/common/storj"
+	"sync"
+	"time"
+)
+
+// PoolConfig defines how the piecestore connections are reused.
+type PoolConfig struct {
+	IdleTimeout time.Duration `default:"2m" help:"idle piecestore connections are closed after this timeout"`
+	MaxStreams  int           `default:"4" help:"maximum number of concurrent piece downloads (connections) per node"`
+}
+
+// PoolStats are the counters of the connection pool.
+type PoolStats struct {
+	// Dials is the number of new connections.
+	Dials int64
+	// Reuses is the number of times when an idle connection is used.
+	Reuses int64
+	// Waits is the number of times when a download waited for a free stream slot.
+	Waits int64
+	// Expired is the number of idle connections closed because of the idle timeout (or closed by the remote side).
+	Expired int64
+}
+
+// Add returns the sum of the counters.
+func (s PoolStats) Add(o PoolStats) PoolStats {
+	return PoolStats{
+		Dials:   s.Dials + o.Dials,
+		Reuses:  s.Reuses + o.Reuses,
+		Waits:   s.Waits + o.Waits,
+		Expired: s.Expired + o.Expired,
+	}
+}
+
+// Sub returns the difference of the counters.
+func (s PoolStats) Sub(o PoolStats) PoolStats {
+	return PoolStats{
+		Dials:   s.Dials - o.Dials,
+		Reuses:  s.Reuses - o.Reuses,
+		Waits:   s.Waits - o.Waits,
+		Expired: s.Expired - o.Expired,
+	}
+}
+
+// Pool keeps the idle piecestore connections keyed by node ID, to reuse them for the next piece downloads (even across object downloads).
+// One drpc connection serves only one stream at a time, therefore the maximum number of concurrent streams is the maximum number of connections per node.
+type Pool struct {
+	dialer rpc.Dialer
+	config PoolConfig
+
+	mu    sync.Mutex
+	nodes map[storj.NodeID]*poolEntry
+	stats PoolStats
+
+	// stop finishes the reaper goroutine.
+	stop     chan struct{}
+	stopOnce sync.Once
+	reaper   sync.WaitGroup
+}
+
+type poolEntry struct {
+	// slots limits the number of connections in use.
+	slots chan struct{}
+	idle  []idleConn
+}
+
+type idleConn struct {
+	conn  *rpc.Conn
+	since time.Time
+}
+
+// NewPool creates a new connection pool.
+func NewPool(dialer rpc.Dialer, config PoolConfig) *Pool {
+	if config.MaxStreams <= 0 {
+		config.MaxStreams = 1
+	}
+	p := &Pool{
+		dialer: dialer,
+		config: config,
+		nodes:  map[storj.NodeID]*poolEntry{},
+		stop:   make(chan struct{}),
+	}
+	if config.IdleTimeout > 0 {
+		p.reaper.Add(1)
+		go p.reap(max(config.IdleTimeout/2, time.Millisecond))
+	}
+	return p
+}
+
+// reap closes the expired idle connections periodically, including the connections of the nodes which are not used any more.
+func (p *Pool) reap(interval time.Duration) {
+	defer p.reaper.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.closeExpired()
+		}
+	}
+}
+
+// closeExpired closes the idle connections which are expired or closed by the remote side.
+func (p *Pool) closeExpired() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.nodes {
+		var kept []idleConn
+		for _, c := range e.idle {
+			if p.expired(c) {
+				p.stats.Expired++
+				_ = c.conn.Close()
+				continue
+			}
+			kept = append(kept, c)
+		}
+		e.idle = kept
+	}
+}
+
+func (p *Pool) expired(c idleConn) bool {
+	return time.Since(c.since) > p.config.IdleTimeout || isClosed(c.conn)
+}
+
+func (p *Pool) entry(id storj.NodeID) *poolEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, found := p.nodes[id]
+	if !found {
+		e = &poolEntry{
+			slots: make(chan struct{}, p.config.MaxStreams),
+		}
+		p.nodes[id] = e
+	}
+	return e
+}
+
+// Get returns an idle connection of the node, or dials a new one. The connection should be returned with Put.
+func (p *Pool) Get(ctx context.Context, node storj.NodeURL) (*rpc.Conn, error) {
+	e := p.entry(node.ID)
+	select {
+	case e.slots <- struct{}{}:
+	default:
+		p.mu.Lock()
+		p.stats.Waits++
+		p.mu.Unlock()
+		select {
+		case e.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if conn := p.takeIdle(e); conn != nil {
+		return conn, nil
+	}
+
+	conn, err := p.dialer.DialNodeURL(ctx, node)
+	if err != nil {
+		<-e.slots
+		return nil, err
+	}
+	p.mu.Lock()
+	p.stats.Dials++
+	p.mu.Unlock()
+	return conn, nil
+}
+
+// takeIdle returns the most recently used idle connection which is not yet expired.
+func (p *Pool) takeIdle(e *poolEntry) *rpc.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(e.idle) > 0 {
+		last := e.idle[len(e.idle)-1]
+		e.idle = e.idle[:len(e.idle)-1]
+		if p.expired(last) {
+			p.stats.Expired++
+			_ = last.conn.Close()
+			continue
+		}
+		p.stats.Reuses++
+		return last.conn
+	}
+	return nil
+}
+
+// Put releases the connection. It's kept for reuse, unless it's closed or reuse is false.
+func (p *Pool) Put(node storj.NodeID, conn *rpc.Conn, reuse bool) {
+	e := p.entry(node)
+	if !reuse || isClosed(conn) {
+		_ = conn.Close()
+	} else {
+		p.mu.Lock()
+		e.idle = append(e.idle, idleConn{
+			conn:  conn,
+			since: time.Now(),
+		})
+		p.mu.Unlock()
+	}
+	<-e.slots
+}
+
+// Stats returns the current counters.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// Close stops the reaper and closes all the idle connections.
+func (p *Pool) Close() error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	p.reaper.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.nodes {
+		for _, c := range e.idle {
+			_ = c.conn.Close()
+		}
+		e.idle = nil
+	}
+	return nil
+}
+
+func isClosed(conn *rpc.Conn) bool {
+	select {
+	case <-conn.Closed():
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,40 @@
+package downloadng
+
+import (
+	"github.com/elek/stbb/pkg/downloadng/stub"
+	"github.com/stretchr/testify/require"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+	"testing"
+	"time"
+)
+
+func TestPoolIdleTimeout(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	network, err := stub.NewNetwork(2)
+	require.NoError(t, err)
+	dialer, err := network.Dialer(ctx)
+	require.NoError(t, err)
+
+	pool := NewPool(dialer, PoolConfig{IdleTimeout: 50 * time.Millisecond, MaxStreams: 1})
+	defer func() { require.NoError(t, pool.Close()) }()
+
+	node := storj.NodeURL{ID: network.Nodes[0].Identity.ID, Address: network.Nodes[0].Address}
+	conn, err := pool.Get(ctx, node)
+	require.NoError(t, err)
+	pool.Put(node.ID, conn, true)
+
+	// the node is never used again, the reaper should close the connection
+	require.Eventually(t, func() bool {
+		return pool.Stats().Expired == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.True(t, isClosed(conn))
+	require.Equal(t, int64(1), pool.Stats().Dials)
+
+	conn, err = pool.Get(ctx, node)
+	require.NoError(t, err)
+	pool.Put(node.ID, conn, true)
+	require.Equal(t, int64(2), pool.Stats().Dials)
+	require.Equal(t, int64(0), pool.Stats().Reuses)
+}
@@ -0,0 +1,48 @@
+package downloadng
+
+// stripeRange describes which part of a segment should be downloaded and decrypted to serve a plain byte range.
+type stripeRange struct {
+	// pieceOffset and pieceLength are the byte range requested from each piece.
+	pieceOffset int64
+	pieceLength int64
+
+	// encryptedSkip is the number of decoded (still encrypted) bytes to drop before the first encryption block.
+	encryptedSkip int64
+
+	// firstBlock is the index of the first encryption block.
+	firstBlock int64
+
+	// plainSkip is the number of decrypted bytes to drop from the beginning of the first block.
+	plainSkip int64
+
+	// plainLength is the number of decrypted bytes to keep.
+	plainLength int64
+}
+
+// calculateRange maps a plain byte range of a segment (offset is relative to the beginning of the segment) to
+// encryption blocks and erasure coded stripes.
+//
+// blockSize is the plain size of one encryption block, encryptedBlockSize is the size of the same block after encryption.
+func calculateRange(offset int64, length int64, encryptedSize int64, blockSize int64, encryptedBlockSize int64, shareSize int, required int) stripeRange {
+	firstBlock := offset / blockSize
+	lastBlock := (offset + length - 1) / blockSize
+
+	encryptedStart := firstBlock * encryptedBlockSize
+	encryptedEnd := (lastBlock + 1) * encryptedBlockSize
+	if encryptedEnd > encryptedSize {
+		encryptedEnd = encryptedSize
+	}
+
+	stripeSize := int64(shareSize) * int64(required)
+	firstStripe := encryptedStart / stripeSize
+	lastStripe := (encryptedEnd - 1) / stripeSize
+
+	return stripeRange{
+		pieceOffset:   firstStripe * int64(shareSize),
+		pieceLength:   (lastStripe - firstStripe + 1) * int64(shareSize),
+		encryptedSkip: encryptedStart - firstStripe*stripeSize,
+		firstBlock:    firstBlock,
+		plainSkip:     offset - firstBlock*blockSize,
+		plainLength:   length,
+	}
+}
@@ -0,0 +1,48 @@
+package downloadng
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCalculateRange(t *testing.T) {
+	t.Run("block size is the stripe size", func(t *testing.T) {
+		// 29*256 = 7424 encrypted block, 7424-16 plain block
+		rng := calculateRange(10000, 5000, 7424*10, 7408, 7424, 256, 29)
+		require.Equal(t, stripeRange{
+			pieceOffset:   256,
+			pieceLength:   512,
+			encryptedSkip: 0,
+			firstBlock:    1,
+			plainSkip:     10000 - 7408,
+			plainLength:   5000,
+		}, rng)
+	})
+
+	t.Run("beginning of the segment", func(t *testing.T) {
+		rng := calculateRange(0, 100, 7424*10, 7408, 7424, 256, 29)
+		require.Equal(t, int64(0), rng.pieceOffset)
+		require.Equal(t, int64(256), rng.pieceLength)
+		require.Equal(t, int64(0), rng.plainSkip)
+	})
+
+	t.Run("block is not aligned to stripes", func(t *testing.T) {
+		// stripe size is 768, encrypted block size is 1024
+		rng := calculateRange(2000, 100, 10240, 1008, 1024, 256, 3)
+		require.Equal(t, stripeRange{
+			pieceOffset:   256,
+			pieceLength:   768,
+			encryptedSkip: 1024 - 768,
+			firstBlock:    1,
+			plainSkip:     2000 - 1008,
+			plainLength:   100,
+		}, rng)
+	})
+
+	t.Run("end of the segment", func(t *testing.T) {
+		rng := calculateRange(1500, 500, 2048, 1008, 1024, 256, 3)
+		require.Equal(t, int64(256), rng.pieceOffset)
+		require.Equal(t, int64(512), rng.pieceLength)
+		require.Equal(t, int64(256), rng.encryptedSkip)
+	})
+}
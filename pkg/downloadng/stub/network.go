@@ -0,0 +1,203 @@
+package stub
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/elek/stbb/pkg/satellite"
+	"io"
+	"net"
+	"storj.io/common/grant"
+	"storj.io/common/identity"
+	"storj.io/common/identity/testidentity"
+	"storj.io/common/macaroon"
+	"storj.io/common/pb"
+	"storj.io/common/peertls/tlsopts"
+	"storj.io/common/rpc"
+	"storj.io/common/storj"
+	"storj.io/common/testrand"
+	"storj.io/drpc/drpcmigrate"
+	"storj.io/drpc/drpcmux"
+	"storj.io/drpc/drpcserver"
+	"storj.io/uplink"
+	"sync"
+)
+
+// satelliteAddress is the address of the stub satellite. Storage nodes are using 10.10.10.x addresses.
+const satelliteAddress = "10.10.10.254:7777"
+
+// Network is an in-process storj network: one stub satellite and stub storage nodes.
+// Connections are not using real sockets, they are created by DialContext.
+type Network struct {
+	Satellite *identity.FullIdentity
+	Nodes     stubNodes
+
+	mu      sync.Mutex
+	servers map[string]*endpoint
+}
+
+type endpoint struct {
+	tlsConfig *tls.Config
+	server    *drpcserver.Server
+}
+
+// NewNetwork creates a satellite and the given number of storage nodes.
+func NewNetwork(size int) (*Network, error) {
+	ident, err := testidentity.PregeneratedSignedIdentity(0, storj.LatestIDVersion())
+	if err != nil {
+		return nil, err
+	}
+	n := &Network{
+		Satellite: ident,
+		Nodes:     NewStubNodes(size),
+		servers:   make(map[string]*endpoint),
+	}
+
+	rs, err := satellite.ParseRS("29/35/65/110")
+	if err != nil {
+		return nil, err
+	}
+	var urls []storj.NodeURL
+	for _, node := range n.Nodes {
+		urls = append(urls, storj.NodeURL{ID: node.Identity.ID, Address: node.Address})
+	}
+	err = n.SetMetainfo(satellite.NewMetainfo(ident, satellite.NewNodes(urls...), rs))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range n.Nodes {
+		mux := drpcmux.New()
+		err = pb.DRPCRegisterPiecestore(mux, newPiecestore(n, node))
+		if err != nil {
+			return nil, err
+		}
+		n.servers[node.Address], err = newEndpoint(node.Identity, mux)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// SetMetainfo replaces the metainfo endpoint of the stub satellite (for example with a different redundancy scheme).
+// It should be called before the first connection to the satellite.
+func (n *Network) SetMetainfo(server pb.DRPCMetainfoServer) error {
+	mux := drpcmux.New()
+	err := pb.DRPCRegisterMetainfo(mux, server)
+	if err != nil {
+		return err
+	}
+	e, err := newEndpoint(n.Satellite, mux)
+	if err != nil {
+		return err
+	}
+	n.servers[satelliteAddress] = e
+	return nil
+}
+
+func newEndpoint(ident *identity.FullIdentity, mux *drpcmux.Mux) (*endpoint, error) {
+	tlsOptions, err := tlsopts.NewOptions(ident, tlsopts.Config{
+		PeerIDVersions: "*",
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint{
+		tlsConfig: tlsOptions.ServerTLSConfig(),
+		server:    drpcserver.New(mux),
+	}, nil
+}
+
+// SetFaults changes the injected failures of the storage node.
+func (n *Network) SetFaults(id storj.NodeID, faults Faults) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	node, err := n.Nodes.GetByID(id)
+	if err != nil {
+		return err
+	}
+	node.Faults = faults
+	return nil
+}
+
+func (n *Network) faults(node *nodeStub) Faults {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return node.Faults
+}
+
+// DialContext opens an in-memory connection to the satellite or to a storage node.
+// It can be used as uplink.Config.DialContext or as the dial function of rpc.TCPConnector.
+func (n *Network) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	e, found := n.servers[address]
+	if !found {
+		return nil, fmt.Errorf("no such address %s", address)
+	}
+	if node, err := n.Nodes.GetByAddress(address); err == nil && n.faults(node).Offline {
+		return nil, fmt.Errorf("node %s is offline", address)
+	}
+
+	client, server := net.Pipe()
+	go func() {
+		defer func() { _ = server.Close() }()
+
+		// TCP connector sends the DRPC header before the TLS handshake
+		header := make([]byte, len(drpcmigrate.DRPCHeader))
+		_, err := io.ReadFull(server, header)
+		if err != nil {
+			return
+		}
+		_ = e.server.ServeOne(context.Background(), tls.Server(server, e.tlsConfig))
+	}()
+	return client, nil
+}
+
+// Dialer returns an rpc dialer which connects to the in-memory network.
+func (n *Network) Dialer(ctx context.Context) (rpc.Dialer, error) {
+	ident, err := identity.NewFullIdentity(ctx, identity.NewCAOptions{
+		Difficulty:  0,
+		Concurrency: 1,
+	})
+	if err != nil {
+		return rpc.Dialer{}, err
+	}
+
+	tlsOptions, err := tlsopts.NewOptions(ident, tlsopts.Config{
+		PeerIDVersions: "0",
+	}, nil)
+	if err != nil {
+		return rpc.Dialer{}, err
+	}
+	dialer := rpc.NewDefaultDialer(tlsOptions)
+	dialer.Connector = rpc.NewDefaultTCPConnector(n.DialContext)
+	return dialer, nil
+}
+
+// UplinkConfig returns an uplink configuration which connects to the in-memory network.
+func (n *Network) UplinkConfig() uplink.Config {
+	return uplink.Config{
+		UserAgent:   "stbb",
+		DialContext: n.DialContext,
+	}
+}
+
+// Access creates a new access grant for the stub satellite.
+func (n *Network) Access() (*grant.Access, error) {
+	secret, err := macaroon.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	apiKey, err := macaroon.NewAPIKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	key := testrand.Key()
+	encAccess := grant.NewEncryptionAccessWithDefaultKey(&key)
+	encAccess.SetDefaultPathCipher(storj.EncAESGCM)
+	return &grant.Access{
+		SatelliteAddress: storj.NodeURL{ID: n.Satellite.ID, Address: satelliteAddress}.String(),
+		APIKey:           apiKey,
+		EncAccess:        encAccess,
+	}, nil
+}
@@ -5,6 +5,7 @@ import (
 	"storj.io/common/identity"
 	"storj.io/common/identity/testidentity"
 	"storj.io/common/storj"
+	"time"
 )
 
 type stubNodes []*nodeStub
@@ -39,6 +40,22 @@ type nodeStub struct {
 	Address  string
 	Identity *identity.FullIdentity
 	Index    int
+	Faults   Faults
+}
+
+// Faults defines the injected failures of one storage node.
+type Faults struct {
+	// Offline nodes can't be dialed.
+	Offline bool
+
+	// Latency is the delay before the first byte of each piece download.
+	Latency time.Duration
+
+	// Missing nodes respond with NotFound for each piece download.
+	Missing bool
+
+	// Corrupt nodes flip the bits of the returned piece data.
+	Corrupt bool
 }
 
 func NewNodeStub(index int) *nodeStub {
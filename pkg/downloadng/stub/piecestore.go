@@ -2,204 +2,180 @@ package stub
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"io"
 	"storj.io/common/pb"
+	"storj.io/common/rpc/rpcstatus"
 	"storj.io/common/signing"
 	"storj.io/common/storj"
-	"storj.io/drpc"
 	"sync"
 	"time"
 )
 
-var nodes = map[storj.NodeID]*nodeContent{}
+// piecestore is an in-memory storage node endpoint.
+type piecestore struct {
+	pb.DRPCPiecestoreUnimplementedServer
 
-var nodesLock = sync.Mutex{}
+	node    *nodeStub
+	network *Network
 
-type nodeContent struct {
+	mu     sync.Mutex
 	pieces map[storj.PieceID][]byte
+	// hashes are the uplink signed hashes and the original order limits, sent back for audit and repair.
+	hashes map[storj.PieceID]storedHash
 }
 
-type DownloadState struct {
-	initialOffset int64
-	maxPaidOffset int64
-	position      int64
-}
-
-type piecestore struct {
-	node          *nodeStub
-	closed        chan struct{}
-	once          sync.Once
-	key           storj.PiecePrivateKey
-	pieceSet      map[int][]byte
-	pieceTemplate []byte
-	nodeContent   *nodeContent
+type storedHash struct {
+	hash  *pb.PieceHash
+	limit *pb.OrderLimit
 }
 
-func (p *piecestore) Unblocked() <-chan struct{} {
-	return make(chan struct{})
-}
-
-func NewPiecestoreStub(node *nodeStub) (*piecestore, error) {
-	_, key, err := storj.NewPieceKey()
-	if err != nil {
-		panic(err)
-	}
-	nodesLock.Lock()
-	defer nodesLock.Unlock()
-	if _, found := nodes[node.Identity.ID]; !found {
-		nodes[node.Identity.ID] = &nodeContent{
-			pieces: make(map[storj.PieceID][]byte),
-		}
-	}
-
+func newPiecestore(network *Network, node *nodeStub) *piecestore {
 	return &piecestore{
-		key:         key,
-		node:        node,
-		closed:      make(chan struct{}),
-		nodeContent: nodes[node.Identity.ID],
-	}, nil
-}
-
-func (p *piecestore) Close() error {
-	p.once.Do(func() {
-		close(p.closed)
-	})
-	return nil
-}
-
-func (p *piecestore) Closed() <-chan struct{} {
-	return p.closed
-}
-
-func (p *piecestore) Invoke(ctx context.Context, rpc string, enc drpc.Encoding, in, out drpc.Message) error {
-	panic("implement me")
-}
-
-func (p *piecestore) NewStream(ctx context.Context, rpc string, enc drpc.Encoding) (drpc.Stream, error) {
-	return &piecestoreStream{
-		key:         p.key,
-		rpc:         rpc,
-		ctx:         ctx,
-		node:        p.node,
-		requests:    make(chan drpc.Message, 1000),
-		downloads:   make(map[string]*DownloadState),
-		nodeContent: p.nodeContent,
-	}, nil
-}
-
-type piecestoreStream struct {
-	ctx         context.Context
-	node        *nodeStub
-	rpc         string
-	requests    chan drpc.Message
-	key         storj.PiecePrivateKey
-	downloads   map[string]*DownloadState
-	nodeContent *nodeContent
-}
-
-func (p *piecestoreStream) Context() context.Context {
-	return p.ctx
+		node:    node,
+		network: network,
+		pieces:  make(map[storj.PieceID][]byte),
+		hashes:  make(map[storj.PieceID]storedHash),
+	}
 }
 
-func (p *piecestoreStream) MsgSend(msg drpc.Message, enc drpc.Encoding) error {
-	switch m := msg.(type) {
-	case *pb.PieceUploadRequest:
-		if m.Limit == nil {
-			return nil
+func (p *piecestore) Upload(stream pb.DRPCPiecestore_UploadStream) error {
+	var limit *pb.OrderLimit
+	var data []byte
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return rpcstatus.Error(rpcstatus.Canceled, "upload is not committed")
 		}
-		if _, found := p.nodeContent.pieces[m.Limit.PieceId]; !found {
-			p.nodeContent.pieces[m.Limit.PieceId] = []byte{}
+		if err != nil {
+			return err
 		}
-		if m.Chunk != nil && m.Chunk.Data != nil {
-			p.nodeContent.pieces[m.Limit.PieceId] = append(p.nodeContent.pieces[m.Limit.PieceId], m.Chunk.Data...)
+		if req.Limit != nil {
+			limit = req.Limit
 		}
-		if m.Done == nil {
-			return nil
-		}
-	case *pb.PieceDownloadRequest:
-		key := p.getStreamKey(m)
-		downloadState, found := p.downloads[key]
-		if !found {
-			downloadState = &DownloadState{}
-			p.downloads[key] = downloadState
+		if limit == nil {
+			return rpcstatus.Error(rpcstatus.InvalidArgument, "order limit is missing")
 		}
-		if m.Order != nil {
-			downloadState.maxPaidOffset = downloadState.initialOffset + m.Order.Amount
+		if req.Chunk != nil {
+			data = append(data, req.Chunk.Data...)
 		}
-		if m.Chunk != nil {
-			downloadState.initialOffset = m.Chunk.Offset
-			downloadState.position = m.Chunk.Offset
-			return nil
+		if req.Done == nil {
+			continue
 		}
 
-	default:
-		panic(fmt.Sprintf("%T is not supported", m))
+		p.mu.Lock()
+		p.pieces[limit.PieceId] = data
+		p.hashes[limit.PieceId] = storedHash{hash: req.Done, limit: limit}
+		p.mu.Unlock()
+
+		hash, err := signing.SignPieceHash(stream.Context(), signing.SignerFromFullIdentity(p.node.Identity), &pb.PieceHash{
+			PieceId:       limit.PieceId,
+			Hash:          req.Done.Hash,
+			HashAlgorithm: req.Done.HashAlgorithm,
+			PieceSize:     int64(len(data)),
+			Timestamp:     time.Now(),
+		})
+		if err != nil {
+			return rpcstatus.Error(rpcstatus.Internal, err.Error())
+		}
+		return stream.SendAndClose(&pb.PieceUploadResponse{
+			Done: hash,
+		})
 	}
-	p.requests <- msg
-	return nil
 }
 
-func (p *piecestoreStream) getStreamKey(m *pb.PieceDownloadRequest) string {
-	key := ""
-	if m.Limit != nil {
-		key = m.Limit.SerialNumber.String()
+func (p *piecestore) Download(stream pb.DRPCPiecestore_DownloadStream) error {
+	ctx := stream.Context()
+	req, err := stream.Recv()
+	if err != nil {
+		return err
 	}
-	if m.Order != nil {
-		key = m.Order.SerialNumber.String()
+	if req.Limit == nil || req.Chunk == nil {
+		return rpcstatus.Error(rpcstatus.InvalidArgument, "order limit and chunk are required in the first message")
 	}
-	return key
-}
 
-func (p *piecestoreStream) MsgRecv(msg drpc.Message, enc drpc.Encoding) error {
-	request := <-p.requests
-
-	switch m := request.(type) {
-	case *pb.PieceUploadRequest:
-		response := msg.(*pb.PieceUploadResponse)
-		if m.Done != nil {
-			signer := signing.SignerFromFullIdentity(p.node.Identity)
-			m.Done.Timestamp = time.Now()
-			hash, err := signing.SignPieceHash(p.ctx, signer, m.Done)
-			if err != nil {
-				return err
-			}
-			response.Done = hash
+	faults := p.network.faults(p.node)
+
+	p.mu.Lock()
+	data, found := p.pieces[req.Limit.PieceId]
+	stored := p.hashes[req.Limit.PieceId]
+	p.mu.Unlock()
+	if !found || faults.Missing {
+		return rpcstatus.Errorf(rpcstatus.NotFound, "piece %s is not found", req.Limit.PieceId)
+	}
+
+	if faults.Latency > 0 {
+		select {
+		case <-time.After(faults.Latency):
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-	case *pb.PieceDownloadRequest:
-		response := msg.(*pb.PieceDownloadResponse)
-		key := p.getStreamKey(m)
-		downloadState := p.downloads[key]
-		remaining := downloadState.maxPaidOffset - downloadState.position
-		if remaining > 0 {
-			data := p.nodeContent.pieces[m.Limit.PieceId]
-			response.Chunk = &pb.PieceDownloadResponse_Chunk{
-				Offset: downloadState.position,
-				Data:   data[downloadState.position : downloadState.position+remaining],
-			}
-			downloadState.position += remaining
+	}
+
+	start := req.Chunk.Offset
+	end := start + req.Chunk.ChunkSize
+	if start < 0 || end > int64(len(data)) {
+		return rpcstatus.Errorf(rpcstatus.InvalidArgument, "requested range %d-%d is out of the piece (%d)", start, end, len(data))
+	}
+
+	if req.Limit.Action == pb.PieceAction_GET_AUDIT || req.Limit.Action == pb.PieceAction_GET_REPAIR {
+		err = stream.Send(&pb.PieceDownloadResponse{
+			Hash:  stored.hash,
+			Limit: stored.limit,
+		})
+		if err != nil {
+			return err
 		}
-	case struct{}:
-	default:
-		panic(fmt.Sprintf("%T is not supported", m))
 	}
-	return nil
-}
 
-func (p *piecestoreStream) CloseSend() error {
-	p.requests <- struct{}{}
-	return nil
-}
+	position := start
+	for {
+		// data is sent only up to the paid amount (the first message may also contain an order)
+		if req.Order != nil {
+			paid := start + req.Order.Amount
+			if paid > end {
+				paid = end
+			}
+			if paid > position {
+				chunk := append([]byte{}, data[position:paid]...)
+				if faults.Corrupt {
+					for i := range chunk {
+						chunk[i] ^= 0xff
+					}
+				}
+				err = stream.Send(&pb.PieceDownloadResponse{
+					Chunk: &pb.PieceDownloadResponse_Chunk{
+						Offset: position,
+						Data:   chunk,
+					},
+				})
+				if err != nil {
+					return err
+				}
+				position = paid
+			}
+		}
 
-func (p *piecestoreStream) Close() error {
-	if p.requests != nil {
-		close(p.requests)
-		p.requests = nil
+		req, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 	}
-	return nil
 }
 
-func (p *piecestore) Transport() drpc.Transport {
-	return nil
+func (p *piecestore) Exists(ctx context.Context, req *pb.ExistsRequest) (*pb.ExistsResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	resp := &pb.ExistsResponse{}
+	for i, id := range req.PieceIds {
+		if _, found := p.pieces[id]; !found {
+			resp.Missing = append(resp.Missing, uint32(i))
+		}
+	}
+	return resp, nil
 }
 
-var _ drpc.Conn = &piecestore{}
+var _ pb.DRPCPiecestoreServer = &piecestore{}
@@ -0,0 +1,130 @@
+package downloadng
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceLevel defines what is recorded about the messages between the actors.
+type TraceLevel string
+
+const (
+	// TraceSilent doesn't record anything.
+	TraceSilent TraceLevel = "silent"
+
+	// TraceSummary collects message counts and backpressure per mailbox.
+	TraceSummary TraceLevel = "summary"
+
+	// TraceVerbose collects the summary and every message with timestamp.
+	TraceVerbose TraceLevel = "verbose"
+)
+
+// Tracer records the messages delivered between the actors. Everything is kept in memory and printed only at the end,
+// so tracing doesn't distort the timing of the download (as printing each message would).
+type Tracer struct {
+	level TraceLevel
+	start time.Time
+
+	mu        sync.Mutex
+	mailboxes map[string]*MailboxStats
+	events    []traceEvent
+}
+
+// MailboxStats is the summary of the messages received by one mailbox.
+type MailboxStats struct {
+	Name     string
+	Messages map[string]int
+
+	// Blocked is the total time spent by the senders waiting for the receiver.
+	Blocked    time.Duration
+	MaxBlocked time.Duration
+}
+
+type traceEvent struct {
+	elapsed time.Duration
+	mailbox string
+	message string
+	blocked time.Duration
+}
+
+// NewTracer creates a tracer with the given level.
+func NewTracer(level TraceLevel) *Tracer {
+	return &Tracer{
+		level:     level,
+		start:     time.Now(),
+		mailboxes: map[string]*MailboxStats{},
+	}
+}
+
+func (t *Tracer) sent(mailbox string, msg any, blocked time.Duration) {
+	if t == nil || t.level == TraceSilent {
+		return
+	}
+	message := fmt.Sprintf("%T", msg)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats, found := t.mailboxes[mailbox]
+	if !found {
+		stats = &MailboxStats{
+			Name:     mailbox,
+			Messages: map[string]int{},
+		}
+		t.mailboxes[mailbox] = stats
+	}
+	stats.Messages[message]++
+	stats.Blocked += blocked
+	stats.MaxBlocked = max(stats.MaxBlocked, blocked)
+
+	if t.level == TraceVerbose {
+		t.events = append(t.events, traceEvent{
+			elapsed: time.Since(t.start),
+			mailbox: mailbox,
+			message: message,
+			blocked: blocked,
+		})
+	}
+}
+
+// Stats returns the summary of all the mailboxes, ordered by name.
+func (t *Tracer) Stats() (stats []MailboxStats) {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.mailboxes {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// Print writes out the recorded messages (verbose) and the summary of each mailbox.
+func (t *Tracer) Print(w io.Writer) {
+	if t == nil || t.level == TraceSilent {
+		return
+	}
+	t.mu.Lock()
+	for _, e := range t.events {
+		_, _ = fmt.Fprintf(w, "%12s %-16s <- %-32s blocked=%s\n", e.elapsed, e.mailbox, e.message, e.blocked)
+	}
+	t.mu.Unlock()
+
+	for _, s := range t.Stats() {
+		var types []string
+		total := 0
+		for m, c := range s.Messages {
+			types = append(types, fmt.Sprintf("%s=%d", strings.TrimPrefix(strings.TrimPrefix(m, "*"), "downloadng."), c))
+			total += c
+		}
+		sort.Strings(types)
+		_, _ = fmt.Fprintf(w, "%-16s messages=%-6d blocked=%-12s max-blocked=%-12s %s\n", s.Name, total, s.Blocked, s.MaxBlocked, strings.Join(types, " "))
+	}
+}
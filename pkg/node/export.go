@@ -47,7 +47,7 @@ func (c Export) Run() error {
 	defer geoIP.Close()
 	k := 0
 	for _, n := range nodes {
-		ipInfo := ipInfo{}
+		ipInfo := IPInfo{}
 		ip, err := addressToIP(n.LastIPPort)
 		if err == nil {
 			_ = geoIP.Lookup(ip, &ipInfo)
@@ -62,7 +62,8 @@ func (c Export) Run() error {
 	return nil
 }
 
-type ipInfo struct {
+// IPInfo is the GeoIP record of an IP address. The country fields are filled from a country/city database, the AS fields from an ASN database.
+type IPInfo struct {
 	Country struct {
 		IsoCode string `maxminddb:"iso_code"`
 	} `maxminddb:"country"`
@@ -72,6 +73,8 @@ type ipInfo struct {
 	RegisteredCountry struct {
 		IsoCode string `maxminddb:"iso_code"`
 	} `maxminddb:"registered_country"`
+	ASN          uint   `maxminddb:"autonomous_system_number" json:",omitempty"`
+	Organization string `maxminddb:"autonomous_system_organization" json:",omitempty"`
 }
 
 type NodeRecord struct {
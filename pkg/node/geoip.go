@@ -21,7 +21,7 @@ func (g GeoIP) Run() error {
 	}
 	defer geoIP.Close()
 
-	ipInfo := ipInfo{}
+	ipInfo := IPInfo{}
 	ip := net.ParseIP(g.IP)
 	if len(ip) == 0 {
 		return errors.New("Wrong IP")
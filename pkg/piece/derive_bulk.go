@@ -0,0 +1,244 @@
+package piece
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elek/stbb/pkg/db"
+	"github.com/zeebo/errs/v2"
+	"go.uber.org/zap"
+	"storj.io/common/storj"
+	"storj.io/common/uuid"
+	"storj.io/storj/satellite/metabase"
+)
+
+// DeriveBulk derives the piece IDs of all the pieces of many segments.
+type DeriveBulk struct {
+	db.WithDatabase
+	Segments string         `arg:"" help:"CSV file with 'stream_id,position,root_piece_id,alias_pieces' lines. Alias pieces are hex encoded, as the remote_alias_pieces column of the segments table"`
+	Aliases  string         `help:"CSV file with 'node_id,node_alias' lines (export of the node_aliases table). Default is to read the aliases from the metabase"`
+	Node     []storj.NodeID `help:"derive only the pieces of these nodes"`
+	Output   string         `default:"derived.csv" help:"CSV file with one line per piece (node_id,piece_id,stream_id,position,piece_num,root_piece_id), ordered by node"`
+}
+
+// segmentPieces is a segment with the locations of the pieces.
+type segmentPieces struct {
+	streamID    uuid.UUID
+	position    metabase.SegmentPosition
+	rootPieceID storj.PieceID
+	pieces      metabase.AliasPieces
+}
+
+// derivedPiece is one piece of a segment, stored on one node.
+type derivedPiece struct {
+	node        storj.NodeID
+	pieceID     storj.PieceID
+	streamID    uuid.UUID
+	position    metabase.SegmentPosition
+	number      uint16
+	rootPieceID storj.PieceID
+}
+
+func (d derivedPiece) record() []string {
+	return []string{
+		d.node.String(),
+		d.pieceID.String(),
+		d.streamID.String(),
+		strconv.FormatUint(d.position.Encode(), 10),
+		strconv.Itoa(int(d.number)),
+		d.rootPieceID.String(),
+	}
+}
+
+func (d DeriveBulk) Run() error {
+	ctx := context.Background()
+
+	segments, err := readSegmentList(d.Segments)
+	if err != nil {
+		return err
+	}
+
+	aliases, err := d.aliasMap(ctx)
+	if err != nil {
+		return err
+	}
+
+	selected := map[storj.NodeID]bool{}
+	for _, n := range d.Node {
+		selected[n] = true
+	}
+
+	var pieces []derivedPiece
+	unknown := map[metabase.NodeAlias]bool{}
+	for _, segment := range segments {
+		derived, missing := deriveSegment(segment, aliases)
+		for _, alias := range missing {
+			unknown[alias] = true
+		}
+		for _, p := range derived {
+			if len(selected) == 0 || selected[p.node] {
+				pieces = append(pieces, p)
+			}
+		}
+	}
+	sort.SliceStable(pieces, func(i, j int) bool {
+		return pieces[i].node.Less(pieces[j].node)
+	})
+
+	out, err := os.Create(d.Output)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	defer func() { _ = out.Close() }()
+	w := csv.NewWriter(out)
+	_ = w.Write([]string{"node_id", "piece_id", "stream_id", "position", "piece_num", "root_piece_id"})
+	perNode := map[storj.NodeID]int{}
+	for _, p := range pieces {
+		perNode[p.node]++
+		if err := w.Write(p.record()); err != nil {
+			return errs.Wrap(err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return errs.Wrap(err)
+	}
+
+	fmt.Printf("%d pieces of %d segments are derived for %d nodes (%s)\n", len(pieces), len(segments), len(perNode), d.Output)
+	if len(unknown) > 0 {
+		fmt.Printf("WARNING: %d node aliases are unknown, their pieces are ignored\n", len(unknown))
+	}
+	return nil
+}
+
+// aliasMap reads the node aliases from the CSV file, or from the metabase if the file is not set.
+func (d DeriveBulk) aliasMap(ctx context.Context) (*metabase.NodeAliasMap, error) {
+	if d.Aliases != "" {
+		return readAliasMap(d.Aliases)
+	}
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	metabaseDB, err := d.GetMetabaseDB(ctx, log.Named("metabase"))
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	defer func() { _ = metabaseDB.Close() }()
+	aliases, err := metabaseDB.LatestNodesAliasMap(ctx)
+	return aliases, errs.Wrap(err)
+}
+
+// deriveSegment returns the pieces of the segment, and the aliases which are not in the alias map.
+func deriveSegment(segment segmentPieces, aliases *metabase.NodeAliasMap) (pieces []derivedPiece, missing []metabase.NodeAlias) {
+	for _, p := range segment.pieces {
+		node, ok := aliases.Node(p.Alias)
+		if !ok {
+			missing = append(missing, p.Alias)
+			continue
+		}
+		pieces = append(pieces, derivedPiece{
+			node:        node,
+			pieceID:     segment.rootPieceID.Derive(node, int32(p.Number)),
+			streamID:    segment.streamID,
+			position:    segment.position,
+			number:      p.Number,
+			rootPieceID: segment.rootPieceID,
+		})
+	}
+	return pieces, missing
+}
+
+// readSegmentList reads the 'stream_id,position,root_piece_id,alias_pieces' lines. Header line is skipped.
+func readSegmentList(path string) (segments []segmentPieces, err error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, ",")
+		if len(parts) < 4 {
+			return nil, errs.Errorf("invalid line in %s (stream_id,position,root_piece_id,alias_pieces is expected): %s", path, line)
+		}
+		if parts[0] == "stream_id" {
+			continue
+		}
+		streamID, err := uuid.FromString(parts[0])
+		if err != nil {
+			return nil, errs.Errorf("invalid stream ID in line %s: %v", line, err)
+		}
+		position, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, errs.Errorf("invalid position in line %s: %v", line, err)
+		}
+		root, err := storj.PieceIDFromString(parts[2])
+		if err != nil {
+			return nil, errs.Errorf("invalid root piece ID in line %s: %v", line, err)
+		}
+		encoded, err := hex.DecodeString(strings.TrimPrefix(parts[3], `\x`))
+		if err != nil {
+			return nil, errs.Errorf("invalid alias pieces in line %s: %v", line, err)
+		}
+		var pieces metabase.AliasPieces
+		if err := pieces.SetBytes(encoded); err != nil {
+			return nil, errs.Errorf("invalid alias pieces in line %s: %v", line, err)
+		}
+		segments = append(segments, segmentPieces{
+			streamID:    streamID,
+			position:    metabase.SegmentPositionFromEncoded(position),
+			rootPieceID: root,
+			pieces:      pieces,
+		})
+	}
+	return segments, nil
+}
+
+// readAliasMap reads the 'node_id,node_alias' lines. Header line is skipped.
+func readAliasMap(path string) (*metabase.NodeAliasMap, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	var entries []metabase.NodeAliasEntry
+	for _, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, ",")
+		if len(parts) < 2 {
+			return nil, errs.Errorf("invalid line in %s (node_id,node_alias is expected): %s", path, line)
+		}
+		if parts[0] == "node_id" {
+			continue
+		}
+		id, err := parseNodeID(parts[0])
+		if err != nil {
+			return nil, errs.Errorf("invalid node ID in line %s: %v", line, err)
+		}
+		alias, err := strconv.ParseInt(parts[1], 10, 32)
+		if err != nil {
+			return nil, errs.Errorf("invalid node alias in line %s: %v", line, err)
+		}
+		entries = append(entries, metabase.NodeAliasEntry{ID: id, Alias: metabase.NodeAlias(alias)})
+	}
+	return metabase.NewNodeAliasMap(entries), nil
+}
+
+// parseNodeID parses the node ID in base58 or in hex (as it's exported from the database).
+func parseNodeID(s string) (storj.NodeID, error) {
+	if raw, err := hex.DecodeString(strings.TrimPrefix(s, `\x`)); err == nil && len(raw) == len(storj.NodeID{}) {
+		return storj.NodeIDFromBytes(raw)
+	}
+	return storj.NodeIDFromString(s)
+}
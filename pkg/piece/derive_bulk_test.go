@@ -0,0 +1,98 @@
+package piece
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"storj.io/common/storj"
+	"storj.io/common/testrand"
+	"storj.io/storj/satellite/metabase"
+	"storj.io/storj/storagenode/blobstore/filestore"
+)
+
+func TestDeriveBulk(t *testing.T) {
+	dir := t.TempDir()
+	node1, node2 := testrand.NodeID(), testrand.NodeID()
+	aliases := fmt.Sprintf("node_id,node_alias\n%s,1\n\\x%s,2\n", node1, hex.EncodeToString(node2.Bytes()))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "aliases.csv"), []byte(aliases), 0644))
+
+	root1, root2 := testrand.PieceID(), testrand.PieceID()
+	pieces1, err := metabase.AliasPieces{{Number: 0, Alias: 1}, {Number: 3, Alias: 2}, {Number: 5, Alias: 9}}.Bytes()
+	require.NoError(t, err)
+	pieces2, err := metabase.AliasPieces{{Number: 1, Alias: 2}}.Bytes()
+	require.NoError(t, err)
+	stream := testrand.UUID()
+	segments := fmt.Sprintf("stream_id,position,root_piece_id,alias_pieces\n%s,0,%s,\\x%s\n%s,%d,%s,%s\n",
+		stream, root1, hex.EncodeToString(pieces1),
+		stream, metabase.SegmentPosition{Index: 1}.Encode(), root2, hex.EncodeToString(pieces2))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "segments.csv"), []byte(segments), 0644))
+
+	list, err := readSegmentList(filepath.Join(dir, "segments.csv"))
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, uint32(1), list[1].position.Index)
+
+	aliasMap, err := readAliasMap(filepath.Join(dir, "aliases.csv"))
+	require.NoError(t, err)
+	derived, missing := deriveSegment(list[0], aliasMap)
+	require.Equal(t, []metabase.NodeAlias{9}, missing)
+	require.Len(t, derived, 2)
+	require.Equal(t, root1.Derive(node1, 0), derived[0].pieceID)
+	require.Equal(t, root1.Derive(node2, 3), derived[1].pieceID)
+
+	output := filepath.Join(dir, "derived.csv")
+	require.NoError(t, DeriveBulk{
+		Segments: filepath.Join(dir, "segments.csv"),
+		Aliases:  filepath.Join(dir, "aliases.csv"),
+		Node:     []storj.NodeID{node2},
+		Output:   output,
+	}.Run())
+	f, err := os.Open(output)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	records, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, []string{node2.String(), root1.Derive(node2, 3).String(), stream.String(), "0", "3", root1.String()}, records[1])
+	require.Equal(t, root2.Derive(node2, 1).String(), records[2][1])
+
+	t.Run("reverse", func(t *testing.T) {
+		orphan := testrand.PieceID()
+		wanted := map[storj.PieceID]*derivedPiece{
+			root1.Derive(node2, 3): nil,
+			root2.Derive(node2, 1): nil,
+			orphan:                 nil,
+		}
+		require.Equal(t, 1, reverseMatch(list[0], node2, 2, wanted))
+		require.Equal(t, 0, reverseMatch(list[0], node2, 2, wanted))
+		require.Equal(t, 0, reverseMatch(list[1], node1, 1, wanted))
+		require.Equal(t, 1, reverseMatch(list[1], node2, 2, wanted))
+		require.Equal(t, stream, wanted[root2.Derive(node2, 1)].streamID)
+		require.Equal(t, uint16(1), wanted[root2.Derive(node2, 1)].number)
+		require.Nil(t, wanted[orphan])
+
+		blobs := filepath.Join(t.TempDir(), "blobs")
+		namespace := filepath.Join(blobs, filestore.PathEncoding.EncodeToString(testrand.NodeID().Bytes()))
+		for id := range wanted {
+			key := filestore.PathEncoding.EncodeToString(id.Bytes())
+			require.NoError(t, os.MkdirAll(filepath.Join(namespace, key[:2]), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(namespace, key[:2], key[2:]+".sj1"), nil, 0644))
+		}
+		ids, err := readPieceIDs(namespace)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []storj.PieceID{root1.Derive(node2, 3), root2.Derive(node2, 1), orphan}, ids)
+
+		// the pieces of the satellites are not mixed
+		_, err = readPieceIDs(blobs)
+		require.Error(t, err)
+
+		ids, err = readPieceIDs(output)
+		require.NoError(t, err)
+		require.Equal(t, []storj.PieceID{root1.Derive(node2, 3), root2.Derive(node2, 1)}, ids)
+	})
+}
@@ -0,0 +1,206 @@
+package piece
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/elek/stbb/pkg/db"
+	"github.com/elek/stbb/pkg/util"
+	"github.com/zeebo/errs/v2"
+	"go.uber.org/zap"
+	"storj.io/common/storj"
+	"storj.io/storj/satellite/metabase"
+	"storj.io/storj/storagenode/blobstore/filestore"
+)
+
+// DeriveReverse finds the segments of derived piece IDs stored on one node, with a full scan of the segments.
+type DeriveReverse struct {
+	db.WithDatabase
+	NodeID storj.NodeID `arg:"" help:"node where the pieces are stored"`
+	Pieces string       `arg:"" help:"file with the derived piece IDs (first column, or the piece_id column if the file has a header), or the blobs directory of one satellite namespace of the storagenode, like blobs/<namespace> (piece IDs are read from the .sj1 file names)"`
+	Output string       `default:"reverse.csv" help:"CSV file with one line per piece (piece_id,status,stream_id,position,piece_num,root_piece_id)"`
+}
+
+const pieceOrphan = "orphan"
+
+func (d DeriveReverse) Run() error {
+	ctx := context.Background()
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	ids, err := readPieceIDs(d.Pieces)
+	if err != nil {
+		return err
+	}
+	wanted := map[storj.PieceID]*derivedPiece{}
+	for _, id := range ids {
+		wanted[id] = nil
+	}
+	fmt.Printf("%d piece IDs are loaded\n", len(wanted))
+
+	metabaseDB, err := d.GetMetabaseDB(ctx, log.Named("metabase"))
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	defer func() { _ = metabaseDB.Close() }()
+
+	aliases, err := metabaseDB.LatestNodesAliasMap(ctx)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	alias, ok := aliases.Alias(d.NodeID)
+	if !ok {
+		return errs.Errorf("node %s doesn't have alias in the metabase", d.NodeID)
+	}
+
+	remaining := len(wanted)
+	progress := util.Progress{}
+	err = metabaseDB.IterateLoopSegments(ctx, metabase.IterateLoopSegments{
+		BatchSize:          100000,
+		AsOfSystemInterval: -10 * time.Second,
+	}, func(ctx context.Context, iterator metabase.LoopSegmentsIterator) error {
+		var entry metabase.LoopSegmentEntry
+		for remaining > 0 && iterator.Next(ctx, &entry) {
+			if entry.Inline() {
+				continue
+			}
+			remaining -= reverseMatch(segmentPieces{
+				streamID:    entry.StreamID,
+				position:    entry.Position,
+				rootPieceID: entry.RootPieceID,
+				pieces:      entry.AliasPieces,
+			}, d.NodeID, alias, wanted)
+			progress.Increment()
+		}
+		return nil
+	})
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	out, err := os.Create(d.Output)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	defer func() { _ = out.Close() }()
+	w := csv.NewWriter(out)
+	_ = w.Write([]string{"piece_id", "status", "stream_id", "position", "piece_num", "root_piece_id"})
+	for _, id := range ids {
+		record := []string{id.String(), pieceOrphan, "", "", "", ""}
+		if found := wanted[id]; found != nil {
+			derived := found.record()
+			record = append([]string{id.String(), pieceFound}, derived[2:]...)
+		}
+		if err := w.Write(record); err != nil {
+			return errs.Wrap(err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return errs.Wrap(err)
+	}
+
+	fmt.Printf("%d segments are scanned, %d pieces are found, %d pieces are orphan (%s)\n", progress.Counter(), len(wanted)-remaining, remaining, d.Output)
+	return nil
+}
+
+// reverseMatch saves the pieces of the segment which are stored on the node and wanted. Returns the number of new matches.
+func reverseMatch(segment segmentPieces, node storj.NodeID, alias metabase.NodeAlias, wanted map[storj.PieceID]*derivedPiece) (matched int) {
+	for _, p := range segment.pieces {
+		if p.Alias != alias {
+			continue
+		}
+		derived := segment.rootPieceID.Derive(node, int32(p.Number))
+		found, ok := wanted[derived]
+		if !ok || found != nil {
+			continue
+		}
+		wanted[derived] = &derivedPiece{
+			node:        node,
+			pieceID:     derived,
+			streamID:    segment.streamID,
+			position:    segment.position,
+			number:      p.Number,
+			rootPieceID: segment.rootPieceID,
+		}
+		matched++
+	}
+	return matched
+}
+
+// readPieceIDs reads the piece IDs from the first (or piece_id) column of a file, or from the names of the blob files of a
+// satellite namespace directory.
+func readPieceIDs(path string) (ids []storj.PieceID, err error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+
+	if stat.IsDir() {
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || filepath.Ext(file) != ".sj1" {
+				return nil
+			}
+			// blobs are saved as <namespace>/<2 chars>/<rest of the encoded piece ID>.sj1, the namespaces of the
+			// different satellites shouldn't be mixed
+			rel, err := filepath.Rel(path, file)
+			if err != nil {
+				return err
+			}
+			if strings.Count(filepath.ToSlash(rel), "/") != 1 {
+				return errs.Errorf("unexpected blob file %s: the directory should be the blobs directory of one satellite namespace (blobs/<namespace>)", file)
+			}
+			key := filepath.Base(filepath.Dir(file)) + strings.TrimSuffix(entry.Name(), ".sj1")
+			raw, err := filestore.PathEncoding.DecodeString(key)
+			if err != nil {
+				return errs.Errorf("invalid blob file name %s: %v", file, err)
+			}
+			id, err := storj.PieceIDFromBytes(raw)
+			if err != nil {
+				return errs.Errorf("invalid blob file name %s: %v", file, err)
+			}
+			ids = append(ids, id)
+			return nil
+		})
+		return ids, errs.Wrap(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	column := 0
+	for i, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, ",")
+		if i == 0 && slices.Contains(parts, "piece_id") {
+			// header, like the output of derive-bulk
+			column = slices.Index(parts, "piece_id")
+			continue
+		}
+		if len(parts) <= column {
+			return nil, errs.Errorf("piece ID is missing from line %s", line)
+		}
+		id, err := storj.PieceIDFromString(parts[column])
+		if err != nil {
+			return nil, errs.Errorf("invalid piece ID in line %s: %v", line, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,250 @@
+package piece
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elek/stbb/pkg/util"
+	"github.com/zeebo/errs/v2"
+	"storj.io/common/identity"
+	"storj.io/common/pb"
+	"storj.io/common/rpc"
+	"storj.io/common/storj"
+)
+
+// ExistBatch checks the existence of many pieces on many nodes, with batched Exists requests.
+type ExistBatch struct {
+	Inputs      []string      `arg:"" help:"CSV files with 'nodeurl,pieceid' lines, or piece lists of one node (output of 'node piece-list') in the form of 'nodeurl=file'"`
+	Keys        string        `help:"identity directory of the satellite (Exists is allowed only for the satellite). Default is the embedded identity"`
+	BatchSize   int           `default:"1000" help:"number of piece IDs in one Exists request"`
+	Parallelism int           `default:"10" help:"number of nodes checked concurrently"`
+	Timeout     time.Duration `default:"1m" help:"timeout of one Exists request"`
+	Output      string        `default:"exists.csv" help:"result file with one line per piece (nodeid,pieceid,status,error)"`
+}
+
+// existTarget is the list of pieces to check on one node.
+type existTarget struct {
+	node   storj.NodeURL
+	pieces []storj.PieceID
+}
+
+const (
+	pieceFound   = "found"
+	pieceMissing = "missing"
+	pieceError   = "error"
+)
+
+func (e ExistBatch) Run() error {
+	ctx := context.Background()
+
+	targets, err := readExistTargets(e.Inputs)
+	if err != nil {
+		return err
+	}
+
+	var ident *identity.FullIdentity
+	if e.Keys == "" {
+		ident, err = identity.FullIdentityFromPEM(util.Certificate, util.Key)
+	} else {
+		ident, err = identity.Config{
+			CertPath: filepath.Join(e.Keys, "identity.cert"),
+			KeyPath:  filepath.Join(e.Keys, "identity.key"),
+		}.Load()
+	}
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	dialer, err := util.GetDialerForIdentity(ctx, ident, false, false)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	out, err := os.Create(e.Output)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	defer func() { _ = out.Close() }()
+	results := csv.NewWriter(out)
+	_ = results.Write([]string{"node_id", "piece_id", "status", "error"})
+
+	var mu sync.Mutex
+	summary := map[storj.NodeID]map[string]int{}
+	record := func(node storj.NodeID, pieces []storj.PieceID, status func(i int) string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if summary[node] == nil {
+			summary[node] = map[string]int{}
+		}
+		msg := ""
+		if err != nil {
+			msg = err.Error()
+		}
+		for i, piece := range pieces {
+			s := status(i)
+			summary[node][s]++
+			_ = results.Write([]string{node.String(), piece.String(), s, msg})
+		}
+	}
+
+	var wg sync.WaitGroup
+	limiter := make(chan struct{}, max(e.Parallelism, 1))
+	for _, target := range targets {
+		wg.Add(1)
+		limiter <- struct{}{}
+		go func() {
+			defer func() {
+				<-limiter
+				wg.Done()
+			}()
+			e.check(ctx, dialer, target, record)
+		}()
+	}
+	wg.Wait()
+
+	results.Flush()
+	if err := results.Error(); err != nil {
+		return errs.Wrap(err)
+	}
+
+	nodes := make([]storj.NodeID, 0, len(summary))
+	for node := range summary {
+		nodes = append(nodes, node)
+	}
+	rate := func(node storj.NodeID) float64 {
+		s := summary[node]
+		checked := s[pieceFound] + s[pieceMissing]
+		if checked == 0 {
+			return 0
+		}
+		return float64(s[pieceMissing]) / float64(checked)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return rate(nodes[i]) > rate(nodes[j])
+	})
+	fmt.Printf("%-52s %10s %10s %10s %8s\n", "node", "found", "missing", "error", "missing%")
+	for _, node := range nodes {
+		s := summary[node]
+		fmt.Printf("%-52s %10d %10d %10d %7.2f%%\n", node, s[pieceFound], s[pieceMissing], s[pieceError], rate(node)*100)
+	}
+	fmt.Println("Results are saved to", e.Output)
+	return nil
+}
+
+// check sends the pieces of one node in batches. Failed batches are recorded as errors, and the next batch is tried.
+func (e ExistBatch) check(ctx context.Context, dialer rpc.Dialer, target *existTarget, record func(node storj.NodeID, pieces []storj.PieceID, status func(i int) string, err error)) {
+	failed := func(pieces []storj.PieceID, err error) {
+		record(target.node.ID, pieces, func(i int) string { return pieceError }, err)
+	}
+
+	conn, err := dialer.DialNodeURL(ctx, target.node)
+	if err != nil {
+		failed(target.pieces, err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	client := pb.NewDRPCPiecestoreClient(conn)
+
+	batchSize := max(e.BatchSize, 1)
+	for start := 0; start < len(target.pieces); start += batchSize {
+		batch := target.pieces[start:min(start+batchSize, len(target.pieces))]
+		resp, err := func() (*pb.ExistsResponse, error) {
+			ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+			defer cancel()
+			return client.Exists(ctx, &pb.ExistsRequest{PieceIds: batch})
+		}()
+		if err != nil {
+			failed(batch, err)
+			continue
+		}
+		missing := map[int]bool{}
+		for _, ix := range resp.Missing {
+			missing[int(ix)] = true
+		}
+		record(target.node.ID, batch, func(i int) string {
+			if missing[i] {
+				return pieceMissing
+			}
+			return pieceFound
+		}, nil)
+	}
+}
+
+// readExistTargets reads the pieces to check, grouped by nodes.
+func readExistTargets(inputs []string) ([]*existTarget, error) {
+	var targets []*existTarget
+	byNode := map[storj.NodeID]*existTarget{}
+	add := func(node storj.NodeURL, piece storj.PieceID) {
+		target, found := byNode[node.ID]
+		if !found {
+			target = &existTarget{node: node}
+			byNode[node.ID] = target
+			targets = append(targets, target)
+		}
+		target.pieces = append(target.pieces, piece)
+	}
+
+	for _, input := range inputs {
+		var listNode *storj.NodeURL
+		path := input
+		if nodeURL, file, found := strings.Cut(input, "="); found {
+			node, err := storj.ParseNodeURL(nodeURL)
+			if err != nil {
+				return nil, errs.Wrap(err)
+			}
+			listNode, path = &node, file
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errs.Wrap(err)
+		}
+		for _, line := range strings.Split(string(raw), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			parts := strings.Split(line, ",")
+			if listNode != nil {
+				// piece list: streamID,position,rootPieceID,pieceNum,...
+				if len(parts) < 4 {
+					return nil, errs.Errorf("invalid line in the piece list %s: %s", path, line)
+				}
+				root, err := storj.PieceIDFromString(parts[2])
+				if err != nil {
+					return nil, errs.Errorf("invalid root piece ID in line %s: %v", line, err)
+				}
+				num, err := strconv.Atoi(parts[3])
+				if err != nil {
+					return nil, errs.Errorf("invalid piece number in line %s: %v", line, err)
+				}
+				add(*listNode, root.Derive(listNode.ID, int32(num)))
+				continue
+			}
+			if len(parts) < 2 {
+				return nil, errs.Errorf("invalid line in %s (nodeurl,pieceid is expected): %s", path, line)
+			}
+			if parts[0] == "node_url" || parts[0] == "nodeurl" {
+				// header
+				continue
+			}
+			node, err := storj.ParseNodeURL(parts[0])
+			if err != nil {
+				return nil, errs.Errorf("invalid node URL in line %s: %v", line, err)
+			}
+			piece, err := storj.PieceIDFromString(parts[1])
+			if err != nil {
+				return nil, errs.Errorf("invalid piece ID in line %s: %v", line, err)
+			}
+			add(node, piece)
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,84 @@
+package piece
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elek/stbb/pkg/util"
+	"github.com/stretchr/testify/require"
+	"storj.io/common/identity"
+	"storj.io/common/pb"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+	"storj.io/common/testrand"
+)
+
+func TestExistBatch(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	satellite, err := identity.FullIdentityFromPEM(util.Certificate, util.Key)
+	require.NoError(t, err)
+	node, address, _ := startNode(ctx, t)
+	nodeURL := storj.NodeURL{ID: node.ID, Address: address}
+	client := dialNode(ctx, t, satellite, nodeURL)
+
+	signer := util.NewKeySignerFromFullIdentity(satellite, pb.PieceAction_PUT)
+	upload := func(pieceID storj.PieceID) {
+		limit, pk, _, err := signer.CreateOrderLimit(ctx, pieceID, 1000, node.ID)
+		require.NoError(t, err)
+		_, err = client.UploadReader(ctx, limit, pk, bytes.NewReader(testrand.BytesInt(1000)))
+		require.NoError(t, err)
+	}
+
+	stored := []storj.PieceID{testrand.PieceID(), testrand.PieceID()}
+	for _, id := range stored {
+		upload(id)
+	}
+	root := testrand.PieceID()
+	upload(root.Derive(node.ID, 3))
+
+	dir := t.TempDir()
+	offline := storj.NodeURL{ID: testrand.NodeID(), Address: "127.0.0.1:1"}
+	pieces := fmt.Sprintf("nodeurl,pieceid\n%s,%s\n%s,%s\n%s,%s\n%s,%s\n",
+		nodeURL, stored[0],
+		nodeURL, testrand.PieceID(),
+		nodeURL, stored[1],
+		offline, stored[0])
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pieces.csv"), []byte(pieces), 0644))
+	list := fmt.Sprintf("%s,0,%s,3,1000,1000,0,0,29\n%s,0,%s,4,1000,1000,0,0,29\n", testrand.UUID(), root, testrand.UUID(), root)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "list.csv"), []byte(list), 0644))
+
+	output := filepath.Join(dir, "exists.csv")
+	require.NoError(t, ExistBatch{
+		Inputs:      []string{filepath.Join(dir, "pieces.csv"), nodeURL.String() + "=" + filepath.Join(dir, "list.csv")},
+		BatchSize:   2,
+		Parallelism: 2,
+		Timeout:     10 * time.Second,
+		Output:      output,
+	}.Run())
+
+	f, err := os.Open(output)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	records, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+
+	status := map[string]map[string]string{}
+	for _, r := range records[1:] {
+		if status[r[0]] == nil {
+			status[r[0]] = map[string]string{}
+		}
+		status[r[0]][r[1]] = r[2]
+	}
+	require.Len(t, status[node.ID.String()], 5)
+	require.Equal(t, pieceFound, status[node.ID.String()][stored[0].String()])
+	require.Equal(t, pieceFound, status[node.ID.String()][stored[1].String()])
+	require.Equal(t, pieceFound, status[node.ID.String()][root.Derive(node.ID, 3).String()])
+	require.Equal(t, pieceMissing, status[node.ID.String()][root.Derive(node.ID, 4).String()])
+	require.Equal(t, pieceError, status[offline.ID.String()][stored[0].String()])
+}
@@ -2,26 +2,28 @@ package piece
 
 import (
 	"github.com/spacemonkeygo/monkit/v3"
-	"github.com/spf13/cobra"
 )
 
 var mon = monkit.Package()
 
-var PieceCmd = &cobra.Command{
-	Use: "piece",
-}
-
 type Piece struct {
-	UploadDrpc   UploadDrpc         `cmd:"" help:"Upload piece to the Storagenode"`
-	DownloadDrpc DownloadDRPC       `cmd:"" help:"Download piece from the Storagenode"`
-	Nodes        Nodes              `cmd:"" help:"Print out piece locations with pieceID and node ID"`
-	NodeSpeed    NodeSpeed          `cmd:"" help:"Download one piece from all the nodes"`
-	DownloadPs   DownloadPieceStore `cmd:"" help:"Download piece from the Storagenode using piece store"`
-	Unalias      Unalias            `cmd:"" help:"Decode node aliases"`
-	Exist        Exist              `cmd:"" help:"check if piece id is on SN"`
-	Audit        Audit              `cmd:"" help:"audit pieces on node"`
-	Derive       Derive             `cmd:"" help:"derive piece id"`
-	Checksum     Checksum           `cmd:"" help:"check piece checksum"`
-	Orderlimit   Orderlimit         `cmd:"" help:"Parse orderlimit file"`
-	Hash         Hash               `cmd:"" help:"Parse piece hash file"`
+	UploadDrpc    UploadDrpc         `cmd:"" help:"Upload piece to the Storagenode"`
+	DownloadDrpc  DownloadDRPC       `cmd:"" help:"Download piece from the Storagenode"`
+	Nodes         Nodes              `cmd:"" help:"Print out piece locations with pieceID and node ID"`
+	NodeSpeed     NodeSpeed          `cmd:"" help:"Download one piece from all the nodes"`
+	SpeedSurvey   SpeedSurvey        `cmd:"" help:"Measure download speed of the nodes of a placement, grouped by country, ASN and tags"`
+	DownloadPs    DownloadPieceStore `cmd:"" help:"Download piece from the Storagenode using piece store"`
+	Unalias       Unalias            `cmd:"" help:"Decode node aliases"`
+	Exist         Exist              `cmd:"" help:"check if piece id is on SN"`
+	ExistBatch    ExistBatch         `cmd:"" help:"check if pieces are on SNs, with batched requests to many nodes"`
+	Audit         Audit              `cmd:"" help:"audit pieces on node"`
+	Derive        Derive             `cmd:"" help:"derive piece id"`
+	DeriveBulk    DeriveBulk         `cmd:"" help:"derive the piece IDs of all the pieces of a segment list"`
+	DeriveReverse DeriveReverse      `cmd:"" help:"find the segments of derived piece IDs stored on one node"`
+	Checksum      Checksum           `cmd:"" help:"check piece checksum"`
+	Orderlimit    Orderlimit         `cmd:"" help:"Parse orderlimit file"`
+	Hash          Hash               `cmd:"" help:"Parse piece hash file"`
+	Verify        Verify             `cmd:"" help:"Verify piece with the hash, order limit and signatures"`
+	Serve         Serve              `cmd:"" help:"Run a fake storagenode with a real piecestore endpoint"`
+	Proxy         Proxy              `cmd:"" help:"Run a piecestore proxy in front of a storagenode, which injects failures"`
 }
@@ -0,0 +1,339 @@
+package piece
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/elek/stbb/pkg/util"
+	"github.com/zeebo/errs/v2"
+	"go.uber.org/zap"
+	"storj.io/common/identity"
+	"storj.io/common/pb"
+	"storj.io/common/rpc"
+	"storj.io/common/storj"
+)
+
+// Proxy is a piecestore proxy in front of a real storage node, which injects failures.
+type Proxy struct {
+	Target       string   `arg:"" help:"address of the real storage node"`
+	Address      string   `default:"0.0.0.0:28968" help:"listen address of the proxy"`
+	Identity     string   `required:"" help:"identity directory of the storage node. The proxy terminates TLS with it, so the clients see the original node ID"`
+	DialIdentity string   `help:"identity directory used to connect to the storage node. Default is the embedded satellite identity, which makes the satellite only calls (retain, exists) work with the mock satellite"`
+	Rule         []string `sep:"none" help:"fault injection rule like 'action=GET|GET_REPAIR,prefix=AB,probability=0.5,latency=200ms,bandwidth=1MB,drop,drop-after=64KiB,truncate=1MB,corrupt'. The first matching rule is applied."`
+	Verbose      bool     `help:"log each proxied request"`
+}
+
+func (p Proxy) Run() error {
+	ctx := context.Background()
+
+	var log *zap.Logger
+	var err error
+	if p.Verbose {
+		log, err = zap.NewDevelopment()
+	} else {
+		log, err = zap.NewProduction()
+	}
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	node, err := identity.Config{
+		CertPath: filepath.Join(p.Identity, "identity.cert"),
+		KeyPath:  filepath.Join(p.Identity, "identity.key"),
+	}.Load()
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	var dialIdentity *identity.FullIdentity
+	if p.DialIdentity == "" {
+		dialIdentity, err = identity.FullIdentityFromPEM(util.Certificate, util.Key)
+	} else {
+		dialIdentity, err = identity.Config{
+			CertPath: filepath.Join(p.DialIdentity, "identity.cert"),
+			KeyPath:  filepath.Join(p.DialIdentity, "identity.key"),
+		}.Load()
+	}
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	dialer, err := util.GetDialerForIdentity(ctx, dialIdentity, true, false)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	var rules []*faultRule
+	for _, def := range p.Rule {
+		rule, err := parseFaultRule(def)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+
+	listener, err := net.Listen("tcp", p.Address)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	fmt.Printf("Proxying %s@%s to %s with %d rules\n", node.ID, listener.Addr(), p.Target, len(rules))
+	return serve(ctx, listener, node, &proxyEndpoint{
+		log:    log,
+		dialer: dialer,
+		target: storj.NodeURL{ID: node.ID, Address: p.Target},
+		rules:  rules,
+	})
+}
+
+// proxyEndpoint forwards all the piecestore requests to the target node, and injects the failures of the first matching rule.
+type proxyEndpoint struct {
+	log    *zap.Logger
+	dialer rpc.Dialer
+	target storj.NodeURL
+	rules  []*faultRule
+}
+
+var _ pb.DRPCPiecestoreServer = &proxyEndpoint{}
+
+// faults selects the rule for the request, and applies the latency and the connection drop.
+func (p *proxyEndpoint) faults(ctx context.Context, method string, limit *pb.OrderLimit) (*faultState, error) {
+	for _, rule := range p.rules {
+		if !rule.matches(limit) {
+			continue
+		}
+		if rule.probability < 1 && rand.Float64() >= rule.probability {
+			continue
+		}
+		fields := []zap.Field{zap.String("method", method), zap.String("rule", rule.raw)}
+		if limit != nil {
+			fields = append(fields, zap.Stringer("piece", limit.PieceId), zap.Stringer("action", limit.Action))
+		}
+		p.log.Info("injecting fault", fields...)
+		if err := sleep(ctx, rule.latency); err != nil {
+			return nil, err
+		}
+		if rule.drop {
+			return nil, dropConnection(ctx)
+		}
+		return &faultState{rule: rule, start: time.Now()}, nil
+	}
+	p.log.Debug("forwarding", zap.String("method", method))
+	return nil, nil
+}
+
+func (p *proxyEndpoint) connect(ctx context.Context) (*rpc.Conn, pb.DRPCPiecestoreClient, error) {
+	conn, err := p.dialer.DialNodeURL(ctx, p.target)
+	if err != nil {
+		return nil, nil, errs.Wrap(err)
+	}
+	return conn, pb.NewDRPCPiecestoreClient(conn), nil
+}
+
+func (p *proxyEndpoint) Upload(stream pb.DRPCPiecestore_UploadStream) error {
+	ctx := stream.Context()
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	fault, err := p.faults(ctx, "upload", req.Limit)
+	if err != nil {
+		return err
+	}
+	conn, client, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	upstream, err := client.Upload(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		if req.Chunk != nil {
+			req.Chunk.Data, _, err = fault.chunk(ctx, req.Chunk.Data, false)
+			if err != nil {
+				return err
+			}
+		}
+		// error of the node is returned by CloseAndRecv
+		if err := upstream.Send(req); err != nil {
+			break
+		}
+		req, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			_ = upstream.Close()
+			return err
+		}
+	}
+	resp, err := upstream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp)
+}
+
+func (p *proxyEndpoint) Download(stream pb.DRPCPiecestore_DownloadStream) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	fault, err := p.faults(ctx, "download", req.Limit)
+	if err != nil {
+		return err
+	}
+	conn, client, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	upstream, err := client.Download(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = upstream.Close() }()
+	if err := upstream.Send(req); err != nil {
+		return err
+	}
+
+	// orders are sent by the uplink during the download
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				_ = upstream.CloseSend()
+				return
+			}
+			if err := upstream.Send(req); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		resp, err := upstream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stop := false
+		if resp.Chunk != nil {
+			resp.Chunk.Data, stop, err = fault.chunk(ctx, resp.Chunk.Data, true)
+			if err != nil {
+				return err
+			}
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+		if stop {
+			p.log.Info("download is truncated", zap.Stringer("piece", req.Limit.PieceId), zap.Int64("transferred", fault.transferred))
+			return nil
+		}
+	}
+}
+
+func (p *proxyEndpoint) RetainBig(stream pb.DRPCPiecestore_RetainBigStream) error {
+	ctx := stream.Context()
+	if _, err := p.faults(ctx, "retain-big", nil); err != nil {
+		return err
+	}
+	conn, client, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	upstream, err := client.RetainBig(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			_ = upstream.Close()
+			return err
+		}
+		if err := upstream.Send(req); err != nil {
+			break
+		}
+	}
+	resp, err := upstream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp)
+}
+
+func (p *proxyEndpoint) Delete(ctx context.Context, req *pb.PieceDeleteRequest) (*pb.PieceDeleteResponse, error) {
+	if _, err := p.faults(ctx, "delete", req.Limit); err != nil {
+		return nil, err
+	}
+	conn, client, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	return client.Delete(ctx, req)
+}
+
+func (p *proxyEndpoint) DeletePieces(ctx context.Context, req *pb.DeletePiecesRequest) (*pb.DeletePiecesResponse, error) {
+	if _, err := p.faults(ctx, "delete-pieces", nil); err != nil {
+		return nil, err
+	}
+	conn, client, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	return client.DeletePieces(ctx, req)
+}
+
+func (p *proxyEndpoint) Retain(ctx context.Context, req *pb.RetainRequest) (*pb.RetainResponse, error) {
+	if _, err := p.faults(ctx, "retain", nil); err != nil {
+		return nil, err
+	}
+	conn, client, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	return client.Retain(ctx, req)
+}
+
+func (p *proxyEndpoint) RestoreTrash(ctx context.Context, req *pb.RestoreTrashRequest) (*pb.RestoreTrashResponse, error) {
+	if _, err := p.faults(ctx, "restore-trash", nil); err != nil {
+		return nil, err
+	}
+	conn, client, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	return client.RestoreTrash(ctx, req)
+}
+
+func (p *proxyEndpoint) Exists(ctx context.Context, req *pb.ExistsRequest) (*pb.ExistsResponse, error) {
+	if _, err := p.faults(ctx, "exists", nil); err != nil {
+		return nil, err
+	}
+	conn, client, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	return client.Exists(ctx, req)
+}
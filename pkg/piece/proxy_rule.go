@@ -0,0 +1,157 @@
+package piece
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs/v2"
+	"storj.io/common/memory"
+	"storj.io/common/pb"
+	"storj.io/common/rpc/rpcstatus"
+	"storj.io/drpc/drpcctx"
+)
+
+// faultRule describes the failures injected by the proxy for the matching requests.
+type faultRule struct {
+	raw string
+
+	// actions of the order limit (any if empty).
+	actions []pb.PieceAction
+	// prefix of the piece ID (any if empty).
+	prefix string
+	// probability of applying the rule for a matching request.
+	probability float64
+
+	latency   time.Duration
+	bandwidth memory.Size
+	drop      bool
+	dropAfter memory.Size
+	truncate  memory.Size
+	corrupt   bool
+}
+
+// parseFaultRule parses rule definitions like 'action=GET|GET_REPAIR,prefix=AB,probability=0.5,latency=200ms,corrupt'.
+func parseFaultRule(def string) (*faultRule, error) {
+	r := &faultRule{
+		raw:         def,
+		probability: 1,
+	}
+	for _, part := range strings.Split(def, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		var err error
+		switch key {
+		case "action":
+			for _, name := range strings.Split(value, "|") {
+				action, found := pb.PieceAction_value[strings.ToUpper(name)]
+				if !found {
+					return nil, errs.Errorf("unknown action %q in rule %q", name, def)
+				}
+				r.actions = append(r.actions, pb.PieceAction(action))
+			}
+		case "prefix":
+			r.prefix = strings.ToUpper(value)
+		case "probability":
+			r.probability, err = strconv.ParseFloat(value, 64)
+		case "latency":
+			r.latency, err = time.ParseDuration(value)
+		case "bandwidth":
+			err = r.bandwidth.Set(value)
+		case "drop":
+			r.drop = true
+		case "drop-after":
+			err = r.dropAfter.Set(value)
+		case "truncate":
+			err = r.truncate.Set(value)
+		case "corrupt":
+			r.corrupt = true
+		default:
+			return nil, errs.Errorf("unknown key %q in rule %q", key, def)
+		}
+		if err != nil {
+			return nil, errs.Errorf("invalid %s in rule %q: %v", key, def, err)
+		}
+	}
+	return r, nil
+}
+
+// matches checks the action and piece ID of the order limit. Requests without order limit (exists, retain, ...)
+// are matched only by the rules without action and prefix.
+func (r *faultRule) matches(limit *pb.OrderLimit) bool {
+	if limit == nil {
+		return len(r.actions) == 0 && r.prefix == ""
+	}
+	if len(r.actions) > 0 {
+		found := false
+		for _, action := range r.actions {
+			if action == limit.Action {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return strings.HasPrefix(limit.PieceId.String(), r.prefix)
+}
+
+// faultState tracks the transferred data of one proxied request. nil state forwards everything unchanged.
+type faultState struct {
+	rule        *faultRule
+	start       time.Time
+	transferred int64
+}
+
+// chunk applies the bandwidth limit and the data faults to the next chunk. Truncation is applied only to downloads,
+// stop is true when the rest of the stream should be cut.
+func (f *faultState) chunk(ctx context.Context, data []byte, download bool) (_ []byte, stop bool, err error) {
+	if f == nil {
+		return data, false, nil
+	}
+	r := f.rule
+	if download && r.truncate > 0 && f.transferred+int64(len(data)) >= r.truncate.Int64() {
+		data = data[:r.truncate.Int64()-f.transferred]
+		stop = true
+	}
+	if r.corrupt && len(data) > 0 {
+		corrupted := make([]byte, len(data))
+		copy(corrupted, data)
+		corrupted[rand.Intn(len(corrupted))] ^= 0xff
+		data = corrupted
+	}
+	f.transferred += int64(len(data))
+	if r.bandwidth > 0 {
+		due := f.start.Add(time.Duration(float64(f.transferred) / r.bandwidth.Float64() * float64(time.Second)))
+		if err := sleep(ctx, time.Until(due)); err != nil {
+			return nil, false, err
+		}
+	}
+	if r.dropAfter > 0 && f.transferred >= r.dropAfter.Int64() {
+		return nil, false, dropConnection(ctx)
+	}
+	return data, stop, nil
+}
+
+// dropConnection closes the underlying connection of the request, without sending back any response.
+func dropConnection(ctx context.Context) error {
+	if tr, ok := drpcctx.Transport(ctx); ok {
+		_ = tr.Close()
+	}
+	return rpcstatus.Error(rpcstatus.Unavailable, "connection is dropped by the proxy")
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
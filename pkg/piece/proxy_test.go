@@ -0,0 +1,113 @@
+package piece
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/elek/stbb/pkg/util"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs/v2"
+	"go.uber.org/zap"
+	"storj.io/common/identity"
+	"storj.io/common/memory"
+	"storj.io/common/pb"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+	"storj.io/common/testrand"
+)
+
+func TestParseFaultRule(t *testing.T) {
+	rule, err := parseFaultRule("action=GET|get_repair,prefix=aa,probability=0.5,latency=200ms,bandwidth=1MB,drop-after=64KiB,corrupt")
+	require.NoError(t, err)
+	require.Equal(t, []pb.PieceAction{pb.PieceAction_GET, pb.PieceAction_GET_REPAIR}, rule.actions)
+	require.Equal(t, "AA", rule.prefix)
+	require.Equal(t, 0.5, rule.probability)
+	require.Equal(t, 200*time.Millisecond, rule.latency)
+	require.Equal(t, memory.MB, rule.bandwidth)
+	require.Equal(t, 64*memory.KiB, rule.dropAfter)
+	require.True(t, rule.corrupt)
+	require.False(t, rule.drop)
+
+	require.True(t, rule.matches(&pb.OrderLimit{Action: pb.PieceAction_GET_REPAIR, PieceId: storj.PieceID{0}}))
+	require.False(t, rule.matches(&pb.OrderLimit{Action: pb.PieceAction_PUT, PieceId: storj.PieceID{0}}))
+	require.False(t, rule.matches(&pb.OrderLimit{Action: pb.PieceAction_GET, PieceId: storj.PieceID{0xff}}))
+	require.False(t, rule.matches(nil))
+
+	_, err = parseFaultRule("action=FOO")
+	require.Error(t, err)
+	_, err = parseFaultRule("latency=fast")
+	require.Error(t, err)
+}
+
+func TestProxy(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	satellite, err := identity.FullIdentityFromPEM(util.Certificate, util.Key)
+	require.NoError(t, err)
+	node, address, _ := startNode(ctx, t)
+	dialer, err := util.GetDialerForIdentity(ctx, satellite, false, false)
+	require.NoError(t, err)
+
+	proxy := func(rules ...string) *proxyEndpoint {
+		p := &proxyEndpoint{
+			log:    zap.NewNop(),
+			dialer: dialer,
+			target: storj.NodeURL{ID: node.ID, Address: address},
+		}
+		for _, def := range rules {
+			rule, err := parseFaultRule(def)
+			require.NoError(t, err)
+			p.rules = append(p.rules, rule)
+		}
+		return p
+	}
+
+	data := testrand.BytesInt(300_000)
+	pieceID := testrand.PieceID()
+	signer := util.NewKeySignerFromFullIdentity(satellite, pb.PieceAction_PUT)
+
+	// upload is forwarded, the client sees the node ID of the real node
+	limit, pk, _, err := signer.CreateOrderLimit(ctx, pieceID, int64(len(data)), node.ID)
+	require.NoError(t, err)
+	client := dialNode(ctx, t, satellite, storj.NodeURL{ID: node.ID, Address: startServer(ctx, t, node, proxy())})
+	_, err = client.UploadReader(ctx, limit, pk, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	download := func(rules ...string) ([]byte, error) {
+		signer.Action = pb.PieceAction_GET
+		limit, pk, _, err := signer.CreateOrderLimit(ctx, pieceID, int64(len(data)), node.ID)
+		require.NoError(t, err)
+		client := dialNode(ctx, t, satellite, storj.NodeURL{ID: node.ID, Address: startServer(ctx, t, node, proxy(rules...))})
+		d, err := client.Download(ctx, limit, pk, 0, int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		downloaded, err := io.ReadAll(d)
+		return downloaded, errs.Combine(err, d.Close())
+	}
+
+	downloaded, err := download()
+	require.NoError(t, err)
+	require.Equal(t, data, downloaded)
+
+	// rule of other action is ignored
+	downloaded, err = download("action=PUT,corrupt")
+	require.NoError(t, err)
+	require.Equal(t, data, downloaded)
+
+	downloaded, err = download("action=GET,corrupt")
+	require.NoError(t, err)
+	require.Len(t, downloaded, len(data))
+	require.NotEqual(t, data, downloaded)
+
+	_, err = download("truncate=100KiB")
+	require.Error(t, err)
+
+	_, err = download("drop")
+	require.Error(t, err)
+
+	_, err = download("drop-after=100KiB")
+	require.Error(t, err)
+}
@@ -3,62 +3,125 @@ package piece
 import (
 	"context"
 	"crypto/tls"
-	_ "embed"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
 	"github.com/elek/stbb/pkg/util"
-	"github.com/spf13/cobra"
 	"github.com/zeebo/errs/v2"
-	"net"
+	"go.uber.org/zap"
 	"storj.io/common/experiment"
 	"storj.io/common/identity"
 	"storj.io/common/pb"
 	"storj.io/common/peertls/tlsopts"
 	"storj.io/common/rpc"
 	"storj.io/common/rpc/rpctracing"
+	"storj.io/drpc/drpcctx"
 	"storj.io/drpc/drpcmigrate"
 	"storj.io/drpc/drpcmux"
 	"storj.io/drpc/drpcserver"
 	jaeger "storj.io/monkit-jaeger"
 )
 
-func init() {
-	cmd := &cobra.Command{
-		Use: "serve",
-	}
-	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		return serve()
-	}
-	PieceCmd.AddCommand(cmd)
+// Serve runs a fake storage node with a real piecestore endpoint.
+type Serve struct {
+	Address   string `default:"0.0.0.0:28967" help:"listen address of the piecestore endpoint"`
+	Identity  string `help:"identity directory of the storage node (generated if missing). Default is a new identity for each run"`
+	Satellite string `help:"identity directory (or identity.cert) of the trusted satellite. Default is the embedded identity, used by the mock satellite and the order limit signers"`
+	Backend   string `default:"memory" enum:"memory,filestore,badger,hashstore" help:"blob backend to store the pieces (memory,filestore,badger,hashstore)"`
+	Dir       string `help:"directory of the pieces (required for filestore, badger and hashstore)"`
+	Verbose   bool   `help:"log each upload and download"`
 }
 
-func serve() error {
+func (s Serve) Run() error {
 	ctx := context.Background()
 
-	ident, err := identity.FullIdentityFromPEM(util.Certificate, util.Key)
-	fmt.Println("Starting ", ident.ID.String()+"@localhost:28567")
+	var log *zap.Logger
+	var err error
+	if s.Verbose {
+		log, err = zap.NewDevelopment()
+	} else {
+		log, err = zap.NewProduction()
+	}
 	if err != nil {
 		return errs.Wrap(err)
 	}
 
-	tlsConfig := tlsopts.Config{
-		UsePeerCAWhitelist: false,
-		PeerIDVersions:     "0",
+	var ident *identity.FullIdentity
+	if s.Identity == "" {
+		ident, err = identity.NewFullIdentity(ctx, identity.NewCAOptions{
+			Difficulty:  0,
+			Concurrency: 1,
+		})
+	} else {
+		ident, err = util.LoadOrCreateIdentity(ctx, s.Identity)
 	}
-	tlsOptions, err := tlsopts.NewOptions(ident, tlsConfig, nil)
 	if err != nil {
 		return errs.Wrap(err)
 	}
+	satellite, err := trustedSatellite(s.Satellite)
+	if err != nil {
+		return err
+	}
+
+	backend, err := openBackend(ctx, log, s.Backend, s.Dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = backend.Close() }()
+
+	listener, err := net.Listen("tcp", s.Address)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	fmt.Printf("Starting %s@%s (%s backend, trusted satellite %s)\n", ident.ID, listener.Addr(), s.Backend, satellite.ID)
+	return serve(ctx, listener, ident, &pieceStore{
+		log:       log,
+		identity:  ident,
+		satellite: satellite,
+		backend:   backend,
+	})
+}
 
-	listenConfig := net.ListenConfig{}
+// trustedSatellite loads the satellite identity from an identity directory or identity.cert file.
+// Default is the embedded identity.
+func trustedSatellite(path string) (*identity.PeerIdentity, error) {
+	if path == "" {
+		peer, err := identity.PeerIdentityFromPEM(util.Certificate)
+		return peer, errs.Wrap(err)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "identity.cert")
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	peer, err := identity.PeerIdentityFromPEM(raw)
+	return peer, errs.Wrap(err)
+}
 
-	publicTCPListener, err := listenConfig.Listen(ctx, "tcp", "0.0.0.0:28967")
+// serve runs the piecestore endpoint on the listener with the given node identity, until the context is canceled.
+// The connection of each request is available with drpcctx.Transport.
+func serve(ctx context.Context, listener net.Listener, ident *identity.FullIdentity, endpoint pb.DRPCPiecestoreServer) error {
+	tlsConfig := tlsopts.Config{
+		UsePeerCAWhitelist: false,
+		PeerIDVersions:     "0",
+	}
+	tlsOptions, err := tlsopts.NewOptions(ident, tlsConfig, nil)
 	if err != nil {
 		return errs.Wrap(err)
 	}
-	publicLMux := drpcmigrate.NewListenMux(publicTCPListener, len(drpcmigrate.DRPCHeader))
-	publicTLSDRPCListener := tls.NewListener(publicLMux.Route(drpcmigrate.DRPCHeader), tlsOptions.ServerTLSConfig())
 
-	go publicLMux.Run(ctx)
+	lmux := drpcmigrate.NewListenMux(listener, len(drpcmigrate.DRPCHeader))
+	tlsListener := tls.NewListener(lmux.Route(drpcmigrate.DRPCHeader), tlsOptions.ServerTLSConfig())
+	go func() { _ = lmux.Run(ctx) }()
+	go func() {
+		<-ctx.Done()
+		_ = tlsListener.Close()
+	}()
 
 	mux := drpcmux.New()
 	srv := drpcserver.NewWithOptions(
@@ -71,88 +134,24 @@ func serve() error {
 			Manager: rpc.NewDefaultManagerOptions(),
 		},
 	)
-
-	if err := pb.DRPCRegisterPiecestore(mux, &pieceStore{}); err != nil {
+	if err := pb.DRPCRegisterPiecestore(mux, endpoint); err != nil {
 		return errs.Wrap(err)
 	}
-	err = srv.Serve(ctx, publicTLSDRPCListener)
-	if err != nil {
-		fmt.Println(err)
-	}
-	return nil
-
-}
-
-type pieceStore struct {
-}
-
-func (p *pieceStore) RetainBig(stream pb.DRPCPiecestore_RetainBigStream) error {
-	return nil
-}
 
-func (p *pieceStore) Upload(stream pb.DRPCPiecestore_UploadStream) error {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (p *pieceStore) Download(stream pb.DRPCPiecestore_DownloadStream) error {
-	recv, err := stream.Recv()
-	if err != nil {
-		return errs.Wrap(err)
-	}
-	limit := recv.Limit
-	fmt.Println("limit", limit.Limit)
-	offset := int64(0)
+	var wg sync.WaitGroup
+	defer wg.Wait()
 	for {
-		recv, err = stream.Recv()
+		conn, err := tlsListener.Accept()
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
 			return errs.Wrap(err)
 		}
-
-		out := make([]byte, recv.Order.Amount)
-		err = stream.Send(&pb.PieceDownloadResponse{
-			Chunk: &pb.PieceDownloadResponse_Chunk{
-				Offset: offset,
-				Data:   out,
-			},
-			Hash: &pb.PieceHash{},
-		})
-		if err != nil {
-			return errs.Wrap(err)
-		}
-		fmt.Println("order fulfilled", recv.Order.Amount)
-		offset += recv.Order.Amount
-		if offset == limit.Limit {
-			break
-		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = srv.ServeOne(drpcctx.WithTransport(ctx, conn), conn)
+		}()
 	}
-
-	return nil
-}
-
-func (p *pieceStore) Delete(ctx context.Context, request *pb.PieceDeleteRequest) (*pb.PieceDeleteResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (p *pieceStore) DeletePieces(ctx context.Context, request *pb.DeletePiecesRequest) (*pb.DeletePiecesResponse, error) {
-	//TODO implement me
-	panic("implement me")
 }
-
-func (p *pieceStore) Retain(ctx context.Context, request *pb.RetainRequest) (*pb.RetainResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (p *pieceStore) RestoreTrash(ctx context.Context, request *pb.RestoreTrashRequest) (*pb.RestoreTrashResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (p *pieceStore) Exists(ctx context.Context, request *pb.ExistsRequest) (*pb.ExistsResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
-
-var _ pb.DRPCPiecestoreServer = &pieceStore{}
@@ -0,0 +1,281 @@
+package piece
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/elek/stbb/pkg/badger"
+	"github.com/zeebo/errs/v2"
+	"go.uber.org/zap"
+	"storj.io/common/pb"
+	"storj.io/common/storj"
+	"storj.io/storj/storagenode/blobstore"
+	"storj.io/storj/storagenode/blobstore/filestore"
+	"storj.io/storj/storagenode/hashstore"
+	"storj.io/storj/storagenode/piecestore"
+)
+
+// headerSize is the reserved space for the piece header, same as the storagenode (filestore.FormatV1).
+const headerSize = 512
+
+// errUnsupported is returned by backends which can't list or delete the pieces.
+var errUnsupported = errs.Tag("not supported by the backend")
+
+// pieceBackend stores the pieces (data with the header) of the fake storage node.
+type pieceBackend interface {
+	Write(ctx context.Context, satellite storj.NodeID, header *pb.PieceHeader, data []byte) error
+	// Read returns an error wrapping fs.ErrNotExist if the piece is missing.
+	Read(ctx context.Context, satellite storj.NodeID, pieceID storj.PieceID) (*pb.PieceHeader, []byte, error)
+	Delete(ctx context.Context, satellite storj.NodeID, pieceID storj.PieceID) error
+	// Walk iterates over the pieces of the satellite with their creation time.
+	Walk(ctx context.Context, satellite storj.NodeID, fn func(pieceID storj.PieceID, created time.Time) error) error
+	Close() error
+}
+
+// openBackend opens one of the memory, filestore, badger or hashstore backends.
+func openBackend(ctx context.Context, log *zap.Logger, kind string, dir string) (pieceBackend, error) {
+	if kind == "memory" {
+		return newMemoryBackend(), nil
+	}
+	if dir == "" {
+		return nil, errs.Errorf("directory is required for the %s backend", kind)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	switch kind {
+	case "filestore":
+		piecesDir, err := filestore.OpenDir(log, dir, time.Now())
+		if err != nil {
+			return nil, errs.Wrap(err)
+		}
+		return &blobBackend{blobs: filestore.New(log, piecesDir, filestore.DefaultConfig)}, nil
+	case "badger":
+		blobs, err := badger.NewBlobStore(dir)
+		if err != nil {
+			return nil, errs.Wrap(err)
+		}
+		return &blobBackend{blobs: blobs}, nil
+	case "hashstore":
+		hsb, err := piecestore.NewHashStoreBackend(ctx, hashstore.CreateDefaultConfig(0, false), filepath.Join(dir, "hashstore"), "", nil, nil, log, nil)
+		if err != nil {
+			return nil, errs.Wrap(err)
+		}
+		return &hashstoreBackend{hsb: hsb}, nil
+	}
+	return nil, errs.Errorf("unknown backend: %s", kind)
+}
+
+// encodePiece prepends the length prefixed, padded header to the data.
+func encodePiece(header *pb.PieceHeader, data []byte) ([]byte, error) {
+	raw, err := pb.Marshal(header)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	if len(raw) > headerSize-2 {
+		return nil, errs.Errorf("piece header is too large: %d", len(raw))
+	}
+	res := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint16(res[0:2], uint16(len(raw)))
+	copy(res[2:], raw)
+	copy(res[headerSize:], data)
+	return res, nil
+}
+
+func decodePiece(raw []byte) (*pb.PieceHeader, []byte, error) {
+	if len(raw) < headerSize {
+		return nil, nil, errs.Errorf("piece is shorter than the header: %d", len(raw))
+	}
+	size := int(binary.BigEndian.Uint16(raw[0:2]))
+	if size > headerSize-2 {
+		return nil, nil, errs.Errorf("invalid header size: %d", size)
+	}
+	header := &pb.PieceHeader{}
+	if err := pb.Unmarshal(raw[2:2+size], header); err != nil {
+		return nil, nil, errs.Wrap(err)
+	}
+	return header, raw[headerSize:], nil
+}
+
+type storedPiece struct {
+	header *pb.PieceHeader
+	data   []byte
+}
+
+// memoryBackend keeps all the pieces in memory.
+type memoryBackend struct {
+	mu     sync.Mutex
+	pieces map[storj.NodeID]map[storj.PieceID]storedPiece
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{
+		pieces: map[storj.NodeID]map[storj.PieceID]storedPiece{},
+	}
+}
+
+func (m *memoryBackend) Write(ctx context.Context, satellite storj.NodeID, header *pb.PieceHeader, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pieces[satellite] == nil {
+		m.pieces[satellite] = map[storj.PieceID]storedPiece{}
+	}
+	m.pieces[satellite][header.OrderLimit.PieceId] = storedPiece{header: header, data: data}
+	return nil
+}
+
+func (m *memoryBackend) Read(ctx context.Context, satellite storj.NodeID, pieceID storj.PieceID) (*pb.PieceHeader, []byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, found := m.pieces[satellite][pieceID]
+	if !found {
+		return nil, nil, errs.Wrap(fs.ErrNotExist)
+	}
+	return p.header, p.data, nil
+}
+
+func (m *memoryBackend) Delete(ctx context.Context, satellite storj.NodeID, pieceID storj.PieceID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pieces[satellite], pieceID)
+	return nil
+}
+
+func (m *memoryBackend) Walk(ctx context.Context, satellite storj.NodeID, fn func(pieceID storj.PieceID, created time.Time) error) error {
+	m.mu.Lock()
+	pieces := map[storj.PieceID]time.Time{}
+	for id, p := range m.pieces[satellite] {
+		pieces[id] = p.header.CreationTime
+	}
+	m.mu.Unlock()
+	for id, created := range pieces {
+		if err := fn(id, created); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryBackend) Close() error {
+	return nil
+}
+
+// blobBackend stores the pieces in the storagenode format (header + data) in a blob store (filestore or badger).
+type blobBackend struct {
+	blobs blobstore.Blobs
+}
+
+func (b *blobBackend) Write(ctx context.Context, satellite storj.NodeID, header *pb.PieceHeader, data []byte) error {
+	raw, err := encodePiece(header, data)
+	if err != nil {
+		return err
+	}
+	w, err := b.blobs.Create(ctx, blobstore.BlobRef{
+		Namespace: satellite.Bytes(),
+		Key:       header.OrderLimit.PieceId.Bytes(),
+	})
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	if _, err := w.Write(raw); err != nil {
+		return errs.Combine(errs.Wrap(err), w.Cancel(ctx))
+	}
+	return errs.Wrap(w.Commit(ctx))
+}
+
+func (b *blobBackend) Read(ctx context.Context, satellite storj.NodeID, pieceID storj.PieceID) (*pb.PieceHeader, []byte, error) {
+	r, err := b.blobs.Open(ctx, blobstore.BlobRef{
+		Namespace: satellite.Bytes(),
+		Key:       pieceID.Bytes(),
+	})
+	if err != nil {
+		return nil, nil, errs.Wrap(err)
+	}
+	defer func() { _ = r.Close() }()
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, errs.Wrap(err)
+	}
+	return decodePiece(raw)
+}
+
+func (b *blobBackend) Delete(ctx context.Context, satellite storj.NodeID, pieceID storj.PieceID) error {
+	return errs.Wrap(b.blobs.Delete(ctx, blobstore.BlobRef{
+		Namespace: satellite.Bytes(),
+		Key:       pieceID.Bytes(),
+	}))
+}
+
+func (b *blobBackend) Walk(ctx context.Context, satellite storj.NodeID, fn func(pieceID storj.PieceID, created time.Time) error) error {
+	return errs.Wrap(b.blobs.WalkNamespace(ctx, satellite.Bytes(), nil, func(info blobstore.BlobInfo) error {
+		pieceID, err := storj.PieceIDFromBytes(info.BlobRef().Key)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		header, _, err := b.Read(ctx, satellite, pieceID)
+		if err != nil {
+			return err
+		}
+		return fn(pieceID, header.CreationTime)
+	}))
+}
+
+func (b *blobBackend) Close() error {
+	return errs.Wrap(b.blobs.Close())
+}
+
+// hashstoreBackend uses the hashstore of the storagenode. Pieces are deleted only by the compaction of the hashstore.
+type hashstoreBackend struct {
+	hsb *piecestore.HashStoreBackend
+}
+
+func (h *hashstoreBackend) Write(ctx context.Context, satellite storj.NodeID, header *pb.PieceHeader, data []byte) error {
+	w, err := h.hsb.Writer(ctx, satellite, header.OrderLimit.PieceId, header.HashAlgorithm, header.OrderLimit.PieceExpiration)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return errs.Combine(errs.Wrap(err), w.Cancel(ctx))
+	}
+	return errs.Wrap(w.Commit(ctx, header))
+}
+
+func (h *hashstoreBackend) Read(ctx context.Context, satellite storj.NodeID, pieceID storj.PieceID) (*pb.PieceHeader, []byte, error) {
+	r, err := h.hsb.Reader(ctx, satellite, pieceID)
+	if err != nil {
+		return nil, nil, errs.Wrap(err)
+	}
+	defer func() { _ = r.Close() }()
+	header, err := r.GetPieceHeader()
+	if err != nil {
+		return nil, nil, errs.Wrap(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, errs.Wrap(err)
+	}
+	return header, data, nil
+}
+
+func (h *hashstoreBackend) Delete(ctx context.Context, satellite storj.NodeID, pieceID storj.PieceID) error {
+	return errUnsupported.Errorf("hashstore pieces are deleted by compaction")
+}
+
+func (h *hashstoreBackend) Walk(ctx context.Context, satellite storj.NodeID, fn func(pieceID storj.PieceID, created time.Time) error) error {
+	return errUnsupported.Errorf("hashstore pieces are collected by compaction")
+}
+
+func (h *hashstoreBackend) Close() error {
+	return errs.Wrap(h.hsb.Close())
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,347 @@
+package piece
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	"storj.io/common/bloomfilter"
+	"storj.io/common/identity"
+	"storj.io/common/pb"
+	"storj.io/common/rpc/rpcstatus"
+	"storj.io/common/signing"
+	"storj.io/common/storj"
+	"storj.io/uplink/private/piecestore"
+)
+
+// downloadChunkSize is the maximum size of one download response message.
+const downloadChunkSize = 256 * 1024
+
+// pieceStore is a piecestore endpoint which accepts the order limits of one trusted satellite.
+type pieceStore struct {
+	pb.DRPCPiecestoreUnimplementedServer
+
+	log       *zap.Logger
+	identity  *identity.FullIdentity
+	satellite *identity.PeerIdentity
+	backend   pieceBackend
+}
+
+func (p *pieceStore) Upload(stream pb.DRPCPiecestore_UploadStream) error {
+	ctx := stream.Context()
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	limit := req.Limit
+	if err := p.verifyLimit(ctx, limit, pb.PieceAction_PUT, pb.PieceAction_PUT_REPAIR); err != nil {
+		return err
+	}
+	hashAlgorithm := req.HashAlgorithm
+
+	var data []byte
+	var paid int64
+	for {
+		if req.Order != nil {
+			if err := p.verifyOrder(ctx, limit, req.Order); err != nil {
+				return err
+			}
+			paid = max(paid, req.Order.Amount)
+		}
+		if req.Chunk != nil {
+			if req.Chunk.Offset != int64(len(data)) {
+				return rpcstatus.Errorf(rpcstatus.InvalidArgument, "chunk offset %d doesn't match the received data %d", req.Chunk.Offset, len(data))
+			}
+			data = append(data, req.Chunk.Data...)
+			if int64(len(data)) > paid {
+				return rpcstatus.Errorf(rpcstatus.InvalidArgument, "received %d bytes, but only %d is paid", len(data), paid)
+			}
+		}
+		if req.Done != nil {
+			break
+		}
+		req, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return rpcstatus.Error(rpcstatus.Canceled, "upload is not committed")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	done := req.Done
+	if err := signing.VerifyUplinkPieceHashSignature(ctx, limit.UplinkPublicKey, done); err != nil {
+		return rpcstatus.Error(rpcstatus.Unauthenticated, err.Error())
+	}
+	if done.PieceId != limit.PieceId {
+		return rpcstatus.Errorf(rpcstatus.InvalidArgument, "piece ID of the uplink hash (%s) doesn't match the order limit (%s)", done.PieceId, limit.PieceId)
+	}
+	hasher := pb.NewHashFromAlgorithm(hashAlgorithm)
+	_, _ = hasher.Write(data)
+	calculated := hasher.Sum(nil)
+	if !bytes.Equal(calculated, done.Hash) {
+		return rpcstatus.Error(rpcstatus.InvalidArgument, "hash of the received data doesn't match the uplink hash")
+	}
+
+	header := &pb.PieceHeader{
+		Hash:          done.Hash,
+		HashAlgorithm: hashAlgorithm,
+		CreationTime:  done.Timestamp,
+		Signature:     done.Signature,
+		OrderLimit:    *limit,
+		FormatVersion: pb.PieceHeader_FORMAT_V1,
+	}
+	if err := p.backend.Write(ctx, limit.SatelliteId, header, data); err != nil {
+		return rpcstatus.Error(rpcstatus.Internal, err.Error())
+	}
+	p.log.Debug("piece is uploaded", zap.Stringer("piece", limit.PieceId), zap.Stringer("action", limit.Action), zap.Int("size", len(data)))
+
+	signed, err := signing.SignPieceHash(ctx, signing.SignerFromFullIdentity(p.identity), &pb.PieceHash{
+		PieceId:       limit.PieceId,
+		Hash:          calculated,
+		HashAlgorithm: hashAlgorithm,
+		PieceSize:     int64(len(data)),
+		Timestamp:     time.Now(),
+	})
+	if err != nil {
+		return rpcstatus.Error(rpcstatus.Internal, err.Error())
+	}
+	return stream.SendAndClose(&pb.PieceUploadResponse{
+		Done:          signed,
+		NodeCertchain: identity.EncodePeerIdentity(p.identity.PeerIdentity()),
+	})
+}
+
+func (p *pieceStore) Download(stream pb.DRPCPiecestore_DownloadStream) error {
+	ctx := stream.Context()
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	limit := req.Limit
+	if err := p.verifyLimit(ctx, limit, pb.PieceAction_GET, pb.PieceAction_GET_REPAIR, pb.PieceAction_GET_AUDIT); err != nil {
+		return err
+	}
+	if req.Chunk == nil {
+		return rpcstatus.Error(rpcstatus.InvalidArgument, "chunk is missing from the first message")
+	}
+	if req.Chunk.ChunkSize > limit.Limit {
+		return rpcstatus.Errorf(rpcstatus.InvalidArgument, "requested %d bytes, but the order limit is %d", req.Chunk.ChunkSize, limit.Limit)
+	}
+
+	header, data, err := p.backend.Read(ctx, limit.SatelliteId, limit.PieceId)
+	if isNotFound(err) {
+		return rpcstatus.Errorf(rpcstatus.NotFound, "piece %s is not found", limit.PieceId)
+	}
+	if err != nil {
+		return rpcstatus.Error(rpcstatus.Internal, err.Error())
+	}
+	start := req.Chunk.Offset
+	end := start + req.Chunk.ChunkSize
+	if start < 0 || end > int64(len(data)) {
+		return rpcstatus.Errorf(rpcstatus.InvalidArgument, "requested range %d-%d is out of the piece (%d)", start, end, len(data))
+	}
+
+	if limit.Action == pb.PieceAction_GET_AUDIT || limit.Action == pb.PieceAction_GET_REPAIR {
+		originalLimit := header.OrderLimit
+		err = stream.Send(&pb.PieceDownloadResponse{
+			Hash: &pb.PieceHash{
+				PieceId:       limit.PieceId,
+				Hash:          header.Hash,
+				HashAlgorithm: header.HashAlgorithm,
+				PieceSize:     int64(len(data)),
+				Timestamp:     header.CreationTime,
+				Signature:     header.Signature,
+			},
+			Limit: &originalLimit,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	position := start
+	for {
+		// data is sent only up to the paid amount (the first message may also contain an order)
+		if req.Order != nil {
+			if err := p.verifyOrder(ctx, limit, req.Order); err != nil {
+				return err
+			}
+			paid := min(start+req.Order.Amount, end)
+			for position < paid {
+				next := min(position+downloadChunkSize, paid)
+				err = stream.Send(&pb.PieceDownloadResponse{
+					Chunk: &pb.PieceDownloadResponse_Chunk{
+						Offset: position,
+						Data:   data[position:next],
+					},
+				})
+				if err != nil {
+					return err
+				}
+				position = next
+			}
+		}
+		if position >= end {
+			p.log.Debug("piece is downloaded", zap.Stringer("piece", limit.PieceId), zap.Stringer("action", limit.Action), zap.Int64("offset", start), zap.Int64("size", end-start))
+			return nil
+		}
+
+		req, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *pieceStore) Exists(ctx context.Context, req *pb.ExistsRequest) (*pb.ExistsResponse, error) {
+	if err := p.verifySatellite(ctx); err != nil {
+		return nil, err
+	}
+	resp := &pb.ExistsResponse{}
+	for i, id := range req.PieceIds {
+		_, _, err := p.backend.Read(ctx, p.satellite.ID, id)
+		if err != nil {
+			if !isNotFound(err) {
+				return nil, rpcstatus.Error(rpcstatus.Internal, err.Error())
+			}
+			resp.Missing = append(resp.Missing, uint32(i))
+		}
+	}
+	return resp, nil
+}
+
+func (p *pieceStore) DeletePieces(ctx context.Context, req *pb.DeletePiecesRequest) (*pb.DeletePiecesResponse, error) {
+	if err := p.verifySatellite(ctx); err != nil {
+		return nil, err
+	}
+	resp := &pb.DeletePiecesResponse{}
+	for _, id := range req.PieceIds {
+		if err := p.backend.Delete(ctx, p.satellite.ID, id); err != nil {
+			p.log.Warn("piece couldn't be deleted", zap.Stringer("piece", id), zap.Error(err))
+			resp.UnhandledCount++
+		}
+	}
+	return resp, nil
+}
+
+func (p *pieceStore) Retain(ctx context.Context, req *pb.RetainRequest) (*pb.RetainResponse, error) {
+	if err := p.verifySatellite(ctx); err != nil {
+		return nil, err
+	}
+	if err := p.retain(ctx, req); err != nil {
+		return nil, err
+	}
+	return &pb.RetainResponse{}, nil
+}
+
+func (p *pieceStore) RetainBig(stream pb.DRPCPiecestore_RetainBigStream) error {
+	ctx := stream.Context()
+	if err := p.verifySatellite(ctx); err != nil {
+		return err
+	}
+	req, err := piecestore.RetainRequestFromStream(stream)
+	if err != nil {
+		return rpcstatus.Error(rpcstatus.InvalidArgument, err.Error())
+	}
+	return p.retain(ctx, &req)
+}
+
+// retain deletes the pieces which are created before the filter and not included in it.
+func (p *pieceStore) retain(ctx context.Context, req *pb.RetainRequest) error {
+	filter, err := bloomfilter.NewFromBytes(req.Filter)
+	if err != nil {
+		return rpcstatus.Error(rpcstatus.InvalidArgument, err.Error())
+	}
+	var garbage []storj.PieceID
+	err = p.backend.Walk(ctx, p.satellite.ID, func(pieceID storj.PieceID, created time.Time) error {
+		if created.Before(req.CreationDate) && !filter.Contains(pieceID) {
+			garbage = append(garbage, pieceID)
+		}
+		return nil
+	})
+	if errors.Is(err, errUnsupported) {
+		p.log.Info("retain is ignored", zap.Error(err))
+		return nil
+	}
+	if err != nil {
+		return rpcstatus.Error(rpcstatus.Internal, err.Error())
+	}
+	for _, id := range garbage {
+		if err := p.backend.Delete(ctx, p.satellite.ID, id); err != nil {
+			return rpcstatus.Error(rpcstatus.Internal, err.Error())
+		}
+	}
+	p.log.Info("retain is applied", zap.Time("created_before", req.CreationDate), zap.Int("deleted", len(garbage)))
+	return nil
+}
+
+func (p *pieceStore) RestoreTrash(ctx context.Context, req *pb.RestoreTrashRequest) (*pb.RestoreTrashResponse, error) {
+	if err := p.verifySatellite(ctx); err != nil {
+		return nil, err
+	}
+	// deleted pieces are not moved to the trash
+	return &pb.RestoreTrashResponse{}, nil
+}
+
+// verifyLimit checks if the order limit is signed by the trusted satellite for this node, and it's still valid.
+func (p *pieceStore) verifyLimit(ctx context.Context, limit *pb.OrderLimit, actions ...pb.PieceAction) error {
+	if limit == nil {
+		return rpcstatus.Error(rpcstatus.InvalidArgument, "order limit is missing")
+	}
+	if limit.SatelliteId != p.satellite.ID {
+		return rpcstatus.Errorf(rpcstatus.PermissionDenied, "untrusted satellite: %s", limit.SatelliteId)
+	}
+	if limit.StorageNodeId != p.identity.ID {
+		return rpcstatus.Errorf(rpcstatus.InvalidArgument, "order limit is for another node: %s", limit.StorageNodeId)
+	}
+	if !slices.Contains(actions, limit.Action) {
+		return rpcstatus.Errorf(rpcstatus.InvalidArgument, "invalid action: %s", limit.Action)
+	}
+	now := time.Now()
+	if limit.OrderExpiration.Before(now) {
+		return rpcstatus.Errorf(rpcstatus.InvalidArgument, "order limit is expired at %s", limit.OrderExpiration)
+	}
+	if !limit.PieceExpiration.IsZero() && limit.PieceExpiration.Before(now) {
+		return rpcstatus.Errorf(rpcstatus.InvalidArgument, "piece is expired at %s", limit.PieceExpiration)
+	}
+	if err := signing.VerifyOrderLimitSignature(ctx, signing.SigneeFromPeerIdentity(p.satellite), limit); err != nil {
+		return rpcstatus.Errorf(rpcstatus.Unauthenticated, "invalid order limit signature: %v", err)
+	}
+	return nil
+}
+
+// verifyOrder checks if the order is signed by the uplink of the order limit.
+func (p *pieceStore) verifyOrder(ctx context.Context, limit *pb.OrderLimit, order *pb.Order) error {
+	if order.SerialNumber != limit.SerialNumber {
+		return rpcstatus.Error(rpcstatus.InvalidArgument, "order serial number doesn't match the order limit")
+	}
+	if order.Amount > limit.Limit {
+		return rpcstatus.Errorf(rpcstatus.InvalidArgument, "order amount %d is larger than the limit %d", order.Amount, limit.Limit)
+	}
+	if err := signing.VerifyUplinkOrderSignature(ctx, limit.UplinkPublicKey, order); err != nil {
+		return rpcstatus.Errorf(rpcstatus.Unauthenticated, "invalid order signature: %v", err)
+	}
+	return nil
+}
+
+// verifySatellite checks if the request is sent by the trusted satellite.
+func (p *pieceStore) verifySatellite(ctx context.Context) error {
+	peer, err := identity.PeerIdentityFromContext(ctx)
+	if err != nil {
+		return rpcstatus.Error(rpcstatus.Unauthenticated, err.Error())
+	}
+	if peer.ID != p.satellite.ID {
+		return rpcstatus.Errorf(rpcstatus.PermissionDenied, "only the trusted satellite can call this endpoint, not %s", peer.ID)
+	}
+	return nil
+}
+
+var _ pb.DRPCPiecestoreServer = &pieceStore{}
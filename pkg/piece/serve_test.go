@@ -0,0 +1,145 @@
+package piece
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/elek/stbb/pkg/util"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"storj.io/common/bloomfilter"
+	"storj.io/common/identity"
+	"storj.io/common/pb"
+	"storj.io/common/rpc/rpcstatus"
+	"storj.io/common/signing"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+	"storj.io/common/testrand"
+	"storj.io/uplink/private/piecestore"
+)
+
+func TestServe(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	satellite, err := identity.FullIdentityFromPEM(util.Certificate, util.Key)
+	require.NoError(t, err)
+	node, address, backend := startNode(ctx, t)
+	client := dialNode(ctx, t, satellite, storj.NodeURL{ID: node.ID, Address: address})
+
+	data := testrand.BytesInt(300_000)
+	pieceID := testrand.PieceID()
+
+	signer := util.NewKeySignerFromFullIdentity(satellite, pb.PieceAction_PUT)
+	limit, pk, _, err := signer.CreateOrderLimit(ctx, pieceID, int64(len(data)), node.ID)
+	require.NoError(t, err)
+	hash, err := client.UploadReader(ctx, limit, pk, bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, pieceID, hash.PieceId)
+
+	signer.Action = pb.PieceAction_GET
+	limit, pk, _, err = signer.CreateOrderLimit(ctx, pieceID, int64(len(data)), node.ID)
+	require.NoError(t, err)
+	download, err := client.Download(ctx, limit, pk, 0, int64(len(data)))
+	require.NoError(t, err)
+	downloaded, err := io.ReadAll(download)
+	require.NoError(t, err)
+	require.NoError(t, download.Close())
+	require.Equal(t, data, downloaded)
+
+	// empty bloom filter removes all the older pieces
+	require.NoError(t, client.Retain(ctx, &pb.RetainRequest{
+		CreationDate: time.Now().Add(time.Minute),
+		Filter:       bloomfilter.NewOptimal(10, 0.1).Bytes(),
+	}))
+	_, _, err = backend.Read(ctx, satellite.ID, pieceID)
+	require.True(t, isNotFound(err))
+}
+
+func TestServeUploadPieceID(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	satellite, err := identity.FullIdentityFromPEM(util.Certificate, util.Key)
+	require.NoError(t, err)
+	node, address, backend := startNode(ctx, t)
+
+	data := testrand.BytesInt(1000)
+	pieceID := testrand.PieceID()
+	signer := util.NewKeySignerFromFullIdentity(satellite, pb.PieceAction_PUT)
+	limit, pk, _, err := signer.CreateOrderLimit(ctx, pieceID, int64(len(data)), node.ID)
+	require.NoError(t, err)
+	order, err := signing.SignUplinkOrder(ctx, pk, &pb.Order{SerialNumber: limit.SerialNumber, Amount: int64(len(data))})
+	require.NoError(t, err)
+
+	hasher := pb.NewHashFromAlgorithm(pb.PieceHashAlgorithm_SHA256)
+	_, _ = hasher.Write(data)
+	// the hash is signed by the uplink, but for a different piece
+	done, err := signing.SignUplinkPieceHash(ctx, pk, &pb.PieceHash{
+		PieceId:       testrand.PieceID(),
+		Hash:          hasher.Sum(nil),
+		HashAlgorithm: pb.PieceHashAlgorithm_SHA256,
+		PieceSize:     int64(len(data)),
+		Timestamp:     time.Now(),
+	})
+	require.NoError(t, err)
+
+	dialer, err := util.GetDialerForIdentity(ctx, satellite, false, false)
+	require.NoError(t, err)
+	conn, err := dialer.DialNodeURL(ctx, storj.NodeURL{ID: node.ID, Address: address})
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	stream, err := pb.NewDRPCPiecestoreClient(conn).Upload(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.PieceUploadRequest{
+		Limit:         limit,
+		Order:         order,
+		HashAlgorithm: pb.PieceHashAlgorithm_SHA256,
+		Chunk:         &pb.PieceUploadRequest_Chunk{Data: data},
+		Done:          done,
+	}))
+	_, err = stream.CloseAndRecv()
+	require.Error(t, err)
+	require.Equal(t, rpcstatus.InvalidArgument, rpcstatus.Code(err))
+
+	_, _, err = backend.Read(ctx, satellite.ID, pieceID)
+	require.True(t, isNotFound(err))
+}
+
+// startNode runs a piecestore endpoint with memory backend, trusting the embedded satellite identity.
+func startNode(ctx *testcontext.Context, t *testing.T) (*identity.FullIdentity, string, *memoryBackend) {
+	satellite, err := identity.PeerIdentityFromPEM(util.Certificate)
+	require.NoError(t, err)
+	node, err := identity.NewFullIdentity(ctx, identity.NewCAOptions{Difficulty: 0, Concurrency: 1})
+	require.NoError(t, err)
+	backend := newMemoryBackend()
+	address := startServer(ctx, t, node, &pieceStore{
+		log:       zap.NewNop(),
+		identity:  node,
+		satellite: satellite,
+		backend:   backend,
+	})
+	return node, address, backend
+}
+
+func startServer(ctx *testcontext.Context, t *testing.T, ident *identity.FullIdentity, endpoint pb.DRPCPiecestoreServer) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveCtx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	ctx.Go(func() error {
+		return serve(serveCtx, listener, ident, endpoint)
+	})
+	return listener.Addr().String()
+}
+
+func dialNode(ctx *testcontext.Context, t *testing.T, ident *identity.FullIdentity, url storj.NodeURL) *piecestore.Client {
+	dialer, err := util.GetDialerForIdentity(ctx, ident, false, false)
+	require.NoError(t, err)
+	client, err := piecestore.Dial(ctx, dialer, url, piecestore.DefaultConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
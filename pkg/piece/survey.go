@@ -0,0 +1,497 @@
+package piece
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elek/stbb/pkg/db"
+	"github.com/elek/stbb/pkg/node"
+	"github.com/elek/stbb/pkg/util"
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/zeebo/errs/v2"
+	"go.uber.org/zap"
+	"storj.io/common/identity"
+	"storj.io/common/memory"
+	"storj.io/common/pb"
+	"storj.io/common/rpc"
+	"storj.io/common/signing"
+	"storj.io/common/storj"
+	"storj.io/common/uuid"
+	"storj.io/storj/satellite"
+	"storj.io/storj/satellite/metabase"
+)
+
+// SpeedSurvey measures the download speed of the nodes of a placement, with breakdown by country, ASN and node tags.
+type SpeedSurvey struct {
+	db.WithDatabase
+	Placement   int           `default:"0" help:"placement of the sampled segments"`
+	Segments    int           `default:"10" help:"number of segments to sample"`
+	Keys        string        `required:"" help:"identity directory of the satellite to sign the orders"`
+	Size        memory.Size   `default:"1MiB" help:"maximum number of bytes to download from each piece"`
+	CountryDB   string        `help:"MaxMind GeoIP2/GeoLite2 country or city database"`
+	ASNDB       string        `name:"asn-db" help:"MaxMind GeoLite2 ASN database"`
+	Tag         []string      `help:"node tags (name) to group the results by"`
+	Parallelism int           `default:"20" help:"number of concurrent downloads"`
+	Timeout     time.Duration `default:"30s" help:"timeout of one piece download"`
+	Output      string        `default:"survey.csv" help:"CSV file with the result of each download"`
+}
+
+// surveyNode is a node with the GeoIP and tag information.
+type surveyNode struct {
+	url     storj.NodeURL
+	country string
+	asn     string
+	tags    map[string]string
+}
+
+// surveyResult is the measurement of one piece download.
+type surveyResult struct {
+	node *surveyNode
+	// dial is the time to open the connection.
+	dial time.Duration
+	// ttfb is the time from sending the request to the first byte of the data.
+	ttfb time.Duration
+	// duration is the time from sending the request to the last byte.
+	duration time.Duration
+	bytes    int64
+	err      error
+}
+
+// throughput is the transfer speed after the first byte, in bytes/sec.
+func (r surveyResult) throughput() float64 {
+	transfer := r.duration - r.ttfb
+	if transfer <= 0 {
+		transfer = r.duration
+	}
+	if transfer <= 0 {
+		return 0
+	}
+	return float64(r.bytes) / transfer.Seconds()
+}
+
+type surveyJob struct {
+	node    *surveyNode
+	pieceID storj.PieceID
+	size    int64
+}
+
+func (s SpeedSurvey) Run() error {
+	ctx := context.Background()
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	metabaseDB, err := s.GetMetabaseDB(ctx, log.Named("metabase"))
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	defer func() { _ = metabaseDB.Close() }()
+
+	satelliteDB, err := s.GetSatelliteDB(ctx, log.Named("satellite"))
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	defer func() { _ = satelliteDB.Close() }()
+
+	ident, err := identity.Config{
+		CertPath: filepath.Join(s.Keys, "identity.cert"),
+		KeyPath:  filepath.Join(s.Keys, "identity.key"),
+	}.Load()
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	dialer, err := util.GetDialerForIdentity(ctx, ident, false, false)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	signer := util.NewKeySignerFromFullIdentity(ident, pb.PieceAction_GET)
+
+	geo, err := s.openGeoDatabases()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = geo.Close() }()
+
+	segments, err := s.sample(ctx, metabaseDB)
+	if err != nil {
+		return err
+	}
+	aliases, err := metabaseDB.LatestNodesAliasMap(ctx)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	nodes := map[storj.NodeID]*surveyNode{}
+	var jobs []surveyJob
+	for _, segment := range segments {
+		size := min(pieceSizeOf(segment), s.Size.Int64())
+		for _, piece := range segment.AliasPieces {
+			id, ok := aliases.Node(piece.Alias)
+			if !ok {
+				continue
+			}
+			node, found := nodes[id]
+			if !found {
+				node, err = s.nodeInfo(ctx, satelliteDB, id, geo.lookup)
+				if err != nil {
+					fmt.Println("WARN", id, err)
+				}
+				nodes[id] = node
+			}
+			if node == nil {
+				continue
+			}
+			jobs = append(jobs, surveyJob{
+				node:    node,
+				pieceID: segment.RootPieceID.Derive(id, int32(piece.Number)),
+				size:    size,
+			})
+		}
+	}
+	fmt.Printf("Downloading %d pieces of %d segments from %d nodes\n", len(jobs), len(segments), len(nodes))
+
+	var mu sync.Mutex
+	var results []surveyResult
+	var wg sync.WaitGroup
+	limiter := make(chan struct{}, max(s.Parallelism, 1))
+	for _, job := range jobs {
+		wg.Add(1)
+		limiter <- struct{}{}
+		go func() {
+			defer func() {
+				<-limiter
+				wg.Done()
+			}()
+			ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+			defer cancel()
+			res := measureDownload(ctx, dialer, signer, job.node.url, job.pieceID, job.size)
+			res.node = job.node
+			mu.Lock()
+			results = append(results, res)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if err := s.save(results); err != nil {
+		return err
+	}
+
+	printSurvey("country", aggregateSurvey(results, func(n *surveyNode) string { return n.country }))
+	printSurvey("asn", aggregateSurvey(results, func(n *surveyNode) string { return n.asn }))
+	for _, tag := range s.Tag {
+		printSurvey("tag "+tag, aggregateSurvey(results, func(n *surveyNode) string { return n.tags[tag] }))
+	}
+	fmt.Println("Results are saved to", s.Output)
+	return nil
+}
+
+// sample selects random remote segments of the placement, starting the iteration from random stream IDs.
+func (s SpeedSurvey) sample(ctx context.Context, metabaseDB *metabase.DB) ([]metabase.LoopSegmentEntry, error) {
+	var res []metabase.LoopSegmentEntry
+	seen := map[uuid.UUID]bool{}
+	for attempt := 0; len(res) < s.Segments && attempt < s.Segments*10; attempt++ {
+		start, err := uuid.New()
+		if err != nil {
+			return nil, errs.Wrap(err)
+		}
+		err = metabaseDB.IterateLoopSegments(ctx, metabase.IterateLoopSegments{
+			BatchSize:     1000,
+			StartStreamID: start,
+		}, func(ctx context.Context, iterator metabase.LoopSegmentsIterator) error {
+			var entry metabase.LoopSegmentEntry
+			for scanned := 0; scanned < 100000 && iterator.Next(ctx, &entry); scanned++ {
+				if len(entry.AliasPieces) == 0 || int(entry.Placement) != s.Placement || seen[entry.StreamID] {
+					continue
+				}
+				seen[entry.StreamID] = true
+				res = append(res, entry)
+				return nil
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errs.Wrap(err)
+		}
+	}
+	if len(res) == 0 {
+		return nil, errs.Errorf("no segments are found in placement %d", s.Placement)
+	}
+	return res, nil
+}
+
+// pieceSizeOf returns the size of one piece of the segment (padded to the share size).
+func pieceSizeOf(segment metabase.LoopSegmentEntry) int64 {
+	share := int64(segment.Redundancy.ShareSize)
+	required := int64(segment.Redundancy.RequiredShares)
+	if share == 0 || required == 0 {
+		return int64(segment.EncryptedSize)
+	}
+	stripes := int64(math.Ceil(float64(segment.EncryptedSize) / float64(share*required)))
+	return stripes * share
+}
+
+// nodeInfo returns nil (without error) for disqualified and exited nodes.
+func (s SpeedSurvey) nodeInfo(ctx context.Context, satelliteDB satellite.DB, id storj.NodeID, lookup func(ip net.IP) (string, string)) (*surveyNode, error) {
+	dossier, err := satelliteDB.OverlayCache().Get(ctx, id)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	if dossier.Disqualified != nil || dossier.ExitStatus.ExitFinishedAt != nil || dossier.LastIPPort == "" {
+		return nil, nil
+	}
+	node := &surveyNode{
+		url:  storj.NodeURL{ID: id, Address: dossier.LastIPPort},
+		tags: map[string]string{},
+	}
+	if host, _, err := net.SplitHostPort(dossier.LastIPPort); err == nil {
+		node.country, node.asn = lookup(net.ParseIP(host))
+	}
+	if len(s.Tag) > 0 {
+		tags, err := satelliteDB.OverlayCache().GetNodeTags(ctx, id)
+		if err != nil {
+			return node, errs.Wrap(err)
+		}
+		for _, tag := range tags {
+			for _, name := range s.Tag {
+				if tag.Name == name {
+					node.tags[name] = string(tag.Value)
+				}
+			}
+		}
+	}
+	return node, nil
+}
+
+// geoDatabases are the optional GeoIP databases of the survey.
+type geoDatabases struct {
+	countries *maxminddb.Reader
+	asns      *maxminddb.Reader
+}
+
+// openGeoDatabases opens the configured GeoIP databases.
+func (s SpeedSurvey) openGeoDatabases() (*geoDatabases, error) {
+	open := func(path string) (*maxminddb.Reader, error) {
+		if path == "" {
+			return nil, nil
+		}
+		r, err := maxminddb.Open(path)
+		return r, errs.Wrap(err)
+	}
+	g := &geoDatabases{}
+	var err error
+	g.countries, err = open(s.CountryDB)
+	if err != nil {
+		return nil, err
+	}
+	g.asns, err = open(s.ASNDB)
+	if err != nil {
+		_ = g.Close()
+		return nil, err
+	}
+	return g, nil
+}
+
+// lookup returns the country and ASN of an IP address.
+func (g *geoDatabases) lookup(ip net.IP) (country string, asn string) {
+	if ip == nil {
+		return "", ""
+	}
+	var record node.IPInfo
+	if g.countries != nil {
+		_ = g.countries.Lookup(ip, &record)
+	}
+	if g.asns != nil {
+		_ = g.asns.Lookup(ip, &record)
+	}
+	if record.ASN > 0 {
+		asn = fmt.Sprintf("AS%d %s", record.ASN, record.Organization)
+	}
+	return record.Country.IsoCode, asn
+}
+
+// Close closes the opened databases.
+func (g *geoDatabases) Close() error {
+	var group errs.Group
+	for _, r := range []*maxminddb.Reader{g.countries, g.asns} {
+		if r != nil {
+			group.Add(r.Close())
+		}
+	}
+	return group.Err()
+}
+
+func (s SpeedSurvey) save(results []surveyResult) error {
+	out, err := os.Create(s.Output)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	defer func() { _ = out.Close() }()
+	w := csv.NewWriter(out)
+	header := []string{"node_id", "address", "country", "asn"}
+	for _, tag := range s.Tag {
+		header = append(header, "tag_"+tag)
+	}
+	_ = w.Write(append(header, "dial_ms", "ttfb_ms", "duration_ms", "bytes", "throughput_mbps", "error"))
+	for _, r := range results {
+		line := []string{r.node.url.ID.String(), r.node.url.Address, r.node.country, r.node.asn}
+		for _, tag := range s.Tag {
+			line = append(line, r.node.tags[tag])
+		}
+		msg := ""
+		if r.err != nil {
+			msg = r.err.Error()
+		}
+		_ = w.Write(append(line,
+			fmt.Sprintf("%d", r.dial.Milliseconds()),
+			fmt.Sprintf("%d", r.ttfb.Milliseconds()),
+			fmt.Sprintf("%d", r.duration.Milliseconds()),
+			fmt.Sprintf("%d", r.bytes),
+			fmt.Sprintf("%.2f", r.throughput()/memory.MB.Float64()),
+			msg))
+	}
+	w.Flush()
+	return errs.Wrap(w.Error())
+}
+
+// measureDownload downloads size bytes of the piece with one order, and measures the timings.
+func measureDownload(ctx context.Context, dialer rpc.Dialer, signer *util.KeySigner, node storj.NodeURL, pieceID storj.PieceID, size int64) (res surveyResult) {
+	start := time.Now()
+	conn, err := dialer.DialNodeURL(ctx, node)
+	res.dial = time.Since(start)
+	if err != nil {
+		res.err = errs.Wrap(err)
+		return res
+	}
+	defer func() { _ = conn.Close() }()
+
+	limit, pk, serial, err := signer.CreateOrderLimit(ctx, pieceID, size, node.ID)
+	if err != nil {
+		res.err = errs.Wrap(err)
+		return res
+	}
+	order, err := signing.SignUplinkOrder(ctx, pk, &pb.Order{
+		SerialNumber: serial,
+		Amount:       size,
+	})
+	if err != nil {
+		res.err = errs.Wrap(err)
+		return res
+	}
+
+	requested := time.Now()
+	stream, err := pb.NewDRPCPiecestoreClient(conn).Download(ctx)
+	if err != nil {
+		res.err = errs.Wrap(err)
+		return res
+	}
+	defer func() { _ = stream.Close() }()
+	err = stream.Send(&pb.PieceDownloadRequest{
+		Limit: limit,
+		Order: order,
+		Chunk: &pb.PieceDownloadRequest_Chunk{
+			ChunkSize: size,
+		},
+	})
+	if err != nil {
+		res.err = errs.Wrap(err)
+		return res
+	}
+	for res.bytes < size {
+		resp, err := stream.Recv()
+		if err != nil {
+			res.err = errs.Wrap(err)
+			return res
+		}
+		if resp.Chunk == nil {
+			continue
+		}
+		if res.bytes == 0 {
+			res.ttfb = time.Since(requested)
+		}
+		res.bytes += int64(len(resp.Chunk.Data))
+	}
+	res.duration = time.Since(requested)
+	return res
+}
+
+// surveyGroup aggregates the downloads of one country, ASN or tag value.
+type surveyGroup struct {
+	name       string
+	nodes      map[storj.NodeID]bool
+	downloads  int
+	failed     int
+	ttfb       []time.Duration
+	throughput []float64
+}
+
+// aggregateSurvey groups the results by a property of the node. Groups are ordered by the number of downloads.
+func aggregateSurvey(results []surveyResult, key func(n *surveyNode) string) []*surveyGroup {
+	groups := map[string]*surveyGroup{}
+	for _, r := range results {
+		name := key(r.node)
+		if name == "" {
+			name = "unknown"
+		}
+		g, found := groups[name]
+		if !found {
+			g = &surveyGroup{name: name, nodes: map[storj.NodeID]bool{}}
+			groups[name] = g
+		}
+		g.nodes[r.node.url.ID] = true
+		g.downloads++
+		if r.err != nil {
+			g.failed++
+			continue
+		}
+		g.ttfb = append(g.ttfb, r.ttfb)
+		g.throughput = append(g.throughput, r.throughput())
+	}
+	var res []*surveyGroup
+	for _, g := range groups {
+		sort.Slice(g.ttfb, func(i, j int) bool { return g.ttfb[i] < g.ttfb[j] })
+		sort.Float64s(g.throughput)
+		res = append(res, g)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].downloads == res[j].downloads {
+			return res[i].name < res[j].name
+		}
+		return res[i].downloads > res[j].downloads
+	})
+	return res
+}
+
+// percentile returns the p-th percentile of the sorted values.
+func percentile[T any](sorted []T, p float64) T {
+	var zero T
+	if len(sorted) == 0 {
+		return zero
+	}
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+func printSurvey(title string, groups []*surveyGroup) {
+	fmt.Println()
+	fmt.Printf("%-40s %6s %9s %7s %10s %10s %10s\n", strings.ToUpper(title), "nodes", "downloads", "failed", "ttfb_p50", "ttfb_p90", "MB/s_p50")
+	for _, g := range groups {
+		fmt.Printf("%-40s %6d %9d %7d %10s %10s %10.2f\n",
+			g.name,
+			len(g.nodes),
+			g.downloads,
+			g.failed,
+			percentile(g.ttfb, 0.5).Round(time.Millisecond),
+			percentile(g.ttfb, 0.9).Round(time.Millisecond),
+			percentile(g.throughput, 0.5)/memory.MB.Float64())
+	}
+}
@@ -0,0 +1,83 @@
+package piece
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elek/stbb/pkg/util"
+	"github.com/stretchr/testify/require"
+	"storj.io/common/identity"
+	"storj.io/common/pb"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+	"storj.io/common/testrand"
+	"storj.io/storj/satellite/metabase"
+)
+
+func TestMeasureDownload(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	satellite, err := identity.FullIdentityFromPEM(util.Certificate, util.Key)
+	require.NoError(t, err)
+	node, address, _ := startNode(ctx, t)
+	nodeURL := storj.NodeURL{ID: node.ID, Address: address}
+
+	data := testrand.BytesInt(500_000)
+	signer := util.NewKeySignerFromFullIdentity(satellite, pb.PieceAction_PUT)
+	limit, pk, _, err := signer.CreateOrderLimit(ctx, testrand.PieceID(), int64(len(data)), node.ID)
+	require.NoError(t, err)
+	_, err = dialNode(ctx, t, satellite, nodeURL).UploadReader(ctx, limit, pk, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	dialer, err := util.GetDialerForIdentity(ctx, satellite, false, false)
+	require.NoError(t, err)
+	signer.Action = pb.PieceAction_GET
+
+	res := measureDownload(ctx, dialer, signer, nodeURL, limit.PieceId, 300_000)
+	require.NoError(t, res.err)
+	require.Equal(t, int64(300_000), res.bytes)
+	require.Positive(t, res.ttfb)
+	require.GreaterOrEqual(t, res.duration, res.ttfb)
+	require.Positive(t, res.throughput())
+
+	res = measureDownload(ctx, dialer, signer, nodeURL, testrand.PieceID(), 1000)
+	require.Error(t, res.err)
+}
+
+func TestAggregateSurvey(t *testing.T) {
+	de1 := &surveyNode{url: storj.NodeURL{ID: testrand.NodeID()}, country: "DE", asn: "AS1 a"}
+	de2 := &surveyNode{url: storj.NodeURL{ID: testrand.NodeID()}, country: "DE", asn: "AS2 b"}
+	us := &surveyNode{url: storj.NodeURL{ID: testrand.NodeID()}, asn: "AS2 b"}
+
+	results := []surveyResult{
+		{node: de1, ttfb: 10 * time.Millisecond, duration: time.Second, bytes: 1000},
+		{node: de1, ttfb: 30 * time.Millisecond, duration: time.Second, bytes: 1000},
+		{node: de2, ttfb: 20 * time.Millisecond, duration: time.Second, bytes: 1000},
+		{node: de2, err: errors.New("timeout")},
+		{node: us, ttfb: 50 * time.Millisecond, duration: time.Second, bytes: 1000},
+	}
+
+	groups := aggregateSurvey(results, func(n *surveyNode) string { return n.country })
+	require.Len(t, groups, 2)
+	require.Equal(t, "DE", groups[0].name)
+	require.Len(t, groups[0].nodes, 2)
+	require.Equal(t, 4, groups[0].downloads)
+	require.Equal(t, 1, groups[0].failed)
+	require.Equal(t, 20*time.Millisecond, percentile(groups[0].ttfb, 0.5))
+	require.Equal(t, "unknown", groups[1].name)
+
+	groups = aggregateSurvey(results, func(n *surveyNode) string { return n.asn })
+	require.Equal(t, "AS2 b", groups[0].name)
+	require.Len(t, groups[0].nodes, 2)
+
+	require.Equal(t, int64(256), pieceSizeOf(metabase.LoopSegmentEntry{
+		EncryptedSize: 1000,
+		Redundancy:    storj.RedundancyScheme{ShareSize: 256, RequiredShares: 29},
+	}))
+	require.Equal(t, int64(512), pieceSizeOf(metabase.LoopSegmentEntry{
+		EncryptedSize: 256*29 + 1,
+		Redundancy:    storj.RedundancyScheme{ShareSize: 256, RequiredShares: 29},
+	}))
+}
@@ -2,27 +2,73 @@ package piece
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/elek/stbb/pkg/util"
 	"github.com/zeebo/errs/v2"
 	"hash"
+	"io"
+	"net"
 	"os"
+	"sort"
 	"storj.io/common/experiment"
+	"storj.io/common/memory"
 	"storj.io/common/pb"
+	"storj.io/common/rpc"
+	"storj.io/common/rpc/quic"
 	"storj.io/common/signing"
 	"storj.io/common/storj"
+	"storj.io/drpc"
 	"strings"
+	"sync"
+	"time"
 )
 
 type UploadDrpc struct {
 	util.Loop
 	util.DialerHelper
-	NoSync  bool                  `help:"Disable file sync on upload"`
-	Hash    pb.PieceHashAlgorithm `default:"0" help:"Piece hash algorithm to use"`
-	NodeURL storj.NodeURL         `arg:"" name:"nodeurl"`
-	File    string                `arg:"" help:"file to upload as a piece"`
-	Keys    string                `help:"location of the identity files to sign orders"`
-	PieceID string                `help:"Piece ID to use for upload, if not set a new one is generated"`
+	NoSync      bool                  `help:"Disable file sync on upload"`
+	Hash        pb.PieceHashAlgorithm `default:"0" help:"Piece hash algorithm to use"`
+	NodeURL     storj.NodeURL         `arg:"" name:"nodeurl"`
+	File        string                `arg:"" help:"file to upload as a piece"`
+	Keys        string                `help:"location of the identity files to sign orders"`
+	PieceID     string                `help:"Piece ID to use for upload, if not set a new one is generated"`
+	ChunkSize   memory.Size           `default:"1MiB" help:"size of the piece data in one upload message"`
+	Flush       string                `default:"message" enum:"message,cork,end" help:"flush the stream after each message (message), send the order limit together with the first chunk as uplink does (cork), or flush only when the drpc buffer is full and before the commit (end)"`
+	Concurrency int                   `default:"1" help:"number of parallel uploads"`
+	SharedConn  bool                  `help:"use one connection for all the parallel uploads (drpc executes the streams of one connection one after the other)"`
+	Compare     bool                  `help:"upload with TCP, QUIC and Noise, and compare the timing of the phases"`
+}
+
+// uploadTransport is one way to connect to the storagenode.
+type uploadTransport struct {
+	name  string
+	quic  bool
+	noise bool
+}
+
+// uploadTiming is the duration of the phases of one upload. Messages are measured when they are written to the
+// connection, not when they are received by the node.
+type uploadTiming struct {
+	transport string
+	pieceID   storj.PieceID
+	bytes     int64
+
+	// connect is the TCP connection (zero for QUIC and for shared connections).
+	connect time.Duration
+	// handshake is the TLS / Noise handshake (the full dial for QUIC).
+	handshake time.Duration
+	// firstMessage is the time from opening the stream until the first chunk is sent.
+	firstMessage time.Duration
+	// lastByte is the time from the first chunk until the last chunk is sent.
+	lastByte time.Duration
+	// commit is the time to send the signed hash and receive the response of the node.
+	commit time.Duration
+	err    error
+}
+
+func (t uploadTiming) total() time.Duration {
+	return t.connect + t.handshake + t.firstMessage + t.lastByte + t.commit
 }
 
 func (u *UploadDrpc) Run() error {
@@ -34,44 +80,146 @@ func (u *UploadDrpc) Run() error {
 	}
 	orderLimitCreator.Action = pb.PieceAction_PUT
 
-	_, err = u.Loop.Run(func() error {
-		_, _, err := u.ConnectAndUpload(ctx, orderLimitCreator)
+	if u.PieceID != "" && u.Concurrency > 1 {
+		return errs.Errorf("--piece-id can't be used with parallel uploads")
+	}
+
+	dialer, err := u.CreateRPCDialer()
+	if err != nil {
 		return err
-	})
-	return err
+	}
+
+	transports := []uploadTransport{{name: "tcp", quic: u.Quic, noise: u.Noise}}
+	switch {
+	case u.Compare:
+		transports = []uploadTransport{{name: "tcp"}, {name: "quic", quic: true}, {name: "noise", noise: true}}
+	case u.Quic:
+		transports[0].name = "quic"
+	case u.Noise:
+		transports[0].name = "noise"
+	}
+	for _, t := range transports {
+		if t.noise && u.NodeURL.NoiseInfo == (storj.NoiseInfo{}) {
+			fmt.Println("WARNING: node URL doesn't have Noise information, TLS is used instead of Noise")
+		}
+	}
+
+	var timings []uploadTiming
+	for _, transport := range transports {
+		for i := 0; i < u.Sample; i++ {
+			for _, timing := range u.uploadParallel(ctx, dialer, transport, orderLimitCreator) {
+				if timing.err != nil {
+					fmt.Printf("%s upload is failed: %v\n", transport.name, timing.err)
+				} else if u.Verbose {
+					fmt.Printf("%s %s connect=%s handshake=%s first_message=%s last_byte=%s commit=%s\n", transport.name, timing.pieceID,
+						timing.connect, timing.handshake, timing.firstMessage, timing.lastByte, timing.commit)
+				}
+				timings = append(timings, timing)
+			}
+		}
+	}
+
+	failed := printUploadTimings(timings)
+	if failed > 0 {
+		return errs.Errorf("%d uploads are failed", failed)
+	}
+	return nil
 }
 
-func (u *UploadDrpc) ConnectAndUpload(ctx context.Context, orderLimitCreator *util.KeySigner) (size int, id storj.PieceID, err error) {
-	conn, err := u.Connect(ctx, u.NodeURL)
-	if err != nil {
-		return 0, id, err
+// uploadParallel executes Concurrency uploads at the same time, with one connection per upload, or with one shared connection.
+func (u *UploadDrpc) uploadParallel(ctx context.Context, dialer rpc.Dialer, transport uploadTransport, creator *util.KeySigner) []uploadTiming {
+	timings := make([]uploadTiming, max(u.Concurrency, 1))
+
+	var shared *rpc.Conn
+	if u.SharedConn {
+		var err error
+		shared, err = u.dial(ctx, dialer, transport, &timings[0])
+		if err != nil {
+			for i := range timings {
+				timings[i].transport, timings[i].err = transport.name, err
+			}
+			return timings
+		}
+		defer func() { _ = shared.Close() }()
 	}
-	defer conn.Close()
 
-	//client := pb.NewDRPCReplaySafePiecestoreClient(conn)
-	client := pb.NewDRPCPiecestoreClient(conn)
+	var wg sync.WaitGroup
+	for i := range timings {
+		wg.Add(1)
+		go func(timing *uploadTiming) {
+			defer wg.Done()
+			timing.transport = transport.name
+			conn := shared
+			if conn == nil {
+				var err error
+				conn, err = u.dial(ctx, dialer, transport, timing)
+				if err != nil {
+					timing.err = err
+					return
+				}
+				defer func() { _ = conn.Close() }()
+			}
+			timing.err = u.upload(ctx, pb.NewDRPCPiecestoreClient(conn), creator, timing)
+		}(&timings[i])
+	}
+	wg.Wait()
+	return timings
+}
+
+func (u *UploadDrpc) dial(ctx context.Context, dialer rpc.Dialer, transport uploadTransport, timing *uploadTiming) (*rpc.Conn, error) {
+	if transport.quic {
+		dialer.Connector = quic.NewDefaultConnector(nil)
+	} else {
+		// the TCP connection is measured separately, to get the time of the TLS / Noise handshake
+		dialer.Connector = rpc.NewDefaultTCPConnector(func(ctx context.Context, network, address string) (net.Conn, error) {
+			start := time.Now()
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, address)
+			timing.connect = time.Since(start)
+			return conn, err
+		})
+	}
 
-	size, id, err = u.Upload(ctx, client, orderLimitCreator)
+	start := time.Now()
+	conn, err := dialer.DialNode(ctx, u.NodeURL, rpc.DialOptions{
+		ReplaySafe: transport.noise,
+	})
 	if err != nil {
-		return size, id, err
+		return nil, errs.Wrap(err)
 	}
-	if u.Verbose {
-		fmt.Println("id:", id)
-		fmt.Println("pieceHashAlgo:", u.Hash)
+	// connections are opened lazily by the pool, without this the dial would be part of the first message
+	if err := conn.ForceState(ctx); err != nil {
+		_ = conn.Close()
+		return nil, errs.Wrap(err)
+	}
+	timing.handshake = time.Since(start) - timing.connect
+	return conn, nil
+}
 
+// manualFlusher is implemented by the drpc streams, which can buffer the messages until an explicit flush.
+type manualFlusher interface {
+	SetManualFlush(bool)
+	RawFlush() error
+}
+
+func manualFlushOf(stream drpc.Stream) (manualFlusher, error) {
+	if wrapped, ok := stream.(interface{ GetStream() drpc.Stream }); ok {
+		stream = wrapped.GetStream()
 	}
-	return size, id, nil
+	flusher, ok := stream.(manualFlusher)
+	if !ok {
+		return nil, errs.Errorf("manual flush is not supported by %T", stream)
+	}
+	return flusher, nil
 }
 
-func (d *UploadDrpc) Upload(ctx context.Context, client pb.DRPCReplaySafePiecestoreClient, creator *util.KeySigner) (uploaded int, id storj.PieceID, err error) {
+func (d *UploadDrpc) upload(ctx context.Context, client pb.DRPCReplaySafePiecestoreClient, creator *util.KeySigner, timing *uploadTiming) (err error) {
 	defer mon.Task()(&ctx)(&err)
-	var pieceID storj.PieceID
-	if d.PieceID == "" {
-		pieceID = storj.NewPieceID()
-	} else {
-		pieceID, err = storj.PieceIDFromString(d.PieceID)
+	timing.pieceID = storj.NewPieceID()
+	if d.PieceID != "" {
+		timing.pieceID, err = storj.PieceIDFromString(d.PieceID)
 		if err != nil {
-			return 0, pieceID, errs.Wrap(err)
+			return errs.Wrap(err)
 		}
 	}
 
@@ -79,20 +227,36 @@ func (d *UploadDrpc) Upload(ctx context.Context, client pb.DRPCReplaySafePiecest
 		ctx = experiment.With(ctx, "nosync")
 	}
 
-	stream, err := client.Upload(ctx)
+	source, err := os.Open(d.File)
 	if err != nil {
-		return 0, pieceID, errs.Wrap(err)
+		return errs.Wrap(err)
 	}
-	defer stream.Close()
+	defer func() { _ = source.Close() }()
 
-	stat, err := os.Stat(d.File)
+	stat, err := source.Stat()
 	if err != nil {
-		return 0, pieceID, errs.Wrap(err)
+		return errs.Wrap(err)
 	}
 
-	orderLimit, pk, serialNo, err := creator.CreateOrderLimit(ctx, pieceID, stat.Size(), d.NodeURL.ID)
+	orderLimit, pk, serialNo, err := creator.CreateOrderLimit(ctx, timing.pieceID, stat.Size(), d.NodeURL.ID)
 	if err != nil {
-		return 0, pieceID, errs.Wrap(err)
+		return errs.Wrap(err)
+	}
+
+	start := time.Now()
+	stream, err := client.Upload(ctx)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	defer func() { _ = stream.Close() }()
+
+	var flusher manualFlusher
+	if d.Flush != "message" {
+		flusher, err = manualFlushOf(stream)
+		if err != nil {
+			return err
+		}
+		flusher.SetManualFlush(true)
 	}
 
 	err = stream.Send(&pb.PieceUploadRequest{
@@ -100,17 +264,15 @@ func (d *UploadDrpc) Upload(ctx context.Context, client pb.DRPCReplaySafePiecest
 		HashAlgorithm: d.Hash,
 	})
 	if err != nil {
-		return 0, pieceID, errs.Wrap(err)
+		return errs.Wrap(err)
 	}
 
-	order := &pb.Order{
+	order, err := signing.SignUplinkOrder(ctx, pk, &pb.Order{
 		SerialNumber: serialNo,
 		Amount:       stat.Size(),
-	}
-
-	order, err = signing.SignUplinkOrder(ctx, pk, order)
+	})
 	if err != nil {
-		return 0, pieceID, errs.Wrap(err)
+		return errs.Wrap(err)
 	}
 
 	h := pb.NewHashFromAlgorithm(d.Hash)
@@ -118,61 +280,133 @@ func (d *UploadDrpc) Upload(ctx context.Context, client pb.DRPCReplaySafePiecest
 		h = &NoHash{}
 	}
 
-	source, err := os.Open(d.File)
-	if err != nil {
-		return 0, pieceID, errs.Wrap(err)
+	// firstSent closes the first message phase, after the first chunk (or the order limit of an empty piece) is sent.
+	firstSent := func() error {
+		if timing.firstMessage != 0 {
+			return nil
+		}
+		if d.Flush == "cork" {
+			if err := flusher.RawFlush(); err != nil {
+				return errs.Wrap(err)
+			}
+			flusher.SetManualFlush(false)
+		}
+		timing.firstMessage = time.Since(start)
+		return nil
 	}
 
-	buffer := make([]byte, 1024*1024)
-	written := 0
+	buffer := make([]byte, max(d.ChunkSize.Int(), 1))
 	for {
-		n, err := source.Read(buffer)
-		if err != nil {
-			return 0, pieceID, errs.Wrap(err)
+		n, err := io.ReadFull(source, buffer)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return errs.Wrap(err)
 		}
 		err = stream.Send(&pb.PieceUploadRequest{
 			Order: order,
 			Chunk: &pb.PieceUploadRequest_Chunk{
-				Offset: int64(written),
+				Offset: timing.bytes,
 				Data:   buffer[0:n],
 			},
 			HashAlgorithm: d.Hash,
 		})
 		order = nil
 		if err != nil {
-			return 0, pieceID, errs.Wrap(err)
+			return errs.Wrap(err)
 		}
 		_, err = h.Write(buffer[0:n])
 		if err != nil {
-			return 0, pieceID, errs.Wrap(err)
+			return errs.Wrap(err)
 		}
+		timing.bytes += int64(n)
 
-		written += n
-		if written >= int(stat.Size()) {
-			break
+		if err := firstSent(); err != nil {
+			return err
 		}
 	}
+	if err := firstSent(); err != nil {
+		return err
+	}
+	if d.Flush == "end" {
+		if err := flusher.RawFlush(); err != nil {
+			return errs.Wrap(err)
+		}
+		flusher.SetManualFlush(false)
+	}
+	timing.lastByte = time.Since(start) - timing.firstMessage
 
 	uplinkHash, err := signing.SignUplinkPieceHash(ctx, pk, &pb.PieceHash{
-		PieceId:       pieceID,
-		PieceSize:     stat.Size(),
+		PieceId:       timing.pieceID,
+		PieceSize:     timing.bytes,
 		Hash:          h.Sum(nil),
 		Timestamp:     orderLimit.OrderCreation,
 		HashAlgorithm: d.Hash,
 	})
+	if err != nil {
+		return errs.Wrap(err)
+	}
 
+	commitStart := time.Now()
 	err = stream.Send(&pb.PieceUploadRequest{
 		Done: uplinkHash,
 	})
 	if err != nil {
-		return 0, pieceID, errs.Wrap(err)
+		return errs.Wrap(err)
 	}
 
 	_, err = stream.CloseAndRecv()
 	if err != nil {
-		return 0, pieceID, errs.Wrap(err)
+		return errs.Wrap(err)
+	}
+	timing.commit = time.Since(commitStart)
+	return nil
+}
+
+// printUploadTimings prints the median of the phases for each transport, and returns the number of failed uploads.
+func printUploadTimings(timings []uploadTiming) (failed int) {
+	var transports []string
+	phases := map[string]map[string][]time.Duration{}
+	throughput := map[string][]float64{}
+	failures := map[string]int{}
+	for _, t := range timings {
+		if _, found := phases[t.transport]; !found {
+			transports = append(transports, t.transport)
+			phases[t.transport] = map[string][]time.Duration{}
+		}
+		if t.err != nil {
+			failures[t.transport]++
+			failed++
+			continue
+		}
+		p := phases[t.transport]
+		p["connect"] = append(p["connect"], t.connect)
+		p["handshake"] = append(p["handshake"], t.handshake)
+		p["first_message"] = append(p["first_message"], t.firstMessage)
+		p["last_byte"] = append(p["last_byte"], t.lastByte)
+		p["commit"] = append(p["commit"], t.commit)
+		p["total"] = append(p["total"], t.total())
+		throughput[t.transport] = append(throughput[t.transport], float64(t.bytes)/(t.lastByte+t.firstMessage).Seconds())
+	}
+
+	columns := []string{"connect", "handshake", "first_message", "last_byte", "commit", "total"}
+	fmt.Printf("%-10s %7s %7s", "TRANSPORT", "uploads", "failed")
+	for _, c := range columns {
+		fmt.Printf(" %13s", c)
+	}
+	fmt.Printf(" %10s\n", "MB/s_p50")
+	for _, name := range transports {
+		fmt.Printf("%-10s %7d %7d", name, len(phases[name]["total"])+failures[name], failures[name])
+		for _, c := range columns {
+			values := phases[name][c]
+			sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+			fmt.Printf(" %13s", percentile(values, 0.5).Round(time.Microsecond))
+		}
+		sort.Float64s(throughput[name])
+		fmt.Printf(" %10.2f\n", percentile(throughput[name], 0.5)/memory.MB.Float64())
 	}
-	return written, pieceID, nil
+	return failed
 }
 
 type NoHash struct {
@@ -0,0 +1,64 @@
+package piece
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elek/stbb/pkg/util"
+	"github.com/stretchr/testify/require"
+	"storj.io/common/identity"
+	"storj.io/common/memory"
+	"storj.io/common/pb"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+	"storj.io/common/testrand"
+)
+
+func TestUploadDrpc(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	satellite, err := identity.FullIdentityFromPEM(util.Certificate, util.Key)
+	require.NoError(t, err)
+	node, address, backend := startNode(ctx, t)
+
+	data := testrand.BytesInt(300_000)
+	file := filepath.Join(t.TempDir(), "piece")
+	require.NoError(t, os.WriteFile(file, data, 0644))
+
+	dialer, err := util.GetDialerForIdentity(ctx, satellite, false, false)
+	require.NoError(t, err)
+	signer := util.NewKeySignerFromFullIdentity(satellite, pb.PieceAction_PUT)
+
+	for _, flush := range []string{"message", "cork", "end"} {
+		for _, shared := range []bool{false, true} {
+			u := UploadDrpc{
+				NodeURL:     storj.NodeURL{ID: node.ID, Address: address},
+				File:        file,
+				Hash:        pb.PieceHashAlgorithm_BLAKE3,
+				ChunkSize:   64 * memory.KiB,
+				Flush:       flush,
+				Concurrency: 3,
+				SharedConn:  shared,
+			}
+			timings := u.uploadParallel(ctx, dialer, uploadTransport{name: "tcp"}, signer)
+			require.Len(t, timings, 3)
+			for i, timing := range timings {
+				require.NoError(t, timing.err, flush)
+				require.Equal(t, int64(len(data)), timing.bytes)
+				require.Positive(t, timing.firstMessage)
+				require.Positive(t, timing.lastByte)
+				require.Positive(t, timing.commit)
+				if i == 0 || !shared {
+					require.Positive(t, timing.connect)
+					require.Positive(t, timing.handshake)
+				}
+
+				_, stored, err := backend.Read(ctx, satellite.ID, timing.pieceID)
+				require.NoError(t, err)
+				require.Equal(t, data, stored)
+			}
+			require.Zero(t, printUploadTimings(timings))
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package piece
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/elek/stbb/pkg/util"
+	"github.com/zeebo/errs/v2"
+	"storj.io/common/identity"
+	"storj.io/common/pb"
+	"storj.io/common/signing"
+	"storj.io/common/storj"
+)
+
+// Verify checks a piece with the uplink signed hash and the original order limit.
+type Verify struct {
+	util.DialerHelper
+	Piece     string        `arg:"" help:"piece file saved by 'piece download-drpc --save' (.hash and .orderlimit files are read from the same place), or the piece ID if --node-url is used"`
+	NodeURL   storj.NodeURL `help:"download the piece (with GET_REPAIR) from this node instead of reading it from the disk"`
+	Size      int64         `help:"size of the piece to download. Default is the size from the piece hash"`
+	Keys      string        `help:"location of the identity files to sign orders"`
+	Satellite string        `help:"identity directory (or identity.cert) of the satellite to verify the order limit signature. Default is the embedded identity"`
+}
+
+// clockSkew is the accepted difference between the clocks of the uplink and the satellite.
+const clockSkew = time.Hour
+
+// verifyCheck is the result of one verification step. Skipped checks are neither passed nor failed.
+type verifyCheck struct {
+	name    string
+	passed  bool
+	skipped bool
+	detail  string
+}
+
+func (v Verify) Run() error {
+	ctx := context.Background()
+
+	var data []byte
+	var hash *pb.PieceHash
+	var limit *pb.OrderLimit
+	var err error
+	if !v.NodeURL.ID.IsZero() {
+		data, hash, limit, err = v.download(ctx)
+	} else {
+		data, hash, limit, err = readSavedPiece(v.Piece)
+	}
+	if err != nil {
+		return err
+	}
+
+	satellite, err := trustedSatellite(v.Satellite)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, check := range verifyPiece(ctx, data, hash, limit, satellite, time.Now()) {
+		status := "PASS"
+		switch {
+		case check.skipped:
+			status = "SKIP"
+		case !check.passed:
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("%-5s %-22s %s\n", status, check.name, check.detail)
+	}
+	if failed > 0 {
+		return errs.Errorf("%d checks are failed", failed)
+	}
+	fmt.Println("Piece is verified")
+	return nil
+}
+
+func (v Verify) download(ctx context.Context) (data []byte, hash *pb.PieceHash, limit *pb.OrderLimit, err error) {
+	pieceID, err := storj.PieceIDFromString(v.Piece)
+	if err != nil {
+		return nil, nil, nil, errs.Wrap(err)
+	}
+	signer, err := util.NewKeySignerFromDir(v.Keys)
+	if err != nil {
+		return nil, nil, nil, errs.Wrap(err)
+	}
+	signer.Action = pb.PieceAction_GET_REPAIR
+
+	conn, err := v.Connect(ctx, v.NodeURL)
+	if err != nil {
+		return nil, nil, nil, errs.Wrap(err)
+	}
+	defer func() { _ = conn.Close() }()
+	client := pb.NewDRPCReplaySafePiecestoreClient(conn)
+
+	get := func(size int64) error {
+		_, _, err := util.DownloadPiece(ctx, client, signer, util.DownloadRequest{
+			SatelliteID: signer.GetSatelliteID(),
+			Storagenode: v.NodeURL,
+			PieceID:     pieceID,
+			Size:        size,
+		}, func(d []byte, h *pb.PieceHash, l *pb.OrderLimit) {
+			data, hash, limit = d, h, l
+		})
+		return errs.Wrap(err)
+	}
+
+	size := v.Size
+	if size == 0 {
+		// the first byte is enough to get the hash with the size
+		if err := get(1); err != nil {
+			return nil, nil, nil, err
+		}
+		if hash == nil || hash.PieceSize == 0 {
+			return nil, nil, nil, errs.Errorf("piece size is unknown, please use --size")
+		}
+		size = hash.PieceSize
+	}
+	if err := get(size); err != nil {
+		return nil, nil, nil, err
+	}
+	return data, hash, limit, nil
+}
+
+// readSavedPiece reads the piece, and the piece hash / order limit, saved next to it.
+func readSavedPiece(path string) (data []byte, hash *pb.PieceHash, limit *pb.OrderLimit, err error) {
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, errs.Wrap(err)
+	}
+	if raw, err := os.ReadFile(path + ".hash"); err == nil {
+		hash = &pb.PieceHash{}
+		if err := pb.Unmarshal(raw, hash); err != nil {
+			return nil, nil, nil, errs.Wrap(err)
+		}
+	}
+	if raw, err := os.ReadFile(path + ".orderlimit"); err == nil {
+		limit = &pb.OrderLimit{}
+		if err := pb.Unmarshal(raw, limit); err != nil {
+			return nil, nil, nil, errs.Wrap(err)
+		}
+	}
+	return data, hash, limit, nil
+}
+
+// verifyPiece checks the data against the hash, the signatures and the consistency of the hash and the order limit.
+func verifyPiece(ctx context.Context, data []byte, hash *pb.PieceHash, limit *pb.OrderLimit, satellite *identity.PeerIdentity, now time.Time) (checks []verifyCheck) {
+	check := func(name string, passed bool, format string, args ...any) {
+		checks = append(checks, verifyCheck{name: name, passed: passed, detail: fmt.Sprintf(format, args...)})
+	}
+	skip := func(name string, reason string) {
+		checks = append(checks, verifyCheck{name: name, skipped: true, detail: reason})
+	}
+
+	if hash == nil {
+		check("piece hash", false, "piece hash is missing")
+		return checks
+	}
+
+	hasher := pb.NewHashFromAlgorithm(hash.HashAlgorithm)
+	_, _ = hasher.Write(data)
+	calculated := hasher.Sum(nil)
+	if bytes.Equal(calculated, hash.Hash) {
+		check("hash", true, "%s %s", hash.HashAlgorithm, hex.EncodeToString(calculated))
+	} else {
+		check("hash", false, "%s of the data is %s, but the piece hash is %s", hash.HashAlgorithm, hex.EncodeToString(calculated), hex.EncodeToString(hash.Hash))
+	}
+
+	if hash.PieceSize == 0 {
+		skip("size", "size is not included in the piece hash")
+	} else {
+		check("size", hash.PieceSize == int64(len(data)), "data is %d bytes, piece hash has %d bytes", len(data), hash.PieceSize)
+	}
+
+	if limit == nil {
+		skip("order limit", "original order limit is missing")
+		return checks
+	}
+
+	check("piece id", hash.PieceId == limit.PieceId, "hash is signed for %s, order limit is for %s", hash.PieceId, limit.PieceId)
+	check("action", limit.Action == pb.PieceAction_PUT || limit.Action == pb.PieceAction_PUT_REPAIR, "order limit is for %s", limit.Action)
+
+	if err := signing.VerifyUplinkPieceHashSignature(ctx, limit.UplinkPublicKey, hash); err != nil {
+		check("uplink signature", false, "%v", err)
+	} else {
+		check("uplink signature", true, "signed by %s", hex.EncodeToString(limit.UplinkPublicKey.Bytes()))
+	}
+
+	if satellite == nil || satellite.ID != limit.SatelliteId {
+		skip("satellite signature", fmt.Sprintf("identity of %s is not available (use --satellite)", limit.SatelliteId))
+	} else if err := signing.VerifyOrderLimitSignature(ctx, signing.SigneeFromPeerIdentity(satellite), limit); err != nil {
+		check("satellite signature", false, "%v", err)
+	} else {
+		check("satellite signature", true, "signed by %s", limit.SatelliteId)
+	}
+
+	check("size limit", hash.PieceSize <= limit.Limit, "piece has %d bytes, order limit allowed %d bytes", hash.PieceSize, limit.Limit)
+	check("hash timestamp", !hash.Timestamp.Before(limit.OrderCreation.Add(-clockSkew)) && !hash.Timestamp.After(limit.OrderExpiration.Add(clockSkew)),
+		"hash is signed at %s, order limit is valid between %s and %s", hash.Timestamp.Format(time.RFC3339), limit.OrderCreation.Format(time.RFC3339), limit.OrderExpiration.Format(time.RFC3339))
+
+	switch {
+	case limit.PieceExpiration.IsZero():
+		check("expiration", true, "piece doesn't expire")
+	case limit.PieceExpiration.Before(now):
+		check("expiration", false, "piece is expired at %s", limit.PieceExpiration.Format(time.RFC3339))
+	default:
+		check("expiration", true, "piece expires at %s", limit.PieceExpiration.Format(time.RFC3339))
+	}
+	return checks
+}
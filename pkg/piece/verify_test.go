@@ -0,0 +1,98 @@
+package piece
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elek/stbb/pkg/util"
+	"github.com/stretchr/testify/require"
+	"storj.io/common/identity"
+	"storj.io/common/pb"
+	"storj.io/common/signing"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+	"storj.io/common/testrand"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	satellite, err := identity.FullIdentityFromPEM(util.Certificate, util.Key)
+	require.NoError(t, err)
+	nodeID := testrand.NodeID()
+	data := testrand.BytesInt(10_000)
+
+	signer := util.NewKeySignerFromFullIdentity(satellite, pb.PieceAction_PUT)
+	limit, pk, _, err := signer.CreateOrderLimit(ctx, testrand.PieceID(), int64(len(data)), nodeID)
+	require.NoError(t, err)
+	hasher := pb.NewHashFromAlgorithm(pb.PieceHashAlgorithm_BLAKE3)
+	_, _ = hasher.Write(data)
+	hash, err := signing.SignUplinkPieceHash(ctx, pk, &pb.PieceHash{
+		PieceId:       limit.PieceId,
+		Hash:          hasher.Sum(nil),
+		HashAlgorithm: pb.PieceHashAlgorithm_BLAKE3,
+		PieceSize:     int64(len(data)),
+		Timestamp:     time.Now(),
+	})
+	require.NoError(t, err)
+
+	failed := func(checks []verifyCheck) (res []string) {
+		for _, c := range checks {
+			if !c.passed && !c.skipped {
+				res = append(res, c.name)
+			}
+		}
+		return res
+	}
+
+	checks := verifyPiece(ctx, data, hash, limit, satellite.PeerIdentity(), time.Now())
+	require.Empty(t, failed(checks))
+	require.Len(t, checks, 9)
+
+	corrupted := append([]byte{}, data...)
+	corrupted[100]++
+	require.Equal(t, []string{"hash"}, failed(verifyPiece(ctx, corrupted, hash, limit, satellite.PeerIdentity(), time.Now())))
+	require.Equal(t, []string{"hash", "size"}, failed(verifyPiece(ctx, data[1:], hash, limit, satellite.PeerIdentity(), time.Now())))
+
+	tampered := *limit
+	tampered.Limit++
+	require.Equal(t, []string{"satellite signature"}, failed(verifyPiece(ctx, data, hash, &tampered, satellite.PeerIdentity(), time.Now())))
+
+	otherHash := *hash
+	otherHash.PieceSize++
+	require.Equal(t, []string{"size", "uplink signature", "size limit"}, failed(verifyPiece(ctx, data, &otherHash, limit, satellite.PeerIdentity(), time.Now())))
+
+	t.Run("saved", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), limit.PieceId.String())
+		require.NoError(t, os.WriteFile(path, data, 0644))
+		raw, err := pb.Marshal(hash)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path+".hash", raw, 0644))
+		raw, err = pb.Marshal(limit)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path+".orderlimit", raw, 0644))
+
+		require.NoError(t, Verify{Piece: path}.Run())
+		require.NoError(t, os.WriteFile(path, corrupted, 0644))
+		require.Error(t, Verify{Piece: path}.Run())
+	})
+
+	t.Run("download", func(t *testing.T) {
+		node, address, _ := startNode(ctx, t)
+		nodeURL := storj.NodeURL{ID: node.ID, Address: address}
+		limit, pk, _, err := signer.CreateOrderLimit(ctx, testrand.PieceID(), int64(len(data)), node.ID)
+		require.NoError(t, err)
+		_, err = dialNode(ctx, t, satellite, nodeURL).UploadReader(ctx, limit, pk, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		v := Verify{
+			DialerHelper: util.DialerHelper{IdentityDir: "."},
+			Piece:        limit.PieceId.String(),
+			NodeURL:      nodeURL,
+		}
+		require.NoError(t, v.Run())
+	})
+}
@@ -0,0 +1,284 @@
+package placement
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"storj.io/common/memory"
+	"storj.io/common/storj"
+	"storj.io/storj/satellite/nodeselection"
+	"storj.io/storj/satellite/overlay"
+)
+
+// Compare evaluates two placement configurations on the same node set, to review the effect of a placement change.
+type Compare struct {
+	WithNodes
+	Old       string   `required:"" help:"original placement configuration"`
+	New       string   `required:"" help:"modified placement configuration"`
+	Placement []int    `help:"placements to compare. Default is all the placements of both configurations"`
+	Attribute []string `default:"tag:provider,country" help:"node attributes for the histograms of the selected nodes"`
+	Number    int      `default:"100" help:"number of selections per placement and configuration"`
+	NodeNo    int      `default:"110" help:"number of selected nodes, if the placement doesn't define the EC parameters"`
+	Changes   int      `default:"20" help:"maximum number of nodes to print which gain or lose eligibility"`
+}
+
+func (c Compare) Run() error {
+	ctx := context.Background()
+
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	env := nodeselection.NewPlacementConfigEnvironment(nil, nil)
+	oldPlacements, err := WithPlacement{PlacementConfig: c.Old}.GetPlacement(env)
+	if err != nil {
+		return errors.Wrapf(err, "invalid placement configuration %s", c.Old)
+	}
+	newPlacements, err := WithPlacement{PlacementConfig: c.New}.GetPlacement(env)
+	if err != nil {
+		return errors.Wrapf(err, "invalid placement configuration %s", c.New)
+	}
+
+	ids, err := comparedPlacements(oldPlacements, newPlacements, c.Placement)
+	if err != nil {
+		return err
+	}
+
+	var attributes []nodeselection.NodeAttribute
+	for _, name := range c.Attribute {
+		attr, err := nodeselection.CreateNodeAttribute(name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		attributes = append(attributes, attr)
+	}
+	attribute := func(node nodeselection.SelectedNode) string {
+		var values []string
+		for _, attr := range attributes {
+			values = append(values, attr(node))
+		}
+		return strings.Join(values, ",")
+	}
+
+	nodeSource, closeDB, err := c.WithNodes.GetUploadSelectionDB(ctx, log)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	selectionConfig := overlay.NodeSelectionConfig{
+		NewNodeFraction:  0.01,
+		OnlineWindow:     4 * time.Hour,
+		MinimumDiskSpace: 5 * memory.GB,
+	}
+	reputable, newNodes, err := nodeSource.SelectAllStorageNodesUpload(ctx, selectionConfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	nodes := append(reputable, newNodes...)
+
+	oldCache, err := newCompareCache(ctx, log, nodeSource, selectionConfig, oldPlacements)
+	if err != nil {
+		return err
+	}
+	newCache, err := newCompareCache(ctx, log, nodeSource, selectionConfig, newPlacements)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		oldPlacement, inOld := oldPlacements[id]
+		newPlacement, inNew := newPlacements[id]
+		switch {
+		case !inOld:
+			fmt.Printf("=== placement %d (%s): only in %s\n", id, newPlacement.Name, c.New)
+		case !inNew:
+			fmt.Printf("=== placement %d (%s): only in %s\n", id, oldPlacement.Name, c.Old)
+		default:
+			fmt.Printf("=== placement %d (%s)\n", id, newPlacement.Name)
+		}
+
+		diff := compareEligibility(oldPlacement, inOld, newPlacement, inNew, nodes)
+		fmt.Printf("eligible nodes: %d -> %d (%d gained, %d lost)\n", diff.old, diff.new, len(diff.gained), len(diff.lost))
+		diff.print(c.Changes, attribute)
+
+		oldResult := &selectionResult{histogram: map[string]int{}}
+		if inOld {
+			oldResult = c.evaluate(ctx, oldCache, oldPlacement, attribute)
+		}
+		newResult := &selectionResult{histogram: map[string]int{}}
+		if inNew {
+			newResult = c.evaluate(ctx, newCache, newPlacement, attribute)
+		}
+		for _, r := range []struct {
+			name   string
+			result *selectionResult
+		}{{c.Old, oldResult}, {c.New, newResult}} {
+			if r.result.err != nil {
+				fmt.Printf("selection with %s is failed: %v\n", r.name, r.result.err)
+			}
+		}
+		fmt.Printf("out of placement pieces: %d -> %d (in %d -> %d selections)\n", oldResult.oopPieces, newResult.oopPieces, oldResult.oopSelections, newResult.oopSelections)
+		printHistogramDiff(strings.Join(c.Attribute, ","), oldResult, newResult)
+		fmt.Println()
+	}
+	return nil
+}
+
+// evaluate runs the selections with one placement definition.
+func (c Compare) evaluate(ctx context.Context, cache *overlay.UploadSelectionCache, placement nodeselection.Placement, attribute nodeselection.NodeAttribute) *selectionResult {
+	result := &selectionResult{histogram: map[string]int{}}
+	total := c.NodeNo
+	if placement.EC.Total > 0 {
+		total = placement.EC.Total
+	}
+	for i := 0; i < c.Number; i++ {
+		nodes, err := cache.GetNodes(ctx, overlay.FindStorageNodesRequest{
+			RequestedCount: total,
+			Placement:      placement.ID,
+		})
+		if err != nil {
+			result.err = err
+			return result
+		}
+		result.add(nodes, placement.Invariant, attribute)
+	}
+	return result
+}
+
+func newCompareCache(ctx context.Context, log *zap.Logger, nodeSource overlay.UploadSelectionDB, config overlay.NodeSelectionConfig, placements nodeselection.PlacementDefinitions) (*overlay.UploadSelectionCache, error) {
+	cache, err := overlay.NewUploadSelectionCache(log, nodeSource, 60*time.Minute, config, nil, placements)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	go func() {
+		err := cache.Run(ctx)
+		fmt.Println(err)
+	}()
+	return cache, errors.WithStack(cache.Refresh(ctx))
+}
+
+// comparedPlacements returns the requested placement IDs, or the IDs of both configurations.
+func comparedPlacements(old, new nodeselection.PlacementDefinitions, requested []int) (ids []storj.PlacementConstraint, err error) {
+	if len(requested) > 0 {
+		for _, id := range requested {
+			_, inOld := old[storj.PlacementConstraint(id)]
+			_, inNew := new[storj.PlacementConstraint(id)]
+			if !inOld && !inNew {
+				return nil, errors.Errorf("placement %d is not defined in any of the configurations", id)
+			}
+			ids = append(ids, storj.PlacementConstraint(id))
+		}
+		return ids, nil
+	}
+	seen := map[storj.PlacementConstraint]bool{}
+	for _, d := range []nodeselection.PlacementDefinitions{old, new} {
+		for id := range d {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids, nil
+}
+
+// eligibilityDiff is the difference of the nodes which can be selected for upload with the old and new definition.
+type eligibilityDiff struct {
+	old, new     int
+	gained, lost []*nodeselection.SelectedNode
+}
+
+func compareEligibility(oldPlacement nodeselection.Placement, inOld bool, newPlacement nodeselection.Placement, inNew bool, nodes []*nodeselection.SelectedNode) (diff eligibilityDiff) {
+	for _, node := range nodes {
+		oldMatch := inOld && oldPlacement.MatchForUpload(node)
+		newMatch := inNew && newPlacement.MatchForUpload(node)
+		if oldMatch {
+			diff.old++
+		}
+		if newMatch {
+			diff.new++
+		}
+		switch {
+		case newMatch && !oldMatch:
+			diff.gained = append(diff.gained, node)
+		case oldMatch && !newMatch:
+			diff.lost = append(diff.lost, node)
+		}
+	}
+	return diff
+}
+
+func (e eligibilityDiff) print(limit int, attribute nodeselection.NodeAttribute) {
+	for _, change := range []struct {
+		sign  string
+		nodes []*nodeselection.SelectedNode
+	}{{"+", e.gained}, {"-", e.lost}} {
+		for i, node := range change.nodes {
+			if i >= limit {
+				fmt.Printf("%s ... %d more\n", change.sign, len(change.nodes)-limit)
+				break
+			}
+			fmt.Printf("%s %s %s %s\n", change.sign, node.ID, node.LastNet, attribute(*node))
+		}
+	}
+}
+
+// selectionResult is the summary of the selections with one placement definition.
+type selectionResult struct {
+	selections    int
+	pieces        int
+	oopPieces     int
+	oopSelections int
+	histogram     map[string]int
+	err           error
+}
+
+func (s *selectionResult) add(nodes []*nodeselection.SelectedNode, invariant nodeselection.Invariant, attribute nodeselection.NodeAttribute) {
+	s.selections++
+	for _, node := range nodes {
+		s.histogram[attribute(*node)]++
+		s.pieces++
+	}
+	if invariant != nil {
+		pieces, invNodes := convert(nodes)
+		if oop := invariant(pieces, invNodes).Count(); oop > 0 {
+			s.oopPieces += oop
+			s.oopSelections++
+		}
+	}
+}
+
+// share returns the percentage of the pieces stored on nodes with the attribute value.
+func (s *selectionResult) share(value string) float64 {
+	if s.pieces == 0 {
+		return 0
+	}
+	return float64(s.histogram[value]) * 100 / float64(s.pieces)
+}
+
+func printHistogramDiff(name string, old, new *selectionResult) {
+	var values []string
+	for value := range old.histogram {
+		values = append(values, value)
+	}
+	for value := range new.histogram {
+		if _, found := old.histogram[value]; !found {
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	fmt.Printf("%-40s %10s %10s %10s\n", strings.ToUpper(name), "old %", "new %", "diff")
+	for _, value := range values {
+		fmt.Printf("%-40s %10.2f %10.2f %+10.2f\n", value, old.share(value), new.share(value), new.share(value)-old.share(value))
+	}
+}
@@ -0,0 +1,78 @@
+package placement
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"storj.io/common/storj"
+	"storj.io/common/testrand"
+	"storj.io/storj/satellite/nodeselection"
+	"storj.io/storj/shared/location"
+)
+
+func TestCompare(t *testing.T) {
+	placements, err := nodeselection.LoadConfigFromString(`
+placements:
+  - id: 0
+    name: global
+  - id: 1
+    name: eu
+    filter: country("DE")
+    invariant: maxcontrol("last_net", 1)
+`, nodeselection.NewPlacementConfigEnvironment(nil, nil))
+	require.NoError(t, err)
+	modified, err := nodeselection.LoadConfigFromString(`
+placements:
+  - id: 1
+    name: eu
+    filter: country("DE","FR")
+  - id: 2
+    name: us
+    filter: country("US")
+`, nodeselection.NewPlacementConfigEnvironment(nil, nil))
+	require.NoError(t, err)
+
+	ids, err := comparedPlacements(placements, modified, nil)
+	require.NoError(t, err)
+	require.Equal(t, []storj.PlacementConstraint{0, 1, 2}, ids)
+	ids, err = comparedPlacements(placements, modified, []int{2})
+	require.NoError(t, err)
+	require.Equal(t, []storj.PlacementConstraint{2}, ids)
+	_, err = comparedPlacements(placements, modified, []int{1, 7})
+	require.Error(t, err)
+
+	node := func(country location.CountryCode, net string) *nodeselection.SelectedNode {
+		return &nodeselection.SelectedNode{ID: testrand.NodeID(), CountryCode: country, LastNet: net}
+	}
+	nodes := []*nodeselection.SelectedNode{
+		node(location.Germany, "1.1.1"),
+		node(location.Germany, "1.1.1"),
+		node(location.France, "2.2.2"),
+		node(location.UnitedStates, "3.3.3"),
+	}
+
+	diff := compareEligibility(placements[1], true, modified[1], true, nodes)
+	require.Equal(t, 2, diff.old)
+	require.Equal(t, 3, diff.new)
+	require.Equal(t, []*nodeselection.SelectedNode{nodes[2]}, diff.gained)
+	require.Empty(t, diff.lost)
+
+	diff = compareEligibility(placements[0], true, modified[0], false, nodes)
+	require.Equal(t, 4, diff.old)
+	require.Equal(t, 0, diff.new)
+	require.Len(t, diff.lost, 4)
+
+	country, err := nodeselection.CreateNodeAttribute("country")
+	require.NoError(t, err)
+	old := &selectionResult{histogram: map[string]int{}}
+	old.add(nodes[:2], placements[1].Invariant, country)
+	require.Equal(t, 1, old.oopSelections)
+	require.Equal(t, 1, old.oopPieces)
+	require.Equal(t, 100.0, old.share("DE"))
+
+	new := &selectionResult{histogram: map[string]int{}}
+	new.add(nodes[1:3], modified[1].Invariant, country)
+	require.Equal(t, 0, new.oopSelections)
+	require.Equal(t, 50.0, new.share("FR"))
+	require.Equal(t, 0.0, new.share("US"))
+}
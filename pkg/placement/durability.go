@@ -0,0 +1,248 @@
+package placement
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"storj.io/common/memory"
+	"storj.io/common/storj"
+	"storj.io/storj/satellite/nodeselection"
+	"storj.io/storj/satellite/overlay"
+)
+
+// Durability simulates segment selections for each placement, and reports the risk of losing pieces when all the nodes
+// with the same attribute value (provider, subnet, country, ...) fail at the same time.
+type Durability struct {
+	WithPlacement
+	WithNodes
+	Attributes []string `default:"last_net,wallet,email,country,tag:provider" help:"node attributes used as failure domains"`
+	Number     int      `default:"1000" help:"number of simulated segment selections per placement"`
+	NodeNo     int      `default:"110" help:"number of selected nodes, if the placement doesn't define the EC parameters"`
+	Minimum    int      `default:"29" help:"number of pieces required to restore the segment, if the placement doesn't define the EC parameters"`
+	Lost       int      `help:"k: failure of a domain is counted if k or more pieces are lost. Default is the loss of the segment (number of pieces - minimum + 1)"`
+	Top        int      `default:"10" help:"number of the most dangerous failure domains to print per placement"`
+}
+
+func (s Durability) Run() error {
+	ctx := context.Background()
+
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	d, err := s.WithPlacement.GetPlacement(nodeselection.NewPlacementConfigEnvironment(nil, nil))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var attributes []nodeselection.NodeAttribute
+	for _, name := range s.Attributes {
+		attr, err := nodeselection.CreateNodeAttribute(name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		attributes = append(attributes, attr)
+	}
+
+	nodeSource, closeDB, err := s.WithNodes.GetUploadSelectionDB(ctx, log)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	cache, err := overlay.NewUploadSelectionCache(log, nodeSource, 60*time.Minute, overlay.NodeSelectionConfig{
+		NewNodeFraction:  0.01,
+		OnlineWindow:     4 * time.Hour,
+		MinimumDiskSpace: 5 * memory.GB,
+	}, nil, d)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	go func() {
+		if err := cache.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Println("node cache is failed:", err)
+		}
+	}()
+
+	start := time.Now()
+	err = cache.Refresh(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	log.Info("Node cache is loaded", zap.Duration("duration", time.Since(start)))
+
+	var placements []storj.PlacementConstraint
+	for id := range d {
+		placements = append(placements, id)
+	}
+	sort.Slice(placements, func(i, j int) bool {
+		return placements[i] < placements[j]
+	})
+
+	for _, id := range placements {
+		placement := d[id]
+		total, minimum := s.NodeNo, s.Minimum
+		if placement.EC.Total > 0 {
+			total = placement.EC.Total
+		}
+		if placement.EC.Minimum > 0 {
+			minimum = placement.EC.Minimum
+		}
+		lost := total - minimum + 1
+		if s.Lost > 0 {
+			lost = s.Lost
+		}
+
+		fmt.Printf("placement %d (%s): %d selections of %d nodes, failure is losing %d or more pieces\n", id, placement.Name, s.Number, total, lost)
+		risk := newDurabilityRisk(s.Attributes, attributes, lost)
+		for i := 0; i < s.Number; i++ {
+			nodes, err := cache.GetNodes(ctx, overlay.FindStorageNodesRequest{
+				RequestedCount: total,
+				Placement:      id,
+			})
+			if err != nil {
+				fmt.Println("   selection is failed:", err)
+				break
+			}
+			risk.Add(nodes)
+		}
+		risk.Print(s.Top)
+		fmt.Println()
+	}
+	return nil
+}
+
+// durabilityRisk counts the simulated selections where the failure of one attribute value loses too many pieces.
+type durabilityRisk struct {
+	names      []string
+	attributes []nodeselection.NodeAttribute
+	lost       int
+	selections int
+	// failed is the number of selections where at least one value of the attribute loses the segment.
+	failed []int
+	// unknown is the number of selected nodes without value for the attribute (e.g. untagged nodes).
+	// They are not counted as one failure domain.
+	unknown []int
+	domains map[failureDomain]*failureDomainStat
+}
+
+// failureDomain is one value of a node attribute.
+type failureDomain struct {
+	attribute int
+	value     string
+}
+
+type failureDomainStat struct {
+	failed    int
+	pieces    int
+	maxPieces int
+}
+
+func newDurabilityRisk(names []string, attributes []nodeselection.NodeAttribute, lost int) *durabilityRisk {
+	return &durabilityRisk{
+		names:      names,
+		attributes: attributes,
+		lost:       lost,
+		failed:     make([]int, len(attributes)),
+		unknown:    make([]int, len(attributes)),
+		domains:    map[failureDomain]*failureDomainStat{},
+	}
+}
+
+// Add registers one selection.
+func (d *durabilityRisk) Add(nodes []*nodeselection.SelectedNode) {
+	d.selections++
+	for ix, attribute := range d.attributes {
+		counters := map[string]int{}
+		for _, node := range nodes {
+			value := attribute(*node)
+			if value == "" {
+				d.unknown[ix]++
+				continue
+			}
+			counters[value]++
+		}
+		failed := false
+		for value, count := range counters {
+			domain := failureDomain{attribute: ix, value: value}
+			stat, found := d.domains[domain]
+			if !found {
+				stat = &failureDomainStat{}
+				d.domains[domain] = stat
+			}
+			stat.pieces += count
+			stat.maxPieces = max(stat.maxPieces, count)
+			if count >= d.lost {
+				stat.failed++
+				failed = true
+			}
+		}
+		if failed {
+			d.failed[ix]++
+		}
+	}
+}
+
+// Probability returns the ratio of the selections where the failure of the domain loses k or more pieces.
+func (d *durabilityRisk) Probability(domain failureDomain) float64 {
+	if d.selections == 0 || d.domains[domain] == nil {
+		return 0
+	}
+	return float64(d.domains[domain].failed) / float64(d.selections)
+}
+
+// Ranked returns the failure domains, the most dangerous first.
+func (d *durabilityRisk) Ranked() []failureDomain {
+	var domains []failureDomain
+	for domain := range d.domains {
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		a, b := d.domains[domains[i]], d.domains[domains[j]]
+		if a.failed != b.failed {
+			return a.failed > b.failed
+		}
+		if a.maxPieces != b.maxPieces {
+			return a.maxPieces > b.maxPieces
+		}
+		if a.pieces != b.pieces {
+			return a.pieces > b.pieces
+		}
+		if domains[i].attribute != domains[j].attribute {
+			return domains[i].attribute < domains[j].attribute
+		}
+		return domains[i].value < domains[j].value
+	})
+	return domains
+}
+
+// Print prints the risk per attribute, and the top most dangerous failure domains.
+func (d *durabilityRisk) Print(top int) {
+	if d.selections == 0 {
+		return
+	}
+	fmt.Printf("   %-30s %12s %12s %12s\n", "ATTRIBUTE", "P(lost>=k)", "domains", "avg_unknown")
+	for ix, name := range d.names {
+		values := 0
+		for domain := range d.domains {
+			if domain.attribute == ix {
+				values++
+			}
+		}
+		fmt.Printf("   %-30s %12.4f %12d %12.2f\n", name, float64(d.failed[ix])/float64(d.selections), values, float64(d.unknown[ix])/float64(d.selections))
+	}
+	fmt.Println()
+	fmt.Printf("   %-20s %-40s %12s %12s %12s\n", "ATTRIBUTE", "VALUE", "P(lost>=k)", "max_pieces", "avg_pieces")
+	for i, domain := range d.Ranked() {
+		if i >= top {
+			break
+		}
+		stat := d.domains[domain]
+		fmt.Printf("   %-20s %-40s %12.4f %12d %12.2f\n", d.names[domain.attribute], domain.value, d.Probability(domain), stat.maxPieces, float64(stat.pieces)/float64(d.selections))
+	}
+}
@@ -0,0 +1,86 @@
+package placement
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"storj.io/common/testrand"
+	"storj.io/storj/satellite/nodeselection"
+)
+
+func TestDurabilityRisk(t *testing.T) {
+	lastNet, err := nodeselection.CreateNodeAttribute("last_net")
+	require.NoError(t, err)
+	wallet, err := nodeselection.CreateNodeAttribute("wallet")
+	require.NoError(t, err)
+
+	selection := func(nets ...string) (nodes []*nodeselection.SelectedNode) {
+		for _, net := range nets {
+			nodes = append(nodes, &nodeselection.SelectedNode{
+				ID:      testrand.NodeID(),
+				LastNet: net,
+				Wallet:  "0x1",
+			})
+		}
+		return nodes
+	}
+
+	risk := newDurabilityRisk([]string{"last_net", "wallet"}, []nodeselection.NodeAttribute{lastNet, wallet}, 3)
+	risk.Add(selection("a", "a", "a", "b"))
+	risk.Add(selection("a", "b", "c", "d"))
+	risk.Add(selection("b", "b", "c", "d"))
+	risk.Add(selection("c", "c", "c", "c"))
+
+	require.Equal(t, []int{2, 4}, risk.failed)
+	require.Equal(t, 1.0, risk.Probability(failureDomain{attribute: 1, value: "0x1"}))
+	require.Equal(t, 0.25, risk.Probability(failureDomain{attribute: 0, value: "a"}))
+	require.Equal(t, 0.0, risk.Probability(failureDomain{attribute: 0, value: "b"}))
+	require.Equal(t, 0.0, risk.Probability(failureDomain{attribute: 0, value: "x"}))
+
+	ranked := risk.Ranked()
+	require.Len(t, ranked, 5)
+	require.Equal(t, []failureDomain{
+		{attribute: 1, value: "0x1"},
+		{attribute: 0, value: "c"},
+		{attribute: 0, value: "a"},
+		{attribute: 0, value: "b"},
+		{attribute: 0, value: "d"},
+	}, ranked)
+	require.Equal(t, 4, risk.domains[ranked[1]].maxPieces)
+	require.Equal(t, 6, risk.domains[ranked[1]].pieces)
+}
+
+func TestDurabilityRiskUnknown(t *testing.T) {
+	provider, err := nodeselection.CreateNodeAttribute("tag:provider")
+	require.NoError(t, err)
+	email, err := nodeselection.CreateNodeAttribute("email")
+	require.NoError(t, err)
+
+	signer := testrand.NodeID()
+	selection := func(providers ...string) (nodes []*nodeselection.SelectedNode) {
+		for _, p := range providers {
+			node := &nodeselection.SelectedNode{ID: testrand.NodeID()}
+			if p != "" {
+				node.Email = p + "@example.com"
+				node.Tags = nodeselection.NodeTags{{NodeID: node.ID, Signer: signer, Name: "provider", Value: []byte(p)}}
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+
+	risk := newDurabilityRisk([]string{"tag:provider", "email"}, []nodeselection.NodeAttribute{provider, email}, 3)
+	// the untagged nodes are independent, they don't lose the segment together
+	risk.Add(selection("", "", "", "x"))
+	risk.Add(selection("", "", "x", "x"))
+	risk.Add(selection("x", "x", "x", ""))
+
+	require.Equal(t, []int{1, 1}, risk.failed)
+	require.Equal(t, []int{6, 6}, risk.unknown)
+	require.Equal(t, []failureDomain{
+		{attribute: 0, value: "x"},
+		{attribute: 1, value: "x@example.com"},
+	}, risk.Ranked())
+	require.Equal(t, 0.0, risk.Probability(failureDomain{attribute: 0, value: ""}))
+	require.Equal(t, 1.0/3, risk.Probability(failureDomain{attribute: 0, value: "x"}))
+}
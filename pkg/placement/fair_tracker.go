@@ -32,3 +32,28 @@ func (f *FairTracker) BumpGeneration() {
 }
 
 var _ nodeselection.ScoreNode = &FairTracker{}
+
+// Fair is a TrackerWrap which prefers the nodes with fewer recent uploads.
+type Fair struct {
+	tracker *FairTracker
+}
+
+func (f *Fair) Increment(nodes []*nodeselection.SelectedNode, success int) {
+	for i := 0; i < success && i < len(nodes); i++ {
+		f.tracker.Update(nodes[i])
+	}
+}
+
+func (f *Fair) Bump() {
+	f.tracker.BumpGeneration()
+}
+
+func (f *Fair) InitScoreNode() nodeselection.ScoreNode {
+	f.tracker = NewFairTracker()
+	return f.tracker
+}
+
+func (f *Fair) Debug() {
+}
+
+var _ TrackerWrap = &Fair{}
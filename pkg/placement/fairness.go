@@ -0,0 +1,195 @@
+package placement
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"storj.io/common/storj"
+	"storj.io/storj/satellite/nodeselection"
+)
+
+// SuccessRate is a TrackerWrap which scores the nodes by the ratio of the successful uploads, similar to the
+// success tracker of the satellite. Older results are decayed at each generation.
+type SuccessRate struct {
+	success map[storj.NodeID]float64
+	total   map[storj.NodeID]float64
+}
+
+func (s *SuccessRate) Increment(nodes []*nodeselection.SelectedNode, success int) {
+	for i, node := range nodes {
+		if i < success {
+			s.success[node.ID]++
+		}
+		s.total[node.ID]++
+	}
+}
+
+func (s *SuccessRate) Bump() {
+	for k := range s.total {
+		s.success[k] *= 0.9
+		s.total[k] *= 0.9
+	}
+}
+
+func (s *SuccessRate) InitScoreNode() nodeselection.ScoreNode {
+	s.success = map[storj.NodeID]float64{}
+	s.total = map[storj.NodeID]float64{}
+	return s
+}
+
+func (s *SuccessRate) Get(uplink storj.NodeID) func(node *nodeselection.SelectedNode) float64 {
+	return func(node *nodeselection.SelectedNode) float64 {
+		total := s.total[node.ID]
+		if total == 0 {
+			return math.NaN()
+		}
+		return s.success[node.ID] / total
+	}
+}
+
+func (s *SuccessRate) Debug() {
+}
+
+var _ TrackerWrap = &SuccessRate{}
+var _ nodeselection.UploadSuccessTracker = &SuccessRate{}
+
+// fairness records the share of the uploads of each node during a time-stepped simulation.
+type fairness struct {
+	nodes []*nodeselection.SelectedNode
+	index map[storj.NodeID]int
+	// rate is the simulated upload success rate of each node.
+	rate     []float64
+	selected []int
+	uploads  []int
+	step     []int
+}
+
+// newFairness creates the statistics for the nodes. Success rates are uniformly distributed between minRate and
+// maxRate, and derived from the node ID, to make the rates of the nodes the same in different runs.
+func newFairness(nodes []*nodeselection.SelectedNode, minRate, maxRate float64) *fairness {
+	f := &fairness{
+		nodes:    nodes,
+		index:    map[storj.NodeID]int{},
+		rate:     make([]float64, len(nodes)),
+		selected: make([]int, len(nodes)),
+		uploads:  make([]int, len(nodes)),
+		step:     make([]int, len(nodes)),
+	}
+	for i, node := range nodes {
+		f.index[node.ID] = i
+		fraction := float64(binary.BigEndian.Uint64(node.ID[:8])) / math.MaxUint64
+		f.rate[i] = minRate + (maxRate-minRate)*fraction
+	}
+	return f
+}
+
+// Upload simulates one upload to the selected nodes. Each node finishes the upload with its own success rate, and
+// the first `success` finished uploads are kept (the rest are cancelled, as the long tail of the uplink).
+// Returns with the nodes reordered: successful uploads first. The number of the successful uploads is also returned.
+func (f *fairness) Upload(rng *rand.Rand, selected []*nodeselection.SelectedNode, success int) ([]*nodeselection.SelectedNode, int) {
+	var finished, failed []*nodeselection.SelectedNode
+	for _, node := range selected {
+		ix, found := f.index[node.ID]
+		if !found {
+			// not part of the initial population, count it as a failure
+			failed = append(failed, node)
+			continue
+		}
+		f.selected[ix]++
+		if rng.Float64() < f.rate[ix] {
+			finished = append(finished, node)
+		} else {
+			failed = append(failed, node)
+		}
+	}
+	rng.Shuffle(len(finished), func(i, j int) {
+		finished[i], finished[j] = finished[j], finished[i]
+	})
+	if len(finished) > success {
+		failed = append(failed, finished[success:]...)
+		finished = finished[:success]
+	}
+	for _, node := range finished {
+		f.uploads[f.index[node.ID]]++
+		f.step[f.index[node.ID]]++
+	}
+	return append(finished, failed...), len(finished)
+}
+
+// EndStep returns the Gini coefficient of the uploads of the last step, and resets the step counters.
+func (f *fairness) EndStep() float64 {
+	g := gini(f.step)
+	for i := range f.step {
+		f.step[i] = 0
+	}
+	return g
+}
+
+// Starving returns the number of nodes without any successful upload.
+func (f *fairness) Starving() (count int) {
+	for _, u := range f.uploads {
+		if u == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// Ranked returns the node indexes ordered by the number of uploads, the most used first.
+func (f *fairness) Ranked() []int {
+	var ranked []int
+	for i := range f.nodes {
+		ranked = append(ranked, i)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return f.uploads[ranked[i]] > f.uploads[ranked[j]]
+	})
+	return ranked
+}
+
+// Print prints the most and the least used nodes.
+func (f *fairness) Print(top int) {
+	sum := 0
+	for _, u := range f.uploads {
+		sum += u
+	}
+	if sum == 0 {
+		sum = 1
+	}
+	printNodes := func(ranked []int) {
+		fmt.Printf("%-52s %-24s %8s %10s %10s %8s\n", "ID", "ADDRESS", "rate", "selected", "uploads", "share%")
+		for _, ix := range ranked {
+			address := ""
+			if f.nodes[ix].Address != nil {
+				address = f.nodes[ix].Address.Address
+			}
+			fmt.Printf("%-52s %-24s %8.3f %10d %10d %8.4f\n", f.nodes[ix].ID, address, f.rate[ix], f.selected[ix], f.uploads[ix], float64(f.uploads[ix])*100/float64(sum))
+		}
+	}
+	ranked := f.Ranked()
+	top = min(top, len(ranked))
+	fmt.Println("Top nodes:")
+	printNodes(ranked[:top])
+	fmt.Println()
+	fmt.Println("Bottom nodes:")
+	printNodes(ranked[len(ranked)-top:])
+}
+
+// gini returns the Gini coefficient of the values: 0 if all the values are equal, close to 1 if one value has everything.
+func gini(values []int) float64 {
+	sorted := append([]int{}, values...)
+	sort.Ints(sorted)
+	var sum, weighted float64
+	for i, v := range sorted {
+		sum += float64(v)
+		weighted += float64(i+1) * float64(v)
+	}
+	if sum == 0 {
+		return 0
+	}
+	n := float64(len(sorted))
+	return 2*weighted/(n*sum) - (n+1)/n
+}
@@ -0,0 +1,64 @@
+package placement
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"storj.io/common/storj"
+	"storj.io/common/testrand"
+	"storj.io/storj/satellite/nodeselection"
+)
+
+func TestGini(t *testing.T) {
+	require.Equal(t, 0.0, gini(nil))
+	require.Equal(t, 0.0, gini([]int{0, 0, 0}))
+	require.InDelta(t, 0.0, gini([]int{5, 5, 5, 5}), 1e-9)
+	require.InDelta(t, 0.75, gini([]int{0, 0, 0, 8}), 1e-9)
+	require.InDelta(t, 0.25, gini([]int{1, 2, 3, 4}), 1e-9)
+}
+
+func TestFairness(t *testing.T) {
+	var nodes []*nodeselection.SelectedNode
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, &nodeselection.SelectedNode{ID: testrand.NodeID()})
+	}
+	stat := newFairness(nodes, 0.2, 0.8)
+	for _, rate := range stat.rate {
+		require.GreaterOrEqual(t, rate, 0.2)
+		require.LessOrEqual(t, rate, 0.8)
+	}
+	require.Equal(t, stat.rate, newFairness(nodes, 0.2, 0.8).rate)
+
+	// with 100% success rate, the first `success` nodes are successful
+	stat = newFairness(nodes, 1, 1)
+	tracker := &SuccessRate{}
+	score := tracker.InitScoreNode().Get(storj.NodeID{})
+	require.True(t, math.IsNaN(score(nodes[0])))
+
+	rng := rand.New(rand.NewSource(1))
+	unknown := &nodeselection.SelectedNode{ID: testrand.NodeID()}
+	ordered, success := stat.Upload(rng, append([]*nodeselection.SelectedNode{unknown}, nodes[:6]...), 4)
+	require.Equal(t, 4, success)
+	require.Len(t, ordered, 7)
+	require.Contains(t, ordered[4:], unknown)
+	tracker.Increment(ordered, success)
+	for _, node := range ordered[:4] {
+		require.Equal(t, 1.0, score(node))
+	}
+	for _, node := range ordered[4:] {
+		require.Equal(t, 0.0, score(node))
+	}
+	tracker.Bump()
+	require.InDelta(t, 1.0, score(ordered[0]), 1e-9)
+
+	require.Equal(t, 6, stat.Starving())
+	require.Equal(t, gini(stat.uploads), stat.EndStep())
+	require.Equal(t, make([]int, 10), stat.step)
+	ranked := stat.Ranked()
+	for _, ix := range ranked[:4] {
+		require.Equal(t, 1, stat.uploads[ix])
+		require.Equal(t, 1, stat.selected[ix])
+	}
+}
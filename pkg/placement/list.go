@@ -6,7 +6,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/elek/stbb/pkg/db"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -17,7 +16,7 @@ import (
 )
 
 type List struct {
-	db.WithDatabase
+	WithNodes
 	WithPlacement
 	Placement  int      `help:"placement to use"`
 	Attributes []string `help:"node attributes to print out"`
@@ -32,15 +31,13 @@ func (s List) Run() error {
 		return errors.WithStack(err)
 	}
 
-	satelliteDB, err := s.WithDatabase.GetSatelliteDB(ctx, log)
+	nodeSource, closeDB, err := s.WithNodes.GetUploadSelectionDB(ctx, log)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
-	defer func() {
-		satelliteDB.Close()
-	}()
+	defer closeDB()
 
-	reputableNodes, newNodes, err := satelliteDB.OverlayCache().SelectAllStorageNodesUpload(ctx, overlay.NodeSelectionConfig{
+	reputableNodes, newNodes, err := nodeSource.SelectAllStorageNodesUpload(ctx, overlay.NodeSelectionConfig{
 		NewNodeFraction: 0.01,
 		OnlineWindow:    4 * time.Hour,
 	})
@@ -3,7 +3,6 @@ package placement
 import (
 	"context"
 	"fmt"
-	"github.com/elek/stbb/pkg/db"
 	"github.com/elek/stbb/pkg/util"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -16,7 +15,7 @@ import (
 
 type Nodes struct {
 	WithPlacement
-	db.WithDatabase
+	WithNodes
 	Selector []string
 	Filter   string
 
@@ -57,13 +56,13 @@ func (s Nodes) Run() error {
 		}
 
 	}
-	satelliteDB, err := s.WithDatabase.GetSatelliteDB(ctx, log)
+	nodeSource, closeDB, err := s.WithNodes.GetUploadSelectionDB(ctx, log)
 	if err != nil {
 		return err
 	}
-	defer satelliteDB.Close()
+	defer closeDB()
 
-	oldNodes, newNodes, err := satelliteDB.OverlayCache().SelectAllStorageNodesUpload(ctx, overlay.NodeSelectionConfig{
+	oldNodes, newNodes, err := nodeSource.SelectAllStorageNodesUpload(ctx, overlay.NodeSelectionConfig{
 		OnlineWindow:     s.OnlineWindow,
 		MinimumDiskSpace: s.MinimumDiskSpace,
 	})
@@ -1,11 +1,16 @@
 package placement
 
 import (
+	"context"
 	"os"
+	"time"
 
+	"github.com/elek/stbb/pkg/db"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 	"storj.io/storj/satellite/nodeselection"
+	"storj.io/storj/satellite/overlay"
 )
 
 type Placement struct {
@@ -20,6 +25,11 @@ type Placement struct {
 	Replicasets  Replicasets  `cmd:"" help:"experiments with replicasets"`
 	DownloadPool DownloadPool `cmd:"" help:"test download pool, with requesting downloads from satellite and classify received nodes"`
 	Download     Download     `cmd:"" help:"initiate a download request and print out the selected nodes (using satellite)"`
+	Snapshot     Snapshot     `cmd:"" help:"save the participating nodes to a file, which can be used with --snapshot"`
+	Generate     Generate     `cmd:"" help:"generate a synthetic node population from a spec, and save it as a snapshot"`
+	Durability   Durability   `cmd:"" help:"durability risk report of all the placements, for failure of nodes with the same attribute"`
+	Compare      Compare      `cmd:"" help:"compare two placement configurations on the same node set"`
+	Repl         Repl         `cmd:"" help:"interactive evaluation of filters, selectors and score expressions on the loaded nodes"`
 }
 
 type WithPlacement struct {
@@ -44,3 +54,70 @@ func (w WithPlacement) GetPlacement(environment nodeselection.PlacementConfigEnv
 
 	return nodeselection.LoadConfigFromString(placementDef.(string), environment)
 }
+
+// WithNodes loads the nodes from the satellite database, from a snapshot file, or from a generated population.
+type WithNodes struct {
+	db.WithDatabase
+	Snapshot   string `help:"load the nodes from a snapshot file (see 'placement snapshot') instead of the satellite database"`
+	Population string `help:"generate the nodes from a population spec (see 'placement generate') instead of the satellite database"`
+}
+
+// loadSnapshot returns the nodes of the snapshot or population, or nil if the nodes should be loaded from the database.
+func (w WithNodes) loadSnapshot() (*nodeSnapshot, error) {
+	switch {
+	case w.Snapshot != "" && w.Population != "":
+		return nil, errors.New("only one of --snapshot and --population can be used")
+	case w.Snapshot != "":
+		return loadNodeSnapshot(w.Snapshot)
+	case w.Population != "":
+		spec, err := loadPopulationSpec(w.Population)
+		if err != nil {
+			return nil, err
+		}
+		nodes, err := spec.generate()
+		if err != nil {
+			return nil, err
+		}
+		return newNodeSnapshot(nodes), nil
+	}
+	return nil, nil
+}
+
+// GetUploadSelectionDB returns the source of the upload selection cache. The returned function closes the database.
+func (w WithNodes) GetUploadSelectionDB(ctx context.Context, log *zap.Logger) (overlay.UploadSelectionDB, func(), error) {
+	snapshot, err := w.loadSnapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+	if snapshot != nil {
+		return snapshot, func() {}, nil
+	}
+	satelliteDB, err := w.WithDatabase.GetSatelliteDB(ctx, log)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	return satelliteDB.OverlayCache(), func() {
+		satelliteDB.Close()
+	}, nil
+}
+
+// GetParticipatingNodes returns all the participating nodes. Online status of the snapshots is based on the
+// online window of the snapshot.
+func (w WithNodes) GetParticipatingNodes(ctx context.Context, log *zap.Logger, onlineWindow, asOfSystemInterval time.Duration) ([]nodeselection.SelectedNode, error) {
+	snapshot, err := w.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		return snapshot.selectedNodes(), nil
+	}
+	satelliteDB, err := w.WithDatabase.GetSatelliteDB(ctx, log)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() {
+		satelliteDB.Close()
+	}()
+	nodes, err := satelliteDB.OverlayCache().GetAllParticipatingNodes(ctx, onlineWindow, asOfSystemInterval)
+	return nodes, errors.WithStack(err)
+}
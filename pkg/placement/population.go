@@ -0,0 +1,312 @@
+package placement
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"storj.io/common/memory"
+	"storj.io/common/pb"
+	"storj.io/common/storj"
+	"storj.io/storj/satellite/nodeselection"
+	"storj.io/storj/shared/location"
+)
+
+// Generate creates a synthetic node population from a spec, and saves it as a snapshot.
+type Generate struct {
+	Spec   string `arg:"" help:"YAML population spec"`
+	Output string `arg:"" help:"snapshot file (gzip compressed if the name ends with .gz), which can be used with --snapshot"`
+}
+
+func (g Generate) Run() error {
+	spec, err := loadPopulationSpec(g.Spec)
+	if err != nil {
+		return err
+	}
+	nodes, err := spec.generate()
+	if err != nil {
+		return err
+	}
+	if err := newNodeSnapshot(nodes).save(g.Output); err != nil {
+		return err
+	}
+	printPopulation(nodes)
+	fmt.Printf("%d nodes are saved to %s\n", len(nodes), g.Output)
+	return nil
+}
+
+// populationSpec describes a synthetic node population as groups of similar nodes. Example:
+//
+//	seed: 1
+//	groups:
+//	  - count: 1000
+//	    provider: storj
+//	    country: DE
+//	    subnets: 50
+//	    vetted: 0.9
+//	    free-disk: {min: 1TB, max: 20TB, distribution: log}
+//	    tags:
+//	      soc2: {"true": 1}
+//	      server_group: {"group1": 0.5, "group2": 0.5}
+//	      host: {"host{subnet}": 1}
+type populationSpec struct {
+	// Seed of the random generator. The same spec with the same seed generates the same nodes.
+	Seed int64 `yaml:"seed"`
+	// Signer of the tags. Default is the signer used by the fake nodes of 'placement select-pool'.
+	Signer string            `yaml:"signer"`
+	Groups []populationGroup `yaml:"groups"`
+}
+
+// populationGroup is a set of nodes with the same provider and country.
+type populationGroup struct {
+	Count int `yaml:"count"`
+	// Provider is saved as the provider tag, and used to generate the email and wallet of the nodes.
+	Provider string `yaml:"provider"`
+	// Country is the ISO country code of the nodes.
+	Country string `yaml:"country"`
+	// Subnets is the number of different /24 subnets used by the group. Default is one subnet per node.
+	Subnets int `yaml:"subnets"`
+	// Vetted is the ratio of the vetted nodes. Default is 1.
+	Vetted   *float64     `yaml:"vetted"`
+	FreeDisk diskSpec     `yaml:"free-disk"`
+	Tags     tagWeightMap `yaml:"tags"`
+}
+
+// tagWeightMap is the relative weight of the possible values for each tag name. {n} in the value is replaced
+// by the index of the node in the group, {subnet} is replaced by the index of the subnet.
+type tagWeightMap map[string]map[string]float64
+
+// diskSpec is the distribution of the free disk space.
+type diskSpec struct {
+	Min string `yaml:"min"`
+	Max string `yaml:"max"`
+	// Distribution is uniform (default), or log (log-uniform, more small nodes than big ones).
+	Distribution string `yaml:"distribution"`
+}
+
+func loadPopulationSpec(path string) (*populationSpec, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	spec := &populationSpec{}
+	if err := yaml.Unmarshal(content, spec); err != nil {
+		return nil, errors.Wrapf(err, "invalid population spec %s", path)
+	}
+	return spec, nil
+}
+
+// generate creates the nodes of all the groups.
+func (p *populationSpec) generate() ([]nodeselection.SelectedNode, error) {
+	rng := rand.New(rand.NewSource(p.Seed))
+
+	signer, err := storj.NodeIDFromString("1111111111111111111111111111111VyS547o")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if p.Signer != "" {
+		signer, err = storj.NodeIDFromString(p.Signer)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid signer")
+		}
+	}
+
+	var nodes []nodeselection.SelectedNode
+	subnetOffset := 0
+	for gi, group := range p.Groups {
+		if group.Count <= 0 {
+			return nil, errors.Errorf("count of group %d should be positive", gi)
+		}
+		subnets := group.Subnets
+		if subnets <= 0 || subnets > group.Count {
+			subnets = group.Count
+		}
+		if (group.Count+subnets-1)/subnets > 254 {
+			return nil, errors.Errorf("group %d has more than 254 nodes in a subnet, subnets should be at least %d", gi, (group.Count+253)/254)
+		}
+		if err := group.Tags.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid tags of group %d", gi)
+		}
+		vetted := 1.0
+		if group.Vetted != nil {
+			vetted = *group.Vetted
+		}
+		freeDisk, err := group.FreeDisk.sampler()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid free disk of group %d", gi)
+		}
+		country := location.None
+		if group.Country != "" {
+			country = location.ToCountryCode(group.Country)
+			if country == location.None {
+				return nil, errors.Errorf("unknown country code in group %d: %s", gi, group.Country)
+			}
+		}
+		operator := group.Provider
+		if operator == "" {
+			operator = fmt.Sprintf("group%d", gi)
+		}
+		wallet := sha256.Sum256([]byte(operator))
+
+		for i := 0; i < group.Count; i++ {
+			var raw storj.NodeID
+			_, _ = rng.Read(raw[:])
+			id, err := storj.NodeIDFromBytes(raw[:])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			subnet := i % subnets
+			network := fakeSubnet(subnetOffset + subnet)
+			address := fmt.Sprintf("%s.%d:28967", network, i/subnets%254+1)
+
+			node := nodeselection.SelectedNode{
+				ID:          id,
+				Address:     &pb.NodeAddress{Address: address},
+				Email:       operator + "@example.com",
+				Wallet:      "0x" + hex.EncodeToString(wallet[:])[:40],
+				LastNet:     network + ".0",
+				LastIPPort:  address,
+				CountryCode: country,
+				Online:      true,
+				Vetted:      rng.Float64() < vetted,
+				FreeDisk:    freeDisk(rng),
+			}
+			if group.Provider != "" {
+				node.Tags = append(node.Tags, nodeselection.NodeTag{NodeID: id, Signer: signer, Name: "provider", Value: []byte(group.Provider)})
+			}
+			for _, name := range sortedKeys(group.Tags) {
+				value := group.Tags.pick(rng, name)
+				value = strings.ReplaceAll(value, "{n}", strconv.Itoa(i))
+				value = strings.ReplaceAll(value, "{subnet}", strconv.Itoa(subnet))
+				node.Tags = append(node.Tags, nodeselection.NodeTag{NodeID: id, Signer: signer, Name: name, Value: []byte(value)})
+			}
+			nodes = append(nodes, node)
+		}
+		subnetOffset += subnets
+	}
+	return nodes, nil
+}
+
+// validate checks if a value can be picked for each tag.
+func (t tagWeightMap) validate() error {
+	for _, name := range sortedKeys(t) {
+		if len(t[name]) == 0 {
+			return errors.Errorf("no values for tag %s", name)
+		}
+		sum := 0.0
+		for _, value := range sortedKeys(t[name]) {
+			weight := t[name][value]
+			if !(weight >= 0) || math.IsInf(weight, 1) {
+				return errors.Errorf("invalid weight of %s=%s: %v", name, value, weight)
+			}
+			sum += weight
+		}
+		if sum <= 0 {
+			return errors.Errorf("sum of the weights of tag %s should be positive", name)
+		}
+	}
+	return nil
+}
+
+// pick selects a value of the tag, based on the weights.
+func (t tagWeightMap) pick(rng *rand.Rand, name string) string {
+	values := sortedKeys(t[name])
+	sum := 0.0
+	for _, v := range values {
+		sum += t[name][v]
+	}
+	r := rng.Float64() * sum
+	for _, v := range values {
+		r -= t[name][v]
+		if r < 0 {
+			return v
+		}
+	}
+	return values[len(values)-1]
+}
+
+// sampler returns a function which generates free disk values with the distribution.
+func (d diskSpec) sampler() (func(rng *rand.Rand) int64, error) {
+	if d.Min == "" && d.Max == "" {
+		return func(rng *rand.Rand) int64 { return 10 * memory.TB.Int64() }, nil
+	}
+	var low, high memory.Size
+	if err := low.Set(d.Min); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	high = low
+	if d.Max != "" {
+		if err := high.Set(d.Max); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if high < low || low <= 0 {
+		return nil, errors.Errorf("invalid range: %s - %s", low, high)
+	}
+	switch d.Distribution {
+	case "", "uniform":
+		return func(rng *rand.Rand) int64 {
+			return low.Int64() + int64(rng.Float64()*float64(high-low))
+		}, nil
+	case "log":
+		return func(rng *rand.Rand) int64 {
+			return int64(math.Exp(math.Log(low.Float64()) + rng.Float64()*(math.Log(high.Float64())-math.Log(low.Float64()))))
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown distribution: %s", d.Distribution)
+	}
+}
+
+// fakeSubnet returns the first three octets of the nth private /24 network.
+func fakeSubnet(ix int) string {
+	return fmt.Sprintf("%d.%d.%d", 10+ix/65536, ix/256%256, ix%256)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printPopulation prints the number of nodes and the free space for each provider and country.
+func printPopulation(nodes []nodeselection.SelectedNode) {
+	type stat struct {
+		nodes, vetted int
+		freeDisk      int64
+	}
+	stats := map[string]*stat{}
+	for _, node := range nodes {
+		provider := "<none>"
+		for _, tag := range node.Tags {
+			if tag.Name == "provider" {
+				provider = string(tag.Value)
+			}
+		}
+		key := provider + "," + node.CountryCode.String()
+		if stats[key] == nil {
+			stats[key] = &stat{}
+		}
+		stats[key].nodes++
+		if node.Vetted {
+			stats[key].vetted++
+		}
+		stats[key].freeDisk += node.FreeDisk
+	}
+	fmt.Printf("%-30s %8s %8s %12s\n", "PROVIDER,COUNTRY", "nodes", "vetted", "free_disk")
+	for _, key := range sortedKeys(stats) {
+		s := stats[key]
+		fmt.Printf("%-30s %8d %8d %12s\n", key, s.nodes, s.vetted, memory.Size(s.freeDisk).String())
+	}
+}
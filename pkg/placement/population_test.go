@@ -0,0 +1,110 @@
+package placement
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"storj.io/common/memory"
+	"storj.io/storj/satellite/overlay"
+	"storj.io/storj/shared/location"
+)
+
+func TestPopulation(t *testing.T) {
+	spec := `
+seed: 42
+groups:
+  - count: 100
+    provider: storj
+    country: DE
+    subnets: 10
+    vetted: 0.5
+    free-disk: {min: 1TB, max: 10TB, distribution: log}
+    tags:
+      soc2: {"true": 1}
+      server_group: {"group1": 1, "group2": 3}
+      host: {"host{subnet}": 1}
+  - count: 20
+    country: US
+    free-disk: {min: 1GB}
+`
+	path := filepath.Join(t.TempDir(), "population.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(spec), 0644))
+
+	loaded, err := loadPopulationSpec(path)
+	require.NoError(t, err)
+	nodes, err := loaded.generate()
+	require.NoError(t, err)
+	require.Len(t, nodes, 120)
+
+	again, err := loaded.generate()
+	require.NoError(t, err)
+	require.Equal(t, nodes, again)
+
+	subnets := map[string]int{}
+	ids := map[string]bool{}
+	vetted, group2 := 0, 0
+	for i, node := range nodes {
+		ids[node.ID.String()] = true
+		subnets[node.LastNet]++
+		if i >= 100 {
+			require.Equal(t, location.UnitedStates, node.CountryCode)
+			require.Equal(t, memory.GB.Int64(), node.FreeDisk)
+			require.True(t, node.Vetted)
+			require.Empty(t, node.Tags)
+			continue
+		}
+		require.Equal(t, location.Germany, node.CountryCode)
+		require.GreaterOrEqual(t, node.FreeDisk, memory.TB.Int64())
+		require.LessOrEqual(t, node.FreeDisk, 10*memory.TB.Int64())
+		require.Equal(t, "storj@example.com", node.Email)
+		require.Len(t, node.Tags, 4)
+		require.Equal(t, "provider", node.Tags[0].Name)
+		require.Equal(t, "storj", string(node.Tags[0].Value))
+		require.Equal(t, "host"+node.LastNet[len("10.0."):len(node.LastNet)-2], string(node.Tags[1].Value))
+		if string(node.Tags[2].Value) == "group2" {
+			group2++
+		}
+		if node.Vetted {
+			vetted++
+		}
+	}
+	require.Len(t, ids, 120)
+	require.Len(t, subnets, 30)
+	require.Equal(t, 10, subnets["10.0.0.0"])
+	require.Equal(t, 1, subnets["10.0.29.0"])
+	require.InDelta(t, 50, vetted, 20)
+	require.InDelta(t, 75, group2, 20)
+
+	reputable, newNodes, err := newNodeSnapshot(nodes).SelectAllStorageNodesUpload(context.Background(), overlay.NodeSelectionConfig{
+		MinimumDiskSpace: 5 * memory.GB,
+	})
+	require.NoError(t, err)
+	require.Len(t, reputable, vetted)
+	require.Len(t, newNodes, 100-vetted)
+
+	_, err = (&populationSpec{Groups: []populationGroup{{Count: 1, Country: "Germany"}}}).generate()
+	require.Error(t, err)
+	_, err = (&populationSpec{Groups: []populationGroup{{Count: 1, FreeDisk: diskSpec{Min: "1TB", Distribution: "normal"}}}}).generate()
+	require.Error(t, err)
+
+	// a value can't be picked for the tag
+	for _, weights := range []map[string]float64{{}, {"a": 0}, {"a": 1, "b": -1}, {"a": math.NaN()}} {
+		_, err = (&populationSpec{Groups: []populationGroup{{Count: 1, Tags: tagWeightMap{"soc2": weights}}}}).generate()
+		require.Error(t, err, weights)
+	}
+
+	// all the nodes of a subnet should have different addresses
+	_, err = (&populationSpec{Groups: []populationGroup{{Count: 300, Subnets: 1}}}).generate()
+	require.Error(t, err)
+	nodes, err = (&populationSpec{Groups: []populationGroup{{Count: 508, Subnets: 2}}}).generate()
+	require.NoError(t, err)
+	addresses := map[string]bool{}
+	for _, node := range nodes {
+		addresses[node.LastIPPort] = true
+	}
+	require.Len(t, addresses, 508)
+}
@@ -0,0 +1,401 @@
+package placement
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"storj.io/common/memory"
+	"storj.io/common/storj"
+	"storj.io/storj/satellite/nodeselection"
+	"storj.io/storj/satellite/overlay"
+)
+
+// Repl loads the nodes once, and evaluates filters, selectors and score expressions interactively.
+type Repl struct {
+	WithNodes
+	History string `default:"~/.stbb-placement-history" type:"path" help:"file to save the entered commands"`
+}
+
+const replHelp = `filter <filter>       set the node filter (without argument: all nodes), print matching nodes
+select <selector>     select nodes from the filtered nodes with the selector, print histogram of the selected nodes
+score <score>         print the highest and lowest scored nodes from the filtered nodes
+attr <attr>[,<attr>]  set the node attributes used by the histograms (default: tag:provider)
+set <key> <value>     change a setting (samples, rows, nodeno, number)
+history               print the previous commands (!<n> repeats the nth command, !! the last one)
+help                  print this help
+exit                  exit (or Ctrl-D)
+`
+
+func (r Repl) Run() error {
+	ctx := context.Background()
+
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	start := time.Now()
+	nodes, err := r.WithNodes.GetParticipatingNodes(ctx, log, 4*time.Hour, -1*time.Second)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d nodes are loaded in %s. Type 'help' for the available commands.\n", len(nodes), time.Since(start))
+
+	session, err := newReplSession(ctx, zap.NewNop(), nodes, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if r.History != "" {
+		if content, err := os.ReadFile(r.History); err == nil {
+			session.history = parseHistory(string(content))
+		}
+		f, err := os.OpenFile(r.History, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		session.historyFile = f
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return errors.WithStack(scanner.Err())
+		}
+		exit, err := session.Execute(scanner.Text())
+		if err != nil {
+			fmt.Println("ERROR:", err)
+		}
+		if exit {
+			return nil
+		}
+	}
+}
+
+// parseHistory returns the commands of the history file (without empty lines).
+func parseHistory(content string) (commands []string) {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			commands = append(commands, line)
+		}
+	}
+	return commands
+}
+
+// replSession is the state of the REPL: the loaded nodes and the current settings.
+type replSession struct {
+	ctx         context.Context
+	log         *zap.Logger
+	out         io.Writer
+	nodes       []nodeselection.SelectedNode
+	filter      nodeselection.NodeFilter
+	attrNames   string
+	attribute   nodeselection.NodeAttribute
+	history     []string
+	historyFile io.Writer
+	// number of sample nodes to print
+	samples int
+	// max number of histogram rows to print
+	rows int
+	// number of nodes per selection
+	nodeNo int
+	// number of selections
+	number int
+}
+
+func newReplSession(ctx context.Context, log *zap.Logger, nodes []nodeselection.SelectedNode, out io.Writer) (*replSession, error) {
+	session := &replSession{
+		ctx:     ctx,
+		log:     log,
+		out:     out,
+		nodes:   nodes,
+		filter:  nodeselection.AnyFilter{},
+		samples: 5,
+		rows:    20,
+		nodeNo:  110,
+		number:  10,
+	}
+	return session, session.setAttribute("tag:provider")
+}
+
+// Execute executes one command. Returns true if the session should be finished.
+func (s *replSession) Execute(line string) (exit bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		ix := len(s.history)
+		if line != "!!" {
+			ix, err = strconv.Atoi(line[1:])
+			if err != nil {
+				return false, errors.Errorf("invalid history reference: %s", line)
+			}
+		}
+		if ix < 1 || ix > len(s.history) {
+			return false, errors.Errorf("no such command in the history: %s", line)
+		}
+		line = s.history[ix-1]
+		_, _ = fmt.Fprintln(s.out, line)
+	}
+	if line != "history" {
+		s.history = append(s.history, line)
+		if s.historyFile != nil {
+			_, _ = fmt.Fprintln(s.historyFile, line)
+		}
+	}
+
+	command, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch command {
+	case "exit", "quit":
+		return true, nil
+	case "help":
+		_, _ = fmt.Fprint(s.out, replHelp)
+	case "history":
+		for i := max(0, len(s.history)-50); i < len(s.history); i++ {
+			_, _ = fmt.Fprintf(s.out, "%5d  %s\n", i+1, s.history[i])
+		}
+	case "attr":
+		return false, s.setAttribute(arg)
+	case "set":
+		return false, s.set(arg)
+	case "filter":
+		return false, s.setFilter(arg)
+	case "select":
+		return false, s.selectNodes(arg)
+	case "score":
+		return false, s.score(arg)
+	default:
+		return false, errors.Errorf("unknown command: %s (type 'help' for the available commands)", command)
+	}
+	return false, nil
+}
+
+func (s *replSession) setAttribute(names string) error {
+	if names == "" {
+		return errors.New("attribute is missing")
+	}
+	var attributes []nodeselection.NodeAttribute
+	for _, name := range strings.Split(names, ",") {
+		attr, err := nodeselection.CreateNodeAttribute(strings.TrimSpace(name))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		attributes = append(attributes, attr)
+	}
+	s.attrNames = names
+	s.attribute = func(node nodeselection.SelectedNode) string {
+		var values []string
+		for _, attr := range attributes {
+			values = append(values, attr(node))
+		}
+		return strings.Join(values, ",")
+	}
+	return nil
+}
+
+func (s *replSession) set(arg string) error {
+	key, value, _ := strings.Cut(arg, " ")
+	number, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || number <= 0 {
+		return errors.Errorf("value of %s should be a positive number", key)
+	}
+	switch key {
+	case "samples":
+		s.samples = number
+	case "rows":
+		s.rows = number
+	case "nodeno":
+		s.nodeNo = number
+	case "number":
+		s.number = number
+	default:
+		return errors.Errorf("unknown setting: %s", key)
+	}
+	return nil
+}
+
+// matching returns the nodes matching the current filter.
+func (s *replSession) matching() (nodes []*nodeselection.SelectedNode) {
+	for i := range s.nodes {
+		if s.filter.Match(&s.nodes[i]) {
+			nodes = append(nodes, &s.nodes[i])
+		}
+	}
+	return nodes
+}
+
+func (s *replSession) setFilter(expr string) error {
+	filter := nodeselection.NodeFilter(nodeselection.AnyFilter{})
+	if expr != "" {
+		var err error
+		filter, err = nodeselection.FilterFromString(expr, nodeselection.NewPlacementConfigEnvironment(nil, nil))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	s.filter = filter
+
+	matching := s.matching()
+	_, _ = fmt.Fprintf(s.out, "%d of %d nodes are matching\n", len(matching), len(s.nodes))
+	s.printHistogram(matching)
+	_, _ = fmt.Fprintln(s.out)
+
+	samples := make([]*nodeselection.SelectedNode, len(matching))
+	for i, j := range rand.Perm(len(matching)) {
+		samples[i] = matching[j]
+	}
+	for _, node := range samples[:min(s.samples, len(samples))] {
+		_, _ = fmt.Fprintf(s.out, "%s %s %s %s\n", node.ID, node.LastIPPort, s.attribute(*node), memory.Size(node.FreeDisk))
+	}
+	return nil
+}
+
+func (s *replSession) selectNodes(expr string) error {
+	env := nodeselection.NewPlacementConfigEnvironment(nil, nil)
+	selector, err := nodeselection.SelectorFromString(expr, env)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var nodes []nodeselection.SelectedNode
+	for _, node := range s.matching() {
+		nodes = append(nodes, *node)
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	cache, err := overlay.NewUploadSelectionCache(s.log, newNodeSnapshot(nodes), 60*time.Minute, overlay.NodeSelectionConfig{
+		NewNodeFraction:  0.01,
+		OnlineWindow:     4 * time.Hour,
+		MinimumDiskSpace: 5 * memory.GB,
+	}, nil, nodeselection.PlacementDefinitions{
+		0: nodeselection.Placement{
+			ID:           0,
+			Selector:     selector,
+			NodeFilter:   nodeselection.AnyFilter{},
+			UploadFilter: nodeselection.AnyFilter{},
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	go func() {
+		_ = cache.Run(ctx)
+	}()
+	if err := cache.Refresh(ctx); err != nil {
+		return errors.WithStack(err)
+	}
+
+	var selected []*nodeselection.SelectedNode
+	for i := 0; i < s.number; i++ {
+		selection, err := cache.GetNodes(ctx, overlay.FindStorageNodesRequest{
+			RequestedCount: s.nodeNo,
+			Placement:      0,
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		selected = append(selected, selection...)
+	}
+	_, _ = fmt.Fprintf(s.out, "%d selections of %d nodes from %d nodes (%d selected nodes)\n", s.number, s.nodeNo, len(nodes), len(selected))
+	s.printHistogram(selected)
+	return nil
+}
+
+func (s *replSession) score(expr string) error {
+	score, err := scoreFromString(expr)
+	if err != nil {
+		return err
+	}
+	get := score.Get(storj.NodeID{})
+
+	type scored struct {
+		node  *nodeselection.SelectedNode
+		score float64
+	}
+	var nodes []scored
+	for _, node := range s.matching() {
+		nodes = append(nodes, scored{node: node, score: get(node)})
+	}
+	if len(nodes) == 0 {
+		_, _ = fmt.Fprintln(s.out, "no matching nodes")
+		return nil
+	}
+	// NaN is not comparable: these nodes are sorted to the end, and excluded from the statistics
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i].score, nodes[j].score
+		if math.IsNaN(a) || math.IsNaN(b) {
+			return !math.IsNaN(a)
+		}
+		return a > b
+	})
+	valid := len(nodes)
+	for valid > 0 && math.IsNaN(nodes[valid-1].score) {
+		valid--
+	}
+	if valid < len(nodes) {
+		_, _ = fmt.Fprintf(s.out, "%d nodes have NaN score\n", len(nodes)-valid)
+	}
+	nodes = nodes[:valid]
+	if len(nodes) == 0 {
+		return nil
+	}
+	_, _ = fmt.Fprintf(s.out, "%d nodes, max: %f, median: %f, min: %f\n", len(nodes), nodes[0].score, nodes[len(nodes)/2].score, nodes[len(nodes)-1].score)
+
+	// highest and lowest scored nodes (without overlap, if there are only a few nodes)
+	n := min(s.samples, len(nodes))
+	for _, group := range [][]scored{nodes[:n], nodes[max(n, len(nodes)-n):]} {
+		if len(group) == 0 {
+			continue
+		}
+		_, _ = fmt.Fprintln(s.out)
+		for _, node := range group {
+			_, _ = fmt.Fprintf(s.out, "%f %s %s\n", node.score, node.node.ID, s.attribute(*node.node))
+		}
+	}
+	return nil
+}
+
+// printHistogram prints the number of nodes for each value of the current attributes, the most frequent first.
+func (s *replSession) printHistogram(nodes []*nodeselection.SelectedNode) {
+	counts := map[string]int{}
+	for _, node := range nodes {
+		counts[s.attribute(*node)]++
+	}
+	var values []string
+	for value := range counts {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if counts[values[i]] != counts[values[j]] {
+			return counts[values[i]] > counts[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	_, _ = fmt.Fprintf(s.out, "%-40s %8s %8s\n", strings.ToUpper(s.attrNames), "count", "%")
+	for i, value := range values {
+		if i >= s.rows {
+			_, _ = fmt.Fprintf(s.out, "... %d more values\n", len(values)-s.rows)
+			break
+		}
+		_, _ = fmt.Fprintf(s.out, "%-40s %8d %8.2f\n", value, counts[value], float64(counts[value])*100/float64(len(nodes)))
+	}
+}
@@ -0,0 +1,118 @@
+package placement
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"storj.io/common/memory"
+	"storj.io/common/pb"
+	"storj.io/common/testrand"
+	"storj.io/storj/satellite/nodeselection"
+	"storj.io/storj/shared/location"
+)
+
+func TestRepl(t *testing.T) {
+	signer := testrand.NodeID()
+	var nodes []nodeselection.SelectedNode
+	for i := 0; i < 20; i++ {
+		id := testrand.NodeID()
+		country := location.Germany
+		if i%4 == 0 {
+			country = location.UnitedStates
+		}
+		nodes = append(nodes, nodeselection.SelectedNode{
+			ID:          id,
+			Address:     &pb.NodeAddress{Address: fmt.Sprintf("10.0.%d.1:28967", i)},
+			LastNet:     fmt.Sprintf("10.0.%d.0", i),
+			LastIPPort:  fmt.Sprintf("10.0.%d.1:28967", i),
+			CountryCode: country,
+			Online:      true,
+			Vetted:      true,
+			FreeDisk:    int64(i+1) * memory.TB.Int64(),
+			Tags: nodeselection.NodeTags{
+				{NodeID: id, Signer: signer, Name: "provider", Value: []byte(fmt.Sprintf("provider%d", i%2))},
+			},
+		})
+	}
+
+	out := &bytes.Buffer{}
+	history := &bytes.Buffer{}
+	session, err := newReplSession(context.Background(), zap.NewNop(), nodes, out)
+	require.NoError(t, err)
+	session.historyFile = history
+
+	execute := func(line string) string {
+		out.Reset()
+		exit, err := session.Execute(line)
+		require.NoError(t, err)
+		require.False(t, exit)
+		return out.String()
+	}
+
+	result := execute(`filter country("DE")`)
+	require.Contains(t, result, "15 of 20 nodes are matching")
+	require.Contains(t, result, "provider1")
+
+	execute("attr country")
+	result = execute("filter")
+	require.Contains(t, result, "20 of 20 nodes are matching")
+	require.Regexp(t, `DE\s+15\s+75.00`, result)
+
+	execute("set number 3")
+	execute("set nodeno 4")
+	result = execute(`select random()`)
+	require.Contains(t, result, "3 selections of 4 nodes from 20 nodes (12 selected nodes)")
+
+	result = execute(`score node_value("free_disk")`)
+	require.Contains(t, result, fmt.Sprintf("max: %f", float64(20*memory.TB.Int64())))
+	require.Contains(t, result, fmt.Sprintf("min: %f", float64(memory.TB.Int64())))
+
+	// fewer nodes than 2*samples: the highest and lowest groups don't overlap
+	execute(`filter country("US")`)
+	execute("set samples 3")
+	result = execute(`score node_value("free_disk")`)
+	for i := 0; i < 20; i += 4 {
+		require.Equal(t, 1, strings.Count(result, nodes[i].ID.String()))
+	}
+	execute("set samples 5")
+	execute("filter")
+
+	result = execute("!1")
+	require.Contains(t, result, "15 of 20 nodes are matching")
+
+	result = execute("history")
+	require.Contains(t, result, "   13  filter country(\"DE\")")
+	require.Equal(t, 13, strings.Count(history.String(), "\n"))
+
+	_, err = session.Execute("filter country(")
+	require.Error(t, err)
+	_, err = session.Execute("!100")
+	require.Error(t, err)
+	_, err = session.Execute("set samples x")
+	require.Error(t, err)
+
+	exit, err := session.Execute("exit")
+	require.NoError(t, err)
+	require.True(t, exit)
+
+	// nodes without free disk have NaN score
+	session, err = newReplSession(context.Background(), zap.NewNop(), []nodeselection.SelectedNode{
+		{ID: testrand.NodeID(), FreeDisk: memory.TB.Int64()},
+		{ID: testrand.NodeID()},
+		{ID: testrand.NodeID(), FreeDisk: memory.TB.Int64()},
+	}, out)
+	require.NoError(t, err)
+	result = execute(`score node_value("free_disk") / node_value("free_disk")`)
+	require.Contains(t, result, "1 nodes have NaN score")
+	require.Contains(t, result, "2 nodes, max: 1.000000, median: 1.000000, min: 1.000000")
+	require.Equal(t, 1, strings.Count(result, "NaN"))
+
+	require.Empty(t, parseHistory(""))
+	require.Empty(t, parseHistory("\n \n"))
+	require.Equal(t, []string{"filter", "attr country"}, parseHistory("filter\n\n  attr country  \n"))
+}
@@ -3,7 +3,6 @@ package placement
 import (
 	"context"
 	"fmt"
-	"github.com/elek/stbb/pkg/db"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"sort"
@@ -18,7 +17,7 @@ func SelectWithReplicaset() {
 }
 
 type Replicasets struct {
-	db.WithDatabase
+	WithNodes
 	Attribute string `default:"tag:host"`
 	Filter    string
 }
@@ -31,13 +30,13 @@ func (r Replicasets) Run() error {
 		return errors.WithStack(err)
 	}
 
-	satelliteDB, err := r.WithDatabase.GetSatelliteDB(ctx, log)
+	nodeSource, closeDB, err := r.WithNodes.GetUploadSelectionDB(ctx, log)
 	if err != nil {
 		return err
 	}
-	defer satelliteDB.Close()
+	defer closeDB()
 
-	oldNodes, newNodes, err := satelliteDB.OverlayCache().SelectAllStorageNodesUpload(ctx, overlay.NodeSelectionConfig{
+	oldNodes, newNodes, err := nodeSource.SelectAllStorageNodesUpload(ctx, overlay.NodeSelectionConfig{
 		OnlineWindow:     4 * time.Hour,
 		MinimumDiskSpace: 500 * memory.GB,
 	})
@@ -3,7 +3,6 @@ package placement
 import (
 	"context"
 	"fmt"
-	"github.com/elek/stbb/pkg/db"
 	"github.com/jtolio/mito"
 	"github.com/pkg/errors"
 	"reflect"
@@ -18,7 +17,7 @@ import (
 )
 
 type Score struct {
-	db.WithDatabase
+	WithNodes
 	Filter string `default:""`
 	Score  string `default:"node_value(\"free_disk\")"`
 }
@@ -33,36 +32,18 @@ func (n *Score) Run() (err error) {
 
 	of := &oneTracker{}
 
-	satelliteDB, err := n.WithDatabase.GetSatelliteDB(ctx, log)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	defer func() {
-		satelliteDB.Close()
-	}()
-
 	filter, err := nodeselection.FilterFromString(n.Filter, nodeselection.PlacementConfigEnvironment{})
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	nodes, err := satelliteDB.OverlayCache().GetAllParticipatingNodes(ctx, 4*time.Hour, -1*time.Second)
+	nodes, err := n.WithNodes.GetParticipatingNodes(ctx, log, 4*time.Hour, -1*time.Second)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	env := map[any]any{
-		"node_attribute":       nodeselection.CreateNodeAttribute,
-		"node_value":           nodeselection.CreateNodeValue,
-		"uploadSuccessTracker": &oneTracker{},
-	}
-	nodeselection.AddArithmetic(env)
-	score, err := mito.Eval(n.Score, env)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	sc, err := nodeselection.ConvertType(score, reflect.TypeOf(new(nodeselection.ScoreNode)).Elem())
+	sc, err := scoreFromString(n.Score)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
 
 	var attributes []nodeselection.NodeAttribute
@@ -74,19 +55,38 @@ func (n *Score) Run() (err error) {
 		attributes = append(attributes, attribute)
 	}
 	sort.Slice(nodes, func(i, j int) bool {
-		s1 := sc.(nodeselection.ScoreNode).Get(storj.NodeID{})(&nodes[i])
-		s2 := sc.(nodeselection.ScoreNode).Get(storj.NodeID{})(&nodes[j])
+		s1 := sc.Get(storj.NodeID{})(&nodes[i])
+		s2 := sc.Get(storj.NodeID{})(&nodes[j])
 		return s1 < s2
 	})
 	for _, n := range nodes {
 		if filter.Match(&n) {
-			fmt.Println(n.ID, of.Get(storj.NodeID{})(&n), sc.(nodeselection.ScoreNode).Get(storj.NodeID{})(&n), tags(n, attributes))
+			fmt.Println(n.ID, of.Get(storj.NodeID{})(&n), sc.Get(storj.NodeID{})(&n), tags(n, attributes))
 		}
 	}
 
 	return nil
 }
 
+// scoreFromString parses a score expression. Upload success tracker returns the same value for each node.
+func scoreFromString(expr string) (nodeselection.ScoreNode, error) {
+	env := map[any]any{
+		"node_attribute":       nodeselection.CreateNodeAttribute,
+		"node_value":           nodeselection.CreateNodeValue,
+		"uploadSuccessTracker": &oneTracker{},
+	}
+	nodeselection.AddArithmetic(env)
+	score, err := mito.Eval(expr, env)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sc, err := nodeselection.ConvertType(score, reflect.TypeOf(new(nodeselection.ScoreNode)).Elem())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return sc.(nodeselection.ScoreNode), nil
+}
+
 func tags(n nodeselection.SelectedNode, attributes []nodeselection.NodeAttribute) string {
 	var res []string
 	for _, a := range attributes {
@@ -3,7 +3,6 @@ package placement
 import (
 	"context"
 	"fmt"
-	"github.com/elek/stbb/pkg/db"
 	"github.com/elek/stbb/pkg/util"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -19,7 +18,7 @@ import (
 
 type Select struct {
 	WithPlacement
-	db.WithDatabase
+	WithNodes
 	Placement  int
 	NodeNo     int    `default:"110"`
 	Selector   string `default:"wallet"`
@@ -39,15 +38,13 @@ func (s Select) Run() error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	satelliteDB, err := s.WithDatabase.GetSatelliteDB(ctx, log)
+	nodeSource, closeDB, err := s.WithNodes.GetUploadSelectionDB(ctx, log)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
-	defer func() {
-		satelliteDB.Close()
-	}()
+	defer closeDB()
 
-	cache, err := overlay.NewUploadSelectionCache(log, satelliteDB.OverlayCache(), 60*time.Minute, overlay.NodeSelectionConfig{
+	cache, err := overlay.NewUploadSelectionCache(log, nodeSource, 60*time.Minute, overlay.NodeSelectionConfig{
 		NewNodeFraction:  0.01,
 		OnlineWindow:     4 * time.Hour,
 		MinimumDiskSpace: 5 * memory.GB,
@@ -8,7 +8,6 @@ import (
 	"sort"
 
 	"github.com/elek/stbb/pkg/cohorts"
-	"github.com/elek/stbb/pkg/db"
 	"github.com/pkg/errors"
 	"golang.org/x/exp/maps"
 	"storj.io/common/testrand"
@@ -26,12 +25,12 @@ import (
 
 type SelectPool struct {
 	WithPlacement
-	db.WithDatabase
+	WithNodes
 	Placement storj.PlacementConstraint
 	Selector  string
 	Values    string
 	CSV       bool
-	Tracker   string `default:"noop"`
+	Tracker   string `default:"noop" help:"upload tracker used by the selectors (noop, fair, success)"`
 	Rps       int    `default:"400"`
 	K         int    `default:"1000000"`
 	FakeNodes int    `default:"0" help:"Number of fake nodes to use instead of db"`
@@ -75,16 +74,9 @@ func (n *SelectPool) Run() (err error) {
 		return strings.Join(result, ",")
 	}
 
-	var tw TrackerWrap
-	switch n.Tracker {
-	case "noop":
-		tw = &Noop{}
-	//case "fair":
-	//	tw = &Fair{}
-	//case "bitshift":
-	//	tw = &BitShift{}
-	default:
-		return errors.New("unknown tracker: " + n.Tracker)
+	tw, err := newTrackerWrap(n.Tracker)
+	if err != nil {
+		return err
 	}
 
 	var cancelFilter nodeselection.NodeFilter
@@ -150,14 +142,12 @@ func (n *SelectPool) Run() (err error) {
 		nodeSource = &NodeList{Nodes: nodes}
 
 	} else {
-		satelliteDB, err := n.WithDatabase.GetSatelliteDB(ctx, log)
+		var closeDB func()
+		nodeSource, closeDB, err = n.WithNodes.GetUploadSelectionDB(ctx, log)
 		if err != nil {
-			return errors.WithStack(err)
+			return err
 		}
-		defer func() {
-			satelliteDB.Close()
-		}()
-		nodeSource = satelliteDB.OverlayCache()
+		defer closeDB()
 	}
 
 	cache, err := overlay.NewUploadSelectionCache(log, nodeSource, 60*time.Minute, overlay.NodeSelectionConfig{
@@ -351,6 +341,21 @@ type TrackerWrap interface {
 	Debug()
 }
 
+func newTrackerWrap(name string) (TrackerWrap, error) {
+	switch name {
+	case "noop":
+		return &Noop{}, nil
+	case "fair":
+		return &Fair{}, nil
+	case "success":
+		return &SuccessRate{}, nil
+	//case "bitshift":
+	//	return &BitShift{}, nil
+	default:
+		return nil, errors.New("unknown tracker: " + name)
+	}
+}
+
 type Noop struct {
 }
 
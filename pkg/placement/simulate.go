@@ -3,9 +3,9 @@ package placement
 import (
 	"context"
 	"fmt"
-	"github.com/elek/stbb/pkg/db"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"math/rand"
 	"storj.io/common/memory"
 	"storj.io/common/storj"
 	"storj.io/storj/satellite/nodeselection"
@@ -14,11 +14,19 @@ import (
 )
 
 type Simulate struct {
-	db.WithDatabase
+	WithNodes
 	Selector string
 	Filter   string
 	NodeNo   int `default:"110"`
-	Number   int `default:"1"`
+	Number   int `default:"1" help:"number of selections (per step, if steps are used)"`
+
+	Steps   int     `help:"number of time steps of the fairness simulation. Without steps, the number of selections per node is printed"`
+	Tracker string  `default:"noop" help:"upload tracker used by the selector and updated after each upload (noop, fair, success)"`
+	Success int     `default:"65" help:"number of successful uploads to keep from each selection (the rest is cancelled)"`
+	MinRate float64 `default:"0.5" help:"minimum of the simulated upload success rates of the nodes"`
+	MaxRate float64 `default:"1.0" help:"maximum of the simulated upload success rates of the nodes"`
+	Top     int     `default:"10" help:"number of the most and least used nodes to print after the fairness simulation"`
+	Seed    int64   `default:"1" help:"seed of the simulated upload results"`
 }
 
 func (s Simulate) Run() error {
@@ -29,15 +37,18 @@ func (s Simulate) Run() error {
 		return errors.WithStack(err)
 	}
 
-	satelliteDB, err := s.WithDatabase.GetSatelliteDB(ctx, log)
+	nodeSource, closeDB, err := s.WithNodes.GetUploadSelectionDB(ctx, log)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
-	defer func() {
-		satelliteDB.Close()
-	}()
+	defer closeDB()
 
-	env := nodeselection.NewPlacementConfigEnvironment(nil, nil)
+	tw, err := newTrackerWrap(s.Tracker)
+	if err != nil {
+		return err
+	}
+
+	env := nodeselection.NewPlacementConfigEnvironment(tw.InitScoreNode(), &NoopFailureTracker{})
 	selectorInit, err := nodeselection.SelectorFromString(s.Selector, env)
 	if err != nil {
 		return errors.WithStack(err)
@@ -55,11 +66,12 @@ func (s Simulate) Run() error {
 		},
 	}
 
-	cache, err := overlay.NewUploadSelectionCache(log, satelliteDB.OverlayCache(), 60*time.Minute, overlay.NodeSelectionConfig{
+	selectionConfig := overlay.NodeSelectionConfig{
 		NewNodeFraction:  0.01,
 		OnlineWindow:     4 * time.Hour,
 		MinimumDiskSpace: 5 * memory.GB,
-	}, nil, d)
+	}
+	cache, err := overlay.NewUploadSelectionCache(log, nodeSource, 60*time.Minute, selectionConfig, nil, d)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -76,6 +88,20 @@ func (s Simulate) Run() error {
 	}
 	log.Info("Node cache is loaded", zap.Duration("duration", time.Since(start)))
 
+	if s.Steps > 0 {
+		reputable, newNodes, err := nodeSource.SelectAllStorageNodesUpload(ctx, selectionConfig)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		var population []*nodeselection.SelectedNode
+		for _, node := range append(reputable, newNodes...) {
+			if f.Match(node) {
+				population = append(population, node)
+			}
+		}
+		return s.fairness(ctx, cache, tw, population)
+	}
+
 	nodes := map[storj.NodeID]*nodeselection.SelectedNode{}
 	selected := map[storj.NodeID]int{}
 	for i := 0; i < s.Number; i++ {
@@ -98,3 +124,30 @@ func (s Simulate) Run() error {
 	}
 	return nil
 }
+
+// fairness runs the time-stepped simulation: each step performs the selections, simulates the uploads, and
+// updates the tracker with the results.
+func (s Simulate) fairness(ctx context.Context, cache *overlay.UploadSelectionCache, tw TrackerWrap, population []*nodeselection.SelectedNode) error {
+	rng := rand.New(rand.NewSource(s.Seed))
+	stat := newFairness(population, s.MinRate, s.MaxRate)
+	fmt.Printf("%d nodes, %d steps, %d selections per step, tracker: %s\n", len(population), s.Steps, s.Number, s.Tracker)
+	fmt.Printf("%6s %12s %12s %10s\n", "step", "gini(step)", "gini(total)", "starving")
+	for step := 0; step < s.Steps; step++ {
+		for i := 0; i < s.Number; i++ {
+			selection, err := cache.GetNodes(ctx, overlay.FindStorageNodesRequest{
+				RequestedCount: s.NodeNo,
+				Placement:      storj.PlacementConstraint(0),
+				Requester:      storj.NodeID{},
+			})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			tw.Increment(stat.Upload(rng, selection, s.Success))
+		}
+		tw.Bump()
+		fmt.Printf("%6d %12.4f %12.4f %10d\n", step, stat.EndStep(), gini(stat.uploads), stat.Starving())
+	}
+	fmt.Println()
+	stat.Print(s.Top)
+	return nil
+}
@@ -0,0 +1,300 @@
+package placement
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elek/stbb/pkg/db"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"storj.io/common/pb"
+	"storj.io/common/storj"
+	"storj.io/storj/satellite/nodeselection"
+	"storj.io/storj/satellite/overlay"
+	"storj.io/storj/shared/location"
+)
+
+// Snapshot saves the participating nodes to a file, to run selection experiments without database access.
+type Snapshot struct {
+	db.WithDatabase
+	Output       string        `arg:"" help:"snapshot file (gzip compressed if the name ends with .gz)"`
+	OnlineWindow time.Duration `default:"4h" help:"nodes are saved as online if they were contacted in this window"`
+	Anonymize    bool          `help:"replace node IDs, addresses, emails and wallets with consistent pseudonyms. Tags and countries are kept, as placement rules depend on them"`
+}
+
+func (s Snapshot) Run() error {
+	ctx := context.Background()
+
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	satelliteDB, err := s.WithDatabase.GetSatelliteDB(ctx, log)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		satelliteDB.Close()
+	}()
+
+	nodes, err := satelliteDB.OverlayCache().GetAllParticipatingNodes(ctx, s.OnlineWindow, -1*time.Second)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	snapshot := newNodeSnapshot(nodes)
+	if s.Anonymize {
+		if err := snapshot.anonymize(); err != nil {
+			return err
+		}
+	}
+	if err := snapshot.save(s.Output); err != nil {
+		return err
+	}
+	fmt.Printf("%d nodes are saved to %s\n", len(snapshot.Nodes), s.Output)
+	return nil
+}
+
+// nodeSnapshot is the saved state of the participating nodes.
+type nodeSnapshot struct {
+	Created    time.Time      `json:"created"`
+	Anonymized bool           `json:"anonymized"`
+	Nodes      []snapshotNode `json:"nodes"`
+}
+
+// snapshotNode is the serialized form of nodeselection.SelectedNode.
+type snapshotNode struct {
+	ID         storj.NodeID  `json:"id"`
+	Address    string        `json:"address"`
+	Email      string        `json:"email,omitempty"`
+	Wallet     string        `json:"wallet,omitempty"`
+	LastNet    string        `json:"last_net"`
+	LastIPPort string        `json:"last_ip_port"`
+	Country    string        `json:"country,omitempty"`
+	Exiting    bool          `json:"exiting,omitempty"`
+	Suspended  bool          `json:"suspended,omitempty"`
+	Online     bool          `json:"online"`
+	Vetted     bool          `json:"vetted"`
+	PieceCount int64         `json:"piece_count"`
+	FreeDisk   int64         `json:"free_disk"`
+	Tags       []snapshotTag `json:"tags,omitempty"`
+}
+
+// snapshotTag is a signed node tag. Values are saved as strings, to make it easy to edit the snapshots.
+type snapshotTag struct {
+	Signer   storj.NodeID `json:"signer"`
+	SignedAt time.Time    `json:"signed_at"`
+	Name     string       `json:"name"`
+	Value    string       `json:"value"`
+}
+
+func newNodeSnapshot(nodes []nodeselection.SelectedNode) *nodeSnapshot {
+	snapshot := &nodeSnapshot{
+		Created: time.Now(),
+	}
+	for _, node := range nodes {
+		saved := snapshotNode{
+			ID:         node.ID,
+			Email:      node.Email,
+			Wallet:     node.Wallet,
+			LastNet:    node.LastNet,
+			LastIPPort: node.LastIPPort,
+			Exiting:    node.Exiting,
+			Suspended:  node.Suspended,
+			Online:     node.Online,
+			Vetted:     node.Vetted,
+			PieceCount: node.PieceCount,
+			FreeDisk:   node.FreeDisk,
+		}
+		if node.Address != nil {
+			saved.Address = node.Address.Address
+		}
+		if node.CountryCode != location.None {
+			saved.Country = node.CountryCode.String()
+		}
+		for _, tag := range node.Tags {
+			saved.Tags = append(saved.Tags, snapshotTag{
+				Signer:   tag.Signer,
+				SignedAt: tag.SignedAt,
+				Name:     tag.Name,
+				Value:    string(tag.Value),
+			})
+		}
+		snapshot.Nodes = append(snapshot.Nodes, saved)
+	}
+	return snapshot
+}
+
+// selectedNodes converts the saved nodes back to nodeselection.SelectedNode.
+func (s *nodeSnapshot) selectedNodes() []nodeselection.SelectedNode {
+	var nodes []nodeselection.SelectedNode
+	for _, saved := range s.Nodes {
+		node := nodeselection.SelectedNode{
+			ID: saved.ID,
+			Address: &pb.NodeAddress{
+				Address: saved.Address,
+			},
+			Email:      saved.Email,
+			Wallet:     saved.Wallet,
+			LastNet:    saved.LastNet,
+			LastIPPort: saved.LastIPPort,
+			Exiting:    saved.Exiting,
+			Suspended:  saved.Suspended,
+			Online:     saved.Online,
+			Vetted:     saved.Vetted,
+			PieceCount: saved.PieceCount,
+			FreeDisk:   saved.FreeDisk,
+		}
+		if saved.Country != "" {
+			node.CountryCode = location.ToCountryCode(saved.Country)
+		}
+		for _, tag := range saved.Tags {
+			node.Tags = append(node.Tags, nodeselection.NodeTag{
+				NodeID:   saved.ID,
+				SignedAt: tag.SignedAt,
+				Signer:   tag.Signer,
+				Name:     tag.Name,
+				Value:    []byte(tag.Value),
+			})
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// SelectAllStorageNodesUpload implements overlay.UploadSelectionDB, with the same conditions as the database query.
+func (s *nodeSnapshot) SelectAllStorageNodesUpload(ctx context.Context, selectionCfg overlay.NodeSelectionConfig) (reputable, new []*nodeselection.SelectedNode, err error) {
+	nodes := s.selectedNodes()
+	for i := range nodes {
+		node := &nodes[i]
+		if !node.Online || node.Exiting || node.Suspended || node.FreeDisk < selectionCfg.MinimumDiskSpace.Int64() {
+			continue
+		}
+		if node.Vetted {
+			reputable = append(reputable, node)
+		} else {
+			new = append(new, node)
+		}
+	}
+	return reputable, new, nil
+}
+
+var _ overlay.UploadSelectionDB = &nodeSnapshot{}
+
+// anonymize replaces the identifying fields with pseudonyms. The same value gets the same pseudonym in one snapshot
+// (but not in different snapshots), therefore grouping by wallet, email or subnet gives the same result.
+func (s *nodeSnapshot) anonymize() error {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return errors.WithStack(err)
+	}
+	pseudonym := func(kind string, value string) []byte {
+		mac := hmac.New(sha256.New, salt)
+		_, _ = mac.Write([]byte(kind + ":" + value))
+		return mac.Sum(nil)
+	}
+
+	nets := map[string]string{}
+	hosts := map[string]int{}
+	for i := range s.Nodes {
+		node := &s.Nodes[i]
+
+		id, err := storj.NodeIDFromBytes(pseudonym("id", node.ID.String()))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		node.ID = id
+
+		if node.Email != "" {
+			node.Email = "operator-" + hex.EncodeToString(pseudonym("email", node.Email))[:10] + "@example.com"
+		}
+		if node.Wallet != "" {
+			node.Wallet = "0x" + hex.EncodeToString(pseudonym("wallet", node.Wallet))[:40]
+		}
+
+		// subnets are mapped to 10.x.y.0 networks, nodes of the same subnet get different host addresses
+		fakeNet, found := nets[node.LastNet]
+		if !found {
+			ix := len(nets)
+			fakeNet = fakeSubnet(ix)
+			nets[node.LastNet] = fakeNet
+		}
+		hosts[fakeNet]++
+		port := "28967"
+		if _, p, err := net.SplitHostPort(node.LastIPPort); err == nil {
+			port = p
+		}
+		node.LastNet = fakeNet + ".0"
+		node.LastIPPort = net.JoinHostPort(fmt.Sprintf("%s.%d", fakeNet, (hosts[fakeNet]-1)%254+1), port)
+		node.Address = node.LastIPPort
+	}
+	s.Anonymized = true
+	return nil
+}
+
+func (s *nodeSnapshot) save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var out io.Writer = f
+	var gz *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		gz = gzip.NewWriter(f)
+		out = gz
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", " ")
+	if err := encoder.Encode(s); err != nil {
+		return errors.WithStack(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(f.Close())
+}
+
+func loadNodeSnapshot(path string) (*nodeSnapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var in io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer func() {
+			_ = gz.Close()
+		}()
+		in = gz
+	}
+	snapshot := &nodeSnapshot{}
+	if err := json.NewDecoder(in).Decode(snapshot); err != nil {
+		return nil, errors.Wrapf(err, "invalid snapshot file %s", path)
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,85 @@
+package placement
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"storj.io/common/memory"
+	"storj.io/common/pb"
+	"storj.io/common/testrand"
+	"storj.io/storj/satellite/nodeselection"
+	"storj.io/storj/satellite/overlay"
+	"storj.io/storj/shared/location"
+)
+
+func TestSnapshot(t *testing.T) {
+	signer := testrand.NodeID()
+	node := func(net string, host int, wallet string, freeDisk memory.Size) nodeselection.SelectedNode {
+		id := testrand.NodeID()
+		return nodeselection.SelectedNode{
+			ID:          id,
+			Address:     &pb.NodeAddress{Address: "node.example.com:28967"},
+			Email:       "operator@example.com",
+			Wallet:      wallet,
+			LastNet:     net + ".0",
+			LastIPPort:  fmt.Sprintf("%s.%d:28967", net, host),
+			CountryCode: location.Germany,
+			Online:      true,
+			Vetted:      host%2 == 0,
+			FreeDisk:    freeDisk.Int64(),
+			Tags: nodeselection.NodeTags{
+				{NodeID: id, Signer: signer, SignedAt: time.Unix(1700000000, 0).UTC(), Name: "soc2", Value: []byte("true")},
+			},
+		}
+	}
+	nodes := []nodeselection.SelectedNode{
+		node("1.2.3", 1, "0x1", memory.TB),
+		node("1.2.3", 2, "0x1", memory.TB),
+		node("5.6.7", 3, "0x2", memory.TB),
+		node("5.6.7", 4, "0x3", memory.GB),
+	}
+	offline := node("8.8.8", 5, "0x4", memory.TB)
+	offline.Online = false
+	nodes = append(nodes, offline)
+
+	for _, name := range []string{"nodes.json", "nodes.json.gz"} {
+		path := filepath.Join(t.TempDir(), name)
+		require.NoError(t, newNodeSnapshot(nodes).save(path))
+		loaded, err := loadNodeSnapshot(path)
+		require.NoError(t, err)
+		require.Equal(t, nodes, loaded.selectedNodes())
+	}
+
+	snapshot := newNodeSnapshot(nodes)
+	reputable, newNodes, err := snapshot.SelectAllStorageNodesUpload(context.Background(), overlay.NodeSelectionConfig{
+		MinimumDiskSpace: 5 * memory.GB,
+	})
+	require.NoError(t, err)
+	require.Len(t, reputable, 1)
+	require.Len(t, newNodes, 2)
+	require.Equal(t, nodes[1].ID, reputable[0].ID)
+
+	require.NoError(t, snapshot.anonymize())
+	require.True(t, snapshot.Anonymized)
+	anonymized := snapshot.selectedNodes()
+	for i, n := range anonymized {
+		require.NotEqual(t, nodes[i].ID, n.ID)
+		require.Equal(t, n.ID, n.Tags[0].NodeID)
+		require.Equal(t, nodes[i].Tags[0].Value, n.Tags[0].Value)
+		require.Equal(t, location.Germany, n.CountryCode)
+		require.NotEqual(t, nodes[i].Wallet, n.Wallet)
+		require.NotEqual(t, nodes[i].LastIPPort, n.LastIPPort)
+		require.Equal(t, n.LastIPPort, n.Address.Address)
+	}
+	// nodes of the same subnet / wallet are still in the same group
+	require.Equal(t, anonymized[0].LastNet, anonymized[1].LastNet)
+	require.NotEqual(t, anonymized[0].LastIPPort, anonymized[1].LastIPPort)
+	require.Equal(t, anonymized[2].LastNet, anonymized[3].LastNet)
+	require.NotEqual(t, anonymized[1].LastNet, anonymized[2].LastNet)
+	require.Equal(t, anonymized[0].Wallet, anonymized[1].Wallet)
+	require.NotEqual(t, anonymized[2].Wallet, anonymized[3].Wallet)
+}
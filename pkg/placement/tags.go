@@ -3,7 +3,6 @@ package placement
 import (
 	"context"
 	"fmt"
-	"github.com/elek/stbb/pkg/db"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"golang.org/x/exp/maps"
@@ -14,7 +13,7 @@ import (
 )
 
 type Tags struct {
-	db.WithDatabase
+	WithNodes
 	ValueTags   []string `help:"node tags to check the value" default:""`
 	CategoryTag string   `help:"node tags to categorize nodes" default:"tag:server_group"`
 	Filter      string   `help:"additional display only node filter" default:""`
@@ -34,15 +33,7 @@ func (s Tags) Run() error {
 		return err
 	}
 
-	satelliteDB, err := s.WithDatabase.GetSatelliteDB(ctx, log)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	defer func() {
-		satelliteDB.Close()
-	}()
-
-	nodes, err := satelliteDB.OverlayCache().GetAllParticipatingNodes(ctx, 4*time.Hour, 10*time.Millisecond)
+	nodes, err := s.WithNodes.GetParticipatingNodes(ctx, log, 4*time.Hour, 10*time.Millisecond)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -0,0 +1,399 @@
+package satellite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elek/stbb/pkg/util"
+	"github.com/zeebo/errs/v2"
+	"storj.io/common/errs2"
+	"storj.io/common/identity"
+	"storj.io/common/pb"
+	"storj.io/common/rpc"
+	"storj.io/common/rpc/rpcstatus"
+	"storj.io/common/signing"
+	"storj.io/common/storj"
+)
+
+// audit outcomes, as they are classified by the audit verifier of the satellite.
+const (
+	auditSuccess   = "success"
+	auditFailure   = "failure"
+	auditOffline   = "offline"
+	auditUnknown   = "unknown"
+	auditContained = "contained"
+)
+
+// AuditNode audits random stripes of the pieces of a storage node, and calculates the reputation of the node.
+type AuditNode struct {
+	URL            string        `arg:"" help:"storage node URL (id@address)"`
+	Pieces         string        `arg:"" help:"CSV file with the segments of the node (output of 'node piece-list')"`
+	Keys           string        `help:"directory of the satellite identity (identity.cert/identity.key). Default is the embedded identity"`
+	Audits         int           `default:"100" help:"number of audits to execute (random pieces and stripes)"`
+	ShareSize      int           `default:"256" help:"erasure share size of the segments"`
+	RequiredShares int           `default:"29" help:"required shares of the segments, if the piece list doesn't include it"`
+	Timeout        time.Duration `default:"30s" help:"timeout of one share download. Timed out nodes are contained and reverified"`
+	Reverify       int           `default:"3" help:"number of reverifications of contained nodes before the audit is failed"`
+	SkipHash       bool          `help:"don't download the full pieces to verify the shares against the signed piece hash"`
+	Verbose        bool          `help:"print the result of each audit"`
+
+	InitialAlpha  float64 `default:"1000" help:"initial alpha value of the reputations"`
+	InitialBeta   float64 `default:"0" help:"initial beta value of the reputations"`
+	Lambda        float64 `default:"0.999" help:"forgetting factor of the audit reputation"`
+	Weight        float64 `default:"1.0" help:"normalization weight of the reputations"`
+	DQ            float64 `default:"0.96" help:"audit score cut-off for disqualification"`
+	UnknownLambda float64 `default:"0.95" help:"forgetting factor of the unknown audit reputation"`
+	UnknownDQ     float64 `default:"0.6" help:"unknown audit score cut-off for disqualification"`
+}
+
+// auditedPiece is one line of the piece list.
+type auditedPiece struct {
+	id             storj.PieceID
+	encryptedSize  int64
+	requiredShares int
+}
+
+func (a AuditNode) Run() error {
+	ctx := context.Background()
+	if a.ShareSize <= 0 || a.RequiredShares <= 0 || a.Audits <= 0 {
+		return errs.Errorf("share size, required shares and number of audits should be positive")
+	}
+
+	nodeURL, err := storj.ParseNodeURL(a.URL)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	pieces, err := a.readPieces(nodeURL.ID)
+	if err != nil {
+		return err
+	}
+	if len(pieces) == 0 {
+		return errs.Errorf("no pieces in %s", a.Pieces)
+	}
+
+	var ident *identity.FullIdentity
+	if a.Keys == "" {
+		ident, err = identity.FullIdentityFromPEM(util.Certificate, util.Key)
+	} else {
+		satelliteIdentityCfg := identity.Config{
+			CertPath: filepath.Join(a.Keys, "identity.cert"),
+			KeyPath:  filepath.Join(a.Keys, "identity.key"),
+		}
+		ident, err = satelliteIdentityCfg.Load()
+	}
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	dialer, err := util.GetDialerForIdentity(ctx, ident, true, false)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	auditor := &auditor{
+		dialer:   dialer,
+		signer:   util.NewKeySignerFromFullIdentity(ident, pb.PieceAction_GET_AUDIT),
+		node:     nodeURL,
+		timeout:  a.Timeout,
+		verified: map[storj.PieceID][]byte{},
+	}
+
+	audit := reputation{alpha: a.InitialAlpha, beta: a.InitialBeta}
+	unknown := reputation{alpha: a.InitialAlpha, beta: a.InitialBeta}
+	outcomes := map[string]int{}
+	contained := 0
+	for i := 0; i < a.Audits; i++ {
+		piece := pieces[rand.Intn(len(pieces))]
+		stripes := pieceSize(piece.encryptedSize, piece.requiredShares, a.ShareSize) / int64(a.ShareSize)
+		stripe := rand.Int63n(max(stripes, 1))
+
+		var outcome, detail string
+		for attempt := 0; ; attempt++ {
+			outcome, detail = auditor.audit(ctx, piece.id, stripe*int64(a.ShareSize), int64(a.ShareSize), !a.SkipHash)
+			if outcome != auditContained {
+				break
+			}
+			contained++
+			if attempt >= a.Reverify {
+				outcome, detail = auditFailure, fmt.Sprintf("contained, timed out %d times", attempt+1)
+				break
+			}
+		}
+		outcomes[outcome]++
+
+		switch outcome {
+		case auditSuccess:
+			audit.update(true, a.Lambda, a.Weight)
+			unknown.update(true, a.UnknownLambda, a.Weight)
+		case auditFailure:
+			audit.update(false, a.Lambda, a.Weight)
+		case auditUnknown:
+			unknown.update(false, a.UnknownLambda, a.Weight)
+		}
+		if a.Verbose {
+			fmt.Printf("AUDIT_RESULT: %s,%s,%d,%s\n", outcome, piece.id, stripe, detail)
+		}
+	}
+
+	fmt.Printf("Audited %d stripes of %d pieces on %s\n", a.Audits, len(pieces), nodeURL.ID)
+	var names []string
+	for name := range outcomes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-8s %d\n", name, outcomes[name])
+	}
+	if contained > 0 {
+		fmt.Printf("  contained %d times (timeout)\n", contained)
+	}
+	fmt.Printf("Audit score:         %.4f (DQ below %.2f, %d more failures to disqualification)\n", audit.score(), a.DQ, audit.failuresUntil(a.DQ, a.Lambda, a.Weight))
+	fmt.Printf("Unknown audit score: %.4f (DQ below %.2f, %d more unknown errors to disqualification)\n", unknown.score(), a.UnknownDQ, unknown.failuresUntil(a.UnknownDQ, a.UnknownLambda, a.Weight))
+	if audit.score() < a.DQ || unknown.score() < a.UnknownDQ {
+		fmt.Println("The node would be DISQUALIFIED")
+	}
+	return nil
+}
+
+// readPieces parses the piece list (streamID,position,rootPieceID,pieceNum,plainSize,encryptedSize,placement,expiration,requiredShares).
+func (a AuditNode) readPieces(node storj.NodeID) ([]auditedPiece, error) {
+	raw, err := os.ReadFile(a.Pieces)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	var res []auditedPiece
+	for _, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, ",")
+		if len(parts) < 6 {
+			return nil, errs.Errorf("invalid line in the piece list: %s", line)
+		}
+		root, err := storj.PieceIDFromString(parts[2])
+		if err != nil {
+			return nil, errs.Errorf("invalid root piece ID in line %s: %v", line, err)
+		}
+		num, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return nil, errs.Errorf("invalid piece number in line %s: %v", line, err)
+		}
+		size, err := strconv.ParseInt(parts[5], 10, 64)
+		if err != nil {
+			return nil, errs.Errorf("invalid encrypted size in line %s: %v", line, err)
+		}
+		if size < 0 {
+			return nil, errs.Errorf("negative encrypted size in line %s", line)
+		}
+		required := a.RequiredShares
+		if len(parts) > 8 {
+			required, err = strconv.Atoi(parts[8])
+			if err != nil {
+				return nil, errs.Errorf("invalid required shares in line %s: %v", line, err)
+			}
+		}
+		if required <= 0 {
+			return nil, errs.Errorf("required shares should be positive in line %s", line)
+		}
+		res = append(res, auditedPiece{
+			id:             root.Derive(node, int32(num)),
+			encryptedSize:  size,
+			requiredShares: required,
+		})
+	}
+	return res, nil
+}
+
+// pieceSize is the size of one erasure coded piece of a segment.
+func pieceSize(encryptedSize int64, requiredShares int, shareSize int) int64 {
+	stripeSize := int64(requiredShares * shareSize)
+	stripes := (encryptedSize + stripeSize - 1) / stripeSize
+	return stripes * int64(shareSize)
+}
+
+var (
+	// errAuditFailed is returned when the node sends invalid data.
+	errAuditFailed = errs.Tag("audit failed")
+	// errContained is returned when the node times out (the satellite contains the node and reverifies the share later).
+	errContained = errs.Tag("contained")
+)
+
+// classify returns the audit outcome of the download error (ok is false if there is no error).
+func classify(err error) (outcome string, ok bool) {
+	switch {
+	case err == nil:
+		return "", false
+	case errors.Is(err, errContained):
+		return auditContained, true
+	case rpc.Error.Has(err):
+		// connection is established lazily, dial errors may be returned by the first request
+		return auditOffline, true
+	case errors.Is(err, errAuditFailed), errs2.IsRPC(err, rpcstatus.NotFound):
+		return auditFailure, true
+	default:
+		return auditUnknown, true
+	}
+}
+
+type auditor struct {
+	dialer  rpc.Dialer
+	signer  *util.KeySigner
+	node    storj.NodeURL
+	timeout time.Duration
+
+	// verified are the full pieces which are already checked against the piece hash.
+	verified map[storj.PieceID][]byte
+}
+
+// audit downloads one share, and returns the outcome (or "contained" if the node timed out).
+func (a *auditor) audit(ctx context.Context, pieceID storj.PieceID, offset, size int64, verifyHash bool) (outcome string, detail string) {
+	conn, err := a.dialer.DialNodeURL(ctx, a.node)
+	if err != nil {
+		return auditOffline, err.Error()
+	}
+	defer func() { _ = conn.Close() }()
+	client := pb.NewDRPCPiecestoreClient(util.NewTracedConnection(conn))
+
+	share, hash, limit, err := a.download(ctx, client, pieceID, offset, size)
+	if outcome, ok := classify(err); ok {
+		return outcome, err.Error()
+	}
+	if int64(len(share)) != size {
+		return auditFailure, fmt.Sprintf("share is %d bytes instead of %d", len(share), size)
+	}
+	if !verifyHash {
+		return auditSuccess, ""
+	}
+
+	full, found := a.verified[pieceID]
+	if !found {
+		full, err = a.verifiedPiece(ctx, client, pieceID, hash, limit)
+		if outcome, ok := classify(err); ok {
+			return outcome, err.Error()
+		}
+		a.verified[pieceID] = full
+	}
+	if offset+size > int64(len(full)) || !bytes.Equal(full[offset:offset+size], share) {
+		return auditFailure, "share doesn't match the hashed piece"
+	}
+	return auditSuccess, ""
+}
+
+// verifiedPiece downloads the full piece, and checks it against the hash signed by the uplink.
+func (a *auditor) verifiedPiece(ctx context.Context, client pb.DRPCPiecestoreClient, pieceID storj.PieceID, hash *pb.PieceHash, limit *pb.OrderLimit) ([]byte, error) {
+	if hash == nil || limit == nil {
+		return nil, errAuditFailed.Errorf("node didn't send the piece hash and the original order limit")
+	}
+	if err := signing.VerifyUplinkPieceHashSignature(ctx, limit.UplinkPublicKey, hash); err != nil {
+		return nil, errAuditFailed.Wrap(err)
+	}
+	data, _, _, err := a.download(ctx, client, pieceID, 0, hash.PieceSize)
+	if err != nil {
+		return nil, err
+	}
+	hasher := pb.NewHashFromAlgorithm(hash.HashAlgorithm)
+	_, _ = hasher.Write(data)
+	if !bytes.Equal(hasher.Sum(nil), hash.Hash) {
+		return nil, errAuditFailed.Errorf("piece hash mismatch (%d bytes)", len(data))
+	}
+	return data, nil
+}
+
+// download requests a range of the piece with a GET_AUDIT order limit. The node also sends the piece hash and the original order limit.
+func (a *auditor) download(ctx context.Context, client pb.DRPCPiecestoreClient, pieceID storj.PieceID, offset, size int64) (data []byte, hash *pb.PieceHash, limit *pb.OrderLimit, err error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	orderLimit, priv, serial, err := a.signer.CreateOrderLimit(ctx, pieceID, size, a.node.ID)
+	if err != nil {
+		return nil, nil, nil, errs.Wrap(err)
+	}
+	order, err := signing.SignUplinkOrder(ctx, priv, &pb.Order{
+		SerialNumber: serial,
+		Amount:       size,
+	})
+	if err != nil {
+		return nil, nil, nil, errs.Wrap(err)
+	}
+
+	stream, err := client.Download(ctx)
+	if err != nil {
+		return nil, nil, nil, timedOut(ctx, err)
+	}
+	defer func() { _ = stream.Close() }()
+	err = stream.Send(&pb.PieceDownloadRequest{
+		Limit: orderLimit,
+		Order: order,
+		Chunk: &pb.PieceDownloadRequest_Chunk{
+			Offset:    offset,
+			ChunkSize: size,
+		},
+	})
+	if err != nil {
+		return nil, nil, nil, timedOut(ctx, err)
+	}
+	for int64(len(data)) < size {
+		resp, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, nil, nil, timedOut(ctx, err)
+		}
+		if resp.Hash != nil {
+			hash, limit = resp.Hash, resp.Limit
+		}
+		if resp.Chunk != nil {
+			data = append(data, resp.Chunk.Data...)
+		}
+	}
+	return data, hash, limit, nil
+}
+
+func timedOut(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return errContained.Wrap(err)
+	}
+	return errs.Wrap(err)
+}
+
+// reputation is the beta reputation model of the satellite (see storj.io/storj/satellite/reputation).
+type reputation struct {
+	alpha, beta float64
+}
+
+func (r *reputation) update(success bool, lambda, weight float64) {
+	v := -1.0
+	if success {
+		v = 1
+	}
+	r.alpha = lambda*r.alpha + weight*(1+v)/2
+	r.beta = lambda*r.beta + weight*(1-v)/2
+}
+
+func (r reputation) score() float64 {
+	if r.alpha+r.beta == 0 {
+		return 1
+	}
+	return r.alpha / (r.alpha + r.beta)
+}
+
+// failuresUntil returns the number of consecutive failures which push the score below the threshold.
+func (r reputation) failuresUntil(threshold, lambda, weight float64) int {
+	for i := 0; i < 1_000_000; i++ {
+		if r.score() < threshold {
+			return i
+		}
+		r.update(false, lambda, weight)
+	}
+	return -1
+}
@@ -0,0 +1,46 @@
+package satellite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"storj.io/common/testrand"
+)
+
+func TestReadPieces(t *testing.T) {
+	node := testrand.NodeID()
+	root := testrand.PieceID()
+	read := func(requiredShares int, lines string) ([]auditedPiece, error) {
+		path := filepath.Join(t.TempDir(), "pieces.csv")
+		require.NoError(t, os.WriteFile(path, []byte(lines), 0644))
+		return AuditNode{Pieces: path, RequiredShares: requiredShares}.readPieces(node)
+	}
+
+	pieces, err := read(29, "stream,0,"+root.String()+",3,1000,1024,0,0,2\nstream,0,"+root.String()+",4,1000,1024\n")
+	require.NoError(t, err)
+	require.Len(t, pieces, 2)
+	require.Equal(t, root.Derive(node, 3), pieces[0].id)
+	require.Equal(t, 2, pieces[0].requiredShares)
+	require.Equal(t, 29, pieces[1].requiredShares)
+	require.Equal(t, int64(512), pieceSize(pieces[0].encryptedSize, pieces[0].requiredShares, 256))
+
+	_, err = read(29, "stream,0,"+root.String()+",3,1000,1024,0,0,0\n")
+	require.Error(t, err)
+	_, err = read(0, "stream,0,"+root.String()+",3,1000,1024\n")
+	require.Error(t, err)
+	_, err = read(29, "stream,0,"+root.String()+",3,1000,-1\n")
+	require.Error(t, err)
+
+	require.Error(t, AuditNode{ShareSize: 0, RequiredShares: 29, Audits: 1}.Run())
+	require.Error(t, AuditNode{ShareSize: 256, RequiredShares: 0, Audits: 1}.Run())
+}
+
+func TestReputation(t *testing.T) {
+	r := reputation{alpha: 1000}
+	require.Equal(t, 1.0, r.score())
+	r.update(false, 0.999, 1)
+	require.Less(t, r.score(), 1.0)
+	require.Positive(t, r.failuresUntil(0.96, 0.999, 1))
+}
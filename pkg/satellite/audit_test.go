@@ -0,0 +1,75 @@
+package satellite_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elek/stbb/pkg/downloadng/stub"
+	"github.com/elek/stbb/pkg/satellite"
+	"github.com/stretchr/testify/require"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+	"storj.io/common/testrand"
+	"storj.io/uplink"
+)
+
+func TestAuditNode(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	network, err := stub.NewNetwork(5)
+	require.NoError(t, err)
+	var urls []storj.NodeURL
+	for _, node := range network.Nodes {
+		urls = append(urls, storj.NodeURL{ID: node.Identity.ID, Address: node.Address})
+	}
+	rs, err := satellite.ParseRS("2/3/4/5")
+	require.NoError(t, err)
+	metainfo := satellite.NewMetainfo(network.Satellite, satellite.NewNodes(urls...), rs)
+	require.NoError(t, network.SetMetainfo(metainfo))
+
+	access, err := network.Access()
+	require.NoError(t, err)
+	serialized, err := access.Serialize()
+	require.NoError(t, err)
+	parsed, err := uplink.ParseAccess(serialized)
+	require.NoError(t, err)
+	project, err := network.UplinkConfig().OpenProject(ctx, parsed)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, project.Close()) }()
+	_, err = project.EnsureBucket(ctx, "bucket1")
+	require.NoError(t, err)
+	upload, err := project.UploadObject(ctx, "bucket1", "key", nil)
+	require.NoError(t, err)
+	_, err = upload.Write(testrand.BytesInt(100_000))
+	require.NoError(t, err)
+	require.NoError(t, upload.Commit())
+
+	// piece list of a node with a piece (only the pieces of the success threshold are committed),
+	// in the format of 'node piece-list'
+	var node storj.NodeURL
+	var lines string
+	for _, url := range urls {
+		node, lines = url, metainfo.PieceList(url.ID)
+		if lines != "" {
+			break
+		}
+	}
+	require.NotEmpty(t, lines)
+	pieceList := filepath.Join(t.TempDir(), "pieces.csv")
+	require.NoError(t, os.WriteFile(pieceList, []byte(lines), 0644))
+
+	dialer, err := network.Dialer(ctx)
+	require.NoError(t, err)
+	audit := func(faults stub.Faults) string {
+		require.NoError(t, network.SetFaults(node.ID, faults))
+		outcome, detail, err := satellite.AuditLastStripe(ctx, dialer, network.Satellite, node, pieceList, 256)
+		require.NoError(t, err)
+		t.Log(outcome, detail)
+		return outcome
+	}
+	require.Equal(t, satellite.AuditSuccess, audit(stub.Faults{}))
+	require.Equal(t, satellite.AuditFailure, audit(stub.Faults{Corrupt: true}))
+	require.Equal(t, satellite.AuditFailure, audit(stub.Faults{Missing: true}))
+	require.Equal(t, satellite.AuditOffline, audit(stub.Faults{Offline: true}))
+}
@@ -0,0 +1,58 @@
+package satellite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/elek/stbb/pkg/util"
+	"storj.io/common/identity"
+	"storj.io/common/pb"
+	"storj.io/common/rpc"
+	"storj.io/common/storj"
+)
+
+// Helpers of the external tests (satellite_test). They can't be in this package,
+// as the stub network of downloadng uses the satellite metainfo.
+
+const (
+	AuditSuccess = auditSuccess
+	AuditFailure = auditFailure
+	AuditOffline = auditOffline
+)
+
+// PieceList returns the pieces stored by the node, in the format of 'node piece-list'.
+func (m *Metainfo) PieceList(node storj.NodeID) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var lines string
+	for _, o := range m.streams {
+		for _, s := range o.segments {
+			for _, p := range s.pieces {
+				if p.node.ID == node {
+					lines += fmt.Sprintf("%s,0,%s,%d,%d,%d,0,0,%d\n", s.streamID, s.rootPieceID, p.num, s.plainSize, s.encryptedSize, s.rs.MinReq)
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// AuditLastStripe audits the last stripe of the first piece from the piece list.
+func AuditLastStripe(ctx context.Context, dialer rpc.Dialer, satellite *identity.FullIdentity, node storj.NodeURL, pieceList string, shareSize int) (outcome string, detail string, err error) {
+	pieces, err := AuditNode{Pieces: pieceList, ShareSize: shareSize}.readPieces(node.ID)
+	if err != nil {
+		return "", "", err
+	}
+	a := &auditor{
+		dialer:   dialer,
+		signer:   util.NewKeySignerFromFullIdentity(satellite, pb.PieceAction_GET_AUDIT),
+		node:     node,
+		timeout:  5 * time.Second,
+		verified: map[storj.PieceID][]byte{},
+	}
+	piece := pieces[0]
+	stripes := pieceSize(piece.encryptedSize, piece.requiredShares, shareSize) / int64(shareSize)
+	outcome, detail = a.audit(ctx, piece.id, (stripes-1)*int64(shareSize), int64(shareSize), true)
+	return outcome, detail, nil
+}
@@ -3,31 +3,71 @@ package satellite
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elek/stbb/pkg/bloom"
 	"github.com/elek/stbb/pkg/util"
+	"github.com/zeebo/errs"
 	"storj.io/common/bloomfilter"
 	"storj.io/common/identity"
+	"storj.io/common/memory"
 	"storj.io/common/pb"
 	"storj.io/common/storj"
-	"time"
 )
 
+// retainMessageLimit is the biggest filter which is sent with a single Retain request (same as the limit of the satellite).
+const retainMessageLimit = 4100050
+
 type GC struct {
-	URL string `arg:""`
+	URL               string      `arg:"" help:"storage node URL (id@address)"`
+	Filter            string      `help:"bloom filter file, as written by 'bloom create' (or a RetainInfo protobuf with .pb suffix)"`
+	Pieces            string      `help:"file with piece IDs (first column of each line) to build the bloom filter from"`
+	Empty             bool        `help:"send an empty filter: all the pieces created before the creation date are garbage"`
+	FalsePositiveRate float64     `default:"0.1" help:"false positive rate of the filter built from --pieces"`
+	MaxMemory         memory.Size `default:"0" help:"maximum size of the filter built from --pieces (0: no limit)"`
+	CreationDate      time.Time   `help:"creation date of the filter (RFC3339). Only older pieces are collected. Default is the date of the .pb filter, or now"`
+	Keys              string      `help:"directory of the satellite identity (identity.cert/identity.key). Default is the embedded identity"`
+	Big               bool        `help:"always use the streaming RetainBig endpoint (by default, only filters bigger than the message limit are streamed)"`
+	ChunkSize         memory.Size `default:"4100050" help:"size of the filter chunks sent with RetainBig"`
+	SkipNodeCheck     bool        `help:"send the .pb filter even if it's generated for a different storage node"`
 }
 
 func (g GC) Run() error {
 	ctx := context.Background()
 
-	ident, err := identity.FullIdentityFromPEM(util.Certificate, util.Key)
+	nodeURL, err := storj.ParseNodeURL(g.URL)
 	if err != nil {
 		return err
 	}
+	filter, created, err := g.filter(nodeURL.ID)
+	if err != nil {
+		return err
+	}
+	if !g.CreationDate.IsZero() {
+		created = g.CreationDate
+	}
+	if created.IsZero() {
+		created = time.Now()
+	}
 
-	dialer, err := util.GetDialerForIdentity(ctx, ident, false, false)
+	var ident *identity.FullIdentity
+	if g.Keys == "" {
+		ident, err = identity.FullIdentityFromPEM(util.Certificate, util.Key)
+	} else {
+		satelliteIdentityCfg := identity.Config{
+			CertPath: filepath.Join(g.Keys, "identity.cert"),
+			KeyPath:  filepath.Join(g.Keys, "identity.key"),
+		}
+		ident, err = satelliteIdentityCfg.Load()
+	}
 	if err != nil {
 		return err
 	}
-	nodeURL, err := storj.ParseNodeURL(g.URL)
+
+	dialer, err := util.GetDialerForIdentity(ctx, ident, false, false)
 	if err != nil {
 		return err
 	}
@@ -37,15 +77,135 @@ func (g GC) Run() error {
 	}
 	defer conn.Close()
 
-	filter := bloomfilter.NewOptimal(10, 0.1)
+	hashCount, size := filter.Parameters()
+	fmt.Printf("Sending filter from %s to %s (satellite %s): %s, %d hash functions, creation date %s\n", g.source(), nodeURL.ID, ident.ID, memory.Size(size), hashCount, created.Format(time.RFC3339))
+
 	client := pb.NewDRPCPiecestoreClient(util.NewTracedConnection(conn))
-	retain, err := client.Retain(ctx, &pb.RetainRequest{
-		CreationDate: time.Now().Add(168 * time.Hour),
-		Filter:       filter.Bytes(),
-	})
+	raw := filter.Bytes()
+	start := time.Now()
+	if !g.Big && len(raw) <= retainMessageLimit {
+		retain, err := client.Retain(ctx, &pb.RetainRequest{
+			CreationDate: created,
+			Filter:       raw,
+		})
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		fmt.Printf("Retain is accepted in %s %s\n", time.Since(start), retain.String())
+		return nil
+	}
+
+	chunks, err := retainBig(ctx, client, created, raw, g.ChunkSize.Int())
 	if err != nil {
 		return err
 	}
-	fmt.Println(retain.String())
+	fmt.Printf("RetainBig is accepted in %s (%d messages)\n", time.Since(start), chunks)
 	return nil
 }
+
+// filter returns the bloom filter to send to the node, and the creation date stored with it (if any).
+func (g GC) filter(node storj.NodeID) (*bloomfilter.Filter, time.Time, error) {
+	set := 0
+	for _, s := range []bool{g.Filter != "", g.Pieces != "", g.Empty} {
+		if s {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, time.Time{}, errs.New("exactly one of --filter, --pieces or --empty should be used")
+	}
+
+	switch {
+	case g.Filter != "" && strings.HasSuffix(g.Filter, ".pb"):
+		retainInfo, err := bloom.OpenRetainInfo(g.Filter)
+		if err != nil {
+			return nil, time.Time{}, errs.Wrap(err)
+		}
+		if retainInfo.StorageNodeId != node && !g.SkipNodeCheck {
+			return nil, time.Time{}, errs.New("filter is generated for node %s, not for %s (use --skip-node-check to send it anyway)", retainInfo.StorageNodeId, node)
+		}
+		filter, err := bloomfilter.NewFromBytes(retainInfo.Filter)
+		return filter, retainInfo.CreationDate, errs.Wrap(err)
+	case g.Filter != "":
+		filter, err := bloom.OpenFilter(g.Filter, false)
+		return filter, time.Time{}, errs.Wrap(err)
+	case g.Pieces != "":
+		pieces, err := readPieceIDs(g.Pieces)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		filter := bloomfilter.NewOptimalMaxSize(max(int64(len(pieces)), 1), g.FalsePositiveRate, g.MaxMemory)
+		for _, id := range pieces {
+			filter.Add(id)
+		}
+		return filter, time.Time{}, nil
+	default:
+		return bloomfilter.NewOptimal(10, g.FalsePositiveRate), time.Time{}, nil
+	}
+}
+
+func (g GC) source() string {
+	switch {
+	case g.Filter != "":
+		return g.Filter
+	case g.Pieces != "":
+		return g.Pieces
+	}
+	return "<empty>"
+}
+
+// retainBig sends the filter in chunks, the last message has the hash of the full filter.
+func retainBig(ctx context.Context, client pb.DRPCPiecestoreClient, created time.Time, filter []byte, chunkSize int) (int, error) {
+	if chunkSize <= 0 {
+		return 0, errs.New("chunk size should be positive")
+	}
+	hasher := pb.NewHashFromAlgorithm(pb.PieceHashAlgorithm_BLAKE3)
+	_, _ = hasher.Write(filter)
+	hash := hasher.Sum(nil)
+
+	stream, err := client.RetainBig(ctx)
+	if err != nil {
+		return 0, errs.Wrap(err)
+	}
+	messages := 0
+	for offset := 0; ; offset += chunkSize {
+		end := min(offset+chunkSize, len(filter))
+		req := &pb.RetainRequest{
+			CreationDate: created,
+			Filter:       filter[offset:end],
+		}
+		last := end == len(filter)
+		if last {
+			req.HashAlgorithm = pb.PieceHashAlgorithm_BLAKE3
+			req.Hash = hash
+		}
+		if err := stream.Send(req); err != nil {
+			return messages, errs.Combine(errs.Wrap(err), stream.Close())
+		}
+		messages++
+		if last {
+			break
+		}
+	}
+	return messages, errs.Wrap(stream.Close())
+}
+
+func readPieceIDs(path string) ([]storj.PieceID, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	var res []storj.PieceID
+	for _, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, err := storj.PieceIDFromString(strings.Split(line, ",")[0])
+		if err != nil {
+			return nil, errs.New("invalid piece ID in line %q: %v", line, err)
+		}
+		res = append(res, id)
+	}
+	return res, nil
+}
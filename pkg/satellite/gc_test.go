@@ -0,0 +1,93 @@
+package satellite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"storj.io/common/bloomfilter"
+	"storj.io/common/pb"
+	"storj.io/common/testrand"
+	"storj.io/storj/satellite/internalpb"
+)
+
+type retainBigClient struct {
+	pb.DRPCPiecestoreClient
+	stream *retainBigStream
+}
+
+func (c *retainBigClient) RetainBig(ctx context.Context) (pb.DRPCPiecestore_RetainBigClient, error) {
+	return c.stream, nil
+}
+
+type retainBigStream struct {
+	pb.DRPCPiecestore_RetainBigClient
+	requests []*pb.RetainRequest
+	closed   bool
+}
+
+func (s *retainBigStream) Send(req *pb.RetainRequest) error {
+	s.requests = append(s.requests, req)
+	return nil
+}
+
+func (s *retainBigStream) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestRetainBig(t *testing.T) {
+	ctx := context.Background()
+	created := time.Now()
+	for _, size := range []int{1, 99, 100, 101, 1000} {
+		filter := testrand.BytesInt(size)
+		client := &retainBigClient{stream: &retainBigStream{}}
+
+		messages, err := retainBig(ctx, client, created, filter, 100)
+		require.NoError(t, err)
+		require.Equal(t, (size+99)/100, messages)
+		require.True(t, client.stream.closed)
+
+		var received []byte
+		for i, req := range client.stream.requests {
+			require.Equal(t, created, req.CreationDate)
+			received = append(received, req.Filter...)
+			require.Equal(t, i == messages-1, len(req.Hash) > 0)
+		}
+		require.Equal(t, filter, received)
+
+		hasher := pb.NewHashFromAlgorithm(pb.PieceHashAlgorithm_BLAKE3)
+		_, _ = hasher.Write(filter)
+		require.Equal(t, hasher.Sum(nil), client.stream.requests[messages-1].Hash)
+	}
+}
+
+func TestGCFilterNode(t *testing.T) {
+	node, other := testrand.NodeID(), testrand.NodeID()
+	created := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	filter := bloomfilter.NewOptimal(100, 0.1)
+	filter.Add(testrand.PieceID())
+	raw, err := pb.Marshal(&internalpb.RetainInfo{
+		Filter:        filter.Bytes(),
+		CreationDate:  created,
+		StorageNodeId: node,
+	})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "filter.pb")
+	require.NoError(t, os.WriteFile(path, raw, 0644))
+
+	loaded, date, err := GC{Filter: path}.filter(node)
+	require.NoError(t, err)
+	require.Equal(t, created, date.UTC())
+	require.Equal(t, filter.Bytes(), loaded.Bytes())
+
+	_, _, err = GC{Filter: path}.filter(other)
+	require.ErrorContains(t, err, node.String())
+
+	_, _, err = GC{Filter: path, SkipNodeCheck: true}.filter(other)
+	require.NoError(t, err)
+}
@@ -0,0 +1,216 @@
+package satellite
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs/v2"
+	"storj.io/common/pb"
+	"storj.io/common/storj"
+)
+
+// Event is one recorded interaction between a storage node and the mock satellite.
+type Event struct {
+	Time       time.Time        `json:"time"`
+	Satellite  string           `json:"satellite,omitempty"`
+	CheckIn    *CheckInEvent    `json:"checkin,omitempty"`
+	Settlement *SettlementEvent `json:"settlement,omitempty"`
+	Ping       *PingEvent       `json:"ping,omitempty"`
+}
+
+// CheckInEvent is the content of a node check-in.
+type CheckInEvent struct {
+	Address  string            `json:"address"`
+	Version  string            `json:"version,omitempty"`
+	FreeDisk int64             `json:"free_disk"`
+	Wallet   string            `json:"wallet,omitempty"`
+	Email    string            `json:"email,omitempty"`
+	Features uint64            `json:"features"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+// SettlementEvent is the summary of one SettlementWithWindow stream.
+type SettlementEvent struct {
+	Orders int              `json:"orders"`
+	Status string           `json:"status"`
+	Error  string           `json:"error,omitempty"`
+	Amount map[string]int64 `json:"amount"`
+}
+
+// PingEvent is a PingMe request of the node, or a ping from the satellite to the node.
+type PingEvent struct {
+	Source   string        `json:"source"`
+	Address  string        `json:"address"`
+	Success  bool          `json:"success"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// History keeps the events of the storage nodes (by node ID), and optionally appends them to a JSON lines file.
+type History struct {
+	mu     sync.Mutex
+	file   *os.File
+	events map[string][]Event
+}
+
+// historyLine is one line of the history file.
+type historyLine struct {
+	Node string `json:"node"`
+	Event
+}
+
+// NewHistory creates the history. When path is not empty, the existing events are loaded from the file,
+// and all the new events are appended to it.
+func NewHistory(path string) (*History, error) {
+	h := &History{
+		events: map[string][]Event{},
+	}
+	if path == "" {
+		return h, nil
+	}
+	events, err := LoadHistory(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if events != nil {
+		h.events = events
+	}
+	h.file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	return h, nil
+}
+
+// LoadHistory reads the persisted events.
+func LoadHistory(path string) (map[string][]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	events := map[string][]Event{}
+	dec := json.NewDecoder(f)
+	for {
+		var line historyLine
+		err := dec.Decode(&line)
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, errs.Errorf("invalid history file %s: %v", path, err)
+		}
+		events[line.Node] = append(events[line.Node], line.Event)
+	}
+}
+
+// Record adds a new event of the node. Events are recorded even if they can't be persisted.
+func (h *History) Record(id storj.NodeID, event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events[id.String()] = append(h.events[id.String()], event)
+	if h.file == nil {
+		return nil
+	}
+	raw, err := json.Marshal(historyLine{Node: id.String(), Event: event})
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	_, err = h.file.Write(append(raw, '\n'))
+	return errs.Wrap(err)
+}
+
+// Close closes the history file.
+func (h *History) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return errs.Wrap(err)
+}
+
+// Events returns a copy of the events. With a non-zero id, only the events of the node are returned.
+func (h *History) Events(id storj.NodeID) map[string][]Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res := map[string][]Event{}
+	for node, events := range h.events {
+		if !id.IsZero() && node != id.String() {
+			continue
+		}
+		res[node] = append([]Event{}, events...)
+	}
+	return res
+}
+
+// ServeHTTP returns the events as JSON. GET /history returns all the nodes, GET /history/{node} only one node.
+func (h *History) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var id storj.NodeID
+	if node := r.PathValue("node"); node != "" {
+		var err error
+		id, err = storj.NodeIDFromString(node)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(h.Events(id))
+}
+
+// Handler returns the HTTP handler of the history endpoints.
+func (h *History) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /history", h)
+	mux.Handle("GET /history/{node}", h)
+	return mux
+}
+
+func checkInEvent(req *pb.CheckInRequest) *CheckInEvent {
+	event := &CheckInEvent{
+		Address:  req.Address,
+		Version:  req.Version.GetVersion(),
+		FreeDisk: req.Capacity.GetFreeDisk(),
+		Wallet:   req.Operator.GetWallet(),
+		Email:    req.Operator.GetEmail(),
+		Features: req.Features,
+	}
+	for _, tag := range req.SignedTags.GetTags() {
+		var tags pb.NodeTagSet
+		if err := pb.Unmarshal(tag.GetSerializedTag(), &tags); err != nil {
+			continue
+		}
+		for _, t := range tags.Tags {
+			if event.Tags == nil {
+				event.Tags = map[string]string{}
+			}
+			event.Tags[t.Name] = string(t.Value)
+		}
+	}
+	return event
+}
+
+// sortedNodes returns the node IDs of the events in a stable order.
+func sortedNodes(events map[string][]Event) []string {
+	var nodes []string
+	for node := range events {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
@@ -0,0 +1,154 @@
+package satellite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/zeebo/errs/v2"
+)
+
+// NodeHistory prints the events recorded by a running (or stopped) mock satellite.
+type NodeHistory struct {
+	Source  string `arg:"" default:"satellite-history.jsonl" help:"history file (--history of the mock satellite) or the URL of the HTTP endpoint (--http)"`
+	Node    string `help:"show only the events of one node"`
+	Verbose bool   `help:"print all the events, not only the summary"`
+	JSON    bool   `help:"print the raw events as JSON"`
+}
+
+func (n NodeHistory) Run() error {
+	events, err := n.load()
+	if err != nil {
+		return err
+	}
+	if n.Node != "" {
+		events = map[string][]Event{n.Node: events[n.Node]}
+	}
+	if n.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return errs.Wrap(enc.Encode(events))
+	}
+	for _, node := range sortedNodes(events) {
+		printNodeSummary(node, events[node])
+		if n.Verbose {
+			for _, e := range events[node] {
+				fmt.Println("  " + e.String())
+			}
+		}
+	}
+	return nil
+}
+
+func (n NodeHistory) load() (map[string][]Event, error) {
+	if !strings.HasPrefix(n.Source, "http://") && !strings.HasPrefix(n.Source, "https://") {
+		return LoadHistory(n.Source)
+	}
+	u, err := url.Parse(n.Source)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/history"
+	}
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errs.Errorf("%s: %s %s", u, resp.Status, strings.TrimSpace(string(body)))
+	}
+	events := map[string][]Event{}
+	err = json.NewDecoder(resp.Body).Decode(&events)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	return events, nil
+}
+
+func printNodeSummary(node string, events []Event) {
+	var checkIns, settlements, pingOK, pingFailed int
+	var last *Event
+	settled := map[string]int64{}
+	for i, e := range events {
+		switch {
+		case e.CheckIn != nil:
+			checkIns++
+			last = &events[i]
+		case e.Settlement != nil:
+			settlements++
+			if e.Settlement.Error == "" && e.Settlement.Status == "ACCEPTED" {
+				for action, amount := range e.Settlement.Amount {
+					settled[action] += amount
+				}
+			}
+		case e.Ping != nil:
+			if e.Ping.Success {
+				pingOK++
+			} else {
+				pingFailed++
+			}
+		}
+	}
+	fmt.Println(node)
+	if last != nil {
+		fmt.Printf("  check-ins:   %d (last: %s, %s, version %s, free disk %d)\n", checkIns, last.Time.Format("2006-01-02 15:04:05"), last.CheckIn.Address, last.CheckIn.Version, last.CheckIn.FreeDisk)
+		if len(last.CheckIn.Tags) > 0 {
+			fmt.Printf("  tags:        %s\n", formatMap(last.CheckIn.Tags))
+		}
+	} else {
+		fmt.Println("  check-ins:   0")
+	}
+	fmt.Printf("  pings:       %d ok, %d failed\n", pingOK, pingFailed)
+	fmt.Printf("  settlements: %d\n", settlements)
+	var actions []string
+	for action := range settled {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		fmt.Printf("    %-12s %d\n", action, settled[action])
+	}
+}
+
+// String returns a one-line description of the event.
+func (e Event) String() string {
+	ts := e.Time.Format("2006-01-02 15:04:05")
+	switch {
+	case e.CheckIn != nil:
+		return fmt.Sprintf("%s checkin    address=%s version=%s free_disk=%d features=%d tags=%s", ts, e.CheckIn.Address, e.CheckIn.Version, e.CheckIn.FreeDisk, e.CheckIn.Features, formatMap(e.CheckIn.Tags))
+	case e.Settlement != nil:
+		res := fmt.Sprintf("%s settlement status=%s orders=%d amount=%s", ts, e.Settlement.Status, e.Settlement.Orders, formatMap(e.Settlement.Amount))
+		if e.Settlement.Error != "" {
+			res += " error=" + e.Settlement.Error
+		}
+		return res
+	case e.Ping != nil:
+		res := fmt.Sprintf("%s ping       source=%s address=%s success=%t duration=%s", ts, e.Ping.Source, e.Ping.Address, e.Ping.Success, e.Ping.Duration)
+		if e.Ping.Error != "" {
+			res += " error=" + e.Ping.Error
+		}
+		return res
+	}
+	return ts + " unknown"
+}
+
+func formatMap[V any](m map[string]V) string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, m[k]))
+	}
+	return strings.Join(parts, ",")
+}
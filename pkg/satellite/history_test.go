@@ -0,0 +1,133 @@
+package satellite
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"storj.io/common/identity/testidentity"
+	"storj.io/common/pb"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+	"storj.io/common/testrand"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	node1, node2 := testrand.NodeID(), testrand.NodeID()
+
+	history, err := NewHistory(path)
+	require.NoError(t, err)
+	require.NoError(t, history.Record(node1, Event{CheckIn: &CheckInEvent{Address: "localhost:1", Tags: map[string]string{"soc2": "true"}}}))
+	require.NoError(t, history.Record(node1, Event{Settlement: &SettlementEvent{Orders: 2, Status: "ACCEPTED", Amount: map[string]int64{"GET": 100}}}))
+	require.NoError(t, history.Record(node2, Event{Ping: &PingEvent{Source: "pingme", Success: true}}))
+	require.NoError(t, history.Close())
+
+	reloaded, err := NewHistory(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, reloaded.Close()) }()
+	events := reloaded.Events(node1)
+	require.Len(t, events, 1)
+	require.Len(t, events[node1.String()], 2)
+	require.Equal(t, "true", events[node1.String()][0].CheckIn.Tags["soc2"])
+	require.Equal(t, int64(100), events[node1.String()][1].Settlement.Amount["GET"])
+
+	server := httptest.NewServer(reloaded.Handler())
+	defer server.Close()
+
+	get := func(path string) map[string][]Event {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, resp.Body.Close()) }()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		res := map[string][]Event{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return res
+	}
+	require.Len(t, get("/history"), 2)
+	require.Len(t, get("/history/" + node2.String())[node2.String()], 1)
+
+	loaded, err := NodeHistory{Source: server.URL}.load()
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+}
+
+func TestHistoryEndpoints(t *testing.T) {
+	ctx := testcontext.New(t)
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	history, err := NewHistory(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, history.Close()) }()
+	scenario, err := NewScenarios("")
+	require.NoError(t, err)
+	rs, err := ParseRS("2/3/4/5")
+	require.NoError(t, err)
+
+	satIdentity, err := testidentity.PregeneratedSignedIdentity(0, storj.LatestIDVersion())
+	require.NoError(t, err)
+	sat := &satellitePeer{
+		identity: satIdentity,
+		scenario: scenario,
+		nodes:    NewNodes(),
+		history:  history,
+		rs:       rs,
+	}
+	url := startSatellite(t, ctx, sat)
+
+	nodeIdentity, err := testidentity.PregeneratedIdentity(1, storj.LatestIDVersion())
+	require.NoError(t, err)
+	conn := dialSatellite(t, ctx, nodeIdentity, url)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	tags, err := pb.Marshal(&pb.NodeTagSet{
+		NodeId: nodeIdentity.ID.Bytes(),
+		Tags:   []*pb.Tag{{Name: "soc2", Value: []byte("true")}},
+	})
+	require.NoError(t, err)
+	_, err = pb.NewDRPCNodeClient(conn).CheckIn(ctx, &pb.CheckInRequest{
+		Address:    "localhost:28967",
+		Capacity:   &pb.NodeCapacity{FreeDisk: 1000},
+		Operator:   &pb.NodeOperator{Email: "operator@example.com"},
+		SignedTags: &pb.SignedNodeTagSets{Tags: []*pb.SignedNodeTagSet{{SerializedTag: tags}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, sat.nodes.All(), 1)
+
+	stream, err := pb.NewDRPCOrdersClient(conn).SettlementWithWindow(ctx)
+	require.NoError(t, err)
+	for _, order := range []struct {
+		action pb.PieceAction
+		amount int64
+	}{{pb.PieceAction_GET, 100}, {pb.PieceAction_GET, 50}, {pb.PieceAction_PUT, 10}} {
+		require.NoError(t, stream.Send(&pb.SettlementRequest{
+			Limit: &pb.OrderLimit{Action: order.action},
+			Order: &pb.Order{Amount: order.amount},
+		}))
+	}
+	resp, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	require.Equal(t, pb.SettlementWithWindowResponse_ACCEPTED, resp.Status)
+
+	check := func(events map[string][]Event) {
+		require.Len(t, events, 1)
+		recorded := events[nodeIdentity.ID.String()]
+		require.Len(t, recorded, 2)
+		require.Equal(t, satIdentity.ID.String(), recorded[0].Satellite)
+		require.Equal(t, "localhost:28967", recorded[0].CheckIn.Address)
+		require.Equal(t, int64(1000), recorded[0].CheckIn.FreeDisk)
+		require.Equal(t, "operator@example.com", recorded[0].CheckIn.Email)
+		require.Equal(t, map[string]string{"soc2": "true"}, recorded[0].CheckIn.Tags)
+		require.Equal(t, 3, recorded[1].Settlement.Orders)
+		require.Equal(t, "ACCEPTED", recorded[1].Settlement.Status)
+		require.Equal(t, map[string]int64{"GET": 150, "PUT": 10}, recorded[1].Settlement.Amount)
+	}
+	check(history.Events(storj.NodeID{}))
+
+	persisted, err := LoadHistory(path)
+	require.NoError(t, err)
+	check(persisted)
+}
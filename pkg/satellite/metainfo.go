@@ -1,13 +1,18 @@
 package satellite
 
 import (
+	"bytes"
 	"context"
-	"fmt"
+	"crypto/sha256"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/klauspost/compress/zstd"
+	"github.com/gogo/protobuf/types"
 	"github.com/zeebo/errs"
-	"golang.org/x/exp/slices"
 	"storj.io/common/identity"
 	"storj.io/common/pb"
 	"storj.io/common/rpc/rpcstatus"
@@ -18,143 +23,198 @@ import (
 	"storj.io/storj/satellite/metainfo"
 )
 
+// maxSegmentDownloads is the number of segments returned together with the object in one DownloadObject call.
+const maxSegmentDownloads = 1
+
+// maxListLimit is the maximum number of items returned by one list call.
+const maxListLimit = 1000
+
+// Metainfo is an in-memory metainfo endpoint. Pieces are placed on the known storage nodes,
+// and the order limits are signed with the identity of the mock satellite, so a stock uplink can upload and download.
 type Metainfo struct {
 	identity *identity.FullIdentity
-}
-
-func (m *Metainfo) AccountLicenses(ctx context.Context, request *pb.AccountLicensesRequest) (*pb.AccountLicensesResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
+	nodes    *Nodes
+	rs       *pb.RedundancyScheme
 
-func (m *Metainfo) GetBucketNotificationConfiguration(ctx context.Context, request *pb.GetBucketNotificationConfigurationRequest) (*pb.GetBucketNotificationConfigurationResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
+	mu      sync.Mutex
+	buckets map[string]*bucket
 
-func (m *Metainfo) SetBucketNotificationConfiguration(ctx context.Context, request *pb.SetBucketNotificationConfigurationRequest) (*pb.SetBucketNotificationConfigurationResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
+	// streams are the pending and committed objects by stream ID.
+	streams map[string]*object
 
-func (m *Metainfo) GetBucketTagging(ctx context.Context, request *pb.GetBucketTaggingRequest) (*pb.GetBucketTaggingResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	// uploads are the segments under upload by segment ID.
+	uploads map[string]*segment
 }
 
-func (m *Metainfo) SetBucketTagging(ctx context.Context, request *pb.SetBucketTaggingRequest) (*pb.SetBucketTaggingResponse, error) {
-	//TODO implement me
-	panic("implement me")
+type bucket struct {
+	name         []byte
+	created      time.Time
+	placement    []byte
+	versioning   int32
+	objectLock   *pb.ObjectLockConfiguration
+	tags         []*pb.BucketTag
+	notification *pb.NotificationConfiguration
+
+	// objects are the committed objects by encrypted key.
+	objects map[string]*object
 }
 
-func (m *Metainfo) DeleteObjects(ctx context.Context, request *pb.DeleteObjectsRequest) (*pb.DeleteObjectsResponse, error) {
-	panic("implement me")
+type object struct {
+	bucket     []byte
+	key        []byte
+	streamID   storj.StreamID
+	status     pb.Object_Status
+	created    time.Time
+	expires    time.Time
+	encryption *pb.EncryptionParameters
+	metadata   objectMetadata
+	retention  *pb.Retention
+	legalHold  bool
+	segments   []*segment
 }
 
-var _ pb.DRPCMetainfoServer = (*Metainfo)(nil)
-
-func (m *Metainfo) SetBucketObjectLockConfiguration(ctx context.Context, request *pb.SetBucketObjectLockConfigurationRequest) (*pb.SetBucketObjectLockConfigurationResponse, error) {
-	//TODO implement me
-	panic("implement me")
+type objectMetadata struct {
+	nonce             storj.Nonce
+	encryptedKey      []byte
+	data              []byte
+	etag              []byte
+	checksumAlgorithm pb.ObjectChecksumAlgorithm
+	checksumComposite bool
+	checksum          []byte
 }
 
-func (m *Metainfo) GetObjectLegalHold(ctx context.Context, request *pb.GetObjectLegalHoldRequest) (*pb.GetObjectLegalHoldResponse, error) {
-	return &pb.GetObjectLegalHoldResponse{
-		Enabled: false,
-	}, nil
+type segment struct {
+	streamID    storj.StreamID
+	segmentID   storj.SegmentID
+	position    *pb.SegmentPosition
+	created     time.Time
+	rootPieceID storj.PieceID
+	rs          *pb.RedundancyScheme
+
+	// uplinkKey and maxPieceSize are used to create the PUT order limits (also for retries).
+	uplinkKey    storj.PiecePublicKey
+	maxPieceSize int64
+	limits       []*pb.AddressedOrderLimit
+
+	encryptedKeyNonce storj.Nonce
+	encryptedKey      []byte
+	encryptedSize     int64
+	plainSize         int64
+	plainOffset       int64
+	etag              []byte
+	checksum          []byte
+	inline            []byte
+
+	// pieces are the uploaded pieces, with the address of the node.
+	pieces []piece
 }
 
-func (m *Metainfo) SetObjectLegalHold(ctx context.Context, request *pb.SetObjectLegalHoldRequest) (*pb.SetObjectLegalHoldResponse, error) {
-	//TODO implement me
-	panic("implement me")
+type piece struct {
+	num  int32
+	node storj.NodeURL
 }
 
-func NewMetainfo(identity *identity.FullIdentity) *Metainfo {
+// NewMetainfo creates the endpoint. New segments are stored with the rs redundancy, on the nodes of the registry.
+func NewMetainfo(identity *identity.FullIdentity, nodes *Nodes, rs *pb.RedundancyScheme) *Metainfo {
 	return &Metainfo{
 		identity: identity,
+		nodes:    nodes,
+		rs:       rs,
+		buckets:  map[string]*bucket{},
+		streams:  map[string]*object{},
+		uploads:  map[string]*segment{},
 	}
 }
 
-func (m *Metainfo) CreateBucket(ctx context.Context, request *pb.CreateBucketRequest) (*pb.CreateBucketResponse, error) {
-	return &pb.CreateBucketResponse{
-		Bucket: &pb.Bucket{
-			Name: request.Name,
-		},
-	}, nil
-}
-
-func (m *Metainfo) GetBucket(ctx context.Context, request *pb.GetBucketRequest) (*pb.GetBucketResponse, error) {
-	return &pb.GetBucketResponse{
-		Bucket: &pb.Bucket{
-			Name: request.Name,
-		},
-	}, nil
-}
-
-func (m *Metainfo) GetBucketLocation(ctx context.Context, request *pb.GetBucketLocationRequest) (*pb.GetBucketLocationResponse, error) {
-	return &pb.GetBucketLocationResponse{
-		Location: []byte("global"),
+// ParseRS parses the redundancy scheme in the k/repair/success/total form (the share size is always 256 bytes).
+func ParseRS(rs string) (*pb.RedundancyScheme, error) {
+	parts := strings.Split(rs, "/")
+	if len(parts) != 4 {
+		return nil, errs.New("redundancy scheme should be in the form k/repair/success/total: %s", rs)
+	}
+	var values []int32
+	for _, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, errs.New("invalid redundancy scheme %s: %v", rs, err)
+		}
+		values = append(values, int32(v))
+	}
+	if values[0] <= 0 || values[0] > values[1] || values[1] > values[2] || values[2] > values[3] {
+		return nil, errs.New("invalid redundancy scheme %s", rs)
+	}
+	return &pb.RedundancyScheme{
+		Type:             pb.RedundancyScheme_RS,
+		MinReq:           values[0],
+		RepairThreshold:  values[1],
+		SuccessThreshold: values[2],
+		Total:            values[3],
+		ErasureShareSize: 256,
 	}, nil
 }
 
-func (m *Metainfo) GetBucketVersioning(ctx context.Context, request *pb.GetBucketVersioningRequest) (*pb.GetBucketVersioningResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (m *Metainfo) SetBucketVersioning(ctx context.Context, request *pb.SetBucketVersioningRequest) (*pb.SetBucketVersioningResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
+var _ pb.DRPCMetainfoServer = (*Metainfo)(nil)
 
-func (m *Metainfo) GetBucketObjectLockConfiguration(ctx context.Context, request *pb.GetBucketObjectLockConfigurationRequest) (*pb.GetBucketObjectLockConfigurationResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
+func (m *Metainfo) BeginObject(ctx context.Context, request *pb.BeginObjectRequest) (*pb.BeginObjectResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-func (m *Metainfo) DeleteBucket(ctx context.Context, request *pb.DeleteBucketRequest) (*pb.DeleteBucketResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
+	b, err := m.bucket(request.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if (request.Retention != nil || request.LegalHold) && !b.lockEnabled() {
+		return nil, rpcstatus.Error(rpcstatus.ObjectLockBucketRetentionConfigurationMissing, "object lock is not enabled for the bucket")
+	}
 
-func (m *Metainfo) ListBuckets(ctx context.Context, request *pb.ListBucketsRequest) (*pb.ListBucketsResponse, error) {
+	streamID, err := m.newStreamID(ctx, request.Bucket, request.EncryptedObjectKey)
+	if err != nil {
+		return nil, err
+	}
 
-	return &pb.ListBucketsResponse{
-		Items: []*pb.BucketListItem{
-			{
-				Name:      []byte("nothing"),
-				CreatedAt: time.Now(),
-			},
+	m.streams[string(streamID)] = &object{
+		bucket:     request.Bucket,
+		key:        request.EncryptedObjectKey,
+		streamID:   streamID,
+		status:     pb.Object_UPLOADING,
+		created:    time.Now(),
+		expires:    request.ExpiresAt,
+		encryption: request.EncryptionParameters,
+		metadata: objectMetadata{
+			nonce:             request.EncryptedMetadataNonce,
+			encryptedKey:      request.EncryptedMetadataEncryptedKey,
+			data:              request.EncryptedMetadata,
+			etag:              request.EncryptedEtag,
+			checksumAlgorithm: request.ChecksumAlgorithm,
+			checksumComposite: request.IsChecksumComposite,
+			checksum:          request.EncryptedChecksum,
 		},
+		retention: request.Retention,
+		legalHold: request.LegalHold,
+	}
+
+	return &pb.BeginObjectResponse{
+		Bucket:             request.Bucket,
+		EncryptedObjectKey: request.EncryptedObjectKey,
+		StreamId:           streamID,
+		RedundancyScheme:   m.rs,
 	}, nil
 }
 
-func (m *Metainfo) BeginObject(ctx context.Context, request *pb.BeginObjectRequest) (*pb.BeginObjectResponse, error) {
+func (m *Metainfo) newStreamID(ctx context.Context, bucket []byte, key []byte) (storj.StreamID, error) {
 	streamID, err := uuid.New()
 	if err != nil {
 		return nil, rpcstatus.Error(rpcstatus.Internal, "unable to create stream id")
 	}
-	satStreamID, err := packStreamID(ctx, &internalpb.StreamID{
-		Bucket:             []byte(request.Bucket),
-		EncryptedObjectKey: []byte(request.EncryptedObjectKey),
-		Version:            int64(request.Version),
+	return packStreamID(ctx, &internalpb.StreamID{
+		Bucket:             bucket,
+		EncryptedObjectKey: key,
 		CreationDate:       time.Now(),
 		StreamId:           streamID[:],
 		MultipartObject:    false,
-		//EncryptionParameters: encryptionParameters,
-		Placement: int32(0),
-		Versioned: false,
+		Placement:          int32(0),
+		Versioned:          false,
 	}, m.identity)
-	if err != nil {
-		return nil, rpcstatus.Error(rpcstatus.Internal, "unable to create stream id")
-	}
-
-	return &pb.ObjectBeginResponse{
-		Bucket:             request.Bucket,
-		EncryptedObjectKey: request.EncryptedObjectKey,
-		StreamId:           satStreamID,
-		//RedundancyScheme:   endpoint.defaultRS,
-	}, nil
 }
 
 func packStreamID(ctx context.Context, satStreamID *internalpb.StreamID, identiy *identity.FullIdentity) (streamID storj.StreamID, err error) {
@@ -187,253 +247,1132 @@ func packStreamID(ctx context.Context, satStreamID *internalpb.StreamID, identiy
 }
 
 func (m *Metainfo) CommitObject(ctx context.Context, request *pb.CommitObjectRequest) (*pb.CommitObjectResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, err := m.pendingObject(request.StreamId)
+	if err != nil {
+		return nil, err
+	}
+	b, err := m.bucket(o.bucket)
+	if err != nil {
+		return nil, err
+	}
+	for _, condition := range request.IfNoneMatch {
+		if condition == "*" && m.committed(b, o.key) != nil {
+			return nil, rpcstatus.Error(rpcstatus.FailedPrecondition, "object already exists")
+		}
+	}
+	if existing := m.committed(b, o.key); existing != nil {
+		if err := existing.protected(false); err != nil {
+			return nil, err
+		}
+	}
+
+	if !request.SkipOverrideEncryptedMetadata && request.EncryptedMetadata != nil {
+		o.metadata = objectMetadata{
+			nonce:             request.EncryptedMetadataNonce,
+			encryptedKey:      request.EncryptedMetadataEncryptedKey,
+			data:              request.EncryptedMetadata,
+			etag:              request.EncryptedEtag,
+			checksumAlgorithm: request.ChecksumAlgorithm,
+			checksumComposite: request.IsChecksumComposite,
+			checksum:          request.EncryptedChecksum,
+		}
+	}
+	if o.retention == nil {
+		o.retention = b.defaultRetention(time.Now())
+	}
+
+	sort.Slice(o.segments, func(i, j int) bool {
+		return lessPosition(o.segments[i].position, o.segments[j].position)
+	})
+	var offset int64
+	for _, s := range o.segments {
+		s.plainOffset = offset
+		offset += s.plainSize
+	}
+
+	o.status = pb.Object_COMMITTED_UNVERSIONED
+	m.replace(b, o)
 	return &pb.CommitObjectResponse{
-		Object: &pb.Object{},
+		Object: m.objectInfo(o),
 	}, nil
 }
 
+// replace stores the committed object, and removes the previous object with the same key.
+func (m *Metainfo) replace(b *bucket, o *object) {
+	if previous, found := b.objects[string(o.key)]; found {
+		delete(m.streams, string(previous.streamID))
+	}
+	b.objects[string(o.key)] = o
+	m.streams[string(o.streamID)] = o
+}
+
+func (m *Metainfo) objectInfo(o *object) *pb.Object {
+	info := &pb.Object{
+		Bucket:                        o.bucket,
+		EncryptedObjectKey:            o.key,
+		Status:                        o.status,
+		StreamId:                      o.streamID,
+		CreatedAt:                     o.created,
+		ExpiresAt:                     o.expires,
+		EncryptionParameters:          o.encryption,
+		RedundancyScheme:              m.rs,
+		EncryptedMetadataNonce:        o.metadata.nonce,
+		EncryptedMetadataEncryptedKey: o.metadata.encryptedKey,
+		EncryptedMetadata:             o.metadata.data,
+		EncryptedEtag:                 o.metadata.etag,
+		ChecksumAlgorithm:             o.metadata.checksumAlgorithm,
+		IsChecksumComposite:           o.metadata.checksumComposite,
+		EncryptedChecksum:             o.metadata.checksum,
+		Retention:                     o.retention,
+	}
+	if o.legalHold {
+		info.LegalHold = &types.BoolValue{Value: true}
+	}
+	if len(info.EncryptedMetadata) > 0 && len(o.segments) > 0 {
+		info.EncryptedMetadata = streamMeta(o, info.EncryptedMetadata)
+	}
+	for _, s := range o.segments {
+		info.PlainSize += s.plainSize
+		info.TotalSize += s.encryptedSize
+		if s.inline != nil {
+			info.InlineSize += s.encryptedSize
+		} else {
+			info.RemoteSize += s.encryptedSize
+		}
+	}
+	return info
+}
+
+// streamMeta completes the stream metadata of the uplink with the encryption parameters and the last segment, as the satellite does.
+func streamMeta(o *object, encryptedMetadata []byte) []byte {
+	meta := pb.StreamMeta{}
+	err := pb.Unmarshal(encryptedMetadata, &meta)
+	if err != nil {
+		return encryptedMetadata
+	}
+	last := o.segments[len(o.segments)-1]
+	if o.encryption != nil {
+		meta.EncryptionType = int32(o.encryption.CipherSuite)
+		meta.EncryptionBlockSize = int32(o.encryption.BlockSize)
+	}
+	meta.NumberOfSegments = int64(len(o.segments))
+	meta.LastSegmentMeta = &pb.SegmentMeta{
+		EncryptedKey: last.encryptedKey,
+		KeyNonce:     last.encryptedKeyNonce.Bytes(),
+	}
+	completed, err := pb.Marshal(&meta)
+	if err != nil {
+		return encryptedMetadata
+	}
+	return completed
+}
+
 func (m *Metainfo) GetObject(ctx context.Context, request *pb.GetObjectRequest) (*pb.GetObjectResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.object(request.Bucket, request.EncryptedObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetObjectResponse{
+		Object: m.objectInfo(o),
+	}, nil
 }
 
 func (m *Metainfo) ListObjects(ctx context.Context, request *pb.ListObjectsRequest) (*pb.ListObjectsResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	delimiter := request.Delimiter
+	if len(delimiter) == 0 {
+		delimiter = []byte("/")
+	}
+	includeMetadata := !request.UseObjectIncludes || request.ObjectIncludes.GetMetadata()
+
+	items := map[string]*pb.ObjectListItem{}
+	for key, o := range b.objects {
+		if o.expired() || !strings.HasPrefix(key, string(request.EncryptedPrefix)) {
+			continue
+		}
+		rel := key[len(request.EncryptedPrefix):]
+		if !request.Recursive {
+			if i := strings.Index(rel, string(delimiter)); i >= 0 {
+				prefix := rel[:i+len(delimiter)]
+				items[prefix] = &pb.ObjectListItem{
+					EncryptedObjectKey: []byte(prefix),
+					Status:             pb.Object_PREFIX,
+				}
+				continue
+			}
+		}
+		item := &pb.ObjectListItem{
+			EncryptedObjectKey: []byte(rel),
+			Status:             o.status,
+			IsLatest:           true,
+			CreatedAt:          o.created,
+			ExpiresAt:          o.expires,
+			PlainSize:          m.objectInfo(o).PlainSize,
+			StreamId:           &o.streamID,
+		}
+		if includeMetadata {
+			info := m.objectInfo(o)
+			item.EncryptedMetadataNonce = o.metadata.nonce
+			item.EncryptedMetadataEncryptedKey = o.metadata.encryptedKey
+			item.EncryptedMetadata = info.EncryptedMetadata
+			item.EncryptedEtag = o.metadata.etag
+			item.ChecksumAlgorithm = o.metadata.checksumAlgorithm
+			item.IsChecksumComposite = o.metadata.checksumComposite
+			item.EncryptedChecksum = o.metadata.checksum
+		}
+		items[rel] = item
+	}
+
+	var keys []string
+	for k := range items {
+		if len(request.EncryptedCursor) > 0 && k <= string(request.EncryptedCursor) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	resp := &pb.ListObjectsResponse{}
+	limit := listLimit(request.Limit)
+	for _, k := range keys {
+		if len(resp.Items) >= limit {
+			resp.More = true
+			break
+		}
+		resp.Items = append(resp.Items, items[k])
+	}
+	return resp, nil
+}
+
+func listLimit(limit int32) int {
+	if limit <= 0 || limit > maxListLimit {
+		return maxListLimit
+	}
+	return int(limit)
 }
 
 func (m *Metainfo) BeginDeleteObject(ctx context.Context, request *pb.BeginDeleteObjectRequest) (*pb.BeginDeleteObjectResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// pending object (abort upload)
+	if request.Status == int32(pb.Object_UPLOADING) && request.StreamId != nil {
+		o, err := m.pendingObject(*request.StreamId)
+		if err != nil {
+			return nil, err
+		}
+		m.abort(o)
+		return &pb.BeginDeleteObjectResponse{
+			StreamId: o.streamID,
+			Object:   m.objectInfo(o),
+		}, nil
+	}
+
+	b, err := m.bucket(request.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	o := m.committed(b, request.EncryptedObjectKey)
+	if o == nil {
+		// deleting a missing object is not an error
+		return &pb.BeginDeleteObjectResponse{}, nil
+	}
+	if err := o.protected(request.BypassGovernanceRetention); err != nil {
+		return nil, err
+	}
+	m.delete(b, o)
+	return &pb.BeginDeleteObjectResponse{
+		StreamId: o.streamID,
+		Object:   m.objectInfo(o),
+	}, nil
+}
+
+func (m *Metainfo) delete(b *bucket, o *object) {
+	delete(b.objects, string(o.key))
+	delete(m.streams, string(o.streamID))
+}
+
+// abort removes the pending object and the segments under upload.
+func (m *Metainfo) abort(o *object) {
+	delete(m.streams, string(o.streamID))
+	for id, s := range m.uploads {
+		if bytes.Equal(s.streamID, o.streamID) {
+			delete(m.uploads, id)
+		}
+	}
 }
 
 func (m *Metainfo) FinishDeleteObject(ctx context.Context, request *pb.FinishDeleteObjectRequest) (*pb.FinishDeleteObjectResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	return &pb.FinishDeleteObjectResponse{}, nil
+}
+
+func (m *Metainfo) DeleteObjects(ctx context.Context, request *pb.DeleteObjectsRequest) (*pb.DeleteObjectsResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.DeleteObjectsResponse{}
+	for _, item := range request.Items {
+		result := &pb.DeleteObjectsResponseItem{
+			EncryptedObjectKey:     item.EncryptedObjectKey,
+			RequestedObjectVersion: item.ObjectVersion,
+		}
+		o := m.committed(b, item.EncryptedObjectKey)
+		switch {
+		case o == nil:
+			result.Status = pb.DeleteObjectsResponseItem_NOT_FOUND
+		case o.protected(request.BypassGovernanceRetention) != nil:
+			result.Status = pb.DeleteObjectsResponseItem_LOCKED
+		default:
+			m.delete(b, o)
+			result.Status = pb.DeleteObjectsResponseItem_OK
+			result.Removed = &pb.DeleteObjectsResponseItemInfo{
+				Status: o.status,
+			}
+		}
+		if !request.Quiet || result.Status != pb.DeleteObjectsResponseItem_OK {
+			resp.Items = append(resp.Items, result)
+		}
+	}
+	return resp, nil
 }
 
 func (m *Metainfo) GetObjectIPs(ctx context.Context, request *pb.GetObjectIPsRequest) (*pb.GetObjectIPsResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.object(request.Bucket, request.EncryptedObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.GetObjectIPsResponse{
+		SegmentCount: int64(len(o.segments)),
+	}
+	ips := map[string]bool{}
+	for _, s := range o.segments {
+		resp.PieceCount += int64(len(s.pieces))
+		resp.ReliablePieceCount += int64(len(s.pieces))
+		for _, p := range s.pieces {
+			host, _, err := net.SplitHostPort(p.node.Address)
+			if err != nil {
+				host = p.node.Address
+			}
+			if !ips[host] {
+				ips[host] = true
+				resp.Ips = append(resp.Ips, []byte(host))
+			}
+		}
+	}
+	return resp, nil
 }
 
 func (m *Metainfo) ListPendingObjectStreams(ctx context.Context, request *pb.ListPendingObjectStreamsRequest) (*pb.ListPendingObjectStreamsResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.bucket(request.Bucket); err != nil {
+		return nil, err
+	}
+	var pending []*object
+	for _, o := range m.streams {
+		if o.status == pb.Object_UPLOADING && bytes.Equal(o.bucket, request.Bucket) && bytes.Equal(o.key, request.EncryptedObjectKey) {
+			if len(request.StreamIdCursor) > 0 && bytes.Compare(o.streamID, request.StreamIdCursor) <= 0 {
+				continue
+			}
+			pending = append(pending, o)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return bytes.Compare(pending[i].streamID, pending[j].streamID) < 0
+	})
+
+	resp := &pb.ListPendingObjectStreamsResponse{}
+	limit := listLimit(request.Limit)
+	for _, o := range pending {
+		if len(resp.Items) >= limit {
+			resp.More = true
+			break
+		}
+		resp.Items = append(resp.Items, &pb.ObjectListItem{
+			EncryptedObjectKey:            o.key,
+			Status:                        o.status,
+			CreatedAt:                     o.created,
+			ExpiresAt:                     o.expires,
+			EncryptedMetadataNonce:        o.metadata.nonce,
+			EncryptedMetadataEncryptedKey: o.metadata.encryptedKey,
+			EncryptedMetadata:             o.metadata.data,
+			StreamId:                      &o.streamID,
+		})
+	}
+	return resp, nil
 }
 
 func (m *Metainfo) DownloadObject(ctx context.Context, request *pb.DownloadObjectRequest) (*pb.DownloadObjectResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.object(request.Bucket, request.EncryptedObjectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info := m.objectInfo(o)
+	start := rangeStart(request.Range, info.PlainSize)
+
+	resp := &pb.DownloadObjectResponse{
+		Object: info,
+		SegmentList: &pb.ListSegmentsResponse{
+			EncryptionParameters: o.encryption,
+		},
+	}
+	for _, s := range o.segments {
+		resp.SegmentList.Items = append(resp.SegmentList.Items, segmentListItem(s))
+		if len(resp.SegmentDownload) < maxSegmentDownloads && s.plainOffset+s.plainSize > start {
+			download, err := m.segmentDownload(ctx, s)
+			if err != nil {
+				return nil, err
+			}
+			resp.SegmentDownload = append(resp.SegmentDownload, download)
+		}
+	}
+	return resp, nil
+}
+
+// rangeStart returns the first requested plain byte of the object.
+func rangeStart(r *pb.Range, size int64) int64 {
+	switch v := r.GetRange().(type) {
+	case *pb.Range_Start:
+		return v.Start.PlainStart
+	case *pb.Range_StartLimit:
+		return v.StartLimit.PlainStart
+	case *pb.Range_Suffix:
+		return max(size-v.Suffix.PlainSuffix, 0)
+	}
+	return 0
+}
+
+func segmentListItem(s *segment) *pb.SegmentListItem {
+	return &pb.SegmentListItem{
+		Position:          s.position,
+		PlainSize:         s.plainSize,
+		PlainOffset:       s.plainOffset,
+		CreatedAt:         s.created,
+		EncryptedETag:     s.etag,
+		EncryptedChecksum: s.checksum,
+		EncryptedKeyNonce: s.encryptedKeyNonce,
+		EncryptedKey:      s.encryptedKey,
+	}
 }
 
 func (m *Metainfo) GetPendingObjectMetadata(ctx context.Context, request *pb.GetPendingObjectMetadataRequest) (*pb.GetPendingObjectMetadataResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.pendingObject(request.StreamId)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetPendingObjectMetadataResponse{
+		EncryptedMetadataNonce:        o.metadata.nonce,
+		EncryptedMetadataEncryptedKey: o.metadata.encryptedKey,
+		EncryptedMetadata:             o.metadata.data,
+		EncryptedEtag:                 o.metadata.etag,
+		ChecksumAlgorithm:             o.metadata.checksumAlgorithm,
+		IsChecksumComposite:           o.metadata.checksumComposite,
+		EncryptedChecksum:             o.metadata.checksum,
+	}, nil
 }
 
 func (m *Metainfo) UpdateObjectMetadata(ctx context.Context, request *pb.UpdateObjectMetadataRequest) (*pb.UpdateObjectMetadataResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.object(request.Bucket, request.EncryptedObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	o.metadata.nonce = request.EncryptedMetadataNonce
+	o.metadata.encryptedKey = request.EncryptedMetadataEncryptedKey
+	o.metadata.data = request.EncryptedMetadata
+	if request.SetEncryptedEtag {
+		o.metadata.etag = request.EncryptedEtag
+	}
+	return &pb.UpdateObjectMetadataResponse{}, nil
 }
 
 func (m *Metainfo) GetObjectRetention(ctx context.Context, request *pb.GetObjectRetentionRequest) (*pb.GetObjectRetentionResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.lockedObject(request.Bucket, request.EncryptedObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	if o.retention == nil {
+		return nil, rpcstatus.Error(rpcstatus.ObjectLockObjectRetentionConfigurationMissing, "object has no retention configuration")
+	}
+	return &pb.GetObjectRetentionResponse{
+		Retention: o.retention,
+	}, nil
 }
 
 func (m *Metainfo) SetObjectRetention(ctx context.Context, request *pb.SetObjectRetentionRequest) (*pb.SetObjectRetentionResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.lockedObject(request.Bucket, request.EncryptedObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	if active(o.retention) {
+		shortened := request.Retention == nil || request.Retention.RetainUntil.Before(o.retention.RetainUntil) || request.Retention.Mode != o.retention.Mode
+		if shortened && (o.retention.Mode == pb.Retention_COMPLIANCE || !request.BypassGovernanceRetention) {
+			return nil, rpcstatus.Error(rpcstatus.ObjectLockObjectProtected, "retention period can't be shortened")
+		}
+	}
+	o.retention = request.Retention
+	return &pb.SetObjectRetentionResponse{}, nil
+}
+
+func (m *Metainfo) GetObjectLegalHold(ctx context.Context, request *pb.GetObjectLegalHoldRequest) (*pb.GetObjectLegalHoldResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.lockedObject(request.Bucket, request.EncryptedObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetObjectLegalHoldResponse{
+		Enabled: o.legalHold,
+	}, nil
+}
+
+func (m *Metainfo) SetObjectLegalHold(ctx context.Context, request *pb.SetObjectLegalHoldRequest) (*pb.SetObjectLegalHoldResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.lockedObject(request.Bucket, request.EncryptedObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	o.legalHold = request.Enabled
+	return &pb.SetObjectLegalHoldResponse{}, nil
+}
+
+// lockedObject returns the committed object from a bucket with object lock.
+func (m *Metainfo) lockedObject(bucketName []byte, key []byte) (*object, error) {
+	b, err := m.bucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	if !b.lockEnabled() {
+		return nil, rpcstatus.Error(rpcstatus.ObjectLockBucketRetentionConfigurationMissing, "object lock is not enabled for the bucket")
+	}
+	return m.object(bucketName, key)
+}
+
+// protected returns an error if the object can't be deleted or overwritten.
+func (o *object) protected(bypassGovernance bool) error {
+	if o.legalHold {
+		return rpcstatus.Error(rpcstatus.ObjectLockObjectProtected, "object is protected by legal hold")
+	}
+	if active(o.retention) && (o.retention.Mode == pb.Retention_COMPLIANCE || !bypassGovernance) {
+		return rpcstatus.Error(rpcstatus.ObjectLockObjectProtected, "object is protected by retention")
+	}
+	return nil
+}
+
+func active(retention *pb.Retention) bool {
+	return retention != nil && retention.Mode != pb.Retention_INVALID && retention.RetainUntil.After(time.Now())
+}
+
+func (o *object) expired() bool {
+	return !o.expires.IsZero() && o.expires.Before(time.Now())
 }
 
 func (m *Metainfo) BeginSegment(ctx context.Context, request *pb.BeginSegmentRequest) (*pb.BeginSegmentResponse, error) {
-	return &pb.BeginSegmentResponse{}, nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.pendingObject(request.StreamId); err != nil {
+		return nil, err
+	}
+
+	publicKey, privateKey, err := storj.NewPieceKey()
+	if err != nil {
+		return nil, rpcstatus.Error(rpcstatus.Internal, err.Error())
+	}
+	segmentID, err := uuid.New()
+	if err != nil {
+		return nil, rpcstatus.Error(rpcstatus.Internal, err.Error())
+	}
+	rootPieceID := storj.NewPieceID()
+
+	maxPieceSize := request.MaxOrderLimit
+	if maxPieceSize == 0 {
+		maxPieceSize = 64 * 1024 * 1024
+	}
+
+	s := &segment{
+		streamID:     request.StreamId,
+		segmentID:    segmentID.Bytes(),
+		position:     request.Position,
+		created:      time.Now(),
+		rootPieceID:  rootPieceID,
+		rs:           m.rs,
+		uplinkKey:    publicKey,
+		maxPieceSize: maxPieceSize,
+		limits:       make([]*pb.AddressedOrderLimit, m.rs.Total),
+	}
+
+	var numbers []int32
+	for i := int32(0); i < m.rs.Total; i++ {
+		numbers = append(numbers, i)
+	}
+	if err := m.putLimits(ctx, s, numbers); err != nil {
+		return nil, err
+	}
+	m.uploads[string(s.segmentID)] = s
+
+	return &pb.BeginSegmentResponse{
+		SegmentId:        s.segmentID,
+		AddressedLimits:  s.limits,
+		PrivateKey:       privateKey,
+		RedundancyScheme: m.rs,
+	}, nil
+}
+
+// putLimits creates new PUT order limits for the given piece numbers (on newly selected nodes).
+func (m *Metainfo) putLimits(ctx context.Context, s *segment, numbers []int32) error {
+	nodes, err := m.nodes.Select(len(numbers))
+	if err != nil {
+		return rpcstatus.Error(rpcstatus.FailedPrecondition, err.Error())
+	}
+	for i, num := range numbers {
+		node := nodes[i]
+		limit, err := m.signLimit(ctx, &pb.OrderLimit{
+			SerialNumber:    newSerialNumber(),
+			StorageNodeId:   node.ID,
+			UplinkPublicKey: s.uplinkKey,
+			PieceId:         s.rootPieceID.Derive(node.ID, num),
+			Limit:           s.maxPieceSize,
+			Action:          pb.PieceAction_PUT,
+			OrderExpiration: time.Now().Add(24 * time.Hour),
+			OrderCreation:   time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		s.limits[num] = &pb.AddressedOrderLimit{
+			Limit: limit,
+			StorageNodeAddress: &pb.NodeAddress{
+				Address: node.Address,
+			},
+		}
+	}
+	return nil
+}
+
+func (m *Metainfo) signLimit(ctx context.Context, limit *pb.OrderLimit) (*pb.OrderLimit, error) {
+	limit.SatelliteId = m.identity.ID
+	signed, err := signing.SignOrderLimit(ctx, signing.SignerFromFullIdentity(m.identity), limit)
+	if err != nil {
+		return nil, rpcstatus.Error(rpcstatus.Internal, err.Error())
+	}
+	return signed, nil
+}
+
+func newSerialNumber() storj.SerialNumber {
+	id, _ := uuid.New()
+	return storj.SerialNumber(id)
 }
 
 func (m *Metainfo) RetryBeginSegmentPieces(ctx context.Context, request *pb.RetryBeginSegmentPiecesRequest) (*pb.RetryBeginSegmentPiecesResponse, error) {
-	return &pb.RetryBeginSegmentPiecesResponse{}, nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, found := m.uploads[string(request.SegmentId)]
+	if !found {
+		return nil, rpcstatus.Error(rpcstatus.NotFound, "segment not found")
+	}
+	for _, num := range request.RetryPieceNumbers {
+		if num < 0 || num >= int32(len(s.limits)) {
+			return nil, rpcstatus.Errorf(rpcstatus.InvalidArgument, "invalid piece number %d", num)
+		}
+	}
+	if err := m.putLimits(ctx, s, request.RetryPieceNumbers); err != nil {
+		return nil, err
+	}
+	return &pb.RetryBeginSegmentPiecesResponse{
+		SegmentId:       s.segmentID,
+		AddressedLimits: s.limits,
+	}, nil
 }
 
 func (m *Metainfo) CommitSegment(ctx context.Context, request *pb.CommitSegmentRequest) (*pb.CommitSegmentResponse, error) {
-	return &pb.CommitSegmentResponse{}, nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, found := m.uploads[string(request.SegmentId)]
+	if !found {
+		return nil, rpcstatus.Error(rpcstatus.NotFound, "segment not found")
+	}
+	o, err := m.pendingObject(s.streamID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pieces []piece
+	for _, result := range request.UploadResult {
+		if result.PieceNum < 0 || result.PieceNum >= int32(len(s.limits)) {
+			continue
+		}
+		limit := s.limits[result.PieceNum]
+		if limit.Limit.StorageNodeId != result.NodeId {
+			continue
+		}
+		pieces = append(pieces, piece{
+			num: result.PieceNum,
+			node: storj.NodeURL{
+				ID:      result.NodeId,
+				Address: limit.StorageNodeAddress.Address,
+			},
+		})
+	}
+	if len(pieces) < int(s.rs.SuccessThreshold) {
+		return nil, rpcstatus.Errorf(rpcstatus.InvalidArgument, "number of valid pieces (%d) is less than the success threshold (%d)", len(pieces), s.rs.SuccessThreshold)
+	}
+	delete(m.uploads, string(request.SegmentId))
+
+	s.encryptedKeyNonce = request.EncryptedKeyNonce
+	s.encryptedKey = request.EncryptedKey
+	s.encryptedSize = request.SizeEncryptedData
+	s.plainSize = request.PlainSize
+	s.etag = request.EncryptedETag
+	s.checksum = request.EncryptedChecksum
+	s.pieces = pieces
+	o.addSegment(s)
+	return &pb.CommitSegmentResponse{
+		SuccessfulPieces: int32(len(pieces)),
+	}, nil
+}
+
+// addSegment adds the segment to the pending object, replacing the one with the same position.
+func (o *object) addSegment(s *segment) {
+	for i, existing := range o.segments {
+		if existing.position.PartNumber == s.position.PartNumber && existing.position.Index == s.position.Index {
+			o.segments[i] = s
+			return
+		}
+	}
+	o.segments = append(o.segments, s)
 }
 
 func (m *Metainfo) MakeInlineSegment(ctx context.Context, request *pb.MakeInlineSegmentRequest) (*pb.MakeInlineSegmentResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.pendingObject(request.StreamId)
+	if err != nil {
+		return nil, err
+	}
+	segmentID, err := uuid.New()
+	if err != nil {
+		return nil, rpcstatus.Error(rpcstatus.Internal, err.Error())
+	}
+	inline := request.EncryptedInlineData
+	if inline == nil {
+		inline = []byte{}
+	}
+	o.addSegment(&segment{
+		streamID:          request.StreamId,
+		segmentID:         segmentID.Bytes(),
+		position:          request.Position,
+		created:           time.Now(),
+		encryptedKeyNonce: request.EncryptedKeyNonce,
+		encryptedKey:      request.EncryptedKey,
+		encryptedSize:     int64(len(inline)),
+		plainSize:         request.PlainSize,
+		etag:              request.EncryptedETag,
+		checksum:          request.EncryptedChecksum,
+		inline:            inline,
+	})
 	return &pb.MakeInlineSegmentResponse{}, nil
 }
 
 func (m *Metainfo) BeginDeleteSegment(ctx context.Context, request *pb.BeginDeleteSegmentRequest) (*pb.BeginDeleteSegmentResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	// segments are deleted together with the object, pieces are collected by GC
+	return &pb.BeginDeleteSegmentResponse{}, nil
 }
 
 func (m *Metainfo) FinishDeleteSegment(ctx context.Context, request *pb.FinishDeleteSegmentRequest) (*pb.FinishDeleteSegmentResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	return &pb.FinishDeleteSegmentResponse{}, nil
 }
 
 func (m *Metainfo) ListSegments(ctx context.Context, request *pb.ListSegmentsRequest) (*pb.ListSegmentsResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.stream(request.StreamId)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.ListSegmentsResponse{
+		EncryptionParameters: o.encryption,
+	}
+	limit := listLimit(request.Limit)
+	for _, s := range o.segments {
+		if request.CursorPosition != nil && !lessPosition(request.CursorPosition, s.position) {
+			continue
+		}
+		if len(resp.Items) >= limit {
+			resp.More = true
+			break
+		}
+		resp.Items = append(resp.Items, segmentListItem(s))
+	}
+	return resp, nil
 }
 
 func (m *Metainfo) DownloadSegment(ctx context.Context, request *pb.DownloadSegmentRequest) (*pb.DownloadSegmentResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (m *Metainfo) DeletePart(ctx context.Context, request *pb.DeletePartRequest) (*pb.DeletePartResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (m *Metainfo) Batch(ctx context.Context, request *pb.BatchRequest) (*pb.BatchResponse, error) {
-	resp := &pb.BatchResponse{}
-
-	for _, r := range request.Requests {
-		switch singleRequest := r.Request.(type) {
-		case *pb.BatchRequestItem_ObjectBegin:
-			r, err := m.BeginObject(ctx, singleRequest.ObjectBegin)
-			if err != nil {
-				return nil, err
-			}
-			resp.Responses = append(resp.Responses, &pb.BatchResponseItem{
-				Response: &pb.BatchResponseItem_ObjectBegin{
-					ObjectBegin: r,
-				},
-			})
-		case *pb.BatchRequestItem_ObjectCommit:
-			r, err := m.CommitObject(ctx, singleRequest.ObjectCommit)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.stream(request.StreamId)
+	if err != nil {
+		return nil, err
+	}
+	position := request.CursorPosition
+	if position == nil {
+		position = &pb.SegmentPosition{}
+	}
+	for i, s := range o.segments {
+		if s.position.PartNumber == position.PartNumber && s.position.Index == position.Index {
+			resp, err := m.segmentDownload(ctx, s)
 			if err != nil {
 				return nil, err
 			}
-			resp.Responses = append(resp.Responses, &pb.BatchResponseItem{
-				Response: &pb.BatchResponseItem_ObjectCommit{
-					ObjectCommit: r,
-				},
-			})
-		case *pb.BatchRequestItem_SegmentMakeInline:
-			r, err := m.MakeInlineSegment(ctx, singleRequest.SegmentMakeInline)
-			if err != nil {
-				return nil, err
+			if i+1 < len(o.segments) {
+				resp.Next = o.segments[i+1].position
 			}
-			resp.Responses = append(resp.Responses, &pb.BatchResponseItem{
-				Response: &pb.BatchResponseItem_SegmentMakeInline{
-					SegmentMakeInline: r,
-				},
-			})
-		default:
-			panic(fmt.Sprintf("unsupported %T", singleRequest))
+			return resp, nil
+		}
+	}
+	return nil, rpcstatus.Errorf(rpcstatus.NotFound, "segment not found: %d/%d", position.PartNumber, position.Index)
+}
+
+// segmentDownload creates the signed GET order limits for all the pieces of the segment.
+func (m *Metainfo) segmentDownload(ctx context.Context, s *segment) (*pb.DownloadSegmentResponse, error) {
+	resp := &pb.DownloadSegmentResponse{
+		SegmentId:           s.segmentID,
+		EncryptedInlineData: s.inline,
+		PlainOffset:         s.plainOffset,
+		PlainSize:           s.plainSize,
+		SegmentSize:         s.encryptedSize,
+		EncryptedKeyNonce:   s.encryptedKeyNonce,
+		EncryptedKey:        s.encryptedKey,
+		Position:            s.position,
+	}
+	if s.inline != nil {
+		return resp, nil
+	}
+
+	publicKey, privateKey, err := storj.NewPieceKey()
+	if err != nil {
+		return nil, rpcstatus.Error(rpcstatus.Internal, err.Error())
+	}
+	resp.PrivateKey = privateKey
+	resp.RedundancyScheme = s.rs
+
+	stripeSize := int64(s.rs.ErasureShareSize * s.rs.MinReq)
+	pieceSize := (s.encryptedSize + stripeSize - 1) / stripeSize * int64(s.rs.ErasureShareSize)
+
+	// limits of the missing pieces are empty (nil elements can't be serialized)
+	resp.AddressedLimits = make([]*pb.AddressedOrderLimit, s.rs.Total)
+	for i := range resp.AddressedLimits {
+		resp.AddressedLimits[i] = &pb.AddressedOrderLimit{}
+	}
+	for _, p := range s.pieces {
+		limit, err := m.signLimit(ctx, &pb.OrderLimit{
+			SerialNumber:    newSerialNumber(),
+			StorageNodeId:   p.node.ID,
+			UplinkPublicKey: publicKey,
+			PieceId:         s.rootPieceID.Derive(p.node.ID, p.num),
+			Limit:           pieceSize,
+			Action:          pb.PieceAction_GET,
+			OrderExpiration: time.Now().Add(24 * time.Hour),
+			OrderCreation:   time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp.AddressedLimits[p.num] = &pb.AddressedOrderLimit{
+			Limit: limit,
+			StorageNodeAddress: &pb.NodeAddress{
+				Address: p.node.Address,
+			},
 		}
 	}
 	return resp, nil
 }
 
-func (m *Metainfo) CompressedBatch(ctx context.Context, request *pb.CompressedBatchRequest) (*pb.CompressedBatchResponse, error) {
-	var err error
-	zr, err := zstd.NewReader(nil)
+func (m *Metainfo) DeletePart(ctx context.Context, request *pb.DeletePartRequest) (*pb.DeletePartResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.pendingObject(request.StreamId)
 	if err != nil {
-		return nil, errs.Wrap(err)
+		return nil, err
 	}
-	zw, err := zstd.NewWriter(nil)
+	var kept []*segment
+	for _, s := range o.segments {
+		if s.position.PartNumber != request.PartNumber {
+			kept = append(kept, s)
+		}
+	}
+	o.segments = kept
+	return &pb.DeletePartResponse{}, nil
+}
+
+func (m *Metainfo) BeginMoveObject(ctx context.Context, request *pb.BeginMoveObjectRequest) (*pb.BeginMoveObjectResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.object(request.Bucket, request.EncryptedObjectKey)
 	if err != nil {
-		return nil, errs.Wrap(err)
+		return nil, err
+	}
+	if _, err := m.bucket(request.NewBucket); err != nil {
+		return nil, err
 	}
+	if err := o.protected(false); err != nil {
+		return nil, err
+	}
+	return &pb.BeginMoveObjectResponse{
+		StreamId:                  o.streamID,
+		EncryptedMetadataKeyNonce: o.metadata.nonce,
+		EncryptedMetadataKey:      o.metadata.encryptedKey,
+		SegmentKeys:               o.segmentKeys(),
+		EncryptionParameters:      o.encryption,
+	}, nil
+}
 
-	var reqData []byte
-	switch request.Selected {
-	case pb.CompressedBatchRequest_NONE:
-		reqData = request.Data
-	case pb.CompressedBatchRequest_ZSTD:
-		reqData, err = zr.DecodeAll(request.Data, nil)
-	default:
-		err = errs.New("unsupported compression")
+func (o *object) segmentKeys() []*pb.EncryptedKeyAndNonce {
+	var keys []*pb.EncryptedKeyAndNonce
+	for _, s := range o.segments {
+		keys = append(keys, &pb.EncryptedKeyAndNonce{
+			Position:          s.position,
+			EncryptedKeyNonce: s.encryptedKeyNonce,
+			EncryptedKey:      s.encryptedKey,
+		})
+	}
+	return keys
+}
+
+// setSegmentKeys replaces the segment encryption keys (for move and copy).
+func (o *object) setSegmentKeys(keys []*pb.EncryptedKeyAndNonce) error {
+	if len(keys) != len(o.segments) {
+		return rpcstatus.Errorf(rpcstatus.InvalidArgument, "wrong number of segment keys: %d != %d", len(keys), len(o.segments))
+	}
+	for _, key := range keys {
+		found := false
+		for _, s := range o.segments {
+			if s.position.PartNumber == key.Position.GetPartNumber() && s.position.Index == key.Position.GetIndex() {
+				s.encryptedKeyNonce = key.EncryptedKeyNonce
+				s.encryptedKey = key.EncryptedKey
+				found = true
+			}
+		}
+		if !found {
+			return rpcstatus.Errorf(rpcstatus.InvalidArgument, "segment key for unknown position %d/%d", key.Position.GetPartNumber(), key.Position.GetIndex())
+		}
+	}
+	return nil
+}
+
+func (m *Metainfo) FinishMoveObject(ctx context.Context, request *pb.FinishMoveObjectRequest) (*pb.FinishMoveObjectResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.stream(request.StreamId)
+	if err != nil || o.status == pb.Object_UPLOADING {
+		return nil, rpcstatus.Error(rpcstatus.NotFound, "object not found")
 	}
+	source, err := m.bucket(o.bucket)
 	if err != nil {
-		return nil, errs.Wrap(err)
+		return nil, err
 	}
-	var unReq pb.BatchRequest
-	err = pb.Unmarshal(reqData, &unReq)
+	target, err := m.bucket(request.NewBucket)
 	if err != nil {
-		return nil, errs.Wrap(err)
+		return nil, err
+	}
+	if existing := m.committed(target, request.NewEncryptedObjectKey); existing != nil && existing != o {
+		if err := existing.protected(false); err != nil {
+			return nil, err
+		}
+	}
+	if err := o.setSegmentKeys(request.NewSegmentKeys); err != nil {
+		return nil, err
 	}
 
-	unResp, err := m.Batch(ctx, &unReq)
-	if err != nil {
-		return nil, errs.Wrap(err)
+	m.delete(source, o)
+	o.bucket = request.NewBucket
+	o.key = request.NewEncryptedObjectKey
+	o.metadata.nonce = request.NewEncryptedMetadataKeyNonce
+	o.metadata.encryptedKey = request.NewEncryptedMetadataKey
+	if request.Retention != nil {
+		o.retention = request.Retention
 	}
+	o.legalHold = o.legalHold || request.LegalHold
+	m.replace(target, o)
+	return &pb.FinishMoveObjectResponse{}, nil
+}
 
-	unrespData, err := pb.Marshal(unResp)
+func (m *Metainfo) BeginCopyObject(ctx context.Context, request *pb.BeginCopyObjectRequest) (*pb.BeginCopyObjectResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.object(request.Bucket, request.EncryptedObjectKey)
 	if err != nil {
-		return nil, errs.Wrap(err)
+		return nil, err
 	}
+	if _, err := m.bucket(request.NewBucket); err != nil {
+		return nil, err
+	}
+	return &pb.BeginCopyObjectResponse{
+		StreamId:                  o.streamID,
+		EncryptedMetadataKeyNonce: o.metadata.nonce,
+		EncryptedMetadataKey:      o.metadata.encryptedKey,
+		SegmentKeys:               o.segmentKeys(),
+		EncryptionParameters:      o.encryption,
+		ChecksumAlgorithm:         o.metadata.checksumAlgorithm,
+	}, nil
+}
 
-	resp := new(pb.CompressedBatchResponse)
-	if slices.Contains(request.Supported, pb.CompressedBatchRequest_ZSTD) {
-		resp.Data = zw.EncodeAll(unrespData, nil)
-		resp.Selected = pb.CompressedBatchRequest_ZSTD
-	} else {
-		resp.Data = unrespData
-		resp.Selected = pb.CompressedBatchRequest_NONE
+func (m *Metainfo) FinishCopyObject(ctx context.Context, request *pb.FinishCopyObjectRequest) (*pb.FinishCopyObjectResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, err := m.stream(request.StreamId)
+	if err != nil || o.status == pb.Object_UPLOADING {
+		return nil, rpcstatus.Error(rpcstatus.NotFound, "object not found")
+	}
+	target, err := m.bucket(request.NewBucket)
+	if err != nil {
+		return nil, err
+	}
+	if (request.Retention != nil || request.LegalHold) && !target.lockEnabled() {
+		return nil, rpcstatus.Error(rpcstatus.ObjectLockBucketRetentionConfigurationMissing, "object lock is not enabled for the bucket")
+	}
+	if existing := m.committed(target, request.NewEncryptedObjectKey); existing != nil {
+		for _, condition := range request.IfNoneMatch {
+			if condition == "*" {
+				return nil, rpcstatus.Error(rpcstatus.FailedPrecondition, "object already exists")
+			}
+		}
+		if err := existing.protected(false); err != nil {
+			return nil, err
+		}
 	}
-	return resp, nil
 
+	streamID, err := m.newStreamID(ctx, request.NewBucket, request.NewEncryptedObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	cp := &object{
+		bucket:     request.NewBucket,
+		key:        request.NewEncryptedObjectKey,
+		streamID:   streamID,
+		status:     o.status,
+		created:    time.Now(),
+		expires:    o.expires,
+		encryption: o.encryption,
+		metadata:   o.metadata,
+		retention:  request.Retention,
+		legalHold:  request.LegalHold,
+	}
+	cp.metadata.nonce = request.NewEncryptedMetadataKeyNonce
+	cp.metadata.encryptedKey = request.NewEncryptedMetadataKey
+	if request.OverrideMetadata {
+		cp.metadata.data = request.NewEncryptedMetadata
+		cp.metadata.etag = request.NewEncryptedEtag
+		cp.metadata.checksumAlgorithm = request.NewChecksumAlgorithm
+		cp.metadata.checksumComposite = request.NewIsChecksumComposite
+		cp.metadata.checksum = request.NewEncryptedChecksum
+	}
+	if cp.retention == nil {
+		cp.retention = target.defaultRetention(time.Now())
+	}
+	// the copy is referencing the same pieces
+	for _, s := range o.segments {
+		copied := *s
+		copied.streamID = streamID
+		cp.segments = append(cp.segments, &copied)
+	}
+	if err := cp.setSegmentKeys(request.NewSegmentKeys); err != nil {
+		return nil, err
+	}
+	m.replace(target, cp)
+	return &pb.FinishCopyObjectResponse{
+		Object: m.objectInfo(cp),
+	}, nil
 }
 
-//
-//	var unReq pb.BatchRequest
-//	err = pb.Unmarshal(reqData, &unReq)
-//	if err != nil {
-//		return nil, errs.Wrap(err)
-//	}
-//
-//	unResp, err := endpoint.Batch(ctx, &unReq)
-//	if err != nil {
-//		return nil, errs.Wrap(err)
-//	}
-//
-//	unrespData, err := pb.Marshal(unResp)
-//	if err != nil {
-//		return nil, errs.Wrap(err)
-//	}
-//
-//	resp = new(pb.CompressedBatchResponse)
-//	if slices.Contains(req.Supported, pb.CompressedBatchRequest_ZSTD) {
-//		resp.Data = endpoint.zstdEncoder.EncodeAll(unrespData, nil)
-//		resp.Selected = pb.CompressedBatchRequest_ZSTD
-//	} else {
-//		resp.Data = unrespData
-//		resp.Selected = pb.CompressedBatchRequest_NONE
-//	}
-//}
-
 func (m *Metainfo) ProjectInfo(ctx context.Context, request *pb.ProjectInfoRequest) (*pb.ProjectInfoResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	salt := sha256.Sum256(m.identity.ID.Bytes())
+	return &pb.ProjectInfoResponse{
+		ProjectSalt:      salt[:],
+		ProjectPublicId:  salt[:16],
+		ProjectCreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, nil
 }
 
 func (m *Metainfo) RevokeAPIKey(ctx context.Context, request *pb.RevokeAPIKeyRequest) (*pb.RevokeAPIKeyResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	// API keys are not validated by the mock
+	return &pb.RevokeAPIKeyResponse{}, nil
 }
 
-func (m *Metainfo) BeginMoveObject(ctx context.Context, request *pb.BeginMoveObjectRequest) (*pb.BeginMoveObjectResponse, error) {
-	//TODO implement me
-	panic("implement me")
+func (m *Metainfo) AccountLicenses(ctx context.Context, request *pb.AccountLicensesRequest) (*pb.AccountLicensesResponse, error) {
+	return &pb.AccountLicensesResponse{}, nil
 }
 
-func (m *Metainfo) FinishMoveObject(ctx context.Context, request *pb.FinishMoveObjectRequest) (*pb.FinishMoveObjectResponse, error) {
-	//TODO implement me
-	panic("implement me")
+// object returns the committed (not expired) object.
+func (m *Metainfo) object(bucketName []byte, key []byte) (*object, error) {
+	b, err := m.bucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	o := m.committed(b, key)
+	if o == nil {
+		return nil, rpcstatus.Errorf(rpcstatus.NotFound, "object not found: %s/%x", bucketName, key)
+	}
+	return o, nil
 }
 
-func (m *Metainfo) BeginCopyObject(ctx context.Context, request *pb.BeginCopyObjectRequest) (*pb.BeginCopyObjectResponse, error) {
-	//TODO implement me
-	panic("implement me")
+func (m *Metainfo) committed(b *bucket, key []byte) *object {
+	o, found := b.objects[string(key)]
+	if !found || o.expired() {
+		return nil
+	}
+	return o
 }
 
-func (m *Metainfo) FinishCopyObject(ctx context.Context, request *pb.FinishCopyObjectRequest) (*pb.FinishCopyObjectResponse, error) {
-	//TODO implement me
-	panic("implement me")
+// stream returns the pending or committed object by stream ID.
+func (m *Metainfo) stream(streamID storj.StreamID) (*object, error) {
+	o, found := m.streams[string(streamID)]
+	if !found || o.expired() {
+		return nil, rpcstatus.Error(rpcstatus.NotFound, "object not found")
+	}
+	return o, nil
+}
+
+func (m *Metainfo) pendingObject(streamID storj.StreamID) (*object, error) {
+	o, err := m.stream(streamID)
+	if err != nil {
+		return nil, err
+	}
+	if o.status != pb.Object_UPLOADING {
+		return nil, rpcstatus.Error(rpcstatus.FailedPrecondition, "object is already committed")
+	}
+	return o, nil
+}
+
+func lessPosition(a, b *pb.SegmentPosition) bool {
+	if a.PartNumber != b.PartNumber {
+		return a.PartNumber < b.PartNumber
+	}
+	return a.Index < b.Index
 }
@@ -0,0 +1,353 @@
+package satellite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/zeebo/errs"
+	"golang.org/x/exp/slices"
+	"storj.io/common/pb"
+	"storj.io/common/rpc/rpcstatus"
+	"storj.io/common/storj"
+)
+
+func (m *Metainfo) Batch(ctx context.Context, req *pb.BatchRequest) (*pb.BatchResponse, error) {
+	resp := &pb.BatchResponse{}
+
+	// stream ID of the BeginObject (and segment ID of BeginSegment) can be used by the following requests of the same batch
+	var lastStreamID storj.StreamID
+	var lastSegmentID storj.SegmentID
+
+	for _, r := range req.Requests {
+		var item pb.BatchResponseItem
+		switch request := r.Request.(type) {
+		case *pb.BatchRequestItem_BucketCreate:
+			r, err := m.CreateBucket(ctx, request.BucketCreate)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketCreate{BucketCreate: r}
+		case *pb.BatchRequestItem_BucketGet:
+			r, err := m.GetBucket(ctx, request.BucketGet)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketGet{BucketGet: r}
+		case *pb.BatchRequestItem_BucketGetLocation:
+			r, err := m.GetBucketLocation(ctx, request.BucketGetLocation)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketGetLocation{BucketGetLocation: r}
+		case *pb.BatchRequestItem_BucketGetTagging:
+			r, err := m.GetBucketTagging(ctx, request.BucketGetTagging)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketGetTagging{BucketGetTagging: r}
+		case *pb.BatchRequestItem_BucketSetTagging:
+			r, err := m.SetBucketTagging(ctx, request.BucketSetTagging)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketSetTagging{BucketSetTagging: r}
+		case *pb.BatchRequestItem_BucketGetVersioning:
+			r, err := m.GetBucketVersioning(ctx, request.BucketGetVersioning)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketGetVersioning{BucketGetVersioning: r}
+		case *pb.BatchRequestItem_BucketSetVersioning:
+			r, err := m.SetBucketVersioning(ctx, request.BucketSetVersioning)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketSetVersioning{BucketSetVersioning: r}
+		case *pb.BatchRequestItem_BucketGetObjectLockConfiguration:
+			r, err := m.GetBucketObjectLockConfiguration(ctx, request.BucketGetObjectLockConfiguration)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketGetObjectLockConfiguration{BucketGetObjectLockConfiguration: r}
+		case *pb.BatchRequestItem_BucketSetObjectLockConfiguration:
+			r, err := m.SetBucketObjectLockConfiguration(ctx, request.BucketSetObjectLockConfiguration)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketSetObjectLockConfiguration{BucketSetObjectLockConfiguration: r}
+		case *pb.BatchRequestItem_BucketGetNotificationConfiguration:
+			r, err := m.GetBucketNotificationConfiguration(ctx, request.BucketGetNotificationConfiguration)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketGetNotificationConfiguration{BucketGetNotificationConfiguration: r}
+		case *pb.BatchRequestItem_BucketSetNotificationConfiguration:
+			r, err := m.SetBucketNotificationConfiguration(ctx, request.BucketSetNotificationConfiguration)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketSetNotificationConfiguration{BucketSetNotificationConfiguration: r}
+		case *pb.BatchRequestItem_BucketDelete:
+			r, err := m.DeleteBucket(ctx, request.BucketDelete)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketDelete{BucketDelete: r}
+		case *pb.BatchRequestItem_BucketList:
+			r, err := m.ListBuckets(ctx, request.BucketList)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_BucketList{BucketList: r}
+		case *pb.BatchRequestItem_ObjectBegin:
+			r, err := m.BeginObject(ctx, request.ObjectBegin)
+			if err != nil {
+				return nil, err
+			}
+			lastStreamID = r.StreamId
+			item.Response = &pb.BatchResponseItem_ObjectBegin{ObjectBegin: r}
+		case *pb.BatchRequestItem_ObjectCommit:
+			if request.ObjectCommit.StreamId.IsZero() {
+				request.ObjectCommit.StreamId = lastStreamID
+			}
+			r, err := m.CommitObject(ctx, request.ObjectCommit)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectCommit{ObjectCommit: r}
+		case *pb.BatchRequestItem_ObjectGet:
+			r, err := m.GetObject(ctx, request.ObjectGet)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectGet{ObjectGet: r}
+		case *pb.BatchRequestItem_ObjectList:
+			r, err := m.ListObjects(ctx, request.ObjectList)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectList{ObjectList: r}
+		case *pb.BatchRequestItem_ObjectBeginDelete:
+			r, err := m.BeginDeleteObject(ctx, request.ObjectBeginDelete)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectBeginDelete{ObjectBeginDelete: r}
+		case *pb.BatchRequestItem_ObjectFinishDelete:
+			r, err := m.FinishDeleteObject(ctx, request.ObjectFinishDelete)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectFinishDelete{ObjectFinishDelete: r}
+		case *pb.BatchRequestItem_ObjectsDelete:
+			r, err := m.DeleteObjects(ctx, request.ObjectsDelete)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectsDelete{ObjectsDelete: r}
+		case *pb.BatchRequestItem_ObjectGetIps:
+			r, err := m.GetObjectIPs(ctx, request.ObjectGetIps)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectGetIps{ObjectGetIps: r}
+		case *pb.BatchRequestItem_ObjectListPendingStreams:
+			r, err := m.ListPendingObjectStreams(ctx, request.ObjectListPendingStreams)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectListPendingStreams{ObjectListPendingStreams: r}
+		case *pb.BatchRequestItem_ObjectDownload:
+			r, err := m.DownloadObject(ctx, request.ObjectDownload)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectDownload{ObjectDownload: r}
+		case *pb.BatchRequestItem_ObjectGetPendingMetadata:
+			r, err := m.GetPendingObjectMetadata(ctx, request.ObjectGetPendingMetadata)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectGetPendingMetadata{ObjectGetPendingMetadata: r}
+		case *pb.BatchRequestItem_ObjectUpdateMetadata:
+			r, err := m.UpdateObjectMetadata(ctx, request.ObjectUpdateMetadata)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectUpdateMetadata{ObjectUpdateMetadata: r}
+		case *pb.BatchRequestItem_ObjectBeginMove:
+			r, err := m.BeginMoveObject(ctx, request.ObjectBeginMove)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectBeginMove{ObjectBeginMove: r}
+		case *pb.BatchRequestItem_ObjectFinishMove:
+			r, err := m.FinishMoveObject(ctx, request.ObjectFinishMove)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectFinishMove{ObjectFinishMove: r}
+		case *pb.BatchRequestItem_ObjectBeginCopy:
+			r, err := m.BeginCopyObject(ctx, request.ObjectBeginCopy)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectBeginCopy{ObjectBeginCopy: r}
+		case *pb.BatchRequestItem_ObjectFinishCopy:
+			r, err := m.FinishCopyObject(ctx, request.ObjectFinishCopy)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectFinishCopy{ObjectFinishCopy: r}
+		case *pb.BatchRequestItem_ObjectGetRetention:
+			r, err := m.GetObjectRetention(ctx, request.ObjectGetRetention)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectGetRetention{ObjectGetRetention: r}
+		case *pb.BatchRequestItem_ObjectSetRetention:
+			r, err := m.SetObjectRetention(ctx, request.ObjectSetRetention)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectSetRetention{ObjectSetRetention: r}
+		case *pb.BatchRequestItem_ObjectGetLegalHold:
+			r, err := m.GetObjectLegalHold(ctx, request.ObjectGetLegalHold)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectGetLegalHold{ObjectGetLegalHold: r}
+		case *pb.BatchRequestItem_ObjectSetLegalHold:
+			r, err := m.SetObjectLegalHold(ctx, request.ObjectSetLegalHold)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_ObjectSetLegalHold{ObjectSetLegalHold: r}
+		case *pb.BatchRequestItem_SegmentBegin:
+			if request.SegmentBegin.StreamId.IsZero() {
+				request.SegmentBegin.StreamId = lastStreamID
+			}
+			r, err := m.BeginSegment(ctx, request.SegmentBegin)
+			if err != nil {
+				return nil, err
+			}
+			lastSegmentID = r.SegmentId
+			item.Response = &pb.BatchResponseItem_SegmentBegin{SegmentBegin: r}
+		case *pb.BatchRequestItem_SegmentCommit:
+			if request.SegmentCommit.SegmentId.IsZero() {
+				request.SegmentCommit.SegmentId = lastSegmentID
+			}
+			r, err := m.CommitSegment(ctx, request.SegmentCommit)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_SegmentCommit{SegmentCommit: r}
+		case *pb.BatchRequestItem_SegmentMakeInline:
+			if request.SegmentMakeInline.StreamId.IsZero() {
+				request.SegmentMakeInline.StreamId = lastStreamID
+			}
+			r, err := m.MakeInlineSegment(ctx, request.SegmentMakeInline)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_SegmentMakeInline{SegmentMakeInline: r}
+		case *pb.BatchRequestItem_SegmentBeginDelete:
+			r, err := m.BeginDeleteSegment(ctx, request.SegmentBeginDelete)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_SegmentBeginDelete{SegmentBeginDelete: r}
+		case *pb.BatchRequestItem_SegmentFinishDelete:
+			r, err := m.FinishDeleteSegment(ctx, request.SegmentFinishDelete)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_SegmentFinishDelete{SegmentFinishDelete: r}
+		case *pb.BatchRequestItem_SegmentList:
+			r, err := m.ListSegments(ctx, request.SegmentList)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_SegmentList{SegmentList: r}
+		case *pb.BatchRequestItem_SegmentDownload:
+			r, err := m.DownloadSegment(ctx, request.SegmentDownload)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_SegmentDownload{SegmentDownload: r}
+		case *pb.BatchRequestItem_SegmentBeginRetryPieces:
+			r, err := m.RetryBeginSegmentPieces(ctx, request.SegmentBeginRetryPieces)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_SegmentBeginRetryPieces{SegmentBeginRetryPieces: r}
+		case *pb.BatchRequestItem_PartDelete:
+			r, err := m.DeletePart(ctx, request.PartDelete)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_PartDelete{PartDelete: r}
+		case *pb.BatchRequestItem_RevokeApiKey:
+			r, err := m.RevokeAPIKey(ctx, request.RevokeApiKey)
+			if err != nil {
+				return nil, err
+			}
+			item.Response = &pb.BatchResponseItem_RevokeApiKey{RevokeApiKey: r}
+		default:
+			return nil, rpcstatus.Error(rpcstatus.Unimplemented, fmt.Sprintf("handler for batch type is not implemented: %T", request))
+		}
+		resp.Responses = append(resp.Responses, &item)
+	}
+	return resp, nil
+}
+func (m *Metainfo) CompressedBatch(ctx context.Context, request *pb.CompressedBatchRequest) (*pb.CompressedBatchResponse, error) {
+	var err error
+	zr, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+
+	var reqData []byte
+	switch request.Selected {
+	case pb.CompressedBatchRequest_NONE:
+		reqData = request.Data
+	case pb.CompressedBatchRequest_ZSTD:
+		reqData, err = zr.DecodeAll(request.Data, nil)
+	default:
+		err = errs.New("unsupported compression")
+	}
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	var unReq pb.BatchRequest
+	err = pb.Unmarshal(reqData, &unReq)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+
+	unResp, err := m.Batch(ctx, &unReq)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+
+	unrespData, err := pb.Marshal(unResp)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+
+	resp := new(pb.CompressedBatchResponse)
+	if slices.Contains(request.Supported, pb.CompressedBatchRequest_ZSTD) {
+		resp.Data = zw.EncodeAll(unrespData, nil)
+		resp.Selected = pb.CompressedBatchRequest_ZSTD
+	} else {
+		resp.Data = unrespData
+		resp.Selected = pb.CompressedBatchRequest_NONE
+	}
+	return resp, nil
+
+}
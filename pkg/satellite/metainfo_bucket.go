@@ -0,0 +1,285 @@
+package satellite
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"storj.io/common/pb"
+	"storj.io/common/rpc/rpcstatus"
+)
+
+// bucket versioning states, as they are reported to the uplink.
+const (
+	unversioned         int32 = 1
+	versioningEnabled   int32 = 2
+	versioningSuspended int32 = 3
+)
+
+func (m *Metainfo) bucket(name []byte) (*bucket, error) {
+	if len(name) == 0 {
+		return nil, rpcstatus.Error(rpcstatus.BucketNameMissing, "bucket name is missing")
+	}
+	b, found := m.buckets[string(name)]
+	if !found {
+		return nil, rpcstatus.Errorf(rpcstatus.NotFound, "bucket not found: %s", name)
+	}
+	return b, nil
+}
+
+func (b *bucket) lockEnabled() bool {
+	return b.objectLock != nil && b.objectLock.Enabled
+}
+
+// defaultRetention returns the retention of new objects, based on the object lock configuration of the bucket.
+func (b *bucket) defaultRetention(now time.Time) *pb.Retention {
+	if !b.lockEnabled() || b.objectLock.DefaultRetention == nil {
+		return nil
+	}
+	d := b.objectLock.DefaultRetention
+	until := now.AddDate(int(d.GetYears()), 0, int(d.GetDays()))
+	return &pb.Retention{
+		Mode:        d.Mode,
+		RetainUntil: until,
+	}
+}
+
+func (b *bucket) info() *pb.Bucket {
+	return &pb.Bucket{
+		Name:      b.name,
+		CreatedAt: b.created,
+	}
+}
+
+func (m *Metainfo) CreateBucket(ctx context.Context, request *pb.CreateBucketRequest) (*pb.CreateBucketResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(request.Name) == 0 {
+		return nil, rpcstatus.Error(rpcstatus.BucketNameMissing, "bucket name is missing")
+	}
+	if _, found := m.buckets[string(request.Name)]; found {
+		return nil, rpcstatus.Error(rpcstatus.AlreadyExists, "bucket already exists")
+	}
+	b := &bucket{
+		name:       request.Name,
+		created:    time.Now(),
+		placement:  request.Placement,
+		versioning: unversioned,
+		objects:    map[string]*object{},
+	}
+	if request.ObjectLockEnabled {
+		b.versioning = versioningEnabled
+		b.objectLock = &pb.ObjectLockConfiguration{
+			Enabled: true,
+		}
+	}
+	m.buckets[string(request.Name)] = b
+	return &pb.CreateBucketResponse{
+		Bucket: b.info(),
+	}, nil
+}
+
+func (m *Metainfo) GetBucket(ctx context.Context, request *pb.GetBucketRequest) (*pb.GetBucketResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetBucketResponse{
+		Bucket: b.info(),
+	}, nil
+}
+
+func (m *Metainfo) GetBucketLocation(ctx context.Context, request *pb.GetBucketLocationRequest) (*pb.GetBucketLocationResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	location := b.placement
+	if len(location) == 0 {
+		location = []byte("global")
+	}
+	return &pb.GetBucketLocationResponse{
+		Location: location,
+	}, nil
+}
+
+func (m *Metainfo) DeleteBucket(ctx context.Context, request *pb.DeleteBucketRequest) (*pb.DeleteBucketResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.objects) > 0 && !request.DeleteAll {
+		return nil, rpcstatus.Error(rpcstatus.FailedPrecondition, "bucket is not empty")
+	}
+	for _, o := range b.objects {
+		if err := o.protected(request.BypassGovernanceRetention); err != nil {
+			return nil, err
+		}
+	}
+	deleted := int64(len(b.objects))
+	for _, o := range b.objects {
+		m.delete(b, o)
+	}
+	delete(m.buckets, string(request.Name))
+	return &pb.DeleteBucketResponse{
+		Bucket:              b.info(),
+		DeletedObjectsCount: deleted,
+	}, nil
+}
+
+func (m *Metainfo) ListBuckets(ctx context.Context, request *pb.ListBucketsRequest) (*pb.ListBucketsResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name := range m.buckets {
+		if len(request.Cursor) > 0 && name < string(request.Cursor) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp := &pb.ListBucketsResponse{}
+	limit := listLimit(request.Limit)
+	for _, name := range names {
+		if len(resp.Items) >= limit {
+			resp.More = true
+			break
+		}
+		resp.Items = append(resp.Items, &pb.BucketListItem{
+			Name:      []byte(name),
+			CreatedAt: m.buckets[name].created,
+		})
+	}
+	return resp, nil
+}
+
+func (m *Metainfo) GetBucketVersioning(ctx context.Context, request *pb.GetBucketVersioningRequest) (*pb.GetBucketVersioningResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetBucketVersioningResponse{
+		Versioning: b.versioning,
+	}, nil
+}
+
+// SetBucketVersioning only records the state, objects are always stored as one (latest) version.
+func (m *Metainfo) SetBucketVersioning(ctx context.Context, request *pb.SetBucketVersioningRequest) (*pb.SetBucketVersioningResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !request.Versioning && b.lockEnabled() {
+		return nil, rpcstatus.Error(rpcstatus.ObjectLockInvalidBucketState, "versioning can't be suspended for buckets with object lock")
+	}
+	switch {
+	case request.Versioning:
+		b.versioning = versioningEnabled
+	case b.versioning == versioningEnabled:
+		b.versioning = versioningSuspended
+	}
+	return &pb.SetBucketVersioningResponse{}, nil
+}
+
+func (m *Metainfo) GetBucketObjectLockConfiguration(ctx context.Context, request *pb.GetBucketObjectLockConfigurationRequest) (*pb.GetBucketObjectLockConfigurationResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !b.lockEnabled() {
+		return nil, rpcstatus.Error(rpcstatus.ObjectLockBucketRetentionConfigurationMissing, "object lock is not enabled for the bucket")
+	}
+	return &pb.GetBucketObjectLockConfigurationResponse{
+		Configuration: b.objectLock,
+	}, nil
+}
+
+func (m *Metainfo) SetBucketObjectLockConfiguration(ctx context.Context, request *pb.SetBucketObjectLockConfigurationRequest) (*pb.SetBucketObjectLockConfigurationResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	if request.Configuration == nil || !request.Configuration.Enabled {
+		return nil, rpcstatus.Error(rpcstatus.ObjectLockInvalidBucketRetentionConfiguration, "object lock can't be disabled")
+	}
+	if b.versioning != versioningEnabled {
+		return nil, rpcstatus.Error(rpcstatus.ObjectLockInvalidBucketState, "object lock requires versioning")
+	}
+	b.objectLock = request.Configuration
+	return &pb.SetBucketObjectLockConfigurationResponse{}, nil
+}
+
+func (m *Metainfo) GetBucketTagging(ctx context.Context, request *pb.GetBucketTaggingRequest) (*pb.GetBucketTaggingResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.tags) == 0 {
+		return nil, rpcstatus.Error(rpcstatus.TagsNotFound, "bucket has no tags")
+	}
+	return &pb.GetBucketTaggingResponse{
+		Tags: b.tags,
+	}, nil
+}
+
+func (m *Metainfo) SetBucketTagging(ctx context.Context, request *pb.SetBucketTaggingRequest) (*pb.SetBucketTaggingResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	for _, tag := range request.Tags {
+		if len(tag.Key) == 0 {
+			return nil, rpcstatus.Error(rpcstatus.TagKeyInvalid, "tag key is empty")
+		}
+		if keys[string(tag.Key)] {
+			return nil, rpcstatus.Errorf(rpcstatus.TagKeyDuplicate, "duplicated tag key: %s", tag.Key)
+		}
+		keys[string(tag.Key)] = true
+	}
+	b.tags = request.Tags
+	return &pb.SetBucketTaggingResponse{}, nil
+}
+
+func (m *Metainfo) GetBucketNotificationConfiguration(ctx context.Context, request *pb.GetBucketNotificationConfigurationRequest) (*pb.GetBucketNotificationConfigurationResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetBucketNotificationConfigurationResponse{
+		Configuration: b.notification,
+	}, nil
+}
+
+// SetBucketNotificationConfiguration stores the configuration, but the mock doesn't send any notification.
+func (m *Metainfo) SetBucketNotificationConfiguration(ctx context.Context, request *pb.SetBucketNotificationConfigurationRequest) (*pb.SetBucketNotificationConfigurationResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := m.bucket(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	b.notification = request.Configuration
+	return &pb.SetBucketNotificationConfigurationResponse{}, nil
+}
@@ -0,0 +1,107 @@
+package satellite_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/elek/stbb/pkg/downloadng/stub"
+	"github.com/elek/stbb/pkg/satellite"
+	"github.com/stretchr/testify/require"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+	"storj.io/common/testrand"
+	"storj.io/uplink"
+)
+
+func TestMetainfo(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	network, err := stub.NewNetwork(20)
+	require.NoError(t, err)
+
+	var urls []storj.NodeURL
+	for _, node := range network.Nodes {
+		urls = append(urls, storj.NodeURL{ID: node.Identity.ID, Address: node.Address})
+	}
+	rs, err := satellite.ParseRS("4/6/8/10")
+	require.NoError(t, err)
+	require.NoError(t, network.SetMetainfo(satellite.NewMetainfo(network.Satellite, satellite.NewNodes(urls...), rs)))
+
+	access, err := network.Access()
+	require.NoError(t, err)
+	serialized, err := access.Serialize()
+	require.NoError(t, err)
+	parsed, err := uplink.ParseAccess(serialized)
+	require.NoError(t, err)
+
+	project, err := network.UplinkConfig().OpenProject(ctx, parsed)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, project.Close()) }()
+
+	_, err = project.EnsureBucket(ctx, "bucket1")
+	require.NoError(t, err)
+
+	upload := func(key string, data []byte) {
+		u, err := project.UploadObject(ctx, "bucket1", key, nil)
+		require.NoError(t, err)
+		_, err = u.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, u.Commit())
+	}
+	download := func(key string) []byte {
+		d, err := project.DownloadObject(ctx, "bucket1", key, nil)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, d.Close()) }()
+		data, err := io.ReadAll(d)
+		require.NoError(t, err)
+		return data
+	}
+
+	remote := testrand.BytesInt(1024*1024 + 1234)
+	inline := testrand.BytesInt(100)
+	upload("dir/remote", remote)
+	upload("inline", inline)
+
+	require.Equal(t, remote, download("dir/remote"))
+	require.Equal(t, inline, download("inline"))
+
+	t.Run("list", func(t *testing.T) {
+		var keys []string
+		it := project.ListObjects(ctx, "bucket1", nil)
+		for it.Next() {
+			keys = append(keys, it.Item().Key)
+		}
+		require.NoError(t, it.Err())
+		require.ElementsMatch(t, []string{"dir/", "inline"}, keys)
+
+		keys = nil
+		it = project.ListObjects(ctx, "bucket1", &uplink.ListObjectsOptions{Recursive: true, System: true})
+		for it.Next() {
+			keys = append(keys, it.Item().Key)
+			if it.Item().Key == "dir/remote" {
+				require.Equal(t, int64(len(remote)), it.Item().System.ContentLength)
+			}
+		}
+		require.NoError(t, it.Err())
+		require.ElementsMatch(t, []string{"dir/remote", "inline"}, keys)
+	})
+
+	t.Run("copy and move", func(t *testing.T) {
+		_, err := project.CopyObject(ctx, "bucket1", "dir/remote", "bucket1", "copied", nil)
+		require.NoError(t, err)
+		require.Equal(t, remote, download("copied"))
+
+		require.NoError(t, project.MoveObject(ctx, "bucket1", "copied", "bucket1", "moved", nil))
+		require.Equal(t, remote, download("moved"))
+
+		_, err = project.StatObject(ctx, "bucket1", "copied")
+		require.ErrorIs(t, err, uplink.ErrObjectNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		_, err := project.DeleteObject(ctx, "bucket1", "inline")
+		require.NoError(t, err)
+		_, err = project.StatObject(ctx, "bucket1", "inline")
+		require.ErrorIs(t, err, uplink.ErrObjectNotFound)
+	})
+}
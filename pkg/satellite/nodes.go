@@ -0,0 +1,78 @@
+package satellite
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/zeebo/errs/v2"
+	"storj.io/common/storj"
+)
+
+// Nodes are the storage nodes known by the mock satellite: the statically configured ones and the ones which checked in.
+type Nodes struct {
+	mu    sync.Mutex
+	nodes map[storj.NodeID]storj.NodeURL
+}
+
+// NewNodes creates the node registry with the given static nodes.
+func NewNodes(static ...storj.NodeURL) *Nodes {
+	n := &Nodes{
+		nodes: map[storj.NodeID]storj.NodeURL{},
+	}
+	for _, url := range static {
+		n.Add(url)
+	}
+	return n
+}
+
+// ParseNodes parses node URLs (id@address).
+func ParseNodes(urls []string) ([]storj.NodeURL, error) {
+	var res []storj.NodeURL
+	for _, u := range urls {
+		url, err := storj.ParseNodeURL(u)
+		if err != nil {
+			return nil, errs.Wrap(err)
+		}
+		if url.ID.IsZero() || url.Address == "" {
+			return nil, errs.Errorf("node url should be in the form id@address: %s", u)
+		}
+		res = append(res, url)
+	}
+	return res, nil
+}
+
+// Add registers (or updates the address of) a node.
+func (n *Nodes) Add(url storj.NodeURL) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.nodes[url.ID] = url
+}
+
+// All returns all the known nodes, ordered by ID.
+func (n *Nodes) All() []storj.NodeURL {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var res []storj.NodeURL
+	for _, url := range n.nodes {
+		res = append(res, url)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID.Less(res[j].ID)
+	})
+	return res
+}
+
+// Select returns count nodes in random order. When there are not enough nodes, the same node is selected multiple times.
+func (n *Nodes) Select(count int) ([]storj.NodeURL, error) {
+	all := n.All()
+	if len(all) == 0 {
+		return nil, errs.Errorf("no storage nodes are available (nodes should check in, or be configured with --nodes)")
+	}
+	var res []storj.NodeURL
+	order := rand.Perm(len(all))
+	for i := 0; i < count; i++ {
+		res = append(res, all[order[i%len(order)]])
+	}
+	return res, nil
+}
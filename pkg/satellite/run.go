@@ -6,6 +6,10 @@ import (
 	_ "embed"
 	"fmt"
 	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,6 +18,8 @@ import (
 	"storj.io/common/identity"
 	"storj.io/common/pb"
 	"storj.io/common/peertls/tlsopts"
+	"storj.io/common/rpc"
+	"storj.io/common/rpc/rpcstatus"
 	"storj.io/common/storj"
 	"storj.io/drpc/drpcmigrate"
 	"storj.io/drpc/drpcmux"
@@ -22,9 +28,19 @@ import (
 
 type NodeEndpoint struct {
 	pb.DRPCNodeUnimplementedServer
+	satellite storj.NodeID
+	scenario  *Scenarios
+	nodes     *Nodes
+	history   *History
+
+	// pingBack is used to ping the nodes on check-in (nil: nodes are not pinged).
+	pingBack *rpc.Dialer
 }
 
-func (s *NodeEndpoint) GetTime(context.Context, *pb.GetTimeRequest) (*pb.GetTimeResponse, error) {
+func (s *NodeEndpoint) GetTime(ctx context.Context, req *pb.GetTimeRequest) (*pb.GetTimeResponse, error) {
+	if _, err := s.scenario.call(ctx, "GetTime"); err != nil {
+		return nil, err
+	}
 	return &pb.GetTimeResponse{
 		Timestamp: time.Now(),
 	}, nil
@@ -32,7 +48,7 @@ func (s *NodeEndpoint) GetTime(context.Context, *pb.GetTimeRequest) (*pb.GetTime
 
 func (s *NodeEndpoint) CheckIn(ctx context.Context, req *pb.CheckInRequest) (*pb.CheckInResponse, error) {
 	var printTags []string
-	for _, tag := range req.SignedTags.Tags {
+	for _, tag := range req.SignedTags.GetTags() {
 		var tags pb.NodeTagSet
 		err := pb.Unmarshal(tag.GetSerializedTag(), &tags)
 		if err != nil {
@@ -43,41 +59,166 @@ func (s *NodeEndpoint) CheckIn(ctx context.Context, req *pb.CheckInRequest) (*pb
 		}
 
 	}
-	fmt.Println("Node checked in", req.Address, req.Capacity.FreeDisk, strings.Join(printTags, ","), "features:", req.Features)
-	return &pb.CheckInResponse{
-		PingNodeSuccess: true,
-	}, nil
+	fmt.Println("Node checked in", req.Address, req.Capacity.GetFreeDisk(), strings.Join(printTags, ","), "features:", req.Features)
+	peer, err := identity.PeerIdentityFromContext(ctx)
+	if err != nil {
+		return nil, rpcstatus.Error(rpcstatus.Unauthenticated, err.Error())
+	}
+	node := storj.NodeURL{
+		ID:      peer.ID,
+		Address: req.Address,
+	}
+	s.nodes.Add(node)
+	s.record(node.ID, Event{CheckIn: checkInEvent(req)})
+
+	scenario, err := s.scenario.call(ctx, "CheckIn")
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.CheckInResponse{
+		PingNodeSuccess:     scenario.CheckIn.PingSuccess,
+		PingErrorMessage:    scenario.CheckIn.PingError,
+		PingNodeSuccessQuic: scenario.CheckIn.PingSuccessQuic,
+		NodeTagSuccess:      scenario.CheckIn.NodeTagSuccess,
+		NodeTagErrorMessage: scenario.CheckIn.NodeTagErrorMessage,
+	}
+	if s.pingBack != nil {
+		if err := s.ping(ctx, node); err != nil {
+			resp.PingNodeSuccess = false
+			resp.PingErrorMessage = err.Error()
+		}
+	}
+	return resp, nil
+}
+
+func (s *NodeEndpoint) PingMe(ctx context.Context, req *pb.PingMeRequest) (*pb.PingMeResponse, error) {
+	peer, err := identity.PeerIdentityFromContext(ctx)
+	if err != nil {
+		return nil, rpcstatus.Error(rpcstatus.Unauthenticated, err.Error())
+	}
+	node := storj.NodeURL{
+		ID:      peer.ID,
+		Address: req.Address,
+	}
+	if _, err := s.scenario.call(ctx, "PingMe"); err != nil {
+		return nil, err
+	}
+	if s.pingBack == nil {
+		s.record(node.ID, Event{Ping: &PingEvent{Source: "pingme", Address: req.Address, Success: true}})
+		return &pb.PingMeResponse{}, nil
+	}
+	if err := s.ping(ctx, node); err != nil {
+		return nil, rpcstatus.Error(rpcstatus.NotFound, err.Error())
+	}
+	return &pb.PingMeResponse{}, nil
+}
+
+// ping calls the contact endpoint of the node, and records the result.
+func (s *NodeEndpoint) ping(ctx context.Context, node storj.NodeURL) (err error) {
+	start := time.Now()
+	defer func() {
+		event := &PingEvent{
+			Source:   "satellite",
+			Address:  node.Address,
+			Success:  err == nil,
+			Duration: time.Since(start),
+		}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		s.record(node.ID, Event{Ping: event})
+	}()
+	conn, err := s.pingBack.DialNodeURL(ctx, node)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_, err = pb.NewDRPCContactClient(conn).PingNode(ctx, &pb.ContactPingRequest{})
+	return errs.Wrap(err)
+}
+
+func (s *NodeEndpoint) record(id storj.NodeID, event Event) {
+	event.Satellite = s.satellite.String()
+	if err := s.history.Record(id, event); err != nil {
+		fmt.Println("History is not saved:", err)
+	}
 }
 
 type NodeStatEndpoint struct {
+	scenario *Scenarios
 }
 
 func (n *NodeStatEndpoint) DailyStorageUsage(ctx context.Context, request *pb.DailyStorageUsageRequest) (*pb.DailyStorageUsageResponse, error) {
-	return &pb.DailyStorageUsageResponse{}, nil
+	scenario, err := n.scenario.call(ctx, "DailyStorageUsage")
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.DailyStorageUsageResponse{}
+	for _, u := range scenario.DailyStorageUsage {
+		if u.Timestamp.Before(request.From) || (!request.To.IsZero() && u.Timestamp.After(request.To)) {
+			continue
+		}
+		resp.DailyStorageUsage = append(resp.DailyStorageUsage, &pb.DailyStorageUsageResponse_StorageUsage{
+			AtRestTotal:     u.AtRestTotal,
+			Timestamp:       u.Timestamp,
+			IntervalEndTime: u.Timestamp,
+		})
+	}
+	return resp, nil
 }
 
 func (n *NodeStatEndpoint) PricingModel(ctx context.Context, request *pb.PricingModelRequest) (*pb.PricingModelResponse, error) {
+	scenario, err := n.scenario.call(ctx, "PricingModel")
+	if err != nil {
+		return nil, err
+	}
 	return &pb.PricingModelResponse{
-		EgressBandwidthPrice: 1,
+		EgressBandwidthPrice: scenario.Pricing.EgressBandwidth,
+		RepairBandwidthPrice: scenario.Pricing.RepairBandwidth,
+		AuditBandwidthPrice:  scenario.Pricing.AuditBandwidth,
+		DiskSpacePrice:       scenario.Pricing.DiskSpace,
 	}, nil
 }
 
-func (n *NodeStatEndpoint) GetStats(context.Context, *pb.GetStatsRequest) (*pb.GetStatsResponse, error) {
+func (n *NodeStatEndpoint) GetStats(ctx context.Context, request *pb.GetStatsRequest) (*pb.GetStatsResponse, error) {
+	scenario, err := n.scenario.call(ctx, "GetStats")
+	if err != nil {
+		return nil, err
+	}
+	stats := scenario.Stats
 	return &pb.GetStatsResponse{
-		UptimeCheck: &pb.ReputationStats{
-			ReputationScore: 1,
-		},
-		AuditCheck: &pb.ReputationStats{
-			ReputationScore: 1,
-		},
+		UptimeCheck:        stats.Uptime.response(),
+		AuditCheck:         stats.Audit.response(),
+		OnlineScore:        stats.OnlineScore,
+		JoinedAt:           stats.JoinedAt,
+		VettedAt:           stats.VettedAt,
+		Disqualified:       stats.Disqualified,
+		Suspended:          stats.Suspended,
+		OfflineSuspended:   stats.OfflineSuspended,
+		OfflineUnderReview: stats.OfflineUnderReview,
 	}, nil
 }
 
 type HeldAmountEndpoint struct {
-	nodeID storj.NodeID
+	scenario *Scenarios
 }
 
 func (h HeldAmountEndpoint) GetPayStub(ctx context.Context, request *pb.GetHeldAmountRequest) (*pb.GetHeldAmountResponse, error) {
+	peer, err := identity.PeerIdentityFromContext(ctx)
+	if err != nil {
+		return nil, rpcstatus.Error(rpcstatus.Unauthenticated, err.Error())
+	}
+	scenario, err := h.scenario.call(ctx, "GetPayStub")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range scenario.Paystubs {
+		if samePeriod(p.Period, request.Period) {
+			stub := p.response()
+			stub.NodeId = peer.ID
+			return stub, nil
+		}
+	}
 	return &pb.GetHeldAmountResponse{
 		Period:    request.Period,
 		CreatedAt: time.Now(),
@@ -85,111 +226,304 @@ func (h HeldAmountEndpoint) GetPayStub(ctx context.Context, request *pb.GetHeldA
 }
 
 func (h HeldAmountEndpoint) GetAllPaystubs(ctx context.Context, request *pb.GetAllPaystubsRequest) (*pb.GetAllPaystubsResponse, error) {
-	return &pb.GetAllPaystubsResponse{
+	peer, err := identity.PeerIdentityFromContext(ctx)
+	if err != nil {
+		return nil, rpcstatus.Error(rpcstatus.Unauthenticated, err.Error())
+	}
+	scenario, err := h.scenario.call(ctx, "GetAllPaystubs")
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.GetAllPaystubsResponse{
 		Paystub: []*pb.GetHeldAmountResponse{},
-	}, nil
+	}
+	for _, p := range scenario.Paystubs {
+		stub := p.response()
+		stub.NodeId = peer.ID
+		resp.Paystub = append(resp.Paystub, stub)
+	}
+	return resp, nil
 }
 
 func (h HeldAmountEndpoint) GetPayment(ctx context.Context, request *pb.GetPaymentRequest) (*pb.GetPaymentResponse, error) {
+	peer, err := identity.PeerIdentityFromContext(ctx)
+	if err != nil {
+		return nil, rpcstatus.Error(rpcstatus.Unauthenticated, err.Error())
+	}
+	scenario, err := h.scenario.call(ctx, "GetPayment")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range scenario.Payments {
+		if samePeriod(p.Period, request.Period) {
+			payment := p.response()
+			payment.NodeId = peer.ID
+			return payment, nil
+		}
+	}
 	n := time.Now()
 	return &pb.GetPaymentResponse{
-		NodeId:    h.nodeID,
+		NodeId:    peer.ID,
 		CreatedAt: time.Date(n.Year(), n.Month(), n.Day(), 0, 0, 0, 0, time.Local),
 		Period:    request.Period,
-		Amount:    44444,
+		Amount:    scenario.PaymentAmount,
 	}, nil
 }
 
 func (h HeldAmountEndpoint) GetAllPayments(ctx context.Context, request *pb.GetAllPaymentsRequest) (*pb.GetAllPaymentsResponse, error) {
-	n := time.Now()
-	return &pb.GetAllPaymentsResponse{
-		Payment: []*pb.GetPaymentResponse{
-			{
-				NodeId:    h.nodeID,
-				CreatedAt: time.Date(n.Year(), n.Month(), n.Day(), 0, 0, 0, 0, time.Local),
-				Period:    time.Date(n.Year(), n.Month()-1, n.Day(), 0, 0, 0, 0, time.Local),
-				Amount:    100000000000000,
-				Receipt:   "zksync-era:0x85ab6c8f8240a005ef90c1b477e6e61ccf1e6d5463672e0d1c166075ded92c0b",
-				Id:        1234,
-			},
-			{
-				NodeId:    h.nodeID,
-				CreatedAt: time.Date(n.Year(), n.Month()-1, n.Day(), 0, 0, 0, 0, time.Local),
-				Period:    time.Date(n.Year(), n.Month()-2, n.Day(), 0, 0, 0, 0, time.Local),
-				Amount:    100000000000000,
-				Receipt:   "zkwithdraw:0x85ab6c8f8240a005ef90c1b477e6e61ccf1e6d5463672e0d1c166075ded92c0b",
-				Id:        1233,
-			},
-		},
-	}, nil
+	peer, err := identity.PeerIdentityFromContext(ctx)
+	if err != nil {
+		return nil, rpcstatus.Error(rpcstatus.Unauthenticated, err.Error())
+	}
+	scenario, err := h.scenario.call(ctx, "GetAllPayments")
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.GetAllPaymentsResponse{}
+	for _, p := range scenario.Payments {
+		payment := p.response()
+		payment.NodeId = peer.ID
+		resp.Payment = append(resp.Payment, payment)
+	}
+	return resp, nil
 }
 
 type OrdersEndpoint struct {
+	satellite storj.NodeID
+	scenario  *Scenarios
+	history   *History
 }
 
-func (o *OrdersEndpoint) SettlementWithWindow(stream pb.DRPCOrders_SettlementWithWindowStream) error {
+func (o *OrdersEndpoint) SettlementWithWindow(stream pb.DRPCOrders_SettlementWithWindowStream) (err error) {
+	peer, err := identity.PeerIdentityFromContext(stream.Context())
+	if err != nil {
+		return rpcstatus.Error(rpcstatus.Unauthenticated, err.Error())
+	}
+	event := &SettlementEvent{
+		Amount: map[string]int64{},
+	}
+	defer func() {
+		if err != nil {
+			event.Error = err.Error()
+		}
+		if err := o.history.Record(peer.ID, Event{Satellite: o.satellite.String(), Settlement: event}); err != nil {
+			fmt.Println("History is not saved:", err)
+		}
+	}()
+
 	storagenodeSettled := map[int32]int64{}
 	for {
 		s, err := stream.Recv()
 		if err != nil {
-			return stream.SendAndClose(&pb.SettlementWithWindowResponse{
-				Status:        pb.SettlementWithWindowResponse_ACCEPTED,
-				ActionSettled: storagenodeSettled,
-			})
+			break
 		}
 		storagenodeSettled[int32(s.Limit.Action)] += s.Order.Amount
+		event.Amount[s.Limit.Action.String()] += s.Order.Amount
+		event.Orders++
 	}
-
+	scenario, err := o.scenario.call(stream.Context(), "SettlementWithWindow")
+	if err != nil {
+		return err
+	}
+	status, err := scenario.settlementStatus()
+	if err != nil {
+		return err
+	}
+	event.Status = status.String()
+	if status != pb.SettlementWithWindowResponse_ACCEPTED {
+		storagenodeSettled = nil
+	}
+	return stream.SendAndClose(&pb.SettlementWithWindowResponse{
+		Status:        status,
+		ActionSettled: storagenodeSettled,
+	})
 }
 
 type Run struct {
+	Address  string   `default:"0.0.0.0:5656" help:"listen address of the (first) satellite"`
+	Identity string   `help:"directory with identity.cert/identity.key (<dir>/<n> for the n-th satellite with --count > 1, starting from 0; generated if missing). Default is the embedded identity for the first satellite, and generated ones for the others"`
+	Count    int      `default:"1" help:"number of satellites to start, on consecutive ports"`
+	Scenario string   `help:"YAML/JSON file with the responses of the node-facing endpoints (reloaded on SIGHUP)"`
+	Nodes    []string `help:"storage nodes (id@address) to use for uploads, in addition to the checked in ones"`
+	RS       string   `default:"29/35/65/110" help:"redundancy scheme of the new segments (k/repair/success/total)"`
+	History  string   `help:"JSON lines file to persist the history of node check-ins, settlements and pings"`
+	HTTP     string   `help:"address of the HTTP server exposing the node history (e.g. localhost:5657)"`
+	PingBack bool     `help:"ping the nodes on check-in and PingMe, as the real satellite does"`
 }
 
 func (r Run) Run() error {
 	ctx := context.Background()
-	ident, err := identity.FullIdentityFromPEM(util.Certificate, util.Key)
-	fmt.Println("Starting ", ident.ID.String()+"@localhost:5656")
+	addresses, err := r.addresses()
 	if err != nil {
-		return errs.Wrap(err)
+		return err
+	}
+
+	scenario, err := NewScenarios(r.Scenario)
+	if err != nil {
+		return err
+	}
+	scenario.ReloadOnSignal(ctx)
+
+	static, err := ParseNodes(r.Nodes)
+	if err != nil {
+		return err
+	}
+	rs, err := ParseRS(r.RS)
+	if err != nil {
+		return err
+	}
+
+	history, err := NewHistory(r.History)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = history.Close() }()
+	if r.HTTP != "" {
+		httpListener, err := net.Listen("tcp", r.HTTP)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		fmt.Println("Node history is available at http://" + httpListener.Addr().String() + "/history")
+		go func() {
+			fmt.Println("HTTP server is stopped:", http.Serve(httpListener, history.Handler()))
+		}()
+	}
+
+	failed := make(chan error, r.Count)
+	for i, address := range addresses {
+		ident, err := r.identity(ctx, i)
+		if err != nil {
+			return err
+		}
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		fmt.Println("Starting", ident.ID.String()+"@"+advertised(listener.Addr()))
+
+		sat := &satellitePeer{
+			identity: ident,
+			scenario: scenario,
+			nodes:    NewNodes(static...),
+			history:  history,
+			rs:       rs,
+			pingBack: r.PingBack,
+		}
+		go func() {
+			failed <- sat.serve(ctx, listener)
+		}()
 	}
+	return <-failed
+}
 
+// addresses returns the listen addresses of the satellites (consecutive ports, or random ports with port 0).
+func (r Run) addresses() ([]string, error) {
+	if r.Count < 1 {
+		return nil, errs.Errorf("at least one satellite should be started")
+	}
+	host, portStr, err := net.SplitHostPort(r.Address)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, errs.Errorf("invalid port in address %s", r.Address)
+	}
+	var res []string
+	for i := 0; i < r.Count; i++ {
+		if port == 0 {
+			res = append(res, r.Address)
+			continue
+		}
+		res = append(res, net.JoinHostPort(host, strconv.Itoa(port+i)))
+	}
+	return res, nil
+}
+
+// identity loads (or generates) the identity of the index-th satellite. A single satellite uses <dir> (as the --keys
+// directory of the other commands), multiple satellites use <dir>/<index>.
+func (r Run) identity(ctx context.Context, index int) (*identity.FullIdentity, error) {
+	if r.Identity == "" {
+		if index == 0 {
+			ident, err := identity.FullIdentityFromPEM(util.Certificate, util.Key)
+			return ident, errs.Wrap(err)
+		}
+		ident, err := identity.NewFullIdentity(ctx, identity.NewCAOptions{
+			Difficulty:  0,
+			Concurrency: 1,
+		})
+		return ident, errs.Wrap(err)
+	}
+	if r.Count <= 1 {
+		// same layout as the --keys directory of the other commands
+		return util.LoadOrCreateIdentity(ctx, r.Identity)
+	}
+	if _, err := os.Stat(filepath.Join(r.Identity, "identity.cert")); err == nil {
+		return nil, errs.Errorf("%s contains a single identity, but %d satellites are started (use %s/<n> directories)", r.Identity, r.Count, r.Identity)
+	}
+	return util.LoadOrCreateIdentity(ctx, filepath.Join(r.Identity, strconv.Itoa(index)))
+}
+
+// advertised returns the address of the listener as the storage nodes can use it (localhost instead of the unspecified address).
+func advertised(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok || !tcp.IP.IsUnspecified() {
+		return addr.String()
+	}
+	return net.JoinHostPort("localhost", strconv.Itoa(tcp.Port))
+}
+
+// satellitePeer is one mock satellite with its own identity and metainfo. Scenario and history are shared between the satellites of the process.
+type satellitePeer struct {
+	identity *identity.FullIdentity
+	scenario *Scenarios
+	nodes    *Nodes
+	history  *History
+	rs       *pb.RedundancyScheme
+	pingBack bool
+}
+
+func (p *satellitePeer) serve(ctx context.Context, listener net.Listener) error {
 	tlsConfig := tlsopts.Config{
 		UsePeerCAWhitelist: false,
 		PeerIDVersions:     "0",
 	}
-	tlsOptions, err := tlsopts.NewOptions(ident, tlsConfig, nil)
+	tlsOptions, err := tlsopts.NewOptions(p.identity, tlsConfig, nil)
 	if err != nil {
 		return errs.Wrap(err)
 	}
 
-	tcpListener, err := net.Listen("tcp", "0.0.0.0:5656")
-	if err != nil {
-		return errs.Wrap(err)
+	nodeEndpoint := &NodeEndpoint{satellite: p.identity.ID, scenario: p.scenario, nodes: p.nodes, history: p.history}
+	if p.pingBack {
+		dialer := rpc.NewDefaultDialer(tlsOptions)
+		dialer.DialTimeout = 10 * time.Second
+		nodeEndpoint.pingBack = &dialer
 	}
-	listenMux := drpcmigrate.NewListenMux(tcpListener, len(drpcmigrate.DRPCHeader))
+
+	listenMux := drpcmigrate.NewListenMux(listener, len(drpcmigrate.DRPCHeader))
 	tlsListener := tls.NewListener(listenMux.Route(drpcmigrate.DRPCHeader), tlsOptions.ServerTLSConfig())
 	go listenMux.Run(ctx)
 	m := drpcmux.New()
 
-	err = pb.DRPCRegisterNode(m, &NodeEndpoint{})
+	err = pb.DRPCRegisterNode(m, nodeEndpoint)
 	if err != nil {
 		return errs.Wrap(err)
 	}
-	err = pb.DRPCRegisterNodeStats(m, &NodeStatEndpoint{})
+	err = pb.DRPCRegisterNodeStats(m, &NodeStatEndpoint{scenario: p.scenario})
 	if err != nil {
 		return errs.Wrap(err)
 	}
-	err = pb.DRPCRegisterHeldAmount(m, &HeldAmountEndpoint{})
+	err = pb.DRPCRegisterHeldAmount(m, &HeldAmountEndpoint{scenario: p.scenario})
 	if err != nil {
 		return errs.Wrap(err)
 	}
 
-	err = pb.DRPCRegisterMetainfo(m, NewMetainfo(ident))
+	err = pb.DRPCRegisterMetainfo(m, NewMetainfo(p.identity, p.nodes, p.rs))
 	if err != nil {
 		return errs.Wrap(err)
 	}
 
-	err = pb.DRPCRegisterOrders(m, &OrdersEndpoint{})
+	err = pb.DRPCRegisterOrders(m, &OrdersEndpoint{satellite: p.identity.ID, scenario: p.scenario, history: p.history})
 	if err != nil {
 		return errs.Wrap(err)
 	}
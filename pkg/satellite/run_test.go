@@ -0,0 +1,154 @@
+package satellite
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"storj.io/common/identity"
+	"storj.io/common/identity/testidentity"
+	"storj.io/common/pb"
+	"storj.io/common/peertls/tlsopts"
+	"storj.io/common/rpc"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+)
+
+func TestRunAddresses(t *testing.T) {
+	addresses, err := Run{Address: "0.0.0.0:5656", Count: 3}.addresses()
+	require.NoError(t, err)
+	require.Equal(t, []string{"0.0.0.0:5656", "0.0.0.0:5657", "0.0.0.0:5658"}, addresses)
+
+	// random port for all the satellites
+	addresses, err = Run{Address: "127.0.0.1:0", Count: 2}.addresses()
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.1:0", "127.0.0.1:0"}, addresses)
+
+	_, err = Run{Address: "0.0.0.0:5656", Count: 0}.addresses()
+	require.Error(t, err)
+	_, err = Run{Address: "localhost", Count: 1}.addresses()
+	require.Error(t, err)
+	_, err = Run{Address: "localhost:http", Count: 1}.addresses()
+	require.Error(t, err)
+
+	require.Equal(t, "localhost:5656", advertised(&net.TCPAddr{IP: net.IPv4zero, Port: 5656}))
+	require.Equal(t, "127.0.0.1:5656", advertised(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5656}))
+}
+
+func TestRunIdentity(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	embedded, err := Run{}.identity(ctx, 0)
+	require.NoError(t, err)
+	generated, err := Run{}.identity(ctx, 1)
+	require.NoError(t, err)
+	require.NotEqual(t, embedded.ID, generated.ID)
+
+	// a single satellite uses the directory directly, as the --keys directory of the other commands
+	dir := t.TempDir()
+	single, err := Run{Identity: dir, Count: 1}.identity(ctx, 0)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(dir, "identity.cert"))
+	require.FileExists(t, filepath.Join(dir, "identity.key"))
+	reloaded, err := Run{Identity: dir, Count: 1}.identity(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, single.ID, reloaded.ID)
+
+	// the single identity is not mixed with the identities of multiple satellites
+	_, err = Run{Identity: dir, Count: 2}.identity(ctx, 0)
+	require.Error(t, err)
+
+	dir = t.TempDir()
+	var ids []storj.NodeID
+	for i := 0; i < 3; i++ {
+		ident, err := Run{Identity: dir, Count: 3}.identity(ctx, i)
+		require.NoError(t, err)
+		ids = append(ids, ident.ID)
+		require.FileExists(t, filepath.Join(dir, strconv.Itoa(i), "identity.cert"))
+	}
+	require.NotEqual(t, ids[0], ids[1])
+	require.NotEqual(t, ids[1], ids[2])
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	reloaded, err = Run{Identity: dir, Count: 3}.identity(ctx, 2)
+	require.NoError(t, err)
+	require.Equal(t, ids[2], reloaded.ID)
+}
+
+func TestRunMultipleSatellites(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	history, err := NewHistory("")
+	require.NoError(t, err)
+	scenario, err := NewScenarios("")
+	require.NoError(t, err)
+	rs, err := ParseRS("2/3/4/5")
+	require.NoError(t, err)
+
+	r := Run{Identity: t.TempDir(), Count: 2}
+	var satellites []*satellitePeer
+	var urls []storj.NodeURL
+	for i := 0; i < r.Count; i++ {
+		ident, err := r.identity(ctx, i)
+		require.NoError(t, err)
+		sat := &satellitePeer{
+			identity: ident,
+			scenario: scenario,
+			nodes:    NewNodes(),
+			history:  history,
+			rs:       rs,
+		}
+		satellites = append(satellites, sat)
+		urls = append(urls, startSatellite(t, ctx, sat))
+	}
+
+	nodeIdentity, err := testidentity.PregeneratedIdentity(1, storj.LatestIDVersion())
+	require.NoError(t, err)
+	for i, url := range urls {
+		conn := dialSatellite(t, ctx, nodeIdentity, url)
+		_, err = pb.NewDRPCNodeClient(conn).CheckIn(ctx, &pb.CheckInRequest{Address: "localhost:28967"})
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+
+		// check-ins are not shared between the satellites
+		require.Len(t, satellites[i].nodes.All(), 1)
+		if i == 0 {
+			require.Len(t, satellites[1].nodes.All(), 0)
+		}
+	}
+
+	// history is shared, but the events are tagged with the satellite
+	events := history.Events(nodeIdentity.ID)[nodeIdentity.ID.String()]
+	require.Len(t, events, 2)
+	require.Equal(t, urls[0].ID.String(), events[0].Satellite)
+	require.Equal(t, urls[1].ID.String(), events[1].Satellite)
+}
+
+// startSatellite serves the satellite on a random local port until the end of the test.
+func startSatellite(t *testing.T, ctx *testcontext.Context, sat *satellitePeer) storj.NodeURL {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveCtx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	ctx.Go(func() error {
+		_ = sat.serve(serveCtx, listener)
+		return nil
+	})
+	return storj.NodeURL{ID: sat.identity.ID, Address: listener.Addr().String()}
+}
+
+// dialSatellite connects to the satellite with the identity of a storage node.
+func dialSatellite(t *testing.T, ctx context.Context, node *identity.FullIdentity, satellite storj.NodeURL) *rpc.Conn {
+	tlsOptions, err := tlsopts.NewOptions(node, tlsopts.Config{PeerIDVersions: "0"}, nil)
+	require.NoError(t, err)
+	conn, err := rpc.NewDefaultDialer(tlsOptions).DialNodeURL(ctx, satellite)
+	require.NoError(t, err)
+	return conn
+}
@@ -1,8 +1,10 @@
 package satellite
 
 type Satellite struct {
-	Run     Run     `cmd:"" help:"Run mock satellite"`
-	Restore Restore `cmd:"" help:"Send restore trash request to the storagenode (satellite->sn)"`
-	Ping    Ping    `cmd:"" help:"Send ping to the storagenode (satellite->sn)"`
-	GC      GC      `cmd:"" help:"Send gc request to the storagenode (satellite->sn)"`
+	Run       Run         `cmd:"" help:"Run mock satellite"`
+	Restore   Restore     `cmd:"" help:"Send restore trash request to the storagenode (satellite->sn)"`
+	Ping      Ping        `cmd:"" help:"Send ping to the storagenode (satellite->sn)"`
+	GC        GC          `cmd:"" help:"Send gc request to the storagenode (satellite->sn)"`
+	AuditNode AuditNode   `cmd:"" help:"Audit random stripes of the pieces of a storagenode, and calculate its reputation (satellite->sn)"`
+	History   NodeHistory `cmd:"" help:"Show the recorded check-ins, settlements and pings of the storage nodes"`
 }
@@ -0,0 +1,350 @@
+package satellite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/zeebo/errs/v2"
+	"gopkg.in/yaml.v3"
+	"storj.io/common/pb"
+	"storj.io/common/rpc/rpcstatus"
+)
+
+// Scenario describes the responses of the node-facing endpoints of the mock satellite.
+// It's loaded from YAML (or JSON, which is also valid YAML). Fields which are not defined keep the default values.
+type Scenario struct {
+	// Endpoints defines latency / rpc errors per method name (e.g. CheckIn, GetStats, GetPayment, SettlementWithWindow).
+	Endpoints map[string]Behavior `yaml:"endpoints"`
+
+	CheckIn           CheckInScenario        `yaml:"checkin"`
+	Stats             StatsScenario          `yaml:"stats"`
+	Pricing           PricingScenario        `yaml:"pricing"`
+	DailyStorageUsage []StorageUsageScenario `yaml:"daily_storage_usage"`
+	Paystubs          []PaystubScenario      `yaml:"paystubs"`
+	Payments          []PaymentScenario      `yaml:"payments"`
+
+	// PaymentAmount is returned by GetPayment when there is no payment defined for the requested period.
+	PaymentAmount int64 `yaml:"payment_amount"`
+
+	// Settlement is the status of the order settlements (accepted or rejected).
+	Settlement string `yaml:"settlement"`
+}
+
+// Behavior is the generic behavior of one RPC method.
+type Behavior struct {
+	Latency time.Duration `yaml:"latency"`
+	// Error is the name of the rpcstatus code (e.g. Unavailable, NotFound, PermissionDenied).
+	Error   string `yaml:"error"`
+	Message string `yaml:"message"`
+}
+
+type CheckInScenario struct {
+	PingSuccess         bool   `yaml:"ping_success"`
+	PingError           string `yaml:"ping_error"`
+	PingSuccessQuic     bool   `yaml:"ping_success_quic"`
+	NodeTagSuccess      bool   `yaml:"node_tag_success"`
+	NodeTagErrorMessage string `yaml:"node_tag_error"`
+}
+
+type ReputationScenario struct {
+	TotalCount   int64   `yaml:"total_count"`
+	SuccessCount int64   `yaml:"success_count"`
+	Alpha        float64 `yaml:"alpha"`
+	Beta         float64 `yaml:"beta"`
+	Score        float64 `yaml:"score"`
+	UnknownAlpha float64 `yaml:"unknown_alpha"`
+	UnknownBeta  float64 `yaml:"unknown_beta"`
+	UnknownScore float64 `yaml:"unknown_score"`
+}
+
+type StatsScenario struct {
+	Audit              ReputationScenario `yaml:"audit"`
+	Uptime             ReputationScenario `yaml:"uptime"`
+	OnlineScore        float64            `yaml:"online_score"`
+	JoinedAt           time.Time          `yaml:"joined_at"`
+	VettedAt           *time.Time         `yaml:"vetted_at"`
+	Disqualified       *time.Time         `yaml:"disqualified"`
+	Suspended          *time.Time         `yaml:"suspended"`
+	OfflineSuspended   *time.Time         `yaml:"offline_suspended"`
+	OfflineUnderReview *time.Time         `yaml:"offline_under_review"`
+}
+
+type PricingScenario struct {
+	EgressBandwidth int64 `yaml:"egress_bandwidth"`
+	RepairBandwidth int64 `yaml:"repair_bandwidth"`
+	AuditBandwidth  int64 `yaml:"audit_bandwidth"`
+	DiskSpace       int64 `yaml:"disk_space"`
+}
+
+type StorageUsageScenario struct {
+	Timestamp   time.Time `yaml:"timestamp"`
+	AtRestTotal float64   `yaml:"at_rest_total"`
+}
+
+type PaystubScenario struct {
+	Period         time.Time `yaml:"period"`
+	CreatedAt      time.Time `yaml:"created_at"`
+	Codes          string    `yaml:"codes"`
+	UsageAtRest    float64   `yaml:"usage_at_rest"`
+	UsageGet       int64     `yaml:"usage_get"`
+	UsagePut       int64     `yaml:"usage_put"`
+	UsageGetRepair int64     `yaml:"usage_get_repair"`
+	UsagePutRepair int64     `yaml:"usage_put_repair"`
+	UsageGetAudit  int64     `yaml:"usage_get_audit"`
+	CompAtRest     int64     `yaml:"comp_at_rest"`
+	CompGet        int64     `yaml:"comp_get"`
+	CompPut        int64     `yaml:"comp_put"`
+	CompGetRepair  int64     `yaml:"comp_get_repair"`
+	CompPutRepair  int64     `yaml:"comp_put_repair"`
+	CompGetAudit   int64     `yaml:"comp_get_audit"`
+	SurgePercent   int64     `yaml:"surge_percent"`
+	Held           int64     `yaml:"held"`
+	Owed           int64     `yaml:"owed"`
+	Disposed       int64     `yaml:"disposed"`
+	Paid           int64     `yaml:"paid"`
+	Distributed    int64     `yaml:"distributed"`
+}
+
+type PaymentScenario struct {
+	ID        int64     `yaml:"id"`
+	Period    time.Time `yaml:"period"`
+	CreatedAt time.Time `yaml:"created_at"`
+	Amount    int64     `yaml:"amount"`
+	Receipt   string    `yaml:"receipt"`
+	Notes     string    `yaml:"notes"`
+}
+
+// DefaultScenario returns the responses used without scenario file.
+func DefaultScenario() *Scenario {
+	n := time.Now()
+	return &Scenario{
+		CheckIn: CheckInScenario{
+			PingSuccess: true,
+		},
+		Stats: StatsScenario{
+			Audit: ReputationScenario{
+				Score: 1,
+			},
+			Uptime: ReputationScenario{
+				Score: 1,
+			},
+		},
+		Pricing: PricingScenario{
+			EgressBandwidth: 1,
+		},
+		Payments: []PaymentScenario{
+			{
+				CreatedAt: time.Date(n.Year(), n.Month(), n.Day(), 0, 0, 0, 0, time.Local),
+				Period:    time.Date(n.Year(), n.Month()-1, n.Day(), 0, 0, 0, 0, time.Local),
+				Amount:    100000000000000,
+				Receipt:   "zksync-era:0x85ab6c8f8240a005ef90c1b477e6e61ccf1e6d5463672e0d1c166075ded92c0b",
+				ID:        1234,
+			},
+			{
+				CreatedAt: time.Date(n.Year(), n.Month()-1, n.Day(), 0, 0, 0, 0, time.Local),
+				Period:    time.Date(n.Year(), n.Month()-2, n.Day(), 0, 0, 0, 0, time.Local),
+				Amount:    100000000000000,
+				Receipt:   "zkwithdraw:0x85ab6c8f8240a005ef90c1b477e6e61ccf1e6d5463672e0d1c166075ded92c0b",
+				ID:        1233,
+			},
+		},
+		PaymentAmount: 44444,
+		Settlement:    "accepted",
+	}
+}
+
+// LoadScenario reads the scenario file on top of the default scenario.
+func LoadScenario(path string) (*Scenario, error) {
+	s := DefaultScenario()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	if err := yaml.Unmarshal(raw, s); err != nil {
+		return nil, errs.Errorf("invalid scenario %s: %v", path, err)
+	}
+	for method, b := range s.Endpoints {
+		if _, err := b.code(); err != nil {
+			return nil, errs.Errorf("invalid scenario %s (%s): %v", path, method, err)
+		}
+	}
+	if _, err := s.settlementStatus(); err != nil {
+		return nil, errs.Errorf("invalid scenario %s: %v", path, err)
+	}
+	return s, nil
+}
+
+func (b Behavior) code() (rpcstatus.StatusCode, error) {
+	if b.Error == "" {
+		return rpcstatus.OK, nil
+	}
+	for c := rpcstatus.Unknown; c <= rpcstatus.MethodNotAllowed; c++ {
+		if strings.EqualFold(c.String(), b.Error) {
+			return c, nil
+		}
+	}
+	return rpcstatus.Unknown, errs.Errorf("unknown rpcstatus code %q", b.Error)
+}
+
+func (s *Scenario) settlementStatus() (pb.SettlementWithWindowResponse_Status, error) {
+	switch strings.ToLower(s.Settlement) {
+	case "", "accepted":
+		return pb.SettlementWithWindowResponse_ACCEPTED, nil
+	case "rejected":
+		return pb.SettlementWithWindowResponse_REJECTED, nil
+	default:
+		return pb.SettlementWithWindowResponse_REJECTED, errs.Errorf("unknown settlement status %q", s.Settlement)
+	}
+}
+
+// Scenarios holds the active scenario, which can be replaced at any time.
+type Scenarios struct {
+	path string
+
+	mu       sync.RWMutex
+	scenario *Scenario
+}
+
+// NewScenarios loads the scenario from path. Without path, the default scenario is used.
+func NewScenarios(path string) (*Scenarios, error) {
+	s := &Scenarios{
+		path:     path,
+		scenario: DefaultScenario(),
+	}
+	if path == "" {
+		return s, nil
+	}
+	return s, s.Reload()
+}
+
+// Get returns the active scenario.
+func (s *Scenarios) Get() *Scenario {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.scenario
+}
+
+// Reload reads the scenario file again. The previous scenario is kept in case of error.
+func (s *Scenarios) Reload() error {
+	if s.path == "" {
+		return nil
+	}
+	scenario, err := LoadScenario(s.path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.scenario = scenario
+	s.mu.Unlock()
+	return nil
+}
+
+// ReloadOnSignal reloads the scenario file on every SIGHUP until the context is canceled.
+func (s *Scenarios) ReloadOnSignal(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-hup:
+				if err := s.Reload(); err != nil {
+					fmt.Println("Scenario is not reloaded:", err)
+					continue
+				}
+				fmt.Println("Scenario is reloaded from", s.path)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// call applies the configured latency and error of the method, and returns the scenario to use for the response.
+func (s *Scenarios) call(ctx context.Context, method string) (*Scenario, error) {
+	scenario := s.Get()
+	b, found := scenario.Endpoints[method]
+	if !found {
+		return scenario, nil
+	}
+	if b.Latency > 0 {
+		select {
+		case <-time.After(b.Latency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	code, err := b.code()
+	if err != nil {
+		return nil, rpcstatus.Error(rpcstatus.Internal, err.Error())
+	}
+	if code != rpcstatus.OK {
+		message := b.Message
+		if message == "" {
+			message = "error from scenario"
+		}
+		return nil, rpcstatus.Error(code, message)
+	}
+	return scenario, nil
+}
+
+func (r ReputationScenario) response() *pb.ReputationStats {
+	return &pb.ReputationStats{
+		TotalCount:             r.TotalCount,
+		SuccessCount:           r.SuccessCount,
+		ReputationAlpha:        r.Alpha,
+		ReputationBeta:         r.Beta,
+		ReputationScore:        r.Score,
+		UnknownReputationAlpha: r.UnknownAlpha,
+		UnknownReputationBeta:  r.UnknownBeta,
+		UnknownReputationScore: r.UnknownScore,
+	}
+}
+
+func (p PaystubScenario) response() *pb.GetHeldAmountResponse {
+	return &pb.GetHeldAmountResponse{
+		Period:         p.Period,
+		CreatedAt:      p.CreatedAt,
+		Codes:          p.Codes,
+		UsageAtRest:    p.UsageAtRest,
+		UsageGet:       p.UsageGet,
+		UsagePut:       p.UsagePut,
+		UsageGetRepair: p.UsageGetRepair,
+		UsagePutRepair: p.UsagePutRepair,
+		UsageGetAudit:  p.UsageGetAudit,
+		CompAtRest:     p.CompAtRest,
+		CompGet:        p.CompGet,
+		CompPut:        p.CompPut,
+		CompGetRepair:  p.CompGetRepair,
+		CompPutRepair:  p.CompPutRepair,
+		CompGetAudit:   p.CompGetAudit,
+		SurgePercent:   p.SurgePercent,
+		Held:           p.Held,
+		Owed:           p.Owed,
+		Disposed:       p.Disposed,
+		Paid:           p.Paid,
+		Distributed:    p.Distributed,
+	}
+}
+
+func (p PaymentScenario) response() *pb.GetPaymentResponse {
+	return &pb.GetPaymentResponse{
+		Id:        p.ID,
+		Period:    p.Period,
+		CreatedAt: p.CreatedAt,
+		Amount:    p.Amount,
+		Receipt:   p.Receipt,
+		Notes:     p.Notes,
+	}
+}
+
+// samePeriod compares the year and month (payout periods are monthly).
+func samePeriod(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month()
+}
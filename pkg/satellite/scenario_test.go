@@ -0,0 +1,154 @@
+package satellite
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"storj.io/common/identity"
+	"storj.io/common/identity/testidentity"
+	"storj.io/common/pb"
+	"storj.io/common/rpc/rpcpeer"
+	"storj.io/common/rpc/rpcstatus"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+)
+
+func TestScenario(t *testing.T) {
+	ctx := testcontext.New(t)
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+endpoints:
+  GetPayment:
+    latency: 50ms
+  DailyStorageUsage:
+    error: unavailable
+    message: under maintenance
+  GetStats:
+    error: PermissionDenied
+pricing:
+  egress_bandwidth: 2000
+  disk_space: 150
+payments:
+  - id: 42
+    period: 2024-02-01T00:00:00Z
+    amount: 180000000
+payment_amount: 7
+settlement: rejected
+`), 0644))
+
+	scenarios, err := NewScenarios(path)
+	require.NoError(t, err)
+
+	stats := &NodeStatEndpoint{scenario: scenarios}
+	_, err = stats.DailyStorageUsage(ctx, &pb.DailyStorageUsageRequest{})
+	require.Error(t, err)
+	require.Equal(t, rpcstatus.Unavailable, rpcstatus.Code(err))
+	require.Contains(t, err.Error(), "under maintenance")
+
+	_, err = stats.GetStats(ctx, &pb.GetStatsRequest{})
+	require.Equal(t, rpcstatus.PermissionDenied, rpcstatus.Code(err))
+	require.Contains(t, err.Error(), "error from scenario")
+
+	pricing, err := stats.PricingModel(ctx, &pb.PricingModelRequest{})
+	require.NoError(t, err)
+	require.Equal(t, int64(2000), pricing.EgressBandwidthPrice)
+	require.Equal(t, int64(150), pricing.DiskSpacePrice)
+	// not defined in the file: default value is kept
+	require.Equal(t, int64(0), pricing.RepairBandwidthPrice)
+
+	history, err := NewHistory("")
+	require.NoError(t, err)
+	rs, err := ParseRS("2/3/4/5")
+	require.NoError(t, err)
+	satelliteIdentity, err := testidentity.PregeneratedIdentity(0, storj.LatestIDVersion())
+	require.NoError(t, err)
+	satellite := startSatellite(t, ctx, &satellitePeer{
+		identity: satelliteIdentity,
+		scenario: scenarios,
+		nodes:    NewNodes(),
+		history:  history,
+		rs:       rs,
+	})
+	nodeIdentity, err := testidentity.PregeneratedIdentity(1, storj.LatestIDVersion())
+	require.NoError(t, err)
+	conn := dialSatellite(t, ctx, nodeIdentity, satellite)
+	defer ctx.Check(conn.Close)
+
+	// the node ID of the payments is the ID of the caller
+	held := pb.NewDRPCHeldAmountClient(conn)
+	start := time.Now()
+	payment, err := held.GetPayment(ctx, &pb.GetPaymentRequest{Period: time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	require.Equal(t, int64(42), payment.Id)
+	require.Equal(t, int64(180000000), payment.Amount)
+	require.Equal(t, nodeIdentity.ID, payment.NodeId)
+
+	payment, err = held.GetPayment(ctx, &pb.GetPaymentRequest{Period: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), payment.Amount)
+	require.Equal(t, nodeIdentity.ID, payment.NodeId)
+
+	payments, err := held.GetAllPayments(ctx, &pb.GetAllPaymentsRequest{})
+	require.NoError(t, err)
+	require.Len(t, payments.Payment, 1)
+	require.Equal(t, nodeIdentity.ID, payments.Payment[0].NodeId)
+
+	// the caller is required
+	_, err = HeldAmountEndpoint{scenario: scenarios}.GetPayment(ctx, &pb.GetPaymentRequest{})
+	require.Equal(t, rpcstatus.Unauthenticated, rpcstatus.Code(err))
+
+	canceled, cancel := context.WithCancel(peerContext(ctx, nodeIdentity))
+	cancel()
+	_, err = HeldAmountEndpoint{scenario: scenarios}.GetPayment(canceled, &pb.GetPaymentRequest{})
+	require.ErrorIs(t, err, context.Canceled)
+
+	status, err := scenarios.Get().settlementStatus()
+	require.NoError(t, err)
+	require.Equal(t, pb.SettlementWithWindowResponse_REJECTED, status)
+
+	t.Run("reload", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("pricing:\n  egress_bandwidth: 3000\n"), 0644))
+		require.NoError(t, scenarios.Reload())
+		pricing, err := stats.PricingModel(ctx, &pb.PricingModelRequest{})
+		require.NoError(t, err)
+		require.Equal(t, int64(3000), pricing.EgressBandwidthPrice)
+		_, err = stats.DailyStorageUsage(ctx, &pb.DailyStorageUsageRequest{})
+		require.NoError(t, err)
+
+		// invalid file: the previous scenario is kept
+		require.NoError(t, os.WriteFile(path, []byte("endpoints:\n  GetStats:\n    error: NoSuchCode\n"), 0644))
+		require.Error(t, scenarios.Reload())
+		pricing, err = stats.PricingModel(ctx, &pb.PricingModelRequest{})
+		require.NoError(t, err)
+		require.Equal(t, int64(3000), pricing.EgressBandwidthPrice)
+
+		require.NoError(t, os.WriteFile(path, []byte("settlement: maybe\n"), 0644))
+		require.Error(t, scenarios.Reload())
+	})
+
+	t.Run("default", func(t *testing.T) {
+		scenarios, err := NewScenarios("")
+		require.NoError(t, err)
+		node := &NodeEndpoint{scenario: scenarios}
+		resp, err := node.GetTime(ctx, &pb.GetTimeRequest{})
+		require.NoError(t, err)
+		require.WithinDuration(t, time.Now(), resp.Timestamp, time.Minute)
+
+		payments, err := HeldAmountEndpoint{scenario: scenarios}.GetAllPayments(peerContext(ctx, nodeIdentity), &pb.GetAllPaymentsRequest{})
+		require.NoError(t, err)
+		require.Len(t, payments.Payment, 2)
+	})
+}
+
+// peerContext returns a context with the identity of the caller, as the DRPC server creates it for the endpoints.
+func peerContext(ctx context.Context, caller *identity.FullIdentity) context.Context {
+	return rpcpeer.NewContext(ctx, &rpcpeer.Peer{
+		State: tls.ConnectionState{PeerCertificates: caller.Chain()},
+	})
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zeebo/errs"
+	"storj.io/common/identity"
+)
+
+// LoadOrCreateIdentity loads identity.cert/identity.key from the directory. When the files are missing, a new identity
+// is generated and saved to the directory.
+func LoadOrCreateIdentity(ctx context.Context, dir string) (*identity.FullIdentity, error) {
+	cfg := identity.Config{
+		CertPath: filepath.Join(dir, "identity.cert"),
+		KeyPath:  filepath.Join(dir, "identity.key"),
+	}
+	if _, err := os.Stat(cfg.CertPath); err == nil {
+		ident, err := cfg.Load()
+		return ident, errs.Wrap(err)
+	}
+	ident, err := identity.NewFullIdentity(ctx, identity.NewCAOptions{
+		Difficulty:  0,
+		Concurrency: 1,
+	})
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	if err := cfg.Save(ident); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	fmt.Println("New identity is saved to", dir)
+	return ident, nil
+}